@@ -37,4 +37,14 @@ go run ../cmd/cyclonus/main.go analyze \
 go run ../cmd/cyclonus/main.go analyze \
   --explain=false \
   --lint=true \
-  --policy-path ../networkpolicies/simple-example
\ No newline at end of file
+  --policy-path ../networkpolicies/simple-example
+
+# diff two sets of policies
+go run ../cmd/cyclonus/main.go diff \
+  --policy-path ../networkpolicies/allow-all.yaml \
+  --policy-path ../networkpolicies/simple-example/ \
+  --probe-path ./probe.json
+
+# simplify policies
+go run ../cmd/cyclonus/main.go simplify \
+  --policy-path ../networkpolicies/simple-example/
@@ -5,8 +5,11 @@ import (
 	"fmt"
 	"github.com/mattfenwick/cyclonus/pkg/connectivity/probe"
 	"github.com/mattfenwick/cyclonus/pkg/generator"
+	"github.com/mattfenwick/cyclonus/pkg/importer"
 	"github.com/mattfenwick/cyclonus/pkg/linter"
 	"io/ioutil"
+	"os"
+	"strings"
 
 	"github.com/mattfenwick/cyclonus/pkg/explainer"
 	"github.com/mattfenwick/cyclonus/pkg/kube"
@@ -19,6 +22,7 @@ import (
 	v1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 type AnalyzeArgs struct {
@@ -26,24 +30,56 @@ type AnalyzeArgs struct {
 	Namespaces         []string
 	UseExamplePolicies bool
 	PolicyPath         string
-	Context            string
+	// InventoryFromPolicyPath derives namespaces and pods from the manifests at PolicyPath
+	InventoryFromPolicyPath bool
+	AdminPolicyPath         string
+	CNIPolicyPath           string
+	Context                 string
+	// SkipInvalidPolicies warns about invalid policies and goes on without them, instead of failing
+	SkipInvalidPolicies bool
 
 	// explain
 	Explain bool
 
 	// lint
-	Lint bool
+	Lint                  bool
+	LintConfigPath        string
+	LintFailOn            string
+	LintInventoryPath     string
+	LintInventoryFromKube bool
 
 	// traffic
 	TrafficPath string
+	// ExplainTraffic finds the rules responsible for allowed traffic, and the edits which would allow denied traffic
+	ExplainTraffic bool
 
 	// targets
 	TargetPodPath string
 
+	// reaching peers
+	ReachingPodPath string
+
 	// synthetic probe
 	ProbePath string
+	// Matrix aggregates the synthetic probe's results into a reachability matrix of namespaces, or of the values of MatrixBy
+	Matrix          bool
+	MatrixBy        string
+	MatrixDrillDown []string
+
+	// output
+	Output           string
+	GraphFormat      string
+	GraphByNamespace bool
 }
 
+const (
+	AnalyzeOutputTable = "table"
+	AnalyzeOutputJSON  = "json"
+	AnalyzeOutputYAML  = "yaml"
+	AnalyzeOutputGraph = "graph"
+	AnalyzeOutputSARIF = "sarif"
+)
+
 func SetupAnalyzeCommand() *cobra.Command {
 	args := &AnalyzeArgs{}
 
@@ -60,13 +96,30 @@ func SetupAnalyzeCommand() *cobra.Command {
 	command.Flags().BoolVarP(&args.AllNamespaces, "all-namespaces", "A", true, "similar to kubectl's '--all-namespaces'/'-A' flag: if true, read policies from all-namespaces")
 	command.Flags().StringSliceVarP(&args.Namespaces, "namespace", "n", []string{}, "similar to kubectl's '--namespace'/'-n' flag, except that multiple namespaces may be passed in; policies will be read from these namespaces")
 	command.Flags().StringVar(&args.PolicyPath, "policy-path", "", "may be a file or a directory; if set, will attempt to read policies from the path")
+	command.Flags().BoolVar(&args.InventoryFromPolicyPath, "inventory-from-policy-path", false, "if true, derive an inventory of namespaces and pods from the Namespaces, Deployments, StatefulSets and Pods read from --policy-path -- such as a rendered helm chart or kustomize overlay -- and use it as the lint inventory, and as the synthetic probe's resources if its config has none")
+	command.Flags().StringVar(&args.AdminPolicyPath, "admin-policy-path", "", "may be a file or a directory; if set, will attempt to read AdminNetworkPolicies and a BaselineAdminNetworkPolicy from the path")
+	command.Flags().StringVar(&args.CNIPolicyPath, "cni-policy-path", "", "may be a file or a directory; if set, will attempt to import Calico NetworkPolicies/GlobalNetworkPolicies and CiliumNetworkPolicies from the path")
+	command.Flags().BoolVar(&args.SkipInvalidPolicies, "skip-invalid-policies", false, "if true, warn about policies which the API server would reject, and analyze the rest; otherwise, fail")
 	command.Flags().StringVar(&args.Context, "context", "", "selects kube context to read policies from; only reads from kube if one or more namespaces or all namespaces are specified")
 
 	command.Flags().BoolVar(&args.Explain, "explain", true, "if true, print explanation of network policies")
 	command.Flags().BoolVar(&args.Lint, "lint", false, "if true, check policies for common problems")
+	command.Flags().StringVar(&args.LintConfigPath, "lint-config", "", "path to yaml lint config, which enables/disables checks and overrides their severities, globally or per namespace")
+	command.Flags().StringVar(&args.LintFailOn, "lint-fail-on", "", fmt.Sprintf("if set, exit with a non-zero status if there are lint warnings at or above this severity, one of %+v; overrides the lint config's failOn", linter.AllSeverities))
+	command.Flags().StringVar(&args.LintInventoryPath, "lint-inventory-path", "", "path to json inventory of namespaces and pods, in the format of the synthetic probe's resources; if set, also checks for targets, peers and named ports which match nothing, and for pods left unselected")
+	command.Flags().BoolVar(&args.LintInventoryFromKube, "lint-inventory-from-kube", false, "if true, read the lint inventory from the namespaces and pods of the kube context and namespaces")
 	command.Flags().StringVar(&args.TargetPodPath, "target-pod-path", "", "path to json target pod file -- json array of dicts; if empty, this step will be skipped")
+	command.Flags().StringVar(&args.ReachingPodPath, "reaching-pod-path", "", "path to json file of pods -- a json array of dicts with a namespace, labels, and optionally a port and protocol -- for which to show the peers allowed to reach them; if there's a lint inventory or synthetic probe, also lists the pods which can reach them; if empty, this step will be skipped")
 	command.Flags().StringVar(&args.TrafficPath, "traffic-path", "", "path to json traffic file, containing of a list of traffic objects; if empty, this step will be skipped")
+	command.Flags().BoolVar(&args.ExplainTraffic, "explain-traffic", false, "if true, for each traffic of --traffic-path, list the rules which allow it or -- if it's denied -- the minimal edits to policies and labels which would allow it")
 	command.Flags().StringVar(&args.ProbePath, "probe-path", "", "path to json model file for synthetic probe; if empty, this step will be skipped")
+	command.Flags().BoolVar(&args.Matrix, "matrix", false, "if true, show the synthetic probe's results as a matrix of groups of pods -- with full, partial or no reachability on each port/protocol -- instead of pod by pod")
+	command.Flags().StringVar(&args.MatrixBy, "matrix-by", "", "pod label to group the reachability matrix by, such as 'app'; if empty, pods are grouped by namespace")
+	command.Flags().StringSliceVar(&args.MatrixDrillDown, "matrix-drill-down", []string{}, "cells of the reachability matrix, as 'FROM:TO' groups, for which to also show the pod by pod results")
+
+	command.Flags().StringVarP(&args.Output, "output", "o", AnalyzeOutputTable, fmt.Sprintf("output format, one of %s, %s, %s, %s, %s; %s and %s print a single document with a key for each section; %s prints only the synthetic probe's connectivity graph, and requires --probe-path; %s prints only the lint warnings as a SARIF 2.1.0 log, and requires --lint", AnalyzeOutputTable, AnalyzeOutputJSON, AnalyzeOutputYAML, AnalyzeOutputGraph, AnalyzeOutputSARIF, AnalyzeOutputJSON, AnalyzeOutputYAML, AnalyzeOutputGraph, AnalyzeOutputSARIF))
+	command.Flags().StringVar(&args.GraphFormat, "graph-format", string(probe.GraphFormatDOT), fmt.Sprintf("graph format, one of %+v", probe.AllGraphFormats))
+	command.Flags().BoolVar(&args.GraphByNamespace, "graph-by-namespace", false, "if true, graph nodes are namespaces instead of pods")
 
 	return command
 }
@@ -84,51 +137,334 @@ func RunAnalyzeCommand(args *AnalyzeArgs) {
 		kubePolicies, err = readPoliciesFromKube(kubeClient, namespaces)
 	}
 	// 2. read policies from file
+	sources := kube.NetworkPolicySources{}
+	var manifestInventory *probe.Resources
 	if args.PolicyPath != "" {
-		policiesFromPath, err := readPoliciesFromPath(args.PolicyPath)
+		manifests, err := readManifestsFromPath(args.PolicyPath)
 		utils.DoOrDie(err)
-		kubePolicies = append(kubePolicies, policiesFromPath...)
+		kubePolicies = append(kubePolicies, manifests.NetworkPolicies...)
+		sources = manifests.Sources
+		if args.InventoryFromPolicyPath {
+			manifestInventory = probe.NewResourcesFromManifests(manifests)
+			logrus.Debugf("derived inventory from %s:\n%s", args.PolicyPath, manifestInventory.RenderTable())
+		}
+	} else if args.InventoryFromPolicyPath {
+		utils.DoOrDie(errors.Errorf("--inventory-from-policy-path requires --policy-path"))
 	}
+	probeConfig := readAnalyzeProbeConfig(args.ProbePath, manifestInventory)
 	// 3. read example policies
 	if args.UseExamplePolicies {
 		kubePolicies = append(kubePolicies, netpol.AllExamples...)
 	}
 
+	// 4. read admin policies from file
+	var anps []*kube.AdminNetworkPolicy
+	var banp *kube.BaselineAdminNetworkPolicy
+	if args.AdminPolicyPath != "" {
+		var err error
+		anps, banp, err = readAdminPoliciesFromPath(args.AdminPolicyPath)
+		utils.DoOrDie(err)
+	}
+
+	// 5. import CNI-specific policies from file
+	var importWarnings []*linter.Warning
+	if args.CNIPolicyPath != "" {
+		imported, err := readCNIPoliciesFromPath(args.CNIPolicyPath, importOptions(kubePolicies, importResources(probeConfig, manifestInventory)))
+		utils.DoOrDie(err)
+		kubePolicies = append(kubePolicies, imported.Policies...)
+		importWarnings = imported.Warnings
+	}
+
 	logrus.Debugf("parsed policies:\n%s", utils.JsonString(kubePolicies))
 
-	// 4. consume policies
-	explainedPolicies := matcher.BuildNetworkPolicies(kubePolicies)
+	// 6. consume policies
+	explainedPolicies, err := matcher.BuildNetworkPoliciesWithAdmin(validPolicies(kubePolicies, args.SkipInvalidPolicies), anps, banp)
+	utils.DoOrDie(err)
+
+	var inventory *probe.Resources
+	if args.Lint || args.ReachingPodPath != "" {
+		inventory = readLintInventory(args.LintInventoryPath, args.LintInventoryFromKube, manifestInventory, args.Context, namespaces)
+	}
+
+	var warnings []*linter.Warning
+	lintConfig := linter.NewDefaultConfig()
+	if args.Lint {
+		lintConfig = readLintConfig(args.LintConfigPath, args.LintFailOn)
+		warnings = lintWarnings(kubePolicies, importWarnings, inventory, lintConfig)
+	}
+	// pods which can reach the reaching query's pods are found in the inventory, or else the synthetic probe's resources
+	reachingInventory := inventory
+	if reachingInventory == nil && probeConfig != nil {
+		reachingInventory = probeConfig.Resources
+	}
 
+	switch args.Output {
+	case AnalyzeOutputTable:
+		printAnalyzeTables(args, explainedPolicies, warnings, probeConfig, reachingInventory)
+	case AnalyzeOutputJSON:
+		fmt.Println(utils.JsonString(BuildAnalyzeReport(args, explainedPolicies, warnings, probeConfig, reachingInventory)))
+	case AnalyzeOutputYAML:
+		fmt.Print(utils.YamlString(BuildAnalyzeReport(args, explainedPolicies, warnings, probeConfig, reachingInventory)))
+	case AnalyzeOutputGraph:
+		if probeConfig == nil {
+			utils.DoOrDie(errors.Errorf("--output %s requires --probe-path", AnalyzeOutputGraph))
+		}
+		GraphSyntheticConnectivity(explainedPolicies, probeConfig, probe.GraphFormat(args.GraphFormat), args.GraphByNamespace)
+	case AnalyzeOutputSARIF:
+		if !args.Lint {
+			utils.DoOrDie(errors.Errorf("--output %s requires --lint", AnalyzeOutputSARIF))
+		}
+		fmt.Println(utils.JsonString(linter.WarningsSARIF(warnings, sources)))
+	default:
+		utils.DoOrDie(errors.Errorf("invalid output format '%s'", args.Output))
+	}
+
+	if args.Lint && lintConfig.IsFailure(warnings) {
+		logrus.Errorf("lint failed: found warnings with severity %s or higher", lintConfig.FailOn)
+		os.Exit(1)
+	}
+}
+
+// printAnalyzeTables prints each requested section; inventory is used to find the pods which can reach the pods
+// of the reaching query, and may be nil
+func printAnalyzeTables(args *AnalyzeArgs, explainedPolicies *matcher.Policy, warnings []*linter.Warning, probeConfig *SyntheticProbeConnectivityConfig, inventory *probe.Resources) {
 	if args.Explain {
 		ExplainPolicies(explainedPolicies)
 	}
 
 	if args.Lint {
-		Lint(kubePolicies)
+		Lint(warnings)
 	}
 
 	if args.TargetPodPath != "" {
 		QueryTargets(explainedPolicies, args.TargetPodPath)
 	}
 
+	if args.ReachingPodPath != "" {
+		QueryReachingPeers(explainedPolicies, args.ReachingPodPath, inventory)
+	}
+
 	if args.TrafficPath != "" {
-		QueryTraffic(explainedPolicies, args.TrafficPath)
+		QueryTraffic(explainedPolicies, args.TrafficPath, args.ExplainTraffic)
 	}
 
-	if args.ProbePath != "" {
-		ProbeSyntheticConnectivity(explainedPolicies, args.ProbePath)
+	if probeConfig != nil {
+		if args.Matrix {
+			MatrixSyntheticConnectivity(explainedPolicies, probeConfig, args.MatrixBy, args.MatrixDrillDown)
+		} else {
+			ProbeSyntheticConnectivity(explainedPolicies, probeConfig)
+		}
 	}
 }
 
+// AnalyzeReport is the structured output of analyze: each section is present only if it was requested
+type AnalyzeReport struct {
+	Explain  *explainer.PolicyReport `json:"explain,omitempty"`
+	Lint     []*linter.WarningReport `json:"lint,omitempty"`
+	Targets  []*TargetPodReport      `json:"targets,omitempty"`
+	Reaching []*ReachingPeersReport  `json:"reaching,omitempty"`
+	Traffic  []*TrafficReport        `json:"traffic,omitempty"`
+	Probes   []*SyntheticProbeReport `json:"probes,omitempty"`
+	Matrix   *SyntheticMatrixReport  `json:"matrix,omitempty"`
+}
+
+type TargetPodReport struct {
+	Pod            QueryTargetPod            `json:"pod"`
+	IngressTargets []*explainer.TargetReport `json:"ingressTargets"`
+	EgressTargets  []*explainer.TargetReport `json:"egressTargets"`
+}
+
+type ReachingPeersReport struct {
+	Pod            *QueryReachingPod   `json:"pod"`
+	SourcePolicies []string            `json:"sourcePolicies"`
+	Peer           matcher.PeerMatcher `json:"peer"`
+	// Pods are the inventory's pods which can reach the pod; it's null if there's no inventory
+	Pods []*probe.ReachingPod `json:"pods"`
+}
+
+type TrafficReport struct {
+	Traffic     *matcher.Traffic              `json:"traffic"`
+	Result      *matcher.AllowedResultReport  `json:"result"`
+	Explanation *explainer.TrafficExplanation `json:"explanation,omitempty"`
+}
+
+type SyntheticProbeReport struct {
+	Port     intstr.IntOrString   `json:"port"`
+	Protocol v1.Protocol          `json:"protocol"`
+	Results  []*probe.TableResult `json:"results"`
+}
+
+type SyntheticMatrixReport struct {
+	*probe.ReachabilityMatrixReport
+	DrillDowns []*MatrixDrillDownReport `json:"drillDowns,omitempty"`
+}
+
+type MatrixDrillDownReport struct {
+	From    string               `json:"from"`
+	To      string               `json:"to"`
+	Results []*probe.TableResult `json:"results"`
+}
+
+func BuildAnalyzeReport(args *AnalyzeArgs, explainedPolicies *matcher.Policy, warnings []*linter.Warning, probeConfig *SyntheticProbeConnectivityConfig, inventory *probe.Resources) *AnalyzeReport {
+	report := &AnalyzeReport{}
+	if args.Explain {
+		report.Explain = explainer.Report(explainedPolicies)
+	}
+
+	if args.Lint {
+		report.Lint = linter.WarningsReport(warnings)
+	}
+
+	if args.TargetPodPath != "" {
+		report.Targets = []*TargetPodReport{}
+		for _, pod := range readQueryTargetPods(args.TargetPodPath) {
+			ingressTargets := explainedPolicies.TargetsApplyingToPod(true, pod.Namespace, pod.Labels)
+			egressTargets := explainedPolicies.TargetsApplyingToPod(false, pod.Namespace, pod.Labels)
+			targetReport := &TargetPodReport{Pod: pod, IngressTargets: []*explainer.TargetReport{}, EgressTargets: []*explainer.TargetReport{}}
+			for _, t := range ingressTargets {
+				targetReport.IngressTargets = append(targetReport.IngressTargets, &explainer.TargetReport{Type: "Ingress", TargetSummary: t.Summary(), Peer: t.Peer})
+			}
+			for _, t := range egressTargets {
+				targetReport.EgressTargets = append(targetReport.EgressTargets, &explainer.TargetReport{Type: "Egress", TargetSummary: t.Summary(), Peer: t.Peer})
+			}
+			report.Targets = append(report.Targets, targetReport)
+		}
+	}
+
+	if args.ReachingPodPath != "" {
+		report.Reaching = []*ReachingPeersReport{}
+		for _, pod := range readQueryReachingPods(args.ReachingPodPath) {
+			reaching := pod.ReachingPeers(explainedPolicies, inventory)
+			reachingReport := &ReachingPeersReport{Pod: pod, SourcePolicies: []string{}, Peer: reaching.Peer}
+			for _, target := range reaching.Targets {
+				reachingReport.SourcePolicies = append(reachingReport.SourcePolicies, target.Summary().SourcePolicies...)
+			}
+			if inventory != nil {
+				reachingReport.Pods = pod.ReachingPods(explainedPolicies, inventory)
+			}
+			report.Reaching = append(report.Reaching, reachingReport)
+		}
+	}
+
+	if args.TrafficPath != "" {
+		report.Traffic = []*TrafficReport{}
+		for _, traffic := range readTraffics(args.TrafficPath) {
+			trafficReport := &TrafficReport{Traffic: traffic, Result: explainedPolicies.IsTrafficAllowed(traffic).Report()}
+			if args.ExplainTraffic {
+				explanation, err := explainer.ExplainTraffic(explainedPolicies, traffic)
+				utils.DoOrDie(err)
+				trafficReport.Explanation = explanation
+			}
+			report.Traffic = append(report.Traffic, trafficReport)
+		}
+	}
+
+	if probeConfig != nil && args.Matrix {
+		matrix := buildReachabilityMatrix(explainedPolicies, probeConfig, args.MatrixBy)
+		report.Matrix = &SyntheticMatrixReport{ReachabilityMatrixReport: matrix.Report()}
+		for _, cell := range parseMatrixCells(args.MatrixDrillDown) {
+			table, err := matrix.DrillDown(cell[0], cell[1])
+			utils.DoOrDie(err)
+			report.Matrix.DrillDowns = append(report.Matrix.DrillDowns, &MatrixDrillDownReport{From: cell[0], To: cell[1], Results: table.Results()})
+		}
+	} else if probeConfig != nil {
+		report.Probes = []*SyntheticProbeReport{}
+		for _, portProtocol := range probeConfig.Probes {
+			table := probe.NewSimulatedRunner(explainedPolicies).
+				RunProbeFixedPortProtocol(probeConfig.Resources, portProtocol.Port, portProtocol.Protocol)
+			report.Probes = append(report.Probes, &SyntheticProbeReport{Port: portProtocol.Port, Protocol: portProtocol.Protocol, Results: table.Results()})
+		}
+	}
+	return report
+}
+
 func ExplainPolicies(explainedPolicies *matcher.Policy) {
 	fmt.Printf("%s\n", explainer.TableExplainer(explainedPolicies))
 }
 
-func Lint(kubePolicies []*networkingv1.NetworkPolicy) {
-	warnings := linter.Lint(kubePolicies, map[linter.Check]bool{})
+func Lint(warnings []*linter.Warning) {
 	fmt.Println(linter.WarningsTable(warnings))
 }
 
+func lintWarnings(kubePolicies []*networkingv1.NetworkPolicy, importWarnings []*linter.Warning, inventory *probe.Resources, config *linter.Config) []*linter.Warning {
+	warnings := append(importWarnings, linter.Lint(kubePolicies, map[linter.Check]bool{})...)
+	if inventory != nil {
+		warnings = append(warnings, linter.LintInventory(kubePolicies, inventory)...)
+	}
+	return config.Apply(warnings)
+}
+
+// readLintInventory reads the inventory from a file, or from kube, or uses the inventory derived from manifests;
+// it's nil if none is requested
+func readLintInventory(path string, fromKube bool, fromManifests *probe.Resources, context string, namespaces []string) *probe.Resources {
+	sourceCount := 0
+	for _, isSource := range []bool{path != "", fromKube, fromManifests != nil} {
+		if isSource {
+			sourceCount++
+		}
+	}
+	switch {
+	case sourceCount > 1:
+		utils.DoOrDie(errors.Errorf("can't read the lint inventory from more than one of a file, kube and the policy path"))
+	case path != "":
+		bs, err := ioutil.ReadFile(path)
+		utils.DoOrDie(errors.Wrapf(err, "unable to read file %s", path))
+		inventory := &probe.Resources{}
+		utils.DoOrDie(errors.Wrapf(json.Unmarshal(bs, inventory), "unable to unmarshal json"))
+		return inventory
+	case fromKube:
+		kubeClient, err := kube.NewKubernetesForContext(context)
+		utils.DoOrDie(err)
+		inventory, err := probe.NewResourcesFromKube(kubeClient, namespaces)
+		utils.DoOrDie(err)
+		return inventory
+	case fromManifests != nil:
+		return fromManifests
+	}
+	return nil
+}
+
+// readLintConfig reads the lint config, if there's a path; a non-empty failOn overrides the config's
+func readLintConfig(path string, failOn string) *linter.Config {
+	config := linter.NewDefaultConfig()
+	if path != "" {
+		bytes, err := ioutil.ReadFile(path)
+		utils.DoOrDie(errors.Wrapf(err, "unable to read file %s", path))
+		config, err = linter.ParseConfig(bytes)
+		utils.DoOrDie(errors.WithMessagef(err, "invalid lint config at %s", path))
+	}
+	if failOn != "" {
+		config.FailOn = linter.Severity(failOn)
+		utils.DoOrDie(config.Validate())
+	}
+	return config
+}
+
+// importResources are the namespaces and pods which cluster-scoped policies apply to: the synthetic probe's, if
+// there is one, otherwise those derived from manifests, if any
+func importResources(probeConfig *SyntheticProbeConnectivityConfig, manifestInventory *probe.Resources) *probe.Resources {
+	if probeConfig != nil {
+		return probeConfig.Resources
+	}
+	return manifestInventory
+}
+
+// importOptions determines which namespaces cluster-scoped policies apply to: the namespaces of the resources
+// if there are any, otherwise the namespaces of the other policies -- without labels.
+func importOptions(kubePolicies []*networkingv1.NetworkPolicy, resources *probe.Resources) *importer.Options {
+	options := &importer.Options{Namespaces: map[string]map[string]string{}}
+	if resources != nil {
+		for ns, labels := range resources.Namespaces {
+			options.Namespaces[ns] = labels
+		}
+		return options
+	}
+	for _, policy := range kubePolicies {
+		options.Namespaces[policy.Namespace] = map[string]string{}
+	}
+	return options
+}
+
 // QueryTargetPod matches targets; targets exist in only a single namespace and can't be matched by namespace
 //   label, therefore we match by exact namespace and by pod labels.
 type QueryTargetPod struct {
@@ -136,21 +472,26 @@ type QueryTargetPod struct {
 	Labels    map[string]string
 }
 
-func QueryTargets(explainedPolicies *matcher.Policy, podPath string) {
+func readQueryTargetPods(podPath string) []QueryTargetPod {
 	var pods []QueryTargetPod
 	bs, err := ioutil.ReadFile(podPath)
 	utils.DoOrDie(err)
 	err = json.Unmarshal(bs, &pods)
 	utils.DoOrDie(err)
+	return pods
+}
 
-	for _, pod := range pods {
+func QueryTargets(explainedPolicies *matcher.Policy, podPath string) {
+	for _, pod := range readQueryTargetPods(podPath) {
 		fmt.Printf("pod %+v:\n\n", pod)
 
 		ingressTargets := explainedPolicies.TargetsApplyingToPod(true, pod.Namespace, pod.Labels)
-		combinedIngressTarget := matcher.CombineTargetsIgnoringPrimaryKey(pod.Namespace, metav1.LabelSelector{MatchLabels: pod.Labels}, ingressTargets)
+		combinedIngressTarget, err := matcher.CombineTargetsIgnoringPrimaryKey(pod.Namespace, metav1.LabelSelector{MatchLabels: pod.Labels}, ingressTargets)
+		utils.DoOrDie(err)
 
 		egressTargets := explainedPolicies.TargetsApplyingToPod(false, pod.Namespace, pod.Labels)
-		combinedEgressTarget := matcher.CombineTargetsIgnoringPrimaryKey(pod.Namespace, metav1.LabelSelector{MatchLabels: pod.Labels}, egressTargets)
+		combinedEgressTarget, err := matcher.CombineTargetsIgnoringPrimaryKey(pod.Namespace, metav1.LabelSelector{MatchLabels: pod.Labels}, egressTargets)
+		utils.DoOrDie(err)
 
 		var combinedIngresses []*matcher.Target
 		if combinedIngressTarget != nil {
@@ -161,22 +502,117 @@ func QueryTargets(explainedPolicies *matcher.Policy, podPath string) {
 			combinedEgresses = []*matcher.Target{combinedEgressTarget}
 		}
 
-		fmt.Printf("Matching targets:\n%s\n", explainer.TableExplainer(matcher.NewPolicyWithTargets(ingressTargets, egressTargets)))
-		fmt.Printf("Combined rules for pod %+v:\n%s\n\n\n", pod, explainer.TableExplainer(matcher.NewPolicyWithTargets(combinedIngresses, combinedEgresses)))
+		matchingPolicy, err := matcher.NewPolicyWithTargets(ingressTargets, egressTargets)
+		utils.DoOrDie(err)
+		combinedPolicy, err := matcher.NewPolicyWithTargets(combinedIngresses, combinedEgresses)
+		utils.DoOrDie(err)
+
+		fmt.Printf("Matching targets:\n%s\n", explainer.TableExplainer(matchingPolicy))
+		fmt.Printf("Combined rules for pod %+v:\n%s\n\n\n", pod, explainer.TableExplainer(combinedPolicy))
 	}
 }
 
-func QueryTraffic(explainedPolicies *matcher.Policy, trafficPath string) {
+// QueryReachingPod asks which peers can reach the pods in a namespace with labels -- on a port and protocol, if
+// Port is set.  Protocol defaults to TCP.
+type QueryReachingPod struct {
+	Namespace string              `json:"namespace"`
+	Labels    map[string]string   `json:"labels"`
+	Port      *intstr.IntOrString `json:"port,omitempty"`
+	Protocol  v1.Protocol         `json:"protocol,omitempty"`
+}
+
+func readQueryReachingPods(podPath string) []*QueryReachingPod {
+	var pods []*QueryReachingPod
+	bs, err := ioutil.ReadFile(podPath)
+	utils.DoOrDie(errors.Wrapf(err, "unable to read file %s", podPath))
+	utils.DoOrDie(errors.Wrapf(json.Unmarshal(bs, &pods), "unable to unmarshal json"))
+	for _, pod := range pods {
+		if pod.Protocol == "" {
+			pod.Protocol = v1.ProtocolTCP
+		}
+	}
+	return pods
+}
+
+// ReachingPeers describes the peers allowed to reach the pod.  A port is matched by both number and name, if
+// the inventory has a pod to resolve it against; otherwise only rules using the same kind of port match it.
+func (q *QueryReachingPod) ReachingPeers(explainedPolicies *matcher.Policy, inventory *probe.Resources) *matcher.ReachingPeers {
+	if q.Port == nil {
+		reaching, err := explainedPolicies.PeersReachingPod(q.Namespace, q.Labels)
+		utils.DoOrDie(err)
+		return reaching
+	}
+	portInt, portName := q.resolvePort(inventory)
+	reaching, err := explainedPolicies.PeersReachingPodOnPort(q.Namespace, q.Labels, portInt, portName, q.Protocol)
+	utils.DoOrDie(err)
+	return reaching
+}
+
+func (q *QueryReachingPod) resolvePort(inventory *probe.Resources) (int, string) {
+	var pods []*probe.Pod
+	if inventory != nil {
+		pods = inventory.PodsMatching(q.Namespace, q.Labels)
+	}
+	switch q.Port.Type {
+	case intstr.String:
+		for _, pod := range pods {
+			if portInt, err := pod.ResolveNamedPort(q.Port.StrVal); err == nil {
+				return portInt, q.Port.StrVal
+			}
+		}
+		return 0, q.Port.StrVal
+	default:
+		for _, pod := range pods {
+			if portName, err := pod.ResolveNumberedPort(int(q.Port.IntVal)); err == nil {
+				return int(q.Port.IntVal), portName
+			}
+		}
+		return int(q.Port.IntVal), ""
+	}
+}
+
+// ReachingPods lists the inventory's pods which can reach the pod, taking egress and admin policies into account
+func (q *QueryReachingPod) ReachingPods(explainedPolicies *matcher.Policy, inventory *probe.Resources) []*probe.ReachingPod {
+	return inventory.PodsReaching(explainedPolicies, q.Namespace, q.Labels, q.Port, q.Protocol)
+}
+
+func (q *QueryReachingPod) String() string {
+	if q.Port == nil {
+		return fmt.Sprintf("%s %+v", q.Namespace, q.Labels)
+	}
+	return fmt.Sprintf("%s %+v on %s/%s", q.Namespace, q.Labels, q.Port.String(), q.Protocol)
+}
+
+func QueryReachingPeers(explainedPolicies *matcher.Policy, podPath string, inventory *probe.Resources) {
+	for _, pod := range readQueryReachingPods(podPath) {
+		fmt.Printf("Peers allowed to reach pod %s:\n%s\n", pod.String(), explainer.ReachingPeersTable(pod.ReachingPeers(explainedPolicies, inventory)))
+		if inventory != nil {
+			fmt.Printf("Pods which can reach pod %s:\n%s\n\n", pod.String(), probe.ReachingPodsTable(pod.ReachingPods(explainedPolicies, inventory)))
+		}
+	}
+}
+
+func readTraffics(trafficPath string) []*matcher.Traffic {
 	var allTraffics []*matcher.Traffic
 	allTrafficBytes, err := ioutil.ReadFile(trafficPath)
 	utils.DoOrDie(err)
 	err = json.Unmarshal(allTrafficBytes, &allTraffics)
 	utils.DoOrDie(err)
-	for _, traffic := range allTraffics {
+	return allTraffics
+}
+
+func QueryTraffic(explainedPolicies *matcher.Policy, trafficPath string, explain bool) {
+	for _, traffic := range readTraffics(trafficPath) {
 		fmt.Printf("Traffic:\n%s\n", traffic.Table())
 
 		result := explainedPolicies.IsTrafficAllowed(traffic)
 		fmt.Printf("Is traffic allowed?\n%s\n\n\n", result.Table())
+
+		if explain {
+			explanation, err := explainer.ExplainTraffic(explainedPolicies, traffic)
+			utils.DoOrDie(err)
+			fmt.Printf("Why?\n%s\n\n\n", explainer.TrafficExplanationTable(explanation))
+		}
 	}
 }
 
@@ -185,13 +621,32 @@ type SyntheticProbeConnectivityConfig struct {
 	Probes    []*generator.PortProtocol
 }
 
-func ProbeSyntheticConnectivity(explainedPolicies *matcher.Policy, modelPath string) {
+func readSyntheticProbeConnectivityConfig(modelPath string) *SyntheticProbeConnectivityConfig {
 	bs, err := ioutil.ReadFile(modelPath)
 	utils.DoOrDie(errors.Wrapf(err, "unable to read file %s", modelPath))
 	config := &SyntheticProbeConnectivityConfig{}
 	err = json.Unmarshal(bs, &config)
 	utils.DoOrDie(errors.Wrapf(err, "unable to unmarshal json"))
+	return config
+}
 
+// readAnalyzeProbeConfig reads the synthetic probe config, if there's a path; if the config has no resources,
+// the inventory derived from manifests is used instead
+func readAnalyzeProbeConfig(modelPath string, manifestInventory *probe.Resources) *SyntheticProbeConnectivityConfig {
+	if modelPath == "" {
+		return nil
+	}
+	config := readSyntheticProbeConnectivityConfig(modelPath)
+	if config.Resources == nil {
+		if manifestInventory == nil {
+			utils.DoOrDie(errors.Errorf("synthetic probe config at %s has no resources, and no inventory was derived from --policy-path", modelPath))
+		}
+		config.Resources = manifestInventory
+	}
+	return config
+}
+
+func ProbeSyntheticConnectivity(explainedPolicies *matcher.Policy, config *SyntheticProbeConnectivityConfig) {
 	// run probes
 	for _, probeConfig := range config.Probes {
 		probeResult := probe.NewSimulatedRunner(explainedPolicies).
@@ -206,3 +661,59 @@ func ProbeSyntheticConnectivity(explainedPolicies *matcher.Policy, modelPath str
 		fmt.Printf("Combined:\n%s\n\n\n", probeResult.RenderTable())
 	}
 }
+
+// MatrixSyntheticConnectivity runs every probe of the synthetic probe config, and prints the combined results
+// as a reachability matrix of groups of pods, followed by the pod by pod table of each drill-down cell
+func MatrixSyntheticConnectivity(explainedPolicies *matcher.Policy, config *SyntheticProbeConnectivityConfig, groupBy string, drillDowns []string) {
+	matrix := buildReachabilityMatrix(explainedPolicies, config, groupBy)
+	fmt.Printf("Reachability:\n%s\n", matrix.RenderTable())
+	if partial := matrix.PartialCells(); len(partial) > 0 {
+		logrus.Infof("found %d partially reachable cells; use --matrix-drill-down FROM:TO to see their pods", len(partial))
+	}
+
+	for _, cell := range parseMatrixCells(drillDowns) {
+		table, err := matrix.DrillDown(cell[0], cell[1])
+		utils.DoOrDie(err)
+		fmt.Printf("%s -> %s:\n%s\n\n\n", cell[0], cell[1], table.RenderTable())
+	}
+}
+
+func buildReachabilityMatrix(explainedPolicies *matcher.Policy, config *SyntheticProbeConnectivityConfig, groupBy string) *probe.ReachabilityMatrix {
+	var tables []*probe.Table
+	for _, probeConfig := range config.Probes {
+		tables = append(tables, probe.NewSimulatedRunner(explainedPolicies).
+			RunProbeFixedPortProtocol(config.Resources, probeConfig.Port, probeConfig.Protocol))
+	}
+	return probe.NewReachabilityMatrix(config.Resources, groupBy, tables...)
+}
+
+// parseMatrixCells splits 'FROM:TO' cells into their groups
+func parseMatrixCells(cells []string) [][2]string {
+	var parsed [][2]string
+	for _, cell := range cells {
+		groups := strings.Split(cell, ":")
+		if len(groups) != 2 {
+			utils.DoOrDie(errors.Errorf("invalid matrix cell '%s', expected FROM:TO", cell))
+		}
+		parsed = append(parsed, [2]string{groups[0], groups[1]})
+	}
+	return parsed
+}
+
+// GraphSyntheticConnectivity runs every probe of the synthetic probe config, and prints the combined
+// results as a single connectivity graph
+func GraphSyntheticConnectivity(explainedPolicies *matcher.Policy, config *SyntheticProbeConnectivityConfig, format probe.GraphFormat, byNamespace bool) {
+	var tables []*probe.Table
+	for _, probeConfig := range config.Probes {
+		tables = append(tables, probe.NewSimulatedRunner(explainedPolicies).
+			RunProbeFixedPortProtocol(config.Resources, probeConfig.Port, probeConfig.Protocol))
+	}
+
+	graph := probe.NewGraph(config.Resources, tables...)
+	if byNamespace {
+		graph = graph.AggregateByNamespace()
+	}
+	rendered, err := graph.Render(format)
+	utils.DoOrDie(err)
+	fmt.Print(rendered)
+}
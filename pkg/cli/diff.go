@@ -0,0 +1,105 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mattfenwick/cyclonus/pkg/connectivity/probe"
+	"github.com/mattfenwick/cyclonus/pkg/kube"
+	"github.com/mattfenwick/cyclonus/pkg/matcher"
+	"github.com/mattfenwick/cyclonus/pkg/utils"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"io/ioutil"
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+)
+
+type DiffArgs struct {
+	PolicyPaths   []string
+	AllNamespaces bool
+	Namespaces    []string
+	Context       string
+
+	ProbePath string
+}
+
+func SetupDiffCommand() *cobra.Command {
+	args := &DiffArgs{}
+
+	command := &cobra.Command{
+		Use:   "diff",
+		Short: "show which traffic changes between two sets of network policies",
+		Long:  "compare two sets of network policies -- from two policy paths, or from kube and a policy path -- by running synthetic probes against the same model",
+		Args:  cobra.ExactArgs(0),
+		Run: func(cmd *cobra.Command, as []string) {
+			RunDiffCommand(args)
+		},
+	}
+
+	command.Flags().StringSliceVar(&args.PolicyPaths, "policy-path", []string{}, "may be a file or a directory; pass twice to compare old (first) to new (second), or pass once to compare policies from kube (old) to policies from the path (new)")
+	command.Flags().BoolVarP(&args.AllNamespaces, "all-namespaces", "A", false, "if only one policy path is given: similar to kubectl's '--all-namespaces'/'-A' flag, read old policies from all namespaces")
+	command.Flags().StringSliceVarP(&args.Namespaces, "namespace", "n", []string{}, "if only one policy path is given: namespaces to read old policies from")
+	command.Flags().StringVar(&args.Context, "context", "", "if only one policy path is given: selects kube context to read old policies from")
+
+	command.Flags().StringVar(&args.ProbePath, "probe-path", "", "path to json model file for synthetic probe")
+	utils.DoOrDie(command.MarkFlagRequired("probe-path"))
+
+	return command
+}
+
+func RunDiffCommand(args *DiffArgs) {
+	var oldPolicies, newPolicies []*networkingv1.NetworkPolicy
+	var err error
+	switch len(args.PolicyPaths) {
+	case 1:
+		namespaces := args.Namespaces
+		if args.AllNamespaces {
+			namespaces = []string{v1.NamespaceAll}
+		}
+		if len(namespaces) == 0 {
+			utils.DoOrDie(errors.Errorf("with a single policy path, must specify namespaces or all namespaces to read old policies from kube"))
+		}
+		kubeClient, err := kube.NewKubernetesForContext(args.Context)
+		utils.DoOrDie(err)
+		oldPolicies, err = readPoliciesFromKube(kubeClient, namespaces)
+		utils.DoOrDie(err)
+		newPolicies, _, err = readPoliciesFromPath(args.PolicyPaths[0])
+		utils.DoOrDie(err)
+	case 2:
+		oldPolicies, _, err = readPoliciesFromPath(args.PolicyPaths[0])
+		utils.DoOrDie(err)
+		newPolicies, _, err = readPoliciesFromPath(args.PolicyPaths[1])
+		utils.DoOrDie(err)
+	default:
+		utils.DoOrDie(errors.Errorf("expected 1 or 2 policy paths, found %d", len(args.PolicyPaths)))
+	}
+
+	bs, err := ioutil.ReadFile(args.ProbePath)
+	utils.DoOrDie(errors.Wrapf(err, "unable to read file %s", args.ProbePath))
+	config := &SyntheticProbeConnectivityConfig{}
+	err = json.Unmarshal(bs, &config)
+	utils.DoOrDie(errors.Wrapf(err, "unable to unmarshal json"))
+
+	DiffPolicies(matcher.BuildNetworkPolicies(validPolicies(oldPolicies, false)), matcher.BuildNetworkPolicies(validPolicies(newPolicies, false)), config)
+}
+
+func DiffPolicies(oldPolicy *matcher.Policy, newPolicy *matcher.Policy, config *SyntheticProbeConnectivityConfig) {
+	oldRunner := probe.NewSimulatedRunner(oldPolicy)
+	newRunner := probe.NewSimulatedRunner(newPolicy)
+	for _, probeConfig := range config.Probes {
+		logrus.Infof("probe on port %s, protocol %s", probeConfig.Port.String(), probeConfig.Protocol)
+
+		diff := probe.NewDiffTable(
+			oldRunner.RunProbeFixedPortProtocol(config.Resources, probeConfig.Port, probeConfig.Protocol),
+			newRunner.RunProbeFixedPortProtocol(config.Resources, probeConfig.Port, probeConfig.Protocol))
+
+		changes := diff.Changes()
+		if len(changes) == 0 {
+			fmt.Printf("no changes on port %s, protocol %s\n\n\n", probeConfig.Port.String(), probeConfig.Protocol)
+			continue
+		}
+		fmt.Printf("%d change(s) on port %s, protocol %s:\n%s\n", len(changes), probeConfig.Port.String(), probeConfig.Protocol, diff.RenderTable())
+		fmt.Printf("Changes:\n%s\n\n\n", diff.RenderChanges())
+	}
+}
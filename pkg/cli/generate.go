@@ -89,13 +89,13 @@ func RunGenerateCommand(args *GenerateArgs) {
 	case "upstream":
 		testCaseGenerator = &generator.UpstreamE2EGenerator{}
 	case "simple-fragments":
-		testCaseGenerator = generator.NewDefaultFragmentGenerator(args.AllowDNS, args.ServerNamespaces, zcPod.IP)
+		testCaseGenerator = generator.NewDefaultFragmentGenerator(args.AllowDNS, args.ServerNamespaces, zcPod.AllIPs()...)
 	case "discrete":
-		testCaseGenerator = generator.NewDefaultDiscreteGenerator(args.AllowDNS, zcPod.IP)
+		testCaseGenerator = generator.NewDefaultDiscreteGenerator(args.AllowDNS, zcPod.AllIPs()...)
 	case "breadth":
-		testCaseGenerator = generator.NewBreadthGenerator(args.AllowDNS, zcPod.IP)
+		testCaseGenerator = generator.NewBreadthGenerator(args.AllowDNS, zcPod.AllIPs()...)
 	case "depth":
-		testCaseGenerator = generator.NewDepthGenerator(args.AllowDNS, zcPod.IP)
+		testCaseGenerator = generator.NewDepthGenerator(args.AllowDNS, zcPod.AllIPs()...)
 	case "conflicts":
 		testCaseGenerator = &generator.ConflictGenerator{
 			AllowDNS:    args.AllowDNS,
@@ -0,0 +1,260 @@
+package cli
+
+import (
+	"fmt"
+	"github.com/mattfenwick/cyclonus/pkg/kube"
+	"github.com/mattfenwick/cyclonus/pkg/linter"
+	"github.com/mattfenwick/cyclonus/pkg/matcher"
+	"github.com/mattfenwick/cyclonus/pkg/utils"
+	"github.com/olekukonko/tablewriter"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"io/ioutil"
+	networkingv1 "k8s.io/api/networking/v1"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type LintArgs struct {
+	ConfigPath string
+	FailOn     string
+	Output     string
+
+	Fix          bool
+	FixOutputDir string
+}
+
+const (
+	LintOutputTable = "table"
+	LintOutputJSON  = "json"
+	LintOutputYAML  = "yaml"
+	LintOutputSARIF = "sarif"
+)
+
+// lintStdin is the path which reads policies from stdin
+const lintStdin = "-"
+
+func SetupLintCommand() *cobra.Command {
+	args := &LintArgs{}
+
+	command := &cobra.Command{
+		Use:   "lint PATH...",
+		Short: "check network policies from files for common problems",
+		Long:  "check network policies from files, directories -- recursively, reading only .yaml, .yml and .json files -- and stdin ('-') for common problems, without contacting a cluster; with --fix, fill in the fields which source checks find missing -- after verifying that the fixed policies allow the same traffic; fixes which would change behavior are only reported",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, as []string) {
+			RunLintCommand(args, as)
+		},
+	}
+
+	command.Flags().StringVar(&args.ConfigPath, "config", "", "path to yaml lint config, which enables/disables checks and overrides their severities, globally or per namespace")
+	command.Flags().StringVar(&args.FailOn, "fail-on", "", fmt.Sprintf("if set, exit with a non-zero status if there are lint warnings at or above this severity, one of %+v; overrides the lint config's failOn", linter.AllSeverities))
+	command.Flags().StringVarP(&args.Output, "output", "o", LintOutputTable, fmt.Sprintf("output format, one of %s, %s, %s, %s", LintOutputTable, LintOutputJSON, LintOutputYAML, LintOutputSARIF))
+
+	command.Flags().BoolVar(&args.Fix, "fix", false, "if true, rewrite yaml files with the fields which source checks find missing filled in")
+	command.Flags().StringVar(&args.FixOutputDir, "fix-output-dir", "", "if set, write fixed files to this directory, mirroring each path, instead of rewriting them in place")
+
+	return command
+}
+
+func RunLintCommand(args *LintArgs, paths []string) {
+	if args.Fix {
+		FixPolicies(paths, args.FixOutputDir)
+		return
+	}
+
+	config := readLintConfig(args.ConfigPath, args.FailOn)
+
+	var policies []*networkingv1.NetworkPolicy
+	sources := kube.NetworkPolicySources{}
+	err := walkLintPaths(paths, func(root string, path string, bytes []byte) error {
+		filePolicies, fileSources, err := kube.ParseNetworkPolicies(path, bytes)
+		if err != nil {
+			return err
+		}
+		policies = append(policies, filePolicies...)
+		sources.Add(fileSources)
+		return nil
+	})
+	utils.DoOrDie(err)
+	logrus.Debugf("read %d policies", len(policies))
+	_, policyErrors := matcher.BuildValidNetworkPolicies(policies)
+	skipped := map[*networkingv1.NetworkPolicy]bool{}
+	for _, policyError := range policyErrors {
+		if !skipped[policyError.Policy] {
+			skipped[policyError.Policy] = true
+			logrus.Warnf("only running source checks on invalid network policy %s/%s", policyError.Namespace, policyError.Name)
+		}
+	}
+
+	warnings := config.Apply(linter.Lint(policies, map[linter.Check]bool{}))
+	switch args.Output {
+	case LintOutputTable:
+		fmt.Println(linter.WarningsTable(warnings))
+	case LintOutputJSON:
+		fmt.Println(utils.JsonString(linter.WarningsReport(warnings)))
+	case LintOutputYAML:
+		fmt.Print(utils.YamlString(linter.WarningsReport(warnings)))
+	case LintOutputSARIF:
+		fmt.Println(utils.JsonString(linter.WarningsSARIF(warnings, sources)))
+	default:
+		utils.DoOrDie(errors.Errorf("invalid output format '%s'", args.Output))
+	}
+
+	if config.IsFailure(warnings) {
+		logrus.Errorf("lint failed: found warnings with severity %s or higher", config.FailOn)
+		os.Exit(1)
+	}
+}
+
+func isManifestFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	default:
+		return false
+	}
+}
+
+// walkLintPaths calls f on every file of paths, along with the path it was found under: files are read
+// as they are, directories recursively -- but only their yaml and json files -- and '-' reads stdin
+func walkLintPaths(paths []string, f func(root string, path string, bytes []byte) error) error {
+	for _, root := range paths {
+		if root == lintStdin {
+			bytes, err := ioutil.ReadAll(os.Stdin)
+			if err != nil {
+				return errors.Wrapf(err, "unable to read stdin")
+			}
+			if err = f(root, "<stdin>", bytes); err != nil {
+				return err
+			}
+			continue
+		}
+		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return errors.Wrapf(err, "unable to walk path %s", path)
+			}
+			if info.IsDir() || (path != root && !isManifestFile(path)) {
+				return nil
+			}
+			bytes, err := ioutil.ReadFile(path)
+			if err != nil {
+				return errors.Wrapf(err, "unable to read file %s", path)
+			}
+			return f(root, path, bytes)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fixedFile is a policy file, before and after fixing
+type fixedFile struct {
+	Root     string
+	Path     string
+	Fixed    []byte
+	Fixes    []*linter.Fix
+	Original []*networkingv1.NetworkPolicy
+	Policies []*networkingv1.NetworkPolicy
+}
+
+// FixPolicies fixes every yaml file of paths, and writes them back only if all of the fixed policies,
+// together, allow the same traffic as the originals
+func FixPolicies(paths []string, outputDir string) {
+	var files []*fixedFile
+	err := walkLintPaths(paths, func(root string, path string, bytes []byte) error {
+		if root == lintStdin {
+			return errors.Errorf("can't fix policies from stdin")
+		}
+		original, _, err := kube.ParseNetworkPolicies(path, bytes)
+		if err != nil {
+			return err
+		}
+		if strings.EqualFold(filepath.Ext(path), ".json") {
+			logrus.Warnf("not fixing json file %s", path)
+			files = append(files, &fixedFile{Root: root, Path: path, Fixed: bytes, Original: original, Policies: original})
+			return nil
+		}
+		fixed, fixes, err := linter.FixYaml(path, bytes)
+		if err != nil {
+			return err
+		}
+		policies, _, err := kube.ParseNetworkPolicies(path, fixed)
+		if err != nil {
+			return errors.WithMessagef(err, "unable to parse fixed yaml for %s", path)
+		}
+		files = append(files, &fixedFile{Root: root, Path: path, Fixed: fixed, Fixes: fixes, Original: original, Policies: policies})
+		return nil
+	})
+	utils.DoOrDie(err)
+
+	var original, fixed []*networkingv1.NetworkPolicy
+	for _, file := range files {
+		original = append(original, file.Original...)
+		fixed = append(fixed, file.Policies...)
+	}
+	utils.DoOrDie(linter.VerifyFixes(original, fixed))
+
+	fixCount, fileCount := 0, 0
+	for _, file := range files {
+		applied := 0
+		for _, fix := range file.Fixes {
+			if !fix.ChangesBehavior {
+				applied++
+			}
+		}
+		if applied == 0 {
+			continue
+		}
+		outputPath := file.Path
+		if outputDir != "" {
+			outputPath = filepath.Join(outputDir, fixOutputRelativePath(file.Root, file.Path))
+			utils.DoOrDie(os.MkdirAll(filepath.Dir(outputPath), 0755))
+		}
+		utils.DoOrDie(errors.Wrapf(ioutil.WriteFile(outputPath, file.Fixed, 0644), "unable to write file %s", outputPath))
+		logrus.Debugf("wrote %s", outputPath)
+		fixCount += applied
+		fileCount++
+	}
+
+	fmt.Println(FixesTable(files))
+	fmt.Printf("fixed %d problems in %d files\n", fixCount, fileCount)
+}
+
+// fixOutputRelativePath is the path of a file relative to the path it was found under -- or, if that path is
+// the file itself, just its name
+func fixOutputRelativePath(root string, path string) string {
+	relative, err := filepath.Rel(root, path)
+	if err != nil || relative == "." {
+		return filepath.Base(path)
+	}
+	return relative
+}
+
+func FixesTable(files []*fixedFile) string {
+	str := &strings.Builder{}
+	table := tablewriter.NewWriter(str)
+	table.SetHeader([]string{"File", "Policy", "Check", "Field", "Value", "Applied"})
+	table.SetAutoWrapText(false)
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+	for _, file := range files {
+		for _, fix := range file.Fixes {
+			applied := "yes"
+			if fix.ChangesBehavior {
+				applied = "no: changes behavior, since ignored rules would be enforced"
+			}
+			table.Append([]string{file.Path, fix.Policy.Namespace + "/" + fix.Policy.Name, string(fix.Check), fix.FieldPath(), fix.ValueString(), applied})
+		}
+	}
+
+	table.Render()
+	return str.String()
+}
@@ -34,8 +34,11 @@ func SetupRootCommand() *cobra.Command {
 
 	command.AddCommand(SetupAnalyzeCommand())
 	command.AddCommand(SetupCompareCommand())
+	command.AddCommand(SetupDiffCommand())
 	command.AddCommand(SetupGenerateCommand())
+	command.AddCommand(SetupLintCommand())
 	command.AddCommand(SetupProbeCommand())
+	command.AddCommand(SetupSimplifyCommand())
 	command.AddCommand(SetupVersionCommand())
 
 	// TODO
@@ -0,0 +1,111 @@
+package cli
+
+import (
+	"fmt"
+	"github.com/mattfenwick/cyclonus/pkg/kube"
+	"github.com/mattfenwick/cyclonus/pkg/kube/netpol"
+	"github.com/mattfenwick/cyclonus/pkg/matcher"
+	"github.com/mattfenwick/cyclonus/pkg/utils"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"io/ioutil"
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"os"
+	"path"
+	"strings"
+)
+
+type SimplifyArgs struct {
+	AllNamespaces      bool
+	Namespaces         []string
+	UseExamplePolicies bool
+	PolicyPath         string
+	Context            string
+
+	OutputDir string
+}
+
+func SetupSimplifyCommand() *cobra.Command {
+	args := &SimplifyArgs{}
+
+	command := &cobra.Command{
+		Use:   "simplify",
+		Short: "print a minimal set of network policies equivalent to the input policies",
+		Long:  "combine policies by target, drop rules which can never change the outcome, and print the result as yaml -- after verifying that it's equivalent to the input",
+		Args:  cobra.ExactArgs(0),
+		Run: func(cmd *cobra.Command, as []string) {
+			RunSimplifyCommand(args)
+		},
+	}
+
+	command.Flags().BoolVar(&args.UseExamplePolicies, "use-example-policies", false, "if true, reads example policies")
+	command.Flags().BoolVarP(&args.AllNamespaces, "all-namespaces", "A", false, "similar to kubectl's '--all-namespaces'/'-A' flag: if true, read policies from all-namespaces")
+	command.Flags().StringSliceVarP(&args.Namespaces, "namespace", "n", []string{}, "similar to kubectl's '--namespace'/'-n' flag, except that multiple namespaces may be passed in; policies will be read from these namespaces")
+	command.Flags().StringVar(&args.PolicyPath, "policy-path", "", "may be a file or a directory; if set, will attempt to read policies from the path")
+	command.Flags().StringVar(&args.Context, "context", "", "selects kube context to read policies from; only reads from kube if one or more namespaces or all namespaces are specified")
+
+	command.Flags().StringVar(&args.OutputDir, "output-dir", "", "if set, write one yaml file per policy to this directory instead of printing to stdout")
+
+	return command
+}
+
+func RunSimplifyCommand(args *SimplifyArgs) {
+	var kubePolicies []*networkingv1.NetworkPolicy
+	namespaces := args.Namespaces
+	if args.AllNamespaces {
+		namespaces = []string{v1.NamespaceAll}
+	}
+	if len(namespaces) > 0 {
+		kubeClient, err := kube.NewKubernetesForContext(args.Context)
+		utils.DoOrDie(err)
+		kubePolicies, err = readPoliciesFromKube(kubeClient, namespaces)
+		utils.DoOrDie(err)
+	}
+	if args.PolicyPath != "" {
+		policiesFromPath, _, err := readPoliciesFromPath(args.PolicyPath)
+		utils.DoOrDie(err)
+		kubePolicies = append(kubePolicies, policiesFromPath...)
+	}
+	if args.UseExamplePolicies {
+		kubePolicies = append(kubePolicies, netpol.AllExamples...)
+	}
+
+	simplified, err := SimplifyPolicies(kubePolicies)
+	utils.DoOrDie(err)
+	logrus.Infof("simplified %d policies to %d policies", len(kubePolicies), len(simplified))
+
+	if args.OutputDir == "" {
+		var docs []string
+		for _, policy := range simplified {
+			docs = append(docs, utils.YamlString(policy))
+		}
+		fmt.Print(strings.Join(docs, "---\n"))
+		return
+	}
+	utils.DoOrDie(os.MkdirAll(args.OutputDir, 0755))
+	for _, policy := range simplified {
+		filePath := path.Join(args.OutputDir, fmt.Sprintf("%s-%s.yaml", policy.Namespace, policy.Name))
+		utils.DoOrDie(errors.Wrapf(ioutil.WriteFile(filePath, []byte(utils.YamlString(policy)), 0644), "unable to write file %s", filePath))
+		logrus.Infof("wrote %s", filePath)
+	}
+}
+
+// SimplifyPolicies creates a minimal set of NetworkPolicies, and verifies that it allows exactly
+// the same traffic as the input
+func SimplifyPolicies(kubePolicies []*networkingv1.NetworkPolicy) ([]*networkingv1.NetworkPolicy, error) {
+	policy, policyErrors := matcher.BuildValidNetworkPolicies(kubePolicies)
+	if len(policyErrors) > 0 {
+		return nil, policyErrors[0]
+	}
+	simplified, err := matcher.ToNetworkPolicies(matcher.Simplify(policy))
+	if err != nil {
+		return nil, err
+	}
+	isEquivalent, traffic := matcher.AreEquivalent(policy, matcher.BuildNetworkPolicies(simplified))
+	if !isEquivalent {
+		return nil, errors.Errorf("simplified policies are not equivalent to the input, differing on traffic:\n%s", traffic.Table())
+	}
+	return simplified, nil
+}
@@ -2,7 +2,10 @@ package cli
 
 import (
 	"context"
+	"github.com/mattfenwick/cyclonus/pkg/importer"
 	"github.com/mattfenwick/cyclonus/pkg/kube"
+	"github.com/mattfenwick/cyclonus/pkg/matcher"
+	"github.com/mattfenwick/cyclonus/pkg/utils"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"io/ioutil"
@@ -11,10 +14,22 @@ import (
 	"os"
 	"path/filepath"
 	"sigs.k8s.io/yaml"
+	"strings"
 )
 
-func readPoliciesFromPath(policyPath string) ([]*networkingv1.NetworkPolicy, error) {
-	var allPolicies []*networkingv1.NetworkPolicy
+// readPoliciesFromPath reads NetworkPolicies from every file under policyPath, remembering where each came from
+func readPoliciesFromPath(policyPath string) ([]*networkingv1.NetworkPolicy, kube.NetworkPolicySources, error) {
+	manifests, err := readManifestsFromPath(policyPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	return manifests.NetworkPolicies, manifests.Sources, nil
+}
+
+// readManifestsFromPath reads NetworkPolicies, along with the namespaces and workloads of a rendered manifest
+// stream, from every file under policyPath
+func readManifestsFromPath(policyPath string) (*kube.Manifests, error) {
+	manifests := kube.NewManifests()
 	err := filepath.Walk(policyPath, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return errors.Wrapf(err, "unable to walk path %s", path)
@@ -29,36 +44,122 @@ func readPoliciesFromPath(policyPath string) ([]*networkingv1.NetworkPolicy, err
 			return errors.Wrapf(err, "unable to read file %s", path)
 		}
 
-		// try parsing a list first
-		var policies []*networkingv1.NetworkPolicy
-		err = yaml.Unmarshal(bytes, &policies)
-		if err == nil {
-			log.Debugf("parsed %d policies from %s", len(policies), path)
-			allPolicies = append(allPolicies, policies...)
-			return nil
+		fileManifests, err := kube.ParseManifests(path, bytes)
+		if err != nil {
+			return err
+		}
+		log.Debugf("parsed %d policies from %s", len(fileManifests.NetworkPolicies), path)
+		manifests.Add(fileManifests)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+		//return nil, errors.Wrapf(err, "unable to walk filesystem from %s", policyPath)
+	}
+	return manifests, nil
+}
+
+// validPolicies checks that policies from users are valid: invalid policies are fatal -- all of them are reported
+// -- unless skipInvalid, in which case they're reported as warnings and dropped
+func validPolicies(kubePolicies []*networkingv1.NetworkPolicy, skipInvalid bool) []*networkingv1.NetworkPolicy {
+	_, policyErrors := matcher.BuildValidNetworkPolicies(kubePolicies)
+	if len(policyErrors) == 0 {
+		return kubePolicies
+	}
+	invalid := map[*networkingv1.NetworkPolicy]bool{}
+	var messages []string
+	for _, policyError := range policyErrors {
+		invalid[policyError.Policy] = true
+		messages = append(messages, policyError.Error())
+	}
+	if !skipInvalid {
+		utils.DoOrDie(errors.Errorf("found %d invalid policies:\n%s", len(invalid), strings.Join(messages, "\n")))
+	}
+	var valid []*networkingv1.NetworkPolicy
+	for _, policy := range kubePolicies {
+		if !invalid[policy] {
+			valid = append(valid, policy)
 		}
+	}
+	for _, message := range messages {
+		log.Warnf("skipping %s", message)
+	}
+	return valid
+}
 
-		log.Debugf("failed to parse list from %s, falling back to parsing single policy", path)
-		var policy *networkingv1.NetworkPolicy
-		err = yaml.Unmarshal(bytes, &policy)
+// readAdminPoliciesFromPath reads AdminNetworkPolicies and at most one BaselineAdminNetworkPolicy, one per file,
+// distinguished by kind
+func readAdminPoliciesFromPath(policyPath string) ([]*kube.AdminNetworkPolicy, *kube.BaselineAdminNetworkPolicy, error) {
+	var anps []*kube.AdminNetworkPolicy
+	var banp *kube.BaselineAdminNetworkPolicy
+	err := filepath.Walk(policyPath, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
-			return errors.Wrapf(err, "unable to unmarshal single policy from yaml at %s", path)
+			return errors.Wrapf(err, "unable to walk path %s", path)
+		}
+		if info.IsDir() {
+			return nil
 		}
+		bytes, err := ioutil.ReadFile(path)
+		if err != nil {
+			return errors.Wrapf(err, "unable to read file %s", path)
+		}
+		var typeMeta metav1.TypeMeta
+		if err = yaml.Unmarshal(bytes, &typeMeta); err != nil {
+			return errors.Wrapf(err, "unable to unmarshal kind from yaml at %s", path)
+		}
+		switch typeMeta.Kind {
+		case "AdminNetworkPolicy":
+			var anp *kube.AdminNetworkPolicy
+			if err = yaml.Unmarshal(bytes, &anp); err != nil {
+				return errors.Wrapf(err, "unable to unmarshal admin network policy from yaml at %s", path)
+			}
+			anps = append(anps, anp)
+		case "BaselineAdminNetworkPolicy":
+			if banp != nil {
+				return errors.Errorf("found more than one baseline admin network policy, second at %s", path)
+			}
+			if err = yaml.Unmarshal(bytes, &banp); err != nil {
+				return errors.Wrapf(err, "unable to unmarshal baseline admin network policy from yaml at %s", path)
+			}
+		default:
+			return errors.Errorf("unexpected kind '%s' at %s", typeMeta.Kind, path)
+		}
+		log.Debugf("parsed %s from %s", typeMeta.Kind, path)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return anps, banp, nil
+}
 
-		log.Debugf("parsed single policy from %s: %+v", path, policy)
-		allPolicies = append(allPolicies, policy)
+// readCNIPoliciesFromPath imports Calico and Cilium policies, translating them into NetworkPolicies.  All files
+// are imported together, so that cluster-scoped policies apply to the namespaces of every namespaced policy.
+func readCNIPoliciesFromPath(policyPath string, options *importer.Options) (*importer.Result, error) {
+	var docs []string
+	err := filepath.Walk(policyPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return errors.Wrapf(err, "unable to walk path %s", path)
+		}
+		if info.IsDir() {
+			return nil
+		}
+		bytes, err := ioutil.ReadFile(path)
+		if err != nil {
+			return errors.Wrapf(err, "unable to read file %s", path)
+		}
+		log.Debugf("read CNI policies from %s", path)
+		docs = append(docs, string(bytes))
 		return nil
 	})
 	if err != nil {
 		return nil, err
-		//return nil, errors.Wrapf(err, "unable to walk filesystem from %s", policyPath)
 	}
-	for _, p := range allPolicies {
-		if len(p.Spec.PolicyTypes) == 0 {
-			return nil, errors.Errorf("missing spec.policyTypes from network policy %s/%s", p.Namespace, p.Name)
-		}
+	result, err := importer.ImportYaml([]byte(strings.Join(docs, "\n---\n")), options)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "unable to import policies from %s", policyPath)
 	}
-	return allPolicies, nil
+	return result, nil
 }
 
 func readPoliciesFromKube(kubeClient *kube.Kubernetes, namespaces []string) ([]*networkingv1.NetworkPolicy, error) {
@@ -0,0 +1,130 @@
+package probe
+
+import (
+	"fmt"
+	"github.com/olekukonko/tablewriter"
+	"sort"
+	"strings"
+)
+
+// ConnectivityChange is a single pod pair + port/protocol whose connectivity differs between two tables
+type ConnectivityChange struct {
+	From string
+	To   string
+	Key  string
+	Old  Connectivity
+	New  Connectivity
+}
+
+// IsOpened is true if the change allows traffic which was previously blocked
+func (c *ConnectivityChange) IsOpened() bool {
+	return c.Old != ConnectivityAllowed && c.New == ConnectivityAllowed
+}
+
+// IsClosed is true if the change blocks traffic which was previously allowed
+func (c *ConnectivityChange) IsClosed() bool {
+	return c.Old == ConnectivityAllowed && c.New != ConnectivityAllowed
+}
+
+type DiffItem struct {
+	From    string
+	To      string
+	Changes map[string]*ConnectivityChange
+}
+
+// DiffTable compares two Tables built from the same Resources and probe, such as
+// the results of simulating two different sets of policies
+type DiffTable struct {
+	Wrapped *TruthTable
+}
+
+func NewDiffTable(oldTable *Table, newTable *Table) *DiffTable {
+	diff := &DiffTable{Wrapped: NewTruthTable(oldTable.Wrapped.Froms, oldTable.Wrapped.Tos, func(fr, to string) interface{} {
+		return &DiffItem{
+			From:    fr,
+			To:      to,
+			Changes: map[string]*ConnectivityChange{},
+		}
+	})}
+	for _, key := range oldTable.Wrapped.Keys() {
+		oldResults := oldTable.Get(key.From, key.To).JobResults
+		newResults := newTable.Get(key.From, key.To).JobResults
+		item := diff.Get(key.From, key.To)
+		for k, oldResult := range oldResults {
+			newConnectivity := ConnectivityUnknown
+			if newResult, ok := newResults[k]; ok {
+				newConnectivity = newResult.Combined
+			}
+			if oldResult.Combined != newConnectivity {
+				item.Changes[k] = &ConnectivityChange{From: key.From, To: key.To, Key: k, Old: oldResult.Combined, New: newConnectivity}
+			}
+		}
+		for k, newResult := range newResults {
+			if _, ok := oldResults[k]; !ok {
+				item.Changes[k] = &ConnectivityChange{From: key.From, To: key.To, Key: k, Old: ConnectivityUnknown, New: newResult.Combined}
+			}
+		}
+	}
+	return diff
+}
+
+func (d *DiffTable) Get(from string, to string) *DiffItem {
+	return d.Wrapped.Get(from, to).(*DiffItem)
+}
+
+// Changes returns every change, sorted by from, to and port/protocol
+func (d *DiffTable) Changes() []*ConnectivityChange {
+	var changes []*ConnectivityChange
+	for _, key := range d.Wrapped.Keys() {
+		item := d.Get(key.From, key.To)
+		var keys []string
+		for k := range item.Changes {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			changes = append(changes, item.Changes[k])
+		}
+	}
+	return changes
+}
+
+// RenderTable renders the pod x pod grid; each cell lists the port/protocols whose connectivity changed
+func (d *DiffTable) RenderTable() string {
+	return d.Wrapped.Table("", true, func(fr, to string, i interface{}) string {
+		changes := d.Get(fr, to).Changes
+		var keys []string
+		for k := range changes {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var lines []string
+		for _, k := range keys {
+			c := changes[k]
+			lines = append(lines, fmt.Sprintf("%s: %s -> %s", k, c.Old.ShortString(), c.New.ShortString()))
+		}
+		return strings.Join(lines, "\n")
+	})
+}
+
+// RenderChanges renders one row per change, noting whether traffic was opened or closed
+func (d *DiffTable) RenderChanges() string {
+	tableString := &strings.Builder{}
+	table := tablewriter.NewWriter(tableString)
+	table.SetHeader([]string{"Change", "From", "To", "Port/Protocol", "Old", "New"})
+	table.SetAutoMergeCells(true)
+	table.SetRowLine(true)
+
+	for _, c := range d.Changes() {
+		change := "other"
+		if c.IsOpened() {
+			change = "blocked -> allowed"
+		} else if c.IsClosed() {
+			change = "allowed -> blocked"
+		}
+		table.Append([]string{change, c.From, c.To, c.Key, string(c.Old), string(c.New)})
+	}
+
+	table.Render()
+	return tableString.String()
+}
@@ -0,0 +1,49 @@
+package probe
+
+import (
+	"github.com/mattfenwick/cyclonus/pkg/kube/netpol"
+	"github.com/mattfenwick/cyclonus/pkg/matcher"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func RunDiffTests() {
+	Describe("DiffTable", func() {
+		resources := &Resources{
+			Namespaces: map[string]map[string]string{
+				"x": {"ns": "x"},
+			},
+			Pods: []*Pod{
+				NewPod("x", "a", map[string]string{"pod": "a"}, "1.2.3.4", []*Container{NewDefaultContainer(80, v1.ProtocolTCP, false)}),
+				NewPod("x", "b", map[string]string{"pod": "b"}, "1.2.3.5", []*Container{NewDefaultContainer(80, v1.ProtocolTCP, false)}),
+			},
+		}
+		port80 := intstr.FromInt(80)
+
+		It("Should find no changes between identical policies", func() {
+			policy := matcher.BuildNetworkPolicies(netpol.AllExamples)
+			oldTable := NewSimulatedRunner(policy).RunProbeFixedPortProtocol(resources, port80, v1.ProtocolTCP)
+			newTable := NewSimulatedRunner(policy).RunProbeFixedPortProtocol(resources, port80, v1.ProtocolTCP)
+			Expect(NewDiffTable(oldTable, newTable).Changes()).To(BeEmpty())
+		})
+
+		It("Should find traffic closed by adding a deny-all policy", func() {
+			oldTable := NewSimulatedRunner(matcher.NewPolicy()).RunProbeFixedPortProtocol(resources, port80, v1.ProtocolTCP)
+			denyAll := netpol.AllowNoIngress.DeepCopy()
+			denyAll.Namespace = "x"
+			newTable := NewSimulatedRunner(matcher.BuildNetworkPolicy(denyAll)).RunProbeFixedPortProtocol(resources, port80, v1.ProtocolTCP)
+
+			changes := NewDiffTable(oldTable, newTable).Changes()
+			Expect(changes).To(HaveLen(4))
+			for _, c := range changes {
+				Expect(c.IsClosed()).To(BeTrue())
+				Expect(c.IsOpened()).To(BeFalse())
+				Expect(c.Key).To(Equal("TCP/80"))
+			}
+			Expect(changes[0].From).To(Equal("x/a"))
+			Expect(changes[0].To).To(Equal("x/a"))
+		})
+	})
+}
@@ -0,0 +1,110 @@
+package probe
+
+import (
+	"fmt"
+	"github.com/mattfenwick/cyclonus/pkg/matcher"
+	"github.com/pkg/errors"
+	"net"
+	"sort"
+	"strings"
+)
+
+// PodClass is a set of pods which policies can't tell apart: they have the same namespace -- and so the same
+// namespace labels -- and the same pod labels, and their IPs are in the same of the policies' CIDRs
+type PodClass struct {
+	Namespace string
+	Labels    map[string]string
+	Pods      []*Pod
+}
+
+// EquivalenceClasses partitions the pods into classes which the policies can't tell apart, sorted by their
+// first pod.  Traffic between any pods of the same two classes, on the same port and protocol, is treated the same.
+func (r *Resources) EquivalenceClasses(policies *matcher.Policy) []*PodClass {
+	classifier := newPodClassifier(policies)
+	var classes []*PodClass
+	for _, pod := range r.Pods {
+		class := classifier.classOf(pod.PodString().String(), pod.Namespace, r.Namespaces[pod.Namespace], pod.Labels, pod.AllIPs()...)
+		if class == len(classes) {
+			classes = append(classes, &PodClass{Namespace: pod.Namespace, Labels: pod.Labels})
+		}
+		classes[class].Pods = append(classes[class].Pods, pod)
+	}
+	for _, class := range classes {
+		sort.Slice(class.Pods, func(i, j int) bool {
+			return class.Pods[i].PodString() < class.Pods[j].PodString()
+		})
+	}
+	sort.Slice(classes, func(i, j int) bool {
+		return classes[i].Pods[0].PodString() < classes[j].Pods[0].PodString()
+	})
+	return classes
+}
+
+// podEndpoint is a pod, at one or more of its IPs
+type podEndpoint struct {
+	Pod string
+	IPs string
+}
+
+// podClassifier numbers equivalence classes in the order they're found, and remembers the class of each
+// endpoint, so that the pods of a job don't have to be reclassified for every job
+type podClassifier struct {
+	cidrs     []*net.IPNet
+	classes   map[string]int
+	endpoints map[podEndpoint]int
+}
+
+func newPodClassifier(policies *matcher.Policy) *podClassifier {
+	classifier := &podClassifier{classes: map[string]int{}, endpoints: map[podEndpoint]int{}}
+	for _, cidr := range matcher.PolicyCIDRs(policies) {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(errors.Wrapf(err, "unable to parse CIDR '%s'", cidr))
+		}
+		classifier.cidrs = append(classifier.cidrs, ipNet)
+	}
+	return classifier
+}
+
+func (c *podClassifier) classOf(pod string, namespace string, namespaceLabels map[string]string, podLabels map[string]string, ips ...string) int {
+	endpoint := podEndpoint{Pod: pod, IPs: strings.Join(ips, ",")}
+	if class, ok := c.endpoints[endpoint]; ok {
+		return class
+	}
+	key := c.classKey(namespace, namespaceLabels, podLabels, ips)
+	class, ok := c.classes[key]
+	if !ok {
+		class = len(c.classes)
+		c.classes[key] = class
+	}
+	c.endpoints[endpoint] = class
+	return class
+}
+
+// classKey serializes everything about a pod which policies can see: its namespace and labels, and -- for
+// each IP -- which CIDRs it's in
+func (c *podClassifier) classKey(namespace string, namespaceLabels map[string]string, podLabels map[string]string, ips []string) string {
+	key := &strings.Builder{}
+	fmt.Fprintf(key, "%s\n%s\n%s\n", namespace, sortedLabels(namespaceLabels), sortedLabels(podLabels))
+	for _, ip := range ips {
+		parsed := net.ParseIP(ip)
+		for _, cidr := range c.cidrs {
+			if parsed != nil && cidr.Contains(parsed) {
+				key.WriteByte('1')
+			} else {
+				key.WriteByte('0')
+			}
+		}
+		key.WriteByte('\n')
+	}
+	return key.String()
+}
+
+func sortedLabels(labels map[string]string) string {
+	var kvs []string
+	for k, v := range labels {
+		kvs = append(kvs, k+"="+v)
+	}
+	sort.Strings(kvs)
+	return strings.Join(kvs, ",")
+}
@@ -0,0 +1,176 @@
+package probe
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/mattfenwick/cyclonus/pkg/matcher"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func RunEquivalenceTests() {
+	Describe("Equivalence classes", func() {
+		tcp := v1.ProtocolTCP
+		port80 := intstr.FromInt(80)
+		allowWeb := &networkingv1.NetworkPolicy{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "x", Name: "allow-web"},
+			Spec: networkingv1.NetworkPolicySpec{
+				PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+				Ingress: []networkingv1.NetworkPolicyIngressRule{
+					{
+						Ports: []networkingv1.NetworkPolicyPort{{Protocol: &tcp, Port: &port80}},
+						From: []networkingv1.NetworkPolicyPeer{
+							{IPBlock: &networkingv1.IPBlock{CIDR: "10.0.0.0/24", Except: []string{"10.0.0.128/25"}}},
+							{PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "db"}}},
+						},
+					},
+				},
+				PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			},
+		}
+		policies := matcher.BuildNetworkPolicies([]*networkingv1.NetworkPolicy{allowWeb})
+		containers := func() []*Container {
+			return []*Container{NewDefaultContainer(80, v1.ProtocolTCP, false), NewDefaultContainer(81, v1.ProtocolTCP, false)}
+		}
+		resources := &Resources{
+			Namespaces: map[string]map[string]string{"x": {"ns": "x"}, "y": {"ns": "y"}},
+			Pods: []*Pod{
+				NewPod("x", "a", map[string]string{"app": "web"}, "10.0.0.1", containers()),
+				NewPod("x", "b", map[string]string{"app": "web"}, "10.0.0.200", containers()),
+				NewPod("x", "c", map[string]string{"app": "web"}, "10.0.0.2", containers()),
+				NewPod("x", "d", map[string]string{"app": "db"}, "10.0.1.1", containers()),
+				NewPod("y", "a", map[string]string{"app": "web"}, "10.0.1.2", containers()),
+				NewPod("y", "b", map[string]string{"app": "db"}, "10.0.1.3", containers()),
+			},
+		}
+
+		It("Should group pods by namespace, labels and the CIDRs of their IPs", func() {
+			var classes [][]string
+			for _, class := range resources.EquivalenceClasses(policies) {
+				var pods []string
+				for _, pod := range class.Pods {
+					pods = append(pods, pod.PodString().String())
+				}
+				classes = append(classes, pods)
+			}
+			Expect(classes).To(Equal([][]string{
+				{"x/a", "x/c"},
+				{"x/b"},
+				{"x/d"},
+				{"y/a"},
+				{"y/b"},
+			}))
+		})
+
+		It("Should have the same results as simulating every job", func() {
+			runner := &SimulatedJobRunner{Policies: policies}
+			for _, port := range []intstr.IntOrString{intstr.FromInt(80), intstr.FromInt(81)} {
+				jobs := resources.GetJobsForNamedPortProtocol(port, v1.ProtocolTCP).Valid
+				Expect(jobs).To(HaveLen(36))
+				for i, result := range runner.RunJobs(jobs) {
+					expected := runner.RunJob(jobs[i])
+					Expect(result.Job).To(Equal(jobs[i]))
+					Expect(result.Combined).To(Equal(expected.Combined))
+					Expect(*result.Ingress).To(Equal(*expected.Ingress))
+					Expect(*result.Egress).To(Equal(*expected.Egress))
+				}
+			}
+		})
+	})
+}
+
+// benchmarkResources builds an inventory of namespaces with 10 apps each, with a policy per namespace allowing each
+// app from the next app of the namespaces of a team, and a policy allowing a CIDR
+func benchmarkResources(namespaces int, podsPerNamespace int) (*Resources, *matcher.Policy) {
+	tcp := v1.ProtocolTCP
+	port80 := intstr.FromInt(80)
+	resources := &Resources{Namespaces: map[string]map[string]string{}}
+	var kubePolicies []*networkingv1.NetworkPolicy
+	for i := 0; i < namespaces; i++ {
+		ns := fmt.Sprintf("ns-%d", i)
+		resources.Namespaces[ns] = map[string]string{"team": fmt.Sprintf("team-%d", i%5)}
+		for j := 0; j < podsPerNamespace; j++ {
+			ip := fmt.Sprintf("10.%d.%d.%d", i/256, i%256, j%256)
+			labels := map[string]string{"app": fmt.Sprintf("app-%d", j%10)}
+			resources.Pods = append(resources.Pods, NewPod(ns, fmt.Sprintf("pod-%d", j), labels, ip, []*Container{NewDefaultContainer(80, v1.ProtocolTCP, false)}))
+		}
+		for app := 0; app < 10; app++ {
+			kubePolicies = append(kubePolicies, &networkingv1.NetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: fmt.Sprintf("allow-app-%d", app)},
+				Spec: networkingv1.NetworkPolicySpec{
+					PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": fmt.Sprintf("app-%d", app)}},
+					Ingress: []networkingv1.NetworkPolicyIngressRule{{
+						Ports: []networkingv1.NetworkPolicyPort{{Protocol: &tcp, Port: &port80}},
+						From: []networkingv1.NetworkPolicyPeer{{
+							NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": fmt.Sprintf("team-%d", i%5)}},
+							PodSelector:       &metav1.LabelSelector{MatchLabels: map[string]string{"app": fmt.Sprintf("app-%d", (app+1)%10)}},
+						}},
+					}},
+					PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+				},
+			})
+		}
+	}
+	kubePolicies = append(kubePolicies, &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns-0", Name: "allow-cidr"},
+		Spec: networkingv1.NetworkPolicySpec{
+			Ingress: []networkingv1.NetworkPolicyIngressRule{{
+				From: []networkingv1.NetworkPolicyPeer{{IPBlock: &networkingv1.IPBlock{CIDR: "10.0.1.0/24"}}},
+			}},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+		},
+	})
+	return resources, matcher.BuildNetworkPolicies(kubePolicies)
+}
+
+// benchmarkJobs builds the jobs on port 80 from the first sources pods to every pod: probing every pair of 10k
+// pods would take 100M jobs
+func benchmarkJobs(resources *Resources, sources int) []*Job {
+	var jobs []*Job
+	for _, podFrom := range resources.Pods[:sources] {
+		for _, podTo := range resources.Pods {
+			job := resources.newJob(podFrom, podTo, "")
+			job.ResolvedPort = 80
+			job.Protocol = v1.ProtocolTCP
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs
+}
+
+func BenchmarkEquivalenceClasses10kPods(b *testing.B) {
+	resources, policies := benchmarkResources(100, 100)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.ReportMetric(float64(len(resources.EquivalenceClasses(policies))), "classes")
+	}
+}
+
+func BenchmarkSimulatedJobRunner10kPods(b *testing.B) {
+	resources, policies := benchmarkResources(100, 100)
+	jobs := benchmarkJobs(resources, 20)
+	runner := &SimulatedJobRunner{Policies: policies}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		runner.RunJobs(jobs)
+	}
+}
+
+// BenchmarkSimulatedJobRunnerUncompressed10kPods is the baseline for BenchmarkSimulatedJobRunner10kPods: the same
+// jobs, each simulated separately
+func BenchmarkSimulatedJobRunnerUncompressed10kPods(b *testing.B) {
+	resources, policies := benchmarkResources(100, 100)
+	jobs := benchmarkJobs(resources, 20)
+	runner := &SimulatedJobRunner{Policies: policies}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, job := range jobs {
+			runner.RunJob(job)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package probe
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"sort"
+	"strings"
+)
+
+type GraphFormat string
+
+const (
+	GraphFormatDOT     GraphFormat = "dot"
+	GraphFormatMermaid GraphFormat = "mermaid"
+	GraphFormatJSON    GraphFormat = "json"
+)
+
+var AllGraphFormats = []GraphFormat{GraphFormatDOT, GraphFormatMermaid, GraphFormatJSON}
+
+// GraphNode is a pod -- or, for a graph aggregated by namespace, a namespace
+type GraphNode struct {
+	ID        string            `json:"id"`
+	Namespace string            `json:"namespace"`
+	Pod       string            `json:"pod,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+// GraphEdge is an allowed flow, labelled with the port/protocols it's allowed on, such as 'TCP/80'
+type GraphEdge struct {
+	From  string   `json:"from"`
+	To    string   `json:"to"`
+	Ports []string `json:"ports"`
+}
+
+// Graph is a connectivity graph: nodes and edges are kept sorted, so that its serializations are stable
+type Graph struct {
+	Nodes []*GraphNode `json:"nodes"`
+	Edges []*GraphEdge `json:"edges"`
+}
+
+// NewGraph builds a graph with a node for every pod, and an edge for every pair of pods with allowed
+// (combined ingress and egress) traffic on at least one port/protocol, from one or more probe tables
+func NewGraph(resources *Resources, tables ...*Table) *Graph {
+	graph := &Graph{Nodes: []*GraphNode{}}
+	for _, pod := range resources.Pods {
+		graph.Nodes = append(graph.Nodes, &GraphNode{
+			ID:        pod.PodString().String(),
+			Namespace: pod.Namespace,
+			Pod:       pod.Name,
+			Labels:    pod.Labels,
+		})
+	}
+	sort.Slice(graph.Nodes, func(i, j int) bool {
+		return graph.Nodes[i].ID < graph.Nodes[j].ID
+	})
+
+	ports := map[string]map[string]map[string]bool{}
+	for _, table := range tables {
+		for _, key := range table.Wrapped.Keys() {
+			for portKey, result := range table.Get(key.From, key.To).JobResults {
+				if result.Combined == ConnectivityAllowed {
+					addGraphEdgePort(ports, key.From, key.To, portKey)
+				}
+			}
+		}
+	}
+	graph.Edges = buildGraphEdges(ports)
+	return graph
+}
+
+func addGraphEdgePort(ports map[string]map[string]map[string]bool, from string, to string, port string) {
+	if _, ok := ports[from]; !ok {
+		ports[from] = map[string]map[string]bool{}
+	}
+	if _, ok := ports[from][to]; !ok {
+		ports[from][to] = map[string]bool{}
+	}
+	ports[from][to][port] = true
+}
+
+func buildGraphEdges(ports map[string]map[string]map[string]bool) []*GraphEdge {
+	edges := []*GraphEdge{}
+	for from, tos := range ports {
+		for to, portSet := range tos {
+			edges = append(edges, &GraphEdge{From: from, To: to, Ports: sortedSet(portSet)})
+		}
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].From != edges[j].From {
+			return edges[i].From < edges[j].From
+		}
+		return edges[i].To < edges[j].To
+	})
+	return edges
+}
+
+func sortedSet(set map[string]bool) []string {
+	var slice []string
+	for key := range set {
+		slice = append(slice, key)
+	}
+	sort.Strings(slice)
+	return slice
+}
+
+// AggregateByNamespace collapses pods into their namespaces: a namespace-to-namespace edge carries every
+// port/protocol allowed between any of their pods
+func (g *Graph) AggregateByNamespace() *Graph {
+	namespaceOf := map[string]string{}
+	namespaces := map[string]bool{}
+	for _, node := range g.Nodes {
+		namespaceOf[node.ID] = node.Namespace
+		namespaces[node.Namespace] = true
+	}
+
+	aggregated := &Graph{Nodes: []*GraphNode{}}
+	for _, ns := range sortedSet(namespaces) {
+		aggregated.Nodes = append(aggregated.Nodes, &GraphNode{ID: ns, Namespace: ns})
+	}
+	ports := map[string]map[string]map[string]bool{}
+	for _, edge := range g.Edges {
+		for _, port := range edge.Ports {
+			addGraphEdgePort(ports, namespaceOf[edge.From], namespaceOf[edge.To], port)
+		}
+	}
+	aggregated.Edges = buildGraphEdges(ports)
+	return aggregated
+}
+
+func (g *Graph) Render(format GraphFormat) (string, error) {
+	switch format {
+	case GraphFormatDOT:
+		return g.DOT(), nil
+	case GraphFormatMermaid:
+		return g.Mermaid(), nil
+	case GraphFormatJSON:
+		bytes, err := json.MarshalIndent(g, "", "  ")
+		if err != nil {
+			return "", errors.Wrapf(err, "unable to marshal graph to json")
+		}
+		return string(bytes), nil
+	default:
+		return "", errors.Errorf("invalid graph format '%s', expected one of %+v", format, AllGraphFormats)
+	}
+}
+
+// nodesByNamespace groups the nodes into namespaces, which are rendered as clusters
+func (g *Graph) nodesByNamespace() ([]string, map[string][]*GraphNode) {
+	grouped := map[string][]*GraphNode{}
+	for _, node := range g.Nodes {
+		grouped[node.Namespace] = append(grouped[node.Namespace], node)
+	}
+	var namespaces []string
+	for ns := range grouped {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+	return namespaces, grouped
+}
+
+func (g *Graph) isAggregated() bool {
+	for _, node := range g.Nodes {
+		if node.Pod != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func (g *Graph) DOT() string {
+	lines := []string{"digraph connectivity {", "  rankdir=LR;", "  node [shape=box];"}
+	if g.isAggregated() {
+		for _, node := range g.Nodes {
+			lines = append(lines, fmt.Sprintf("  %q;", node.ID))
+		}
+	} else {
+		namespaces, grouped := g.nodesByNamespace()
+		for i, ns := range namespaces {
+			lines = append(lines, fmt.Sprintf("  subgraph cluster_%d {", i), fmt.Sprintf("    label=%q;", ns))
+			for _, node := range grouped[ns] {
+				lines = append(lines, fmt.Sprintf("    %q [label=%q];", node.ID, node.Pod))
+			}
+			lines = append(lines, "  }")
+		}
+	}
+	for _, edge := range g.Edges {
+		lines = append(lines, fmt.Sprintf("  %q -> %q [label=%q];", edge.From, edge.To, strings.Join(edge.Ports, ", ")))
+	}
+	return strings.Join(append(lines, "}"), "\n") + "\n"
+}
+
+func (g *Graph) Mermaid() string {
+	// mermaid ids can't contain '/', so nodes are numbered
+	ids := map[string]string{}
+	for i, node := range g.Nodes {
+		ids[node.ID] = fmt.Sprintf("n%d", i)
+	}
+
+	lines := []string{"flowchart LR"}
+	if g.isAggregated() {
+		for _, node := range g.Nodes {
+			lines = append(lines, fmt.Sprintf("  %s[\"%s\"]", ids[node.ID], node.ID))
+		}
+	} else {
+		namespaces, grouped := g.nodesByNamespace()
+		for i, ns := range namespaces {
+			lines = append(lines, fmt.Sprintf("  subgraph ns%d[\"%s\"]", i, ns))
+			for _, node := range grouped[ns] {
+				lines = append(lines, fmt.Sprintf("    %s[\"%s\"]", ids[node.ID], node.Pod))
+			}
+			lines = append(lines, "  end")
+		}
+	}
+	for _, edge := range g.Edges {
+		lines = append(lines, fmt.Sprintf("  %s -->|\"%s\"| %s", ids[edge.From], strings.Join(edge.Ports, ", "), ids[edge.To]))
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
@@ -0,0 +1,75 @@
+package probe
+
+import (
+	"github.com/mattfenwick/cyclonus/pkg/kube/netpol"
+	"github.com/mattfenwick/cyclonus/pkg/matcher"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func RunGraphTests() {
+	Describe("Graph", func() {
+		resources := &Resources{
+			Namespaces: map[string]map[string]string{
+				"x": {"ns": "x"},
+				"y": {"ns": "y"},
+			},
+			Pods: []*Pod{
+				NewPod("x", "a", map[string]string{"pod": "a"}, "1.2.3.4", []*Container{NewDefaultContainer(80, v1.ProtocolTCP, false)}),
+				NewPod("y", "b", map[string]string{"pod": "b"}, "1.2.3.5", []*Container{NewDefaultContainer(80, v1.ProtocolTCP, false)}),
+			},
+		}
+		denyAll := netpol.AllowNoIngress.DeepCopy()
+		denyAll.Namespace = "x"
+		policy := matcher.BuildNetworkPolicies([]*networkingv1.NetworkPolicy{denyAll})
+		table := NewSimulatedRunner(policy).RunProbeFixedPortProtocol(resources, intstr.FromInt(80), v1.ProtocolTCP)
+
+		It("Should have an edge for each allowed pod pair", func() {
+			graph := NewGraph(resources, table)
+			Expect(graph.Nodes).To(HaveLen(2))
+			Expect(graph.Edges).To(Equal([]*GraphEdge{
+				{From: "x/a", To: "y/b", Ports: []string{"TCP/80"}},
+				{From: "y/b", To: "y/b", Ports: []string{"TCP/80"}},
+			}))
+		})
+
+		It("Should aggregate by namespace", func() {
+			graph := NewGraph(resources, table).AggregateByNamespace()
+			Expect(graph.Nodes).To(Equal([]*GraphNode{{ID: "x", Namespace: "x"}, {ID: "y", Namespace: "y"}}))
+			Expect(graph.Edges).To(HaveLen(2))
+		})
+
+		It("Should flatten the table into sorted results", func() {
+			results := table.Results()
+			Expect(results).To(HaveLen(4))
+			Expect(results[0].From).To(Equal("x/a"))
+			Expect(results[0].To).To(Equal("x/a"))
+			Expect(results[0].PortProtocol).To(Equal("TCP/80"))
+			Expect(results[0].Combined).To(Equal(ConnectivityBlocked))
+			Expect(*results[0].Egress).To(Equal(ConnectivityAllowed))
+		})
+
+		It("Should render DOT, Mermaid and JSON", func() {
+			graph := NewGraph(resources, table)
+
+			dot, err := graph.Render(GraphFormatDOT)
+			Expect(err).To(BeNil())
+			Expect(dot).To(ContainSubstring(`"x/a" -> "y/b" [label="TCP/80"];`))
+			Expect(dot).To(ContainSubstring(`label="x";`))
+
+			mermaid, err := graph.Render(GraphFormatMermaid)
+			Expect(err).To(BeNil())
+			Expect(mermaid).To(ContainSubstring(`n0 -->|"TCP/80"| n1`))
+
+			json, err := graph.Render(GraphFormatJSON)
+			Expect(err).To(BeNil())
+			Expect(json).To(ContainSubstring(`"from": "x/a"`))
+
+			_, err = graph.Render("svg")
+			Expect(err).ToNot(BeNil())
+		})
+	})
+}
@@ -5,6 +5,8 @@ import (
 	"github.com/mattfenwick/cyclonus/pkg/matcher"
 	"github.com/pkg/errors"
 	v1 "k8s.io/api/core/v1"
+	"net"
+	"strconv"
 )
 
 type Jobs struct {
@@ -20,7 +22,15 @@ type JobResult struct {
 	Combined Connectivity
 }
 
+// Key identifies a result within a table cell: its port/protocol, and its IP family on dual-stack clusters
 func (jr *JobResult) Key() string {
+	if jr.Job.IPFamily == "" {
+		return jr.PortProtocolKey()
+	}
+	return fmt.Sprintf("%s/%s", jr.PortProtocolKey(), jr.Job.IPFamily)
+}
+
+func (jr *JobResult) PortProtocolKey() string {
 	return fmt.Sprintf("%s/%d", jr.Job.Protocol, jr.Job.ResolvedPort)
 }
 
@@ -40,18 +50,26 @@ type Job struct {
 	ToPodLabels       map[string]string
 	ToContainer       string
 	ToIP              string
+	ToContainerPorts  []*matcher.ContainerPort
 
 	ResolvedPort     int
 	ResolvedPortName string
 	Protocol         v1.Protocol
+
+	// IPFamily is set on dual-stack clusters, where pods are probed once per family
+	IPFamily v1.IPFamily
 }
 
 func (j *Job) Key() string {
-	return fmt.Sprintf("%s/%s/%s/%s/%s/%d", j.FromKey, j.FromContainer, j.ToKey, j.ToContainer, j.Protocol, j.ResolvedPort)
+	key := fmt.Sprintf("%s/%s/%s/%s/%s/%d", j.FromKey, j.FromContainer, j.ToKey, j.ToContainer, j.Protocol, j.ResolvedPort)
+	if j.IPFamily != "" {
+		key = fmt.Sprintf("%s/%s", key, j.IPFamily)
+	}
+	return key
 }
 
 func (j *Job) ToAddress() string {
-	return fmt.Sprintf("%s:%d", j.ToHost, j.ResolvedPort)
+	return net.JoinHostPort(j.ToHost, strconv.Itoa(j.ResolvedPort))
 }
 
 func (j *Job) ClientCommand() []string {
@@ -93,6 +111,7 @@ func (j *Job) Traffic() *matcher.Traffic {
 				PodLabels:       j.ToPodLabels,
 				NamespaceLabels: j.ToNamespaceLabels,
 				Namespace:       j.ToNamespace,
+				ContainerPorts:  j.ToContainerPorts,
 			},
 			IP: j.ToIP,
 		},
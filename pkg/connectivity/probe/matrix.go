@@ -0,0 +1,222 @@
+package probe
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"sort"
+	"strings"
+)
+
+// Reachability summarizes the connectivity from one group of pods to another, on a single port/protocol
+type Reachability string
+
+const (
+	ReachabilityFull    Reachability = "full"
+	ReachabilityPartial Reachability = "partial"
+	ReachabilityNone    Reachability = "none"
+)
+
+// MatrixGroupNone is the group of the pods which don't have the label that a matrix is grouped by
+const MatrixGroupNone = "<none>"
+
+// MatrixCell counts the pairs of pods, from one group to another, which are allowed on a port/protocol.  Pairs
+// whose connectivity wasn't determined -- such as those to pods which don't serve the port -- aren't counted.
+type MatrixCell struct {
+	From         string       `json:"from"`
+	To           string       `json:"to"`
+	PortProtocol string       `json:"portProtocol"`
+	Allowed      int          `json:"allowed"`
+	Total        int          `json:"total"`
+	Reachability Reachability `json:"reachability"`
+}
+
+// ShortString follows the probe tables: '.' if every pair is allowed, 'X' if none are, and the fraction of
+// allowed pairs otherwise
+func (c *MatrixCell) ShortString() string {
+	switch c.Reachability {
+	case ReachabilityFull:
+		return "."
+	case ReachabilityNone:
+		return "X"
+	default:
+		return fmt.Sprintf("%d/%d", c.Allowed, c.Total)
+	}
+}
+
+// ReachabilityMatrix aggregates probe tables by groups of pods -- namespaces, or the values of a pod label -- for
+// clusters with too many pods to read a pod-by-pod table
+type ReachabilityMatrix struct {
+	// GroupBy is the pod label that pods are grouped by; if it's empty, pods are grouped by namespace
+	GroupBy       string
+	Groups        []string
+	PortProtocols []string
+
+	groupPods map[string][]string
+	// cells is keyed by port/protocol, then from group, then to group
+	cells  map[string]map[string]map[string]*MatrixCell
+	tables []*Table
+}
+
+// NewReachabilityMatrix groups the pods of resources by namespace -- or, if groupBy isn't empty, by the value of
+// that pod label -- and counts the allowed (combined ingress and egress) pairs of pods between each pair of
+// groups, for each port/protocol of one or more probe tables
+func NewReachabilityMatrix(resources *Resources, groupBy string, tables ...*Table) *ReachabilityMatrix {
+	matrix := &ReachabilityMatrix{
+		GroupBy:   groupBy,
+		groupPods: map[string][]string{},
+		cells:     map[string]map[string]map[string]*MatrixCell{},
+		tables:    tables,
+	}
+	groupOf := map[string]string{}
+	for _, pod := range resources.Pods {
+		group := pod.Namespace
+		if groupBy != "" {
+			value, ok := pod.Labels[groupBy]
+			if !ok {
+				value = MatrixGroupNone
+			}
+			group = value
+		}
+		podString := pod.PodString().String()
+		groupOf[podString] = group
+		matrix.groupPods[group] = append(matrix.groupPods[group], podString)
+	}
+	for group, pods := range matrix.groupPods {
+		sort.Strings(pods)
+		matrix.Groups = append(matrix.Groups, group)
+	}
+	sort.Strings(matrix.Groups)
+
+	for _, table := range tables {
+		for _, key := range table.Wrapped.Keys() {
+			for portProtocol, result := range table.Get(key.From, key.To).JobResults {
+				if result.Combined != ConnectivityAllowed && result.Combined != ConnectivityBlocked {
+					continue
+				}
+				cell := matrix.getOrCreateCell(portProtocol, groupOf[key.From], groupOf[key.To])
+				cell.Total++
+				if result.Combined == ConnectivityAllowed {
+					cell.Allowed++
+				}
+			}
+		}
+	}
+	for portProtocol, froms := range matrix.cells {
+		matrix.PortProtocols = append(matrix.PortProtocols, portProtocol)
+		for _, tos := range froms {
+			for _, cell := range tos {
+				switch cell.Allowed {
+				case cell.Total:
+					cell.Reachability = ReachabilityFull
+				case 0:
+					cell.Reachability = ReachabilityNone
+				default:
+					cell.Reachability = ReachabilityPartial
+				}
+			}
+		}
+	}
+	sort.Strings(matrix.PortProtocols)
+	return matrix
+}
+
+func (m *ReachabilityMatrix) getOrCreateCell(portProtocol string, from string, to string) *MatrixCell {
+	if _, ok := m.cells[portProtocol]; !ok {
+		m.cells[portProtocol] = map[string]map[string]*MatrixCell{}
+	}
+	if _, ok := m.cells[portProtocol][from]; !ok {
+		m.cells[portProtocol][from] = map[string]*MatrixCell{}
+	}
+	cell, ok := m.cells[portProtocol][from][to]
+	if !ok {
+		cell = &MatrixCell{From: from, To: to, PortProtocol: portProtocol}
+		m.cells[portProtocol][from][to] = cell
+	}
+	return cell
+}
+
+// Cell returns the cell from one group to another on a port/protocol, or nil if no pairs of their pods were counted
+func (m *ReachabilityMatrix) Cell(from string, to string, portProtocol string) *MatrixCell {
+	return m.cells[portProtocol][from][to]
+}
+
+// Cells returns every cell, sorted by port/protocol, from and to
+func (m *ReachabilityMatrix) Cells() []*MatrixCell {
+	cells := []*MatrixCell{}
+	for _, portProtocol := range m.PortProtocols {
+		for _, from := range m.Groups {
+			for _, to := range m.Groups {
+				if cell := m.Cell(from, to, portProtocol); cell != nil {
+					cells = append(cells, cell)
+				}
+			}
+		}
+	}
+	return cells
+}
+
+// PartialCells returns the cells in which some, but not all, pairs of pods are allowed: these are the ones worth
+// drilling down into
+func (m *ReachabilityMatrix) PartialCells() []*MatrixCell {
+	var cells []*MatrixCell
+	for _, cell := range m.Cells() {
+		if cell.Reachability == ReachabilityPartial {
+			cells = append(cells, cell)
+		}
+	}
+	return cells
+}
+
+// DrillDown builds the pod-by-pod table of a cell: the results from the pods of one group to those of another,
+// for every port/protocol
+func (m *ReachabilityMatrix) DrillDown(from string, to string) (*Table, error) {
+	froms, ok := m.groupPods[from]
+	if !ok {
+		return nil, errors.Errorf("unable to drill down: group %s not found", from)
+	}
+	tos, ok := m.groupPods[to]
+	if !ok {
+		return nil, errors.Errorf("unable to drill down: group %s not found", to)
+	}
+	return &Table{Wrapped: NewTruthTable(froms, tos, func(fr, to string) interface{} {
+		item := &Item{From: fr, To: to, JobResults: map[string]*JobResult{}}
+		for _, table := range m.tables {
+			for portProtocol, result := range table.Get(fr, to).JobResults {
+				item.JobResults[portProtocol] = result
+			}
+		}
+		return item
+	})}, nil
+}
+
+// RenderTable renders a group-by-group table for each port/protocol.  A cell is '.' if every pair of pods is
+// allowed, 'X' if none are, the fraction of allowed pairs otherwise, and '-' if no pairs were counted.
+func (m *ReachabilityMatrix) RenderTable() string {
+	schema := m.GroupBy
+	if schema == "" {
+		schema = "namespace"
+	}
+	var tables []string
+	for _, portProtocol := range m.PortProtocols {
+		truthTable := NewTruthTableFromItems(m.Groups, nil)
+		tables = append(tables, fmt.Sprintf("%s:\n%s", portProtocol, truthTable.Table(schema, false, func(fr, to string, i interface{}) string {
+			cell := m.Cell(fr, to, portProtocol)
+			if cell == nil {
+				return "-"
+			}
+			return cell.ShortString()
+		})))
+	}
+	return strings.Join(tables, "\n")
+}
+
+// ReachabilityMatrixReport is the structured form of a ReachabilityMatrix
+type ReachabilityMatrixReport struct {
+	GroupBy string        `json:"groupBy,omitempty"`
+	Groups  []string      `json:"groups"`
+	Cells   []*MatrixCell `json:"cells"`
+}
+
+func (m *ReachabilityMatrix) Report() *ReachabilityMatrixReport {
+	return &ReachabilityMatrixReport{GroupBy: m.GroupBy, Groups: m.Groups, Cells: m.Cells()}
+}
@@ -0,0 +1,84 @@
+package probe
+
+import (
+	"github.com/mattfenwick/cyclonus/pkg/kube/netpol"
+	"github.com/mattfenwick/cyclonus/pkg/matcher"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func RunMatrixTests() {
+	Describe("ReachabilityMatrix", func() {
+		resources := &Resources{
+			Namespaces: map[string]map[string]string{
+				"x": {"ns": "x"},
+				"y": {"ns": "y"},
+			},
+			Pods: []*Pod{
+				NewPod("x", "a", map[string]string{"app": "web"}, "1.2.3.4", []*Container{NewDefaultContainer(80, v1.ProtocolTCP, false)}),
+				NewPod("x", "b", map[string]string{"app": "db"}, "1.2.3.5", []*Container{NewDefaultContainer(80, v1.ProtocolTCP, false)}),
+				NewPod("y", "c", map[string]string{"app": "web"}, "1.2.3.6", []*Container{NewDefaultContainer(80, v1.ProtocolTCP, false)}),
+				NewPod("y", "d", map[string]string{}, "1.2.3.7", []*Container{NewDefaultContainer(81, v1.ProtocolTCP, false)}),
+			},
+		}
+		denyDB := &networkingv1.NetworkPolicy{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "x", Name: "deny-db"},
+			Spec: networkingv1.NetworkPolicySpec{
+				PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "db"}},
+				PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			},
+		}
+		denyAll := netpol.AllowNoIngress.DeepCopy()
+		denyAll.Namespace = "y"
+		policy := matcher.BuildNetworkPolicies([]*networkingv1.NetworkPolicy{denyDB, denyAll})
+		table := NewSimulatedRunner(policy).RunProbeFixedPortProtocol(resources, intstr.FromInt(80), v1.ProtocolTCP)
+
+		It("Should group pods by namespace", func() {
+			matrix := NewReachabilityMatrix(resources, "", table)
+			Expect(matrix.Groups).To(Equal([]string{"x", "y"}))
+			Expect(matrix.PortProtocols).To(Equal([]string{"TCP/80"}))
+			Expect(matrix.Cells()).To(Equal([]*MatrixCell{
+				{From: "x", To: "x", PortProtocol: "TCP/80", Allowed: 2, Total: 4, Reachability: ReachabilityPartial},
+				{From: "x", To: "y", PortProtocol: "TCP/80", Allowed: 0, Total: 2, Reachability: ReachabilityNone},
+				{From: "y", To: "x", PortProtocol: "TCP/80", Allowed: 2, Total: 4, Reachability: ReachabilityPartial},
+				{From: "y", To: "y", PortProtocol: "TCP/80", Allowed: 0, Total: 2, Reachability: ReachabilityNone},
+			}))
+		})
+
+		It("Should group pods by label, with a group for pods without it", func() {
+			matrix := NewReachabilityMatrix(resources, "app", table)
+			Expect(matrix.Groups).To(Equal([]string{MatrixGroupNone, "db", "web"}))
+			Expect(matrix.Cell("web", "web", "TCP/80")).To(Equal(&MatrixCell{From: "web", To: "web", PortProtocol: "TCP/80", Allowed: 2, Total: 4, Reachability: ReachabilityPartial}))
+			Expect(matrix.Cell(MatrixGroupNone, "db", "TCP/80").Reachability).To(Equal(ReachabilityNone))
+			Expect(matrix.Cell("<none>", "web", "TCP/80").Allowed).To(Equal(1))
+			// d doesn't serve port 80, so no pairs to it are counted
+			Expect(matrix.Cell("web", MatrixGroupNone, "TCP/80")).To(BeNil())
+		})
+
+		It("Should find partial cells, and drill down into them", func() {
+			matrix := NewReachabilityMatrix(resources, "", table)
+			Expect(matrix.PartialCells()).To(HaveLen(2))
+
+			drillDown, err := matrix.DrillDown("y", "x")
+			Expect(err).To(BeNil())
+			Expect(drillDown.Wrapped.Froms).To(Equal([]string{"y/c", "y/d"}))
+			Expect(drillDown.Wrapped.Tos).To(Equal([]string{"x/a", "x/b"}))
+			Expect(drillDown.Get("y/c", "x/a").JobResults["TCP/80"].Combined).To(Equal(ConnectivityAllowed))
+			Expect(drillDown.Get("y/c", "x/b").JobResults["TCP/80"].Combined).To(Equal(ConnectivityBlocked))
+
+			_, err = matrix.DrillDown("y", "z")
+			Expect(err).ToNot(BeNil())
+		})
+
+		It("Should render a table per port/protocol", func() {
+			rendered := NewReachabilityMatrix(resources, "app", table).RenderTable()
+			Expect(rendered).To(HavePrefix("TCP/80:\n"))
+			Expect(rendered).To(MatchRegexp(`\| *web *\| *- *\| *X *\| *2/4 *\|`))
+			Expect(rendered).To(MatchRegexp(`\| *<none> *\| *- *\|`))
+		})
+	})
+}
@@ -2,6 +2,8 @@ package probe
 
 import (
 	"fmt"
+	"github.com/mattfenwick/cyclonus/pkg/kube"
+	"github.com/mattfenwick/cyclonus/pkg/matcher"
 	"github.com/pkg/errors"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -23,6 +25,28 @@ func NewPod(ns string, name string, labels map[string]string, ip string, contain
 	}
 }
 
+// NewPodFromKube builds a pod from an existing kube pod, with a container for each declared container port
+func NewPodFromKube(kubePod *v1.Pod) *Pod {
+	var containers []*Container
+	for _, kubeContainer := range kubePod.Spec.Containers {
+		for _, port := range kubeContainer.Ports {
+			protocol := port.Protocol
+			if protocol == "" {
+				protocol = v1.ProtocolTCP
+			}
+			containers = append(containers, &Container{
+				Name:     kubeContainer.Name,
+				Port:     int(port.ContainerPort),
+				Protocol: protocol,
+				PortName: port.Name,
+			})
+		}
+	}
+	pod := NewPod(kubePod.Namespace, kubePod.Name, kubePod.Labels, kubePod.Status.PodIP, containers)
+	pod.IPs = kube.GetPodIPs(kubePod.Status)
+	return pod
+}
+
 func NewDefaultPod(ns string, name string, ports []int, protocols []v1.Protocol, batchJobs bool) *Pod {
 	var containers []*Container
 	for _, port := range ports {
@@ -40,17 +64,61 @@ func NewDefaultPod(ns string, name string, ports []int, protocols []v1.Protocol,
 }
 
 type Pod struct {
-	Namespace  string
-	Name       string
-	Labels     map[string]string
-	IP         string
+	Namespace string
+	Name      string
+	Labels    map[string]string
+	// IP is the primary IP
+	IP string
+	// IPs holds every IP, one per family on a dual-stack cluster; it's empty if only IP is known
+	IPs        []string
 	Containers []*Container
 }
 
+// AllIPs returns every IP of the pod, falling back to the primary IP
+func (p *Pod) AllIPs() []string {
+	if len(p.IPs) > 0 {
+		return p.IPs
+	}
+	if p.IP != "" {
+		return []string{p.IP}
+	}
+	return nil
+}
+
+// IPForFamily returns the pod's IP of a family, or "" if it has none
+func (p *Pod) IPForFamily(family v1.IPFamily) string {
+	for _, ip := range p.AllIPs() {
+		if kube.GetIPFamily(ip) == family {
+			return ip
+		}
+	}
+	return ""
+}
+
+// IPFamilies returns the families of the pod's IPs, in the order of kube.IPFamilies
+func (p *Pod) IPFamilies() []v1.IPFamily {
+	var families []v1.IPFamily
+	for _, family := range kube.IPFamilies {
+		if p.IPForFamily(family) != "" {
+			families = append(families, family)
+		}
+	}
+	return families
+}
+
 func (p *Pod) ServiceName() string {
 	return fmt.Sprintf("s-%s-%s", p.Namespace, p.Name)
 }
 
+// ClientContainerName is the container which probes are sent from; pods read from a cluster or from manifests
+// may have no containers with ports, in which case it's empty
+func (p *Pod) ClientContainerName() string {
+	if len(p.Containers) == 0 {
+		return ""
+	}
+	return p.Containers[0].Name
+}
+
 func (p *Pod) KubePod() *v1.Pod {
 	zero := int64(0)
 	return &v1.Pod{
@@ -110,6 +178,19 @@ func (p *Pod) ResolveNumberedPort(port int) (string, error) {
 	return "", errors.Errorf("unable to resolve numbered port %d on pod %s/%s", port, p.Namespace, p.Name)
 }
 
+// ContainerPorts builds the pod's container port table, against which named ports are resolved
+func (p *Pod) ContainerPorts() []*matcher.ContainerPort {
+	ports := []*matcher.ContainerPort{}
+	for _, c := range p.Containers {
+		ports = append(ports, &matcher.ContainerPort{
+			Name:     c.PortName,
+			Port:     c.Port,
+			Protocol: c.Protocol,
+		})
+	}
+	return ports
+}
+
 func (p *Pod) IsServingPortProtocol(port int, protocol v1.Protocol) bool {
 	for _, cont := range p.Containers {
 		if cont.Port == port && cont.Protocol == protocol {
@@ -125,6 +206,7 @@ func (p *Pod) SetLabels(labels map[string]string) *Pod {
 		Name:       p.Name,
 		Labels:     labels,
 		IP:         p.IP,
+		IPs:        p.IPs,
 		Containers: p.Containers,
 	}
 }
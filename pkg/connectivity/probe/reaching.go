@@ -0,0 +1,92 @@
+package probe
+
+import (
+	"github.com/mattfenwick/cyclonus/pkg/kube"
+	"github.com/mattfenwick/cyclonus/pkg/matcher"
+	"github.com/olekukonko/tablewriter"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sort"
+	"strings"
+)
+
+// ReachingPod is a pod which is allowed to send traffic to a destination pod, with the ports -- and IP families,
+// on a dual-stack cluster -- on which it's allowed
+type ReachingPod struct {
+	From  string   `json:"from"`
+	To    string   `json:"to"`
+	Ports []string `json:"ports"`
+}
+
+// PodsMatching returns the pods in a namespace whose labels include podLabels
+func (r *Resources) PodsMatching(namespace string, podLabels map[string]string) []*Pod {
+	var pods []*Pod
+	for _, pod := range r.Pods {
+		if pod.Namespace == namespace && kube.IsLabelsMatchLabelSelector(pod.Labels, metav1.LabelSelector{MatchLabels: podLabels}) {
+			pods = append(pods, pod)
+		}
+	}
+	return pods
+}
+
+// PodsReaching simulates traffic from every pod to each pod matching a namespace and labels, and returns the
+// pairs for which it's allowed -- taking both ingress and egress policies into account.  If port is nil, every
+// port served by the destination is tried.
+func (r *Resources) PodsReaching(policies *matcher.Policy, namespace string, podLabels map[string]string, port *intstr.IntOrString, protocol v1.Protocol) []*ReachingPod {
+	destinations := map[string]bool{}
+	for _, pod := range r.PodsMatching(namespace, podLabels) {
+		destinations[pod.PodString().String()] = true
+	}
+
+	var jobs *Jobs
+	if port == nil {
+		jobs = r.GetJobsAllAvailableServers()
+	} else {
+		jobs = r.GetJobsForNamedPortProtocol(*port, protocol)
+	}
+	var destinationJobs []*Job
+	for _, job := range jobs.Valid {
+		if destinations[job.ToKey] {
+			destinationJobs = append(destinationJobs, job)
+		}
+	}
+
+	reachingPods := map[string]*ReachingPod{}
+	for _, result := range (&SimulatedJobRunner{Policies: policies}).RunJobs(destinationJobs) {
+		if result.Combined != ConnectivityAllowed {
+			continue
+		}
+		key := result.Job.FromKey + " -> " + result.Job.ToKey
+		if _, ok := reachingPods[key]; !ok {
+			reachingPods[key] = &ReachingPod{From: result.Job.FromKey, To: result.Job.ToKey}
+		}
+		reachingPods[key].Ports = append(reachingPods[key].Ports, result.Key())
+	}
+
+	sorted := []*ReachingPod{}
+	for _, reachingPod := range reachingPods {
+		sort.Strings(reachingPod.Ports)
+		sorted = append(sorted, reachingPod)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].To != sorted[j].To {
+			return sorted[i].To < sorted[j].To
+		}
+		return sorted[i].From < sorted[j].From
+	})
+	return sorted
+}
+
+func ReachingPodsTable(reachingPods []*ReachingPod) string {
+	tableString := &strings.Builder{}
+	table := tablewriter.NewWriter(tableString)
+	table.SetAutoWrapText(false)
+	table.SetRowLine(true)
+	table.SetHeader([]string{"To", "From", "Ports"})
+	for _, reachingPod := range reachingPods {
+		table.Append([]string{reachingPod.To, reachingPod.From, strings.Join(reachingPod.Ports, "\n")})
+	}
+	table.Render()
+	return tableString.String()
+}
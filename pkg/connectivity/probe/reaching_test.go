@@ -0,0 +1,62 @@
+package probe
+
+import (
+	"github.com/mattfenwick/cyclonus/pkg/matcher"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func RunReachingTests() {
+	Describe("PodsReaching", func() {
+		resources := &Resources{
+			Namespaces: map[string]map[string]string{
+				"x": {"ns": "x"},
+				"y": {"ns": "y"},
+			},
+			Pods: []*Pod{
+				NewPod("x", "a", map[string]string{"pod": "a"}, "1.2.3.4", []*Container{NewDefaultContainer(80, v1.ProtocolTCP, false), NewDefaultContainer(81, v1.ProtocolTCP, false)}),
+				NewPod("y", "b", map[string]string{"pod": "b"}, "1.2.3.5", []*Container{NewDefaultContainer(80, v1.ProtocolTCP, false)}),
+				NewPod("y", "c", map[string]string{"pod": "c"}, "1.2.3.6", []*Container{NewDefaultContainer(80, v1.ProtocolTCP, false)}),
+			},
+		}
+		port80 := intstr.FromInt(80)
+		allowFromB := &networkingv1.NetworkPolicy{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "x", Name: "allow-from-b"},
+			Spec: networkingv1.NetworkPolicySpec{
+				PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"pod": "a"}},
+				Ingress: []networkingv1.NetworkPolicyIngressRule{{
+					Ports: []networkingv1.NetworkPolicyPort{{Port: &port80}},
+					From: []networkingv1.NetworkPolicyPeer{{
+						NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"ns": "y"}},
+						PodSelector:       &metav1.LabelSelector{},
+					}},
+				}},
+			},
+		}
+		denyEgressFromC := &networkingv1.NetworkPolicy{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "y", Name: "deny-egress-from-c"},
+			Spec: networkingv1.NetworkPolicySpec{
+				PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"pod": "c"}},
+				PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+			},
+		}
+		policy := matcher.BuildNetworkPolicies([]*networkingv1.NetworkPolicy{allowFromB, denyEgressFromC})
+
+		It("Should find the pods allowed on every served port, accounting for egress", func() {
+			Expect(resources.PodsReaching(policy, "x", map[string]string{"pod": "a"}, nil, "")).To(Equal([]*ReachingPod{
+				{From: "y/b", To: "x/a", Ports: []string{"TCP/80"}},
+			}))
+		})
+
+		It("Should find the pods allowed on a port", func() {
+			port81 := intstr.FromInt(81)
+			Expect(resources.PodsReaching(policy, "x", map[string]string{"pod": "a"}, &port80, v1.ProtocolTCP)).To(HaveLen(1))
+			Expect(resources.PodsReaching(policy, "x", map[string]string{"pod": "a"}, &port81, v1.ProtocolTCP)).To(BeEmpty())
+			Expect(resources.PodsReaching(policy, "y", map[string]string{}, &port80, v1.ProtocolTCP)).To(HaveLen(4))
+		})
+	})
+}
@@ -2,6 +2,7 @@ package probe
 
 import (
 	"github.com/mattfenwick/cyclonus/pkg/kube"
+	"github.com/mattfenwick/cyclonus/pkg/matcher"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	v1 "k8s.io/api/core/v1"
@@ -44,6 +45,88 @@ func NewDefaultResources(kubernetes *kube.Kubernetes, namespaces []string, podNa
 	return r, nil
 }
 
+// NewResourcesFromKube reads the namespaces and pods that already exist in a cluster, without creating anything;
+// an empty namespace list, or v1.NamespaceAll, reads every namespace.
+func NewResourcesFromKube(kubernetes *kube.Kubernetes, namespaces []string) (*Resources, error) {
+	r := &Resources{Namespaces: map[string]map[string]string{}}
+
+	if len(namespaces) == 0 || (len(namespaces) == 1 && namespaces[0] == v1.NamespaceAll) {
+		kubeNamespaces, err := kubernetes.GetAllNamespaces()
+		if err != nil {
+			return nil, err
+		}
+		namespaces = nil
+		for _, ns := range kubeNamespaces {
+			namespaces = append(namespaces, ns.Name)
+			r.Namespaces[ns.Name] = ns.Labels
+		}
+	} else {
+		for _, ns := range namespaces {
+			kubeNamespace, err := kubernetes.GetNamespace(ns)
+			if err != nil {
+				return nil, err
+			}
+			r.Namespaces[ns] = kubeNamespace.Labels
+		}
+	}
+
+	podList, err := kubernetes.GetPodsInNamespaces(namespaces)
+	if err != nil {
+		return nil, err
+	}
+	for i := range podList {
+		r.Pods = append(r.Pods, NewPodFromKube(&podList[i]))
+	}
+	return r, nil
+}
+
+// namespaceNameLabel is set on every namespace by the API server
+const namespaceNameLabel = "kubernetes.io/metadata.name"
+
+// NewResourcesFromManifests derives namespaces and pods from rendered manifests, so that policies can be analyzed
+// before they're installed.  Each Deployment and StatefulSet contributes a single pod, named after it, with its pod
+// template's labels and container ports -- since its replicas are identical as far as policies are concerned.
+// Resources without a namespace are in the default namespace; namespaces which are used but not declared are
+// included, and every namespace has the label which the API server adds with its name.  Pods have no IP unless
+// one is in their status.
+func NewResourcesFromManifests(manifests *kube.Manifests) *Resources {
+	r := &Resources{Namespaces: map[string]map[string]string{}}
+	addNamespace := func(ns string, labels map[string]string) {
+		if _, ok := r.Namespaces[ns]; !ok {
+			r.Namespaces[ns] = map[string]string{namespaceNameLabel: ns}
+		}
+		for key, value := range labels {
+			r.Namespaces[ns][key] = value
+		}
+	}
+	addPod := func(kubePod *v1.Pod) {
+		pod := kubePod.DeepCopy()
+		if pod.Namespace == "" {
+			pod.Namespace = v1.NamespaceDefault
+		}
+		addNamespace(pod.Namespace, nil)
+		r.Pods = append(r.Pods, NewPodFromKube(pod))
+	}
+
+	for _, ns := range manifests.Namespaces {
+		addNamespace(ns.Name, ns.Labels)
+	}
+	for _, pod := range manifests.Pods {
+		addPod(pod)
+	}
+	for _, deployment := range manifests.Deployments {
+		addPod(&v1.Pod{ObjectMeta: podMetaFromTemplate(deployment.ObjectMeta, deployment.Spec.Template), Spec: deployment.Spec.Template.Spec})
+	}
+	for _, statefulSet := range manifests.StatefulSets {
+		addPod(&v1.Pod{ObjectMeta: podMetaFromTemplate(statefulSet.ObjectMeta, statefulSet.Spec.Template), Spec: statefulSet.Spec.Template.Spec})
+	}
+	return r
+}
+
+func podMetaFromTemplate(workload metav1.ObjectMeta, template v1.PodTemplateSpec) metav1.ObjectMeta {
+	return metav1.ObjectMeta{Namespace: workload.Namespace, Name: workload.Name, Labels: template.Labels}
+}
+
 func (r *Resources) waitForPodsReady(kubernetes *kube.Kubernetes, timeoutSeconds int) error {
 	sleep := 5
 	for i := 0; i < timeoutSeconds; i += sleep {
@@ -84,8 +167,9 @@ func (r *Resources) getPodIPsFromKube(kubernetes *kube.Kubernetes) error {
 			return errors.Errorf("unable to find pod %s/%s in resources", kubePod.Namespace, kubePod.Name)
 		}
 		pod.IP = kubePod.Status.PodIP
+		pod.IPs = kube.GetPodIPs(kubePod.Status)
 
-		logrus.Debugf("ip for pod %s/%s: %s", pod.Namespace, pod.Name, pod.IP)
+		logrus.Debugf("ips for pod %s/%s: %+v", pod.Namespace, pod.Name, pod.AllIPs())
 	}
 
 	return nil
@@ -370,53 +454,96 @@ func (r *Resources) ResetLabelsInKube(kubernetes *kube.Kubernetes) error {
 	return nil
 }
 
+// IsDualStack is true if any pod has IPs of more than one family, in which case jobs are built per family
+func (r *Resources) IsDualStack() bool {
+	for _, pod := range r.Pods {
+		if len(pod.IPFamilies()) > 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// jobIPFamilies returns the families over which a pair of pods are probed: "" -- the primary IPs -- for
+// single-stack clusters, and each family which both pods have for dual-stack clusters.  isDualStack is passed in,
+// rather than checked for each pair of pods, since checking it looks at every pod.
+func jobIPFamilies(isDualStack bool, podFrom *Pod, podTo *Pod) []v1.IPFamily {
+	if !isDualStack {
+		return []v1.IPFamily{""}
+	}
+	var families []v1.IPFamily
+	for _, family := range podFrom.IPFamilies() {
+		if podTo.IPForFamily(family) != "" {
+			families = append(families, family)
+		}
+	}
+	return families
+}
+
+// newJob builds a job from podFrom to podTo.  Jobs for a specific family are sent to the destination pod's IP of
+// that family, since the service's DNS name doesn't allow choosing a family.
+func (r *Resources) newJob(podFrom *Pod, podTo *Pod, family v1.IPFamily) *Job {
+	job := &Job{
+		FromKey:             podFrom.PodString().String(),
+		FromNamespace:       podFrom.Namespace,
+		FromNamespaceLabels: r.Namespaces[podFrom.Namespace],
+		FromPod:             podFrom.Name,
+		FromPodLabels:       podFrom.Labels,
+		FromContainer:       podFrom.ClientContainerName(),
+		FromIP:              podFrom.IP,
+		ToKey:               podTo.PodString().String(),
+		ToHost:              kube.QualifiedServiceAddress(podTo.ServiceName(), podTo.Namespace),
+		ToNamespace:         podTo.Namespace,
+		ToNamespaceLabels:   r.Namespaces[podTo.Namespace],
+		ToPodLabels:         podTo.Labels,
+		ToIP:                podTo.IP,
+		ToContainerPorts:    podTo.ContainerPorts(),
+		IPFamily:            family,
+	}
+	if family != "" {
+		job.FromIP = podFrom.IPForFamily(family)
+		job.ToIP = podTo.IPForFamily(family)
+		job.ToHost = job.ToIP
+	}
+	return job
+}
+
 func (r *Resources) GetJobsForNamedPortProtocol(port intstr.IntOrString, protocol v1.Protocol) *Jobs {
 	jobs := &Jobs{}
+	isDualStack := r.IsDualStack()
 	for _, podFrom := range r.Pods {
 		for _, podTo := range r.Pods {
-			job := &Job{
-				FromKey:             podFrom.PodString().String(),
-				FromNamespace:       podFrom.Namespace,
-				FromNamespaceLabels: r.Namespaces[podFrom.Namespace],
-				FromPod:             podFrom.Name,
-				FromPodLabels:       podFrom.Labels,
-				FromContainer:       podFrom.Containers[0].Name,
-				FromIP:              podFrom.IP,
-				ToKey:               podTo.PodString().String(),
-				ToHost:              kube.QualifiedServiceAddress(podTo.ServiceName(), podTo.Namespace),
-				ToNamespace:         podTo.Namespace,
-				ToNamespaceLabels:   r.Namespaces[podTo.Namespace],
-				ToPodLabels:         podTo.Labels,
-				ToIP:                podTo.IP,
-				ResolvedPort:        -1,
-				ResolvedPortName:    "",
-				Protocol:            protocol,
-			}
-
-			switch port.Type {
-			case intstr.String:
-				job.ResolvedPortName = port.StrVal
-				// TODO what about protocol?
-				portInt, err := podTo.ResolveNamedPort(port.StrVal)
-				if err != nil {
-					jobs.BadNamedPort = append(jobs.BadNamedPort, job)
-					continue
-				}
-				job.ResolvedPort = portInt
-			case intstr.Int:
-				job.ResolvedPort = int(port.IntVal)
-				// TODO what about protocol?
-				portName, err := podTo.ResolveNumberedPort(int(port.IntVal))
-				if err != nil {
-					jobs.BadPortProtocol = append(jobs.BadPortProtocol, job)
-					continue
+			for _, family := range jobIPFamilies(isDualStack, podFrom, podTo) {
+				job := r.newJob(podFrom, podTo, family)
+				job.ResolvedPort = matcher.UnresolvedPort
+				job.ResolvedPortName = ""
+				job.Protocol = protocol
+
+				switch port.Type {
+				case intstr.String:
+					job.ResolvedPortName = port.StrVal
+					// TODO what about protocol?
+					portInt, err := podTo.ResolveNamedPort(port.StrVal)
+					if err != nil {
+						jobs.BadNamedPort = append(jobs.BadNamedPort, job)
+						continue
+					}
+					job.ResolvedPort = portInt
+				case intstr.Int:
+					job.ResolvedPort = int(port.IntVal)
+					// TODO what about protocol?
+					portName, err := podTo.ResolveNumberedPort(int(port.IntVal))
+					if err != nil {
+						jobs.BadPortProtocol = append(jobs.BadPortProtocol, job)
+						continue
+					}
+					job.ResolvedPortName = portName
+				default:
+					panic(errors.Errorf("invalid IntOrString value %+v", port))
 				}
-				job.ResolvedPortName = portName
-			default:
-				panic(errors.Errorf("invalid IntOrString value %+v", port))
-			}
 
-			jobs.Valid = append(jobs.Valid, job)
+				jobs.Valid = append(jobs.Valid, job)
+			}
 		}
 	}
 	return jobs
@@ -424,28 +551,18 @@ func (r *Resources) GetJobsForNamedPortProtocol(port intstr.IntOrString, protoco
 
 func (r *Resources) GetJobsAllAvailableServers() *Jobs {
 	var jobs []*Job
+	isDualStack := r.IsDualStack()
 	for _, podFrom := range r.Pods {
 		for _, podTo := range r.Pods {
-			for _, contTo := range podTo.Containers {
-				jobs = append(jobs, &Job{
-					FromKey:             podFrom.PodString().String(),
-					FromNamespace:       podFrom.Namespace,
-					FromNamespaceLabels: r.Namespaces[podFrom.Namespace],
-					FromPod:             podFrom.Name,
-					FromPodLabels:       podFrom.Labels,
-					FromContainer:       podFrom.Containers[0].Name,
-					FromIP:              podFrom.IP,
-					ToKey:               podTo.PodString().String(),
-					ToHost:              kube.QualifiedServiceAddress(podTo.ServiceName(), podTo.Namespace),
-					ToNamespace:         podTo.Namespace,
-					ToNamespaceLabels:   r.Namespaces[podTo.Namespace],
-					ToPodLabels:         podTo.Labels,
-					ToContainer:         contTo.Name,
-					ToIP:                podTo.IP,
-					ResolvedPort:        contTo.Port,
-					ResolvedPortName:    contTo.PortName,
-					Protocol:            contTo.Protocol,
-				})
+			for _, family := range jobIPFamilies(isDualStack, podFrom, podTo) {
+				for _, contTo := range podTo.Containers {
+					job := r.newJob(podFrom, podTo, family)
+					job.ToContainer = contTo.Name
+					job.ResolvedPort = contTo.Port
+					job.ResolvedPortName = contTo.PortName
+					job.Protocol = contTo.Protocol
+					jobs = append(jobs, job)
+				}
 			}
 		}
 	}
@@ -1,12 +1,133 @@
 package probe
 
 import (
+	"github.com/mattfenwick/cyclonus/pkg/kube"
+	"github.com/mattfenwick/cyclonus/pkg/matcher"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 func RunResourcesTests() {
 	Describe("Resources", func() {
+		It("Should build a pod from a kube pod's container ports", func() {
+			pod := NewPodFromKube(&v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "x", Name: "a", Labels: map[string]string{"pod": "a"}},
+				Spec: v1.PodSpec{Containers: []v1.Container{
+					{Name: "web", Ports: []v1.ContainerPort{{Name: "http", ContainerPort: 80}}},
+					{Name: "dns", Ports: []v1.ContainerPort{{Name: "dns", ContainerPort: 53, Protocol: v1.ProtocolUDP}}},
+				}},
+				Status: v1.PodStatus{PodIP: "10.0.0.1"},
+			})
+
+			Expect(pod.IP).To(Equal("10.0.0.1"))
+			Expect(pod.Labels).To(Equal(map[string]string{"pod": "a"}))
+			Expect(pod.Containers).To(Equal([]*Container{
+				{Name: "web", Port: 80, Protocol: v1.ProtocolTCP, PortName: "http"},
+				{Name: "dns", Port: 53, Protocol: v1.ProtocolUDP, PortName: "dns"},
+			}))
+		})
+
+		It("Should read all of a dual-stack kube pod's IPs", func() {
+			pod := NewPodFromKube(&v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "x", Name: "a"},
+				Status: v1.PodStatus{
+					PodIP:  "10.0.0.1",
+					PodIPs: []v1.PodIP{{IP: "10.0.0.1"}, {IP: "fd00::1"}},
+				},
+			})
+
+			Expect(pod.IP).To(Equal("10.0.0.1"))
+			Expect(pod.AllIPs()).To(Equal([]string{"10.0.0.1", "fd00::1"}))
+			Expect(pod.IPFamilies()).To(Equal([]v1.IPFamily{v1.IPv4Protocol, v1.IPv6Protocol}))
+			Expect(pod.IPForFamily(v1.IPv6Protocol)).To(Equal("fd00::1"))
+		})
+
+		It("Should probe each IP family on a dual-stack cluster", func() {
+			a := NewPod("x", "a", map[string]string{"pod": "a"}, "10.0.0.1", []*Container{NewDefaultContainer(80, v1.ProtocolTCP, false)})
+			a.IPs = []string{"10.0.0.1", "fd00::1"}
+			b := NewPod("y", "b", map[string]string{"pod": "b"}, "10.0.0.2", []*Container{NewDefaultContainer(80, v1.ProtocolTCP, false)})
+			b.IPs = []string{"10.0.0.2", "fd00::2"}
+			resources := &Resources{
+				Namespaces: map[string]map[string]string{"x": {"ns": "x"}, "y": {"ns": "y"}},
+				Pods:       []*Pod{a, b},
+			}
+			Expect(resources.IsDualStack()).To(BeTrue())
+
+			jobs := resources.GetJobsForNamedPortProtocol(intstr.FromInt(80), v1.ProtocolTCP)
+			Expect(jobs.Valid).To(HaveLen(8))
+			Expect(jobs.Valid[1].IPFamily).To(Equal(v1.IPv6Protocol))
+			Expect(jobs.Valid[1].ToAddress()).To(Equal("[fd00::1]:80"))
+
+			allowV4 := &networkingv1.NetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "x", Name: "allow-v4"},
+				Spec: networkingv1.NetworkPolicySpec{
+					PodSelector: metav1.LabelSelector{},
+					Ingress:     []networkingv1.NetworkPolicyIngressRule{{From: []networkingv1.NetworkPolicyPeer{{IPBlock: &networkingv1.IPBlock{CIDR: "10.0.0.0/24"}}}}},
+				},
+			}
+			table := NewSimulatedRunner(matcher.BuildNetworkPolicies([]*networkingv1.NetworkPolicy{allowV4})).
+				RunProbeFixedPortProtocol(resources, intstr.FromInt(80), v1.ProtocolTCP)
+
+			results := table.Results()
+			Expect(results).To(HaveLen(8))
+			Expect(results[4].To).To(Equal("x/a"))
+			Expect(results[4].From).To(Equal("y/b"))
+			Expect(results[4].PortProtocol).To(Equal("TCP/80"))
+			Expect(results[4].IPFamily).To(Equal(v1.IPv4Protocol))
+			Expect(results[4].Combined).To(Equal(ConnectivityAllowed))
+			Expect(results[5].IPFamily).To(Equal(v1.IPv6Protocol))
+			Expect(results[5].Combined).To(Equal(ConnectivityBlocked))
+
+			rendered := table.RenderTable()
+			Expect(rendered).To(HavePrefix("IPv4:\n"))
+			Expect(rendered).To(ContainSubstring("\nIPv6:\n"))
+		})
+
+		It("Should leave named ports unresolved on pods which don't have them", func() {
+			a := NewPod("x", "a", map[string]string{"pod": "a"}, "10.0.0.1", []*Container{NewDefaultContainer(80, v1.ProtocolTCP, false)})
+			b := NewPod("x", "b", map[string]string{"pod": "b"}, "10.0.0.2", []*Container{NewDefaultContainer(81, v1.ProtocolTCP, false)})
+			resources := &Resources{Namespaces: map[string]map[string]string{"x": {"ns": "x"}}, Pods: []*Pod{a, b}}
+
+			jobs := resources.GetJobsForNamedPortProtocol(intstr.FromString("serve-80-tcp"), v1.ProtocolTCP)
+			Expect(jobs.Valid).To(HaveLen(2))
+			Expect(jobs.BadNamedPort).To(HaveLen(2))
+			Expect(jobs.BadNamedPort[0].ResolvedPort).To(Equal(matcher.UnresolvedPort))
+
+			// a job with just a port name is resolved against the destination's container ports
+			job := resources.newJob(b, a, "")
+			job.ResolvedPort, job.ResolvedPortName, job.Protocol = matcher.UnresolvedPort, "serve-80-tcp", v1.ProtocolTCP
+			port, portName := job.Traffic().ResolvePort()
+			Expect(port).To(Equal(80))
+			Expect(portName).To(Equal("serve-80-tcp"))
+		})
+
+		It("Should derive namespaces and pods from manifests", func() {
+			template := v1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "db"}},
+				Spec:       v1.PodSpec{Containers: []v1.Container{{Name: "db", Ports: []v1.ContainerPort{{Name: "sql", ContainerPort: 5432}}}}},
+			}
+			resources := NewResourcesFromManifests(&kube.Manifests{
+				Namespaces:   []*v1.Namespace{{ObjectMeta: metav1.ObjectMeta{Name: "x", Labels: map[string]string{"team": "a"}}}},
+				Pods:         []*v1.Pod{{ObjectMeta: metav1.ObjectMeta{Name: "a", Labels: map[string]string{"pod": "a"}}}},
+				StatefulSets: []*appsv1.StatefulSet{{ObjectMeta: metav1.ObjectMeta{Namespace: "x", Name: "db"}, Spec: appsv1.StatefulSetSpec{Template: template}}},
+			})
+
+			Expect(resources.Namespaces).To(Equal(map[string]map[string]string{
+				"x":       {"kubernetes.io/metadata.name": "x", "team": "a"},
+				"default": {"kubernetes.io/metadata.name": "default"},
+			}))
+			Expect(resources.Pods).To(HaveLen(2))
+			Expect(resources.Pods[0].PodString().String()).To(Equal("default/a"))
+			Expect(resources.Pods[1].PodString().String()).To(Equal("x/db"))
+			Expect(resources.Pods[1].Labels).To(Equal(map[string]string{"app": "db"}))
+			Expect(resources.Pods[1].Containers).To(Equal([]*Container{{Name: "db", Port: 5432, Protocol: v1.ProtocolTCP, PortName: "sql"}}))
+		})
+
 		It("Should add a namespace nondestructively", func() {
 			r := &Resources{
 				Namespaces: map[string]map[string]string{
@@ -10,5 +10,10 @@ import (
 func TestProbe(t *testing.T) {
 	RegisterFailHandler(Fail)
 	RunResourcesTests()
+	RunDiffTests()
+	RunGraphTests()
+	RunReachingTests()
+	RunMatrixTests()
+	RunEquivalenceTests()
 	RunSpecs(t, "generator suite")
 }
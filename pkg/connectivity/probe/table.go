@@ -1,8 +1,11 @@
 package probe
 
 import (
+	"fmt"
+	"github.com/mattfenwick/cyclonus/pkg/kube"
 	"github.com/mattfenwick/cyclonus/pkg/utils"
 	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
 	"sort"
 	"strings"
 )
@@ -55,6 +58,35 @@ func (t *Table) Get(from string, to string) *Item {
 	return t.Wrapped.Get(from, to).(*Item)
 }
 
+// TableResult is the structured form of a single cell of a Table, for a single port/protocol
+type TableResult struct {
+	From         string        `json:"from"`
+	To           string        `json:"to"`
+	PortProtocol string        `json:"portProtocol"`
+	IPFamily     v1.IPFamily   `json:"ipFamily,omitempty"`
+	Ingress      *Connectivity `json:"ingress,omitempty"`
+	Egress       *Connectivity `json:"egress,omitempty"`
+	Combined     Connectivity  `json:"combined"`
+}
+
+// Results flattens the table into a list, sorted by from, to and port/protocol
+func (t *Table) Results() []*TableResult {
+	results := []*TableResult{}
+	for _, key := range t.Wrapped.Keys() {
+		jobResults := t.Get(key.From, key.To).JobResults
+		var portProtocols []string
+		for k := range jobResults {
+			portProtocols = append(portProtocols, k)
+		}
+		sort.Strings(portProtocols)
+		for _, k := range portProtocols {
+			jr := jobResults[k]
+			results = append(results, &TableResult{From: key.From, To: key.To, PortProtocol: jr.PortProtocolKey(), IPFamily: jr.Job.IPFamily, Ingress: jr.Ingress, Egress: jr.Egress, Combined: jr.Combined})
+		}
+	}
+	return results
+}
+
 func (t *Table) RenderIngress() string {
 	return t.renderTableHelper(getIngress)
 }
@@ -67,7 +99,51 @@ func (t *Table) RenderTable() string {
 	return t.renderTableHelper(getCombined)
 }
 
+// IPFamilies returns the IP families of the table's results, which are only set on dual-stack clusters
+func (t *Table) IPFamilies() []v1.IPFamily {
+	found := map[v1.IPFamily]bool{}
+	for _, key := range t.Wrapped.Keys() {
+		for _, jr := range t.Get(key.From, key.To).JobResults {
+			found[jr.Job.IPFamily] = true
+		}
+	}
+	var families []v1.IPFamily
+	for _, family := range kube.IPFamilies {
+		if found[family] {
+			families = append(families, family)
+		}
+	}
+	return families
+}
+
+// ForIPFamily builds a table of just the results of a single IP family, keyed by port/protocol
+func (t *Table) ForIPFamily(family v1.IPFamily) *Table {
+	return &Table{Wrapped: NewTruthTable(t.Wrapped.Froms, t.Wrapped.Tos, func(fr, to string) interface{} {
+		item := &Item{From: fr, To: to, JobResults: map[string]*JobResult{}}
+		for _, jr := range t.Get(fr, to).JobResults {
+			if jr.Job.IPFamily == family {
+				item.JobResults[jr.PortProtocolKey()] = jr
+			}
+		}
+		return item
+	})}
+}
+
+// renderTableHelper renders a separate table per IP family on dual-stack clusters, so that v4 and v6
+// connectivity can be compared side by side
 func (t *Table) renderTableHelper(render func(*JobResult) string) string {
+	families := t.IPFamilies()
+	if len(families) == 0 {
+		return t.renderFamilyTableHelper(render)
+	}
+	var tables []string
+	for _, family := range families {
+		tables = append(tables, fmt.Sprintf("%s:\n%s", family, t.ForIPFamily(family).renderFamilyTableHelper(render)))
+	}
+	return strings.Join(tables, "\n")
+}
+
+func (t *Table) renderFamilyTableHelper(render func(*JobResult) string) string {
 	isSchemaUniform, isSingleElement := true, true
 	schema := map[string]bool{}
 
@@ -101,11 +177,19 @@ func getCombined(result *JobResult) string {
 	return result.Combined.ShortString()
 }
 
+// getIngress and getEgress fall back to the combined result for jobs which weren't run -- such as those to
+// pods which don't serve the port -- and so have no result for a direction
 func getIngress(result *JobResult) string {
+	if result.Ingress == nil {
+		return getCombined(result)
+	}
 	return result.Ingress.ShortString()
 }
 
 func getEgress(result *JobResult) string {
+	if result.Egress == nil {
+		return getCombined(result)
+	}
 	return result.Egress.ShortString()
 }
 
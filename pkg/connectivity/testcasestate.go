@@ -103,6 +103,7 @@ func (t *TestCaseState) CreatePod(ns string, pod string, labels map[string]strin
 		}
 		if kubePod.Status.Phase == "Running" && kubePod.Status.PodIP != "" {
 			newPod.IP = kubePod.Status.PodIP
+			newPod.IPs = kube.GetPodIPs(kubePod.Status)
 			return nil
 		}
 	}
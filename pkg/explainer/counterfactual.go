@@ -0,0 +1,558 @@
+package explainer
+
+import (
+	"fmt"
+	"github.com/mattfenwick/cyclonus/pkg/kube"
+	"github.com/mattfenwick/cyclonus/pkg/matcher"
+	"github.com/olekukonko/tablewriter"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sort"
+	"strings"
+)
+
+// EditKind is a kind of change to policies or labels which would allow blocked traffic
+type EditKind string
+
+const (
+	EditKindAddPort         EditKind = "AddPort"
+	EditKindAddPeer         EditKind = "AddPeer"
+	EditKindLabelPod        EditKind = "LabelPod"
+	EditKindLabelNamespace  EditKind = "LabelNamespace"
+	EditKindAddPolicy       EditKind = "AddPolicy"
+	EditKindChangeAdminRule EditKind = "ChangeAdminRule"
+)
+
+// Edit is a single change which would allow traffic in one direction.  Which fields are set depends on Kind:
+//   - AddPort: Policy, Rule and Port
+//   - AddPeer: Policy, Rule and Peer -- plus Port, if Rule is a new rule
+//   - LabelPod, LabelNamespace: Namespace and Labels, the labels to add to the peer
+//   - AddPolicy: NewPolicy
+//   - ChangeAdminRule: Policy and Rule
+type Edit struct {
+	Kind EditKind `json:"kind"`
+	// Policy is the namespace/name of a NetworkPolicy, or the name of an AdminNetworkPolicy
+	Policy      string                          `json:"policy,omitempty"`
+	Rule        string                          `json:"rule,omitempty"`
+	Port        *networkingv1.NetworkPolicyPort `json:"port,omitempty"`
+	Peer        *networkingv1.NetworkPolicyPeer `json:"peer,omitempty"`
+	Namespace   string                          `json:"namespace,omitempty"`
+	Labels      map[string]string               `json:"labels,omitempty"`
+	NewPolicy   *networkingv1.NetworkPolicy     `json:"newPolicy,omitempty"`
+	Description string                          `json:"description"`
+}
+
+// ResponsibleRule is a rule which decided whether traffic is allowed.  Rule is empty for a NetworkPolicy which
+// denies traffic: it's denied because none of the policy's rules allow it.
+type ResponsibleRule struct {
+	Tier   matcher.Tier `json:"tier"`
+	Policy string       `json:"policy"`
+	Rule   string       `json:"rule,omitempty"`
+}
+
+func (r *ResponsibleRule) String() string {
+	if r.Rule == "" {
+		return r.Policy
+	}
+	return r.Policy + " " + r.Rule
+}
+
+type DirectionExplanation struct {
+	Allowed bool         `json:"allowed"`
+	Tier    matcher.Tier `json:"tier"`
+	// Rules are the allowing rules if traffic is allowed, and otherwise the denying admin rule or NetworkPolicies
+	Rules []*ResponsibleRule `json:"rules"`
+	// Edits are the changes -- any one of which would allow the traffic in this direction -- if it's denied
+	Edits []*Edit `json:"edits"`
+}
+
+// TrafficExplanation explains why traffic is allowed or denied.  If it's denied in both directions, it takes an
+// edit from each direction to allow it.
+type TrafficExplanation struct {
+	Allowed bool                  `json:"allowed"`
+	Ingress *DirectionExplanation `json:"ingress"`
+	Egress  *DirectionExplanation `json:"egress"`
+}
+
+// ExplainTraffic finds the rules responsible for allowing traffic or -- if it's denied -- the minimal edits which
+// would allow it: adding a port or a peer to a policy, labelling the peer pod or its namespace, adding a policy to
+// override a BaselineAdminNetworkPolicy, or changing the denying AdminNetworkPolicy rule.  Every edit is checked by
+// applying it to the traffic or to the policy it changes.
+func ExplainTraffic(policies *matcher.Policy, traffic *matcher.Traffic) (*TrafficExplanation, error) {
+	ingress, err := explainDirection(policies, traffic, true)
+	if err != nil {
+		return nil, err
+	}
+	egress, err := explainDirection(policies, traffic, false)
+	if err != nil {
+		return nil, err
+	}
+	return &TrafficExplanation{Allowed: ingress.Allowed && egress.Allowed, Ingress: ingress, Egress: egress}, nil
+}
+
+func directionName(isIngress bool) string {
+	if isIngress {
+		return "ingress"
+	}
+	return "egress"
+}
+
+func explainDirection(policies *matcher.Policy, traffic *matcher.Traffic, isIngress bool) (*DirectionExplanation, error) {
+	result := policies.IsIngressOrEgressAllowed(traffic, isIngress)
+	explanation := &DirectionExplanation{Allowed: result.IsAllowed(), Tier: result.Tier, Rules: []*ResponsibleRule{}, Edits: []*Edit{}}
+
+	switch result.Tier {
+	case matcher.TierDefault:
+		return explanation, nil
+	case matcher.TierAdminNetworkPolicy, matcher.TierBaselineAdminNetworkPolicy:
+		rule := result.AdminRule
+		ruleString := fmt.Sprintf("%s[%d] '%s'", directionName(isIngress), rule.Index, rule.Name)
+		explanation.Rules = append(explanation.Rules, &ResponsibleRule{Tier: result.Tier, Policy: rule.Policy.Name, Rule: ruleString})
+		if explanation.Allowed {
+			return explanation, nil
+		}
+		if result.Tier == matcher.TierAdminNetworkPolicy {
+			explanation.Edits = append(explanation.Edits, &Edit{
+				Kind:        EditKindChangeAdminRule,
+				Policy:      rule.Policy.Name,
+				Rule:        ruleString,
+				Description: fmt.Sprintf("change the action of %s %s to Allow or Pass, or add a higher priority AdminNetworkPolicy allowing it", rule.Policy.Name, ruleString),
+			})
+			return explanation, nil
+		}
+		edit, err := addPolicyEdit(traffic, isIngress)
+		if err != nil {
+			return nil, err
+		}
+		if edit != nil {
+			explanation.Edits = append(explanation.Edits, edit)
+		}
+		return explanation, nil
+	case matcher.TierNetworkPolicy:
+		if explanation.Allowed {
+			for _, rule := range result.AllowingRules {
+				explanation.Rules = append(explanation.Rules, &ResponsibleRule{Tier: matcher.TierNetworkPolicy, Policy: rule.Policy, Rule: rule.RulePath()})
+			}
+			return explanation, nil
+		}
+		edits := map[string]*Edit{}
+		for _, target := range result.DenyingTargets {
+			for _, policy := range target.SourceRules {
+				explanation.Rules = append(explanation.Rules, &ResponsibleRule{Tier: matcher.TierNetworkPolicy, Policy: policyName(policy)})
+				policyEdits, err := editsForPolicy(policies, policy, target.Namespace, traffic, isIngress)
+				if err != nil {
+					return nil, err
+				}
+				for _, edit := range policyEdits {
+					// the same labels may satisfy several policies
+					edits[edit.Description] = edit
+				}
+			}
+		}
+		for _, edit := range edits {
+			explanation.Edits = append(explanation.Edits, edit)
+		}
+		sort.SliceStable(explanation.Edits, func(i, j int) bool {
+			return explanation.Edits[i].Description < explanation.Edits[j].Description
+		})
+		return explanation, nil
+	default:
+		return nil, errors.Errorf("invalid tier %s", result.Tier)
+	}
+}
+
+func policyName(policy *networkingv1.NetworkPolicy) string {
+	namespace := policy.Namespace
+	if namespace == "" {
+		namespace = v1.NamespaceDefault
+	}
+	return namespace + "/" + policy.Name
+}
+
+// policyRule is the common part of ingress and egress rules
+type policyRule struct {
+	Ports []networkingv1.NetworkPolicyPort
+	Peers []networkingv1.NetworkPolicyPeer
+}
+
+func policyRules(policy *networkingv1.NetworkPolicy, isIngress bool) []*policyRule {
+	var rules []*policyRule
+	if isIngress {
+		for _, rule := range policy.Spec.Ingress {
+			rules = append(rules, &policyRule{Ports: rule.Ports, Peers: rule.From})
+		}
+	} else {
+		for _, rule := range policy.Spec.Egress {
+			rules = append(rules, &policyRule{Ports: rule.Ports, Peers: rule.To})
+		}
+	}
+	return rules
+}
+
+func peersFieldName(isIngress bool) string {
+	if isIngress {
+		return "from"
+	}
+	return "to"
+}
+
+// trafficPeers returns the pod to which a direction's policies apply, and its peer
+func trafficPeers(traffic *matcher.Traffic, isIngress bool) (*matcher.TrafficPeer, *matcher.TrafficPeer) {
+	if isIngress {
+		return traffic.Destination, traffic.Source
+	}
+	return traffic.Source, traffic.Destination
+}
+
+func isRuleAllowing(rule *policyRule, policyNamespace string, traffic *matcher.Traffic, isIngress bool) (bool, error) {
+	peerMatcher, err := matcher.BuildPeerMatcher(policyNamespace, rule.Ports, rule.Peers)
+	if err != nil {
+		return false, err
+	}
+	_, peer := trafficPeers(traffic, isIngress)
+	portInt, portName := traffic.ResolvePort()
+	return peerMatcher.Allows(peer, portInt, portName, traffic.Protocol), nil
+}
+
+// editsForPolicy finds the edits which would make a policy allow traffic:
+//   - adding the port to a rule whose peers allow it
+//   - labelling the peer pod or its namespace, to match a peer of a rule whose ports allow it
+//   - adding the peer to a rule whose ports allow it or, if there's none, adding a rule
+func editsForPolicy(policies *matcher.Policy, policy *networkingv1.NetworkPolicy, policyNamespace string, traffic *matcher.Traffic, isIngress bool) ([]*Edit, error) {
+	_, peer := trafficPeers(traffic, isIngress)
+	portInt, portName := traffic.ResolvePort()
+	port := trafficPort(traffic)
+	rules := policyRules(policy, isIngress)
+
+	var edits []*Edit
+	portAllowingRule := -1
+	for i, rule := range rules {
+		ruleString := fmt.Sprintf("%s[%d]", directionName(isIngress), i)
+		portMatcher, err := matcher.BuildPortMatcher(rule.Ports)
+		if err != nil {
+			return nil, err
+		}
+		isPortAllowed := portMatcher.Allows(portInt, portName, traffic.Protocol)
+		isPeerAllowed, err := isRuleAllowing(&policyRule{Peers: rule.Peers}, policyNamespace, traffic, isIngress)
+		if err != nil {
+			return nil, err
+		}
+
+		if isPeerAllowed && !isPortAllowed && port != nil {
+			edited := &policyRule{Ports: append(append([]networkingv1.NetworkPolicyPort{}, rule.Ports...), *port), Peers: rule.Peers}
+			if isAllowing, err := isRuleAllowing(edited, policyNamespace, traffic, isIngress); err != nil {
+				return nil, err
+			} else if isAllowing {
+				edits = append(edits, &Edit{
+					Kind:        EditKindAddPort,
+					Policy:      policyName(policy),
+					Rule:        ruleString,
+					Port:        port,
+					Description: fmt.Sprintf("add port %s to %s %s.ports", portString(port), policyName(policy), ruleString),
+				})
+			}
+		}
+
+		if isPortAllowed && !isPeerAllowed {
+			if portAllowingRule < 0 {
+				portAllowingRule = i
+			}
+			for _, npPeer := range rule.Peers {
+				edits = append(edits, labelEdits(policies, npPeer, policyNamespace, traffic, isIngress)...)
+			}
+		}
+	}
+
+	npPeer, err := trafficNetworkPolicyPeer(peer, policyNamespace)
+	if err != nil {
+		return nil, err
+	}
+	if npPeer == nil || port == nil {
+		return edits, nil
+	}
+	var edit *Edit
+	var edited *policyRule
+	if portAllowingRule >= 0 {
+		rule := rules[portAllowingRule]
+		ruleString := fmt.Sprintf("%s[%d].%s", directionName(isIngress), portAllowingRule, peersFieldName(isIngress))
+		edited = &policyRule{Ports: rule.Ports, Peers: append(append([]networkingv1.NetworkPolicyPeer{}, rule.Peers...), *npPeer)}
+		edit = &Edit{
+			Kind:        EditKindAddPeer,
+			Policy:      policyName(policy),
+			Rule:        ruleString,
+			Peer:        npPeer,
+			Description: fmt.Sprintf("add peer %s to %s %s", peerString(npPeer), policyName(policy), ruleString),
+		}
+	} else {
+		ruleString := fmt.Sprintf("%s[%d]", directionName(isIngress), len(rules))
+		edited = &policyRule{Ports: []networkingv1.NetworkPolicyPort{*port}, Peers: []networkingv1.NetworkPolicyPeer{*npPeer}}
+		edit = &Edit{
+			Kind:        EditKindAddPeer,
+			Policy:      policyName(policy),
+			Rule:        ruleString,
+			Peer:        npPeer,
+			Port:        port,
+			Description: fmt.Sprintf("add rule %s to %s: %s %s on port %s", ruleString, policyName(policy), peersFieldName(isIngress), peerString(npPeer), portString(port)),
+		}
+	}
+	if isAllowing, err := isRuleAllowing(edited, policyNamespace, traffic, isIngress); err != nil {
+		return nil, err
+	} else if isAllowing {
+		edits = append(edits, edit)
+	}
+	return edits, nil
+}
+
+// labelEdits finds the labels which -- added to the peer pod or to its namespace -- would make it match a
+// NetworkPolicyPeer.  Only one of them is changed, so if neither matches, there's no edit.  The edit is kept only
+// if the relabelled traffic is allowed, and if it doesn't deny the other direction: new labels may also select the
+// pod or namespace for other policies.
+func labelEdits(policies *matcher.Policy, npPeer networkingv1.NetworkPolicyPeer, policyNamespace string, traffic *matcher.Traffic, isIngress bool) []*Edit {
+	_, peer := trafficPeers(traffic, isIngress)
+	if peer.Internal == nil || npPeer.IPBlock != nil {
+		return nil
+	}
+	internal := peer.Internal
+	_, nsMatcher, podMatcher := matcher.BuildIPBlockNamespacePodMatcher(policyNamespace, npPeer)
+	isNamespaceAllowed := nsMatcher.Allows(internal.Namespace, internal.NamespaceLabels)
+	isPodAllowed := podMatcher.Allows(internal.PodLabels)
+
+	var edit *Edit
+	relabelled := *internal
+	peerType := "source"
+	if !isIngress {
+		peerType = "destination"
+	}
+	if isNamespaceAllowed && !isPodAllowed {
+		podSelector, ok := podMatcher.(*matcher.LabelSelectorPodMatcher)
+		if !ok {
+			return nil
+		}
+		labels, ok := labelsToMatch(podSelector.Selector, internal.PodLabels)
+		if !ok {
+			return nil
+		}
+		relabelled.PodLabels = mergeLabels(internal.PodLabels, labels)
+		edit = &Edit{
+			Kind:        EditKindLabelPod,
+			Namespace:   internal.Namespace,
+			Labels:      labels,
+			Description: fmt.Sprintf("label the %s pod %s in namespace %s with %s", peerType, labelsString(internal.PodLabels), internal.Namespace, labelsString(labels)),
+		}
+	} else if isPodAllowed && !isNamespaceAllowed {
+		nsSelector, ok := nsMatcher.(*matcher.LabelSelectorNamespaceMatcher)
+		if !ok {
+			return nil
+		}
+		labels, ok := labelsToMatch(nsSelector.Selector, internal.NamespaceLabels)
+		if !ok {
+			return nil
+		}
+		relabelled.NamespaceLabels = mergeLabels(internal.NamespaceLabels, labels)
+		edit = &Edit{
+			Kind:        EditKindLabelNamespace,
+			Namespace:   internal.Namespace,
+			Labels:      labels,
+			Description: fmt.Sprintf("label the %s pod's namespace %s with %s", peerType, internal.Namespace, labelsString(labels)),
+		}
+	} else {
+		return nil
+	}
+
+	relabelledPeer := &matcher.TrafficPeer{Internal: &relabelled, IP: peer.IP}
+	relabelledTraffic := *traffic
+	if isIngress {
+		relabelledTraffic.Source = relabelledPeer
+	} else {
+		relabelledTraffic.Destination = relabelledPeer
+	}
+	if !policies.IsIngressOrEgressAllowed(&relabelledTraffic, isIngress).IsAllowed() {
+		return nil
+	}
+	// the peer's own policies decide the other direction: new labels mustn't make them deny it
+	isOtherAllowed := policies.IsIngressOrEgressAllowed(traffic, !isIngress).IsAllowed()
+	if isOtherAllowed && !policies.IsIngressOrEgressAllowed(&relabelledTraffic, !isIngress).IsAllowed() {
+		return nil
+	}
+	return []*Edit{edit}
+}
+
+// labelsToMatch finds the labels to add to -- or change in -- a set of labels so that a selector matches them.  It
+// fails for expressions which can only be satisfied by removing labels.
+func labelsToMatch(selector metav1.LabelSelector, labels map[string]string) (map[string]string, bool) {
+	added := map[string]string{}
+	for key, value := range selector.MatchLabels {
+		if current, ok := labels[key]; !ok || current != value {
+			added[key] = value
+		}
+	}
+	for _, exp := range selector.MatchExpressions {
+		if kube.IsMatchExpressionMatchForLabels(mergeLabels(labels, added), exp) {
+			continue
+		}
+		switch exp.Operator {
+		case metav1.LabelSelectorOpIn:
+			if len(exp.Values) == 0 {
+				return nil, false
+			}
+			added[exp.Key] = exp.Values[0]
+		case metav1.LabelSelectorOpExists:
+			added[exp.Key] = ""
+		default:
+			return nil, false
+		}
+	}
+	if len(added) == 0 || !kube.IsLabelsMatchLabelSelector(mergeLabels(labels, added), selector) {
+		return nil, false
+	}
+	return added, true
+}
+
+func mergeLabels(labels map[string]string, added map[string]string) map[string]string {
+	merged := map[string]string{}
+	for key, value := range labels {
+		merged[key] = value
+	}
+	for key, value := range added {
+		merged[key] = value
+	}
+	return merged
+}
+
+// trafficPort is the port on which traffic is sent, as a NetworkPolicyPort: its number, if it's known
+func trafficPort(traffic *matcher.Traffic) *networkingv1.NetworkPolicyPort {
+	portInt, portName := traffic.ResolvePort()
+	protocol := traffic.Protocol
+	var port intstr.IntOrString
+	switch {
+	case portInt != 0:
+		port = intstr.FromInt(portInt)
+	case portName != "":
+		port = intstr.FromString(portName)
+	default:
+		return nil
+	}
+	return &networkingv1.NetworkPolicyPort{Protocol: &protocol, Port: &port}
+}
+
+// trafficNetworkPolicyPeer selects exactly the peer of traffic, as well as a NetworkPolicyPeer can: an external
+// peer by its IP, and an internal peer by its pod labels and namespace.  A namespace in another namespace than the
+// policy's is selected by its name label if it has one, and otherwise by all its labels; if it has none, nil is
+// returned.
+func trafficNetworkPolicyPeer(peer *matcher.TrafficPeer, policyNamespace string) (*networkingv1.NetworkPolicyPeer, error) {
+	if peer.Internal == nil {
+		if peer.IP == "" {
+			return nil, nil
+		}
+		prefixLength := 32
+		if kube.GetIPFamily(peer.IP) == v1.IPv6Protocol {
+			prefixLength = 128
+		}
+		cidr, err := kube.CIDRContainingIP(peer.IP, prefixLength)
+		if err != nil {
+			return nil, err
+		}
+		return &networkingv1.NetworkPolicyPeer{IPBlock: &networkingv1.IPBlock{CIDR: cidr}}, nil
+	}
+
+	internal := peer.Internal
+	npPeer := &networkingv1.NetworkPolicyPeer{PodSelector: &metav1.LabelSelector{MatchLabels: mergeLabels(internal.PodLabels, nil)}}
+	if internal.Namespace == policyNamespace {
+		return npPeer, nil
+	}
+	if name, ok := internal.NamespaceLabels[v1.LabelMetadataName]; ok && name == internal.Namespace {
+		npPeer.NamespaceSelector = &metav1.LabelSelector{MatchLabels: map[string]string{v1.LabelMetadataName: name}}
+	} else if len(internal.NamespaceLabels) > 0 {
+		npPeer.NamespaceSelector = &metav1.LabelSelector{MatchLabels: mergeLabels(internal.NamespaceLabels, nil)}
+	} else {
+		return nil, nil
+	}
+	return npPeer, nil
+}
+
+// addPolicyEdit overrides a denying BaselineAdminNetworkPolicy rule with a NetworkPolicy allowing the traffic.
+// Since the policy selects the pod, all its other traffic in that direction is then denied unless allowed.
+func addPolicyEdit(traffic *matcher.Traffic, isIngress bool) (*Edit, error) {
+	target, peer := trafficPeers(traffic, isIngress)
+	port := trafficPort(traffic)
+	npPeer, err := trafficNetworkPolicyPeer(peer, target.Internal.Namespace)
+	if err != nil || npPeer == nil || port == nil {
+		return nil, err
+	}
+	policy := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Namespace: target.Internal.Namespace, Name: "allow-" + directionName(isIngress)},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: mergeLabels(target.Internal.PodLabels, nil)},
+		},
+	}
+	if isIngress {
+		policy.Spec.PolicyTypes = []networkingv1.PolicyType{networkingv1.PolicyTypeIngress}
+		policy.Spec.Ingress = []networkingv1.NetworkPolicyIngressRule{{Ports: []networkingv1.NetworkPolicyPort{*port}, From: []networkingv1.NetworkPolicyPeer{*npPeer}}}
+	} else {
+		policy.Spec.PolicyTypes = []networkingv1.PolicyType{networkingv1.PolicyTypeEgress}
+		policy.Spec.Egress = []networkingv1.NetworkPolicyEgressRule{{Ports: []networkingv1.NetworkPolicyPort{*port}, To: []networkingv1.NetworkPolicyPeer{*npPeer}}}
+	}
+	return &Edit{
+		Kind:      EditKindAddPolicy,
+		NewPolicy: policy,
+		Description: fmt.Sprintf("add a NetworkPolicy %s selecting pods %s, with %s %s on port %s, to override the BaselineAdminNetworkPolicy -- it will deny all other %s to those pods",
+			policyName(policy), labelsString(target.Internal.PodLabels), peersFieldName(isIngress), peerString(npPeer), portString(port), directionName(isIngress)),
+	}, nil
+}
+
+func portString(port *networkingv1.NetworkPolicyPort) string {
+	return fmt.Sprintf("%s/%s", port.Port.String(), *port.Protocol)
+}
+
+func peerString(peer *networkingv1.NetworkPolicyPeer) string {
+	if peer.IPBlock != nil {
+		return "ipBlock " + peer.IPBlock.CIDR
+	}
+	var parts []string
+	if peer.NamespaceSelector != nil {
+		parts = append(parts, "namespaces "+labelsString(peer.NamespaceSelector.MatchLabels))
+	}
+	if peer.PodSelector != nil {
+		parts = append(parts, "pods "+labelsString(peer.PodSelector.MatchLabels))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func labelsString(labels map[string]string) string {
+	var kvs []string
+	for key, value := range labels {
+		kvs = append(kvs, key+"="+value)
+	}
+	sort.Strings(kvs)
+	return "{" + strings.Join(kvs, ",") + "}"
+}
+
+func TrafficExplanationTable(explanation *TrafficExplanation) string {
+	tableString := &strings.Builder{}
+	table := tablewriter.NewWriter(tableString)
+	table.SetAutoWrapText(false)
+	table.SetRowLine(true)
+	table.SetHeader([]string{"Type", "Tier", "Allowed?", "Responsible rules", "Edits which would allow it"})
+	for _, direction := range []struct {
+		Name        string
+		Explanation *DirectionExplanation
+	}{{"Ingress", explanation.Ingress}, {"Egress", explanation.Egress}} {
+		var rules, edits []string
+		for _, rule := range direction.Explanation.Rules {
+			rules = append(rules, rule.String())
+		}
+		if direction.Explanation.Tier == matcher.TierDefault {
+			rules = append(rules, "no policies apply")
+		}
+		for _, edit := range direction.Explanation.Edits {
+			edits = append(edits, edit.Description)
+		}
+		table.Append([]string{direction.Name, string(direction.Explanation.Tier), fmt.Sprintf("%t", direction.Explanation.Allowed), strings.Join(rules, "\n"), strings.Join(edits, "\n")})
+	}
+	table.SetFooter([]string{"Is allowed?", "", fmt.Sprintf("%t", explanation.Allowed), "", ""})
+	table.Render()
+	return tableString.String()
+}
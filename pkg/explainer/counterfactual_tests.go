@@ -0,0 +1,129 @@
+package explainer
+
+import (
+	"github.com/mattfenwick/cyclonus/pkg/matcher"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func RunCounterfactualTests() {
+	tcp := v1.ProtocolTCP
+	port80 := intstr.FromInt(80)
+	port9090 := intstr.FromInt(9090)
+	allowAPI := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "x", Name: "allow-api"},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "api"}},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{
+				{
+					Ports: []networkingv1.NetworkPolicyPort{{Protocol: &tcp, Port: &port9090}},
+					From:  []networkingv1.NetworkPolicyPeer{{NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "monitoring"}}}},
+				},
+				{
+					Ports: []networkingv1.NetworkPolicyPort{{Protocol: &tcp, Port: &port80}},
+					From:  []networkingv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}}},
+				},
+			},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+		},
+	}
+	policies := matcher.BuildNetworkPolicy(allowAPI)
+
+	traffic := func(namespace string, namespaceLabels map[string]string, podLabels map[string]string, port int) *matcher.Traffic {
+		return &matcher.Traffic{
+			Source: &matcher.TrafficPeer{
+				Internal: &matcher.InternalPeer{Namespace: namespace, NamespaceLabels: namespaceLabels, PodLabels: podLabels},
+				IP:       "10.0.0.2",
+			},
+			Destination: &matcher.TrafficPeer{
+				Internal: &matcher.InternalPeer{Namespace: "x", NamespaceLabels: map[string]string{"kubernetes.io/metadata.name": "x"}, PodLabels: map[string]string{"app": "api"}},
+				IP:       "10.0.0.1",
+			},
+			ResolvedPort: port,
+			Protocol:     v1.ProtocolTCP,
+		}
+	}
+	xLabels := map[string]string{"kubernetes.io/metadata.name": "x"}
+	descriptions := func(edits []*Edit) []string {
+		var lines []string
+		for _, edit := range edits {
+			lines = append(lines, edit.Description)
+		}
+		return lines
+	}
+
+	Describe("Counterfactual explanations", func() {
+		It("should find the rules allowing traffic", func() {
+			explanation, err := ExplainTraffic(policies, traffic("x", xLabels, map[string]string{"app": "web"}, 80))
+			Expect(err).To(BeNil())
+			Expect(explanation.Allowed).To(BeTrue())
+			Expect(explanation.Ingress.Rules).To(Equal([]*ResponsibleRule{{Tier: matcher.TierNetworkPolicy, Policy: "x/allow-api", Rule: "ingress[1].from[0] port[0]"}}))
+			Expect(explanation.Ingress.Edits).To(BeEmpty())
+			Expect(explanation.Egress.Tier).To(Equal(matcher.TierDefault))
+		})
+
+		It("should add a port to a rule whose peer is allowed", func() {
+			explanation, err := ExplainTraffic(policies, traffic("x", xLabels, map[string]string{"app": "web"}, 81))
+			Expect(err).To(BeNil())
+			Expect(explanation.Allowed).To(BeFalse())
+			Expect(explanation.Ingress.Rules).To(Equal([]*ResponsibleRule{{Tier: matcher.TierNetworkPolicy, Policy: "x/allow-api"}}))
+			Expect(descriptions(explanation.Ingress.Edits)).To(Equal([]string{
+				"add port 81/TCP to x/allow-api ingress[1].ports",
+				"add rule ingress[2] to x/allow-api: from pods {app=web} on port 81/TCP",
+			}))
+			Expect(explanation.Ingress.Edits[0].Kind).To(Equal(EditKindAddPort))
+		})
+
+		It("should label the source pod, or add it to a rule whose port is allowed", func() {
+			explanation, err := ExplainTraffic(policies, traffic("x", xLabels, map[string]string{"app": "db"}, 80))
+			Expect(err).To(BeNil())
+			Expect(descriptions(explanation.Ingress.Edits)).To(Equal([]string{
+				"add peer pods {app=db} to x/allow-api ingress[1].from",
+				"label the source pod {app=db} in namespace x with {app=web}",
+			}))
+			Expect(explanation.Ingress.Edits[1].Kind).To(Equal(EditKindLabelPod))
+			Expect(explanation.Ingress.Edits[1].Labels).To(Equal(map[string]string{"app": "web"}))
+		})
+
+		It("should label the source namespace", func() {
+			zLabels := map[string]string{"kubernetes.io/metadata.name": "z"}
+			explanation, err := ExplainTraffic(policies, traffic("z", zLabels, map[string]string{"app": "prometheus"}, 9090))
+			Expect(err).To(BeNil())
+			Expect(descriptions(explanation.Ingress.Edits)).To(Equal([]string{
+				"add peer namespaces {kubernetes.io/metadata.name=z}, pods {app=prometheus} to x/allow-api ingress[0].from",
+				"label the source pod's namespace z with {team=monitoring}",
+			}))
+		})
+
+		It("should not propose labels which other policies would deny", func() {
+			denyWeb := &networkingv1.NetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "x", Name: "deny-web-egress"},
+				Spec: networkingv1.NetworkPolicySpec{
+					PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+					PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+				},
+			}
+			withDeny := matcher.BuildNetworkPolicies([]*networkingv1.NetworkPolicy{allowAPI, denyWeb})
+			explanation, err := ExplainTraffic(withDeny, traffic("x", xLabels, map[string]string{"app": "db"}, 80))
+			Expect(err).To(BeNil())
+			// app=web would allow ingress, but deny egress
+			Expect(explanation.Egress.Allowed).To(BeTrue())
+			Expect(descriptions(explanation.Ingress.Edits)).To(Equal([]string{
+				"add peer pods {app=db} to x/allow-api ingress[1].from",
+			}))
+
+			explanation, err = ExplainTraffic(withDeny, traffic("x", xLabels, map[string]string{"app": "web"}, 80))
+			Expect(err).To(BeNil())
+			Expect(explanation.Ingress.Allowed).To(BeTrue())
+			Expect(explanation.Egress.Allowed).To(BeFalse())
+			Expect(explanation.Egress.Rules).To(Equal([]*ResponsibleRule{{Tier: matcher.TierNetworkPolicy, Policy: "x/deny-web-egress"}}))
+			Expect(descriptions(explanation.Egress.Edits)).To(Equal([]string{
+				"add rule egress[0] to x/deny-web-egress: to pods {app=api} on port 80/TCP",
+			}))
+		})
+	})
+}
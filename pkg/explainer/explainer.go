@@ -12,6 +12,11 @@ import (
 func Explain(policies *matcher.Policy) string {
 	var lines []string
 	ingress, egress := policies.SortedTargets()
+	// 0. admin network policies, which are evaluated first
+	for _, adminPolicy := range policies.AdminPolicies {
+		lines = append(lines, ExplainAdminPolicy(adminPolicy)...)
+	}
+
 	// 1. ingress
 	for _, t := range ingress {
 		lines = append(lines, ExplainTarget(t, true)...)
@@ -22,9 +27,43 @@ func Explain(policies *matcher.Policy) string {
 		lines = append(lines, ExplainTarget(t, false)...)
 	}
 
+	// 3. baseline admin network policy, which is evaluated for pods not selected by any target
+	if policies.BaselinePolicy != nil {
+		lines = append(lines, ExplainAdminPolicy(policies.BaselinePolicy)...)
+	}
+
 	return strings.Join(lines, "\n")
 }
 
+func ExplainAdminPolicy(adminPolicy *matcher.AdminPolicy) []string {
+	indent := "  "
+	header := fmt.Sprintf("%s %s", adminPolicy.Tier(), adminPolicy.Name)
+	if !adminPolicy.IsBaseline {
+		header += fmt.Sprintf(" (priority %d)", adminPolicy.Priority)
+	}
+	lines := []string{
+		header,
+		indent + "subject:",
+		ExplainNamespaceMatcher(adminPolicy.Subject.Namespace, indent+"  "),
+		ExplainPodMatcher(adminPolicy.Subject.Pod, indent+"  "),
+	}
+	for _, direction := range []struct {
+		Name  string
+		Rules []*matcher.AdminRule
+	}{{"ingress", adminPolicy.Ingress}, {"egress", adminPolicy.Egress}} {
+		for _, rule := range direction.Rules {
+			lines = append(lines, fmt.Sprintf(indent+"%s rule %d '%s': %s", direction.Name, rule.Index, rule.Name, rule.Action))
+			switch peer := rule.Peer.(type) {
+			case *matcher.SpecificPeerMatcher:
+				lines = append(lines, ExplainSpecificPeerMatcher(peer, indent+"  ")...)
+			default:
+				panic(errors.Errorf("invalid PeerMatcher type %T", rule.Peer))
+			}
+		}
+	}
+	return append(lines, "")
+}
+
 func ExplainTarget(target *matcher.Target, isIngress bool) []string {
 	indent := "  "
 	var targetType string
@@ -124,6 +163,9 @@ func ExplainSpecificPortMatcher(spm *matcher.SpecificPortMatcher, indent string)
 			lines = append(lines, indent+fmt.Sprintf("all ports on protocol %s", port.Protocol))
 		}
 	}
+	for _, portRange := range spm.PortRanges {
+		lines = append(lines, indent+fmt.Sprintf("ports [%d, %d] on protocol %s", portRange.From, portRange.To, portRange.Protocol))
+	}
 	return lines
 }
 
@@ -2,7 +2,9 @@ package explainer
 
 import (
 	"fmt"
+	"github.com/mattfenwick/cyclonus/pkg/kube"
 	"github.com/mattfenwick/cyclonus/pkg/matcher"
+	"github.com/mattfenwick/cyclonus/pkg/utils"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	v1 "k8s.io/api/core/v1"
@@ -127,5 +129,66 @@ func RunExplainerTests() {
 			}
 			Expect(explanation).To(Equal(expected))
 		})
+
+		It("Admin network policy", func() {
+			ports := []kube.AdminNetworkPolicyPort{{PortNumber: &kube.Port{Protocol: udp, Port: 53}}}
+			anp := &kube.AdminNetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{Name: "pass-dns"},
+				Spec: kube.AdminNetworkPolicySpec{
+					Priority: 10,
+					Subject:  kube.AdminNetworkPolicySubject{Namespaces: &metav1.LabelSelector{}},
+					Egress: []kube.AdminNetworkPolicyEgressRule{{
+						Name:   "dns",
+						Action: kube.AdminNetworkPolicyRuleActionPass,
+						To:     []kube.AdminNetworkPolicyEgressPeer{{Namespaces: &metav1.LabelSelector{}}},
+						Ports:  &ports,
+					}},
+				},
+			}
+			policy, err := matcher.BuildNetworkPoliciesWithAdmin(nil, []*kube.AdminNetworkPolicy{anp}, nil)
+			Expect(err).To(Succeed())
+			explanation := Explain(policy)
+			expected := `AdminNetworkPolicy pass-dns (priority 10)
+  subject:
+    all namespaces
+    all pods
+  egress rule 0 'dns': Pass
+    no ips
+    Internal:
+      Namespace/Pod:
+        all namespaces
+        all pods
+        Port(s):
+          port 53 on protocol UDP
+`
+			if explanation != expected {
+				fmt.Printf("expected:\n\n%s\n\nexplanation:\n\n%s\n\n", expected, explanation)
+			}
+			Expect(explanation).To(Equal(expected))
+			Expect(TableExplainer(policy)).To(ContainSubstring("rule 0 'dns': Pass"))
+
+			report := Report(policy)
+			Expect(report.Targets).To(BeEmpty())
+			Expect(report.AdminPolicies).To(HaveLen(1))
+			Expect(report.AdminPolicies[0].Egress[0].Action).To(Equal(kube.AdminNetworkPolicyRuleActionPass))
+		})
+
+		It("Report", func() {
+			policy := matcher.BuildNetworkPolicies([]*networkingv1.NetworkPolicy{{
+				ObjectMeta: metav1.ObjectMeta{Name: "allow-dns", Namespace: "x"},
+				Spec: networkingv1.NetworkPolicySpec{
+					Egress:      []networkingv1.NetworkPolicyEgressRule{{Ports: []networkingv1.NetworkPolicyPort{{Protocol: &udp, Port: &port53}}}},
+					PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+				},
+			}})
+			report := Report(policy)
+			Expect(report.Targets).To(HaveLen(1))
+			Expect(report.Targets[0].Type).To(Equal("Egress"))
+			Expect(report.Targets[0].SourcePolicies).To(Equal([]string{"x/allow-dns"}))
+
+			serialized := utils.JsonString(report)
+			Expect(serialized).To(ContainSubstring(`"namespace": "x"`))
+			Expect(serialized).To(ContainSubstring(`"sourcePolicies": [`))
+		})
 	})
 }
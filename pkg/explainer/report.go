@@ -0,0 +1,73 @@
+package explainer
+
+import (
+	"github.com/mattfenwick/cyclonus/pkg/kube"
+	"github.com/mattfenwick/cyclonus/pkg/matcher"
+)
+
+// PolicyReport is the structured form of an explanation: the same information as Explain and
+// TableExplainer, in the order in which it's evaluated
+type PolicyReport struct {
+	AdminPolicies  []*AdminPolicyReport `json:"adminPolicies"`
+	Targets        []*TargetReport      `json:"targets"`
+	BaselinePolicy *AdminPolicyReport   `json:"baselinePolicy,omitempty"`
+}
+
+type TargetReport struct {
+	// Type is either Ingress or Egress
+	Type string `json:"type"`
+	*matcher.TargetSummary
+	Peer matcher.PeerMatcher `json:"peer"`
+}
+
+type AdminPolicyReport struct {
+	Name     string                  `json:"name"`
+	Tier     matcher.Tier            `json:"tier"`
+	Priority int                     `json:"priority"`
+	Subject  *matcher.SubjectMatcher `json:"subject"`
+	Ingress  []*AdminRuleReport      `json:"ingress"`
+	Egress   []*AdminRuleReport      `json:"egress"`
+}
+
+type AdminRuleReport struct {
+	Name   string                            `json:"name"`
+	Index  int                               `json:"index"`
+	Action kube.AdminNetworkPolicyRuleAction `json:"action"`
+	Peer   matcher.PeerMatcher               `json:"peer"`
+}
+
+func Report(policies *matcher.Policy) *PolicyReport {
+	report := &PolicyReport{AdminPolicies: []*AdminPolicyReport{}, Targets: []*TargetReport{}}
+	for _, adminPolicy := range policies.AdminPolicies {
+		report.AdminPolicies = append(report.AdminPolicies, ReportAdminPolicy(adminPolicy))
+	}
+	ingress, egress := policies.SortedTargets()
+	for _, t := range ingress {
+		report.Targets = append(report.Targets, &TargetReport{Type: "Ingress", TargetSummary: t.Summary(), Peer: t.Peer})
+	}
+	for _, t := range egress {
+		report.Targets = append(report.Targets, &TargetReport{Type: "Egress", TargetSummary: t.Summary(), Peer: t.Peer})
+	}
+	if policies.BaselinePolicy != nil {
+		report.BaselinePolicy = ReportAdminPolicy(policies.BaselinePolicy)
+	}
+	return report
+}
+
+func ReportAdminPolicy(adminPolicy *matcher.AdminPolicy) *AdminPolicyReport {
+	report := &AdminPolicyReport{
+		Name:     adminPolicy.Name,
+		Tier:     adminPolicy.Tier(),
+		Priority: adminPolicy.Priority,
+		Subject:  adminPolicy.Subject,
+		Ingress:  []*AdminRuleReport{},
+		Egress:   []*AdminRuleReport{},
+	}
+	for _, rule := range adminPolicy.Ingress {
+		report.Ingress = append(report.Ingress, &AdminRuleReport{Name: rule.Name, Index: rule.Index, Action: rule.Action, Peer: rule.Peer})
+	}
+	for _, rule := range adminPolicy.Egress {
+		report.Egress = append(report.Egress, &AdminRuleReport{Name: rule.Name, Index: rule.Index, Action: rule.Action, Peer: rule.Peer})
+	}
+	return report
+}
@@ -10,5 +10,6 @@ import (
 func TestModel(t *testing.T) {
 	RegisterFailHandler(Fail)
 	RunExplainerTests()
+	RunCounterfactualTests()
 	RunSpecs(t, "explainer suite")
 }
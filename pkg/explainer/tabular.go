@@ -27,11 +27,45 @@ func TableExplainer(policies *matcher.Policy) string {
 	table.SetHeader([]string{"Type", "Target", "Source rules", "Peer", "Port/Protocol"})
 
 	builder := &SliceBuilder{}
+	var baseline []*matcher.AdminPolicy
+	if policies.BaselinePolicy != nil {
+		baseline = []*matcher.AdminPolicy{policies.BaselinePolicy}
+	}
 	ingresses, egresses := policies.SortedTargets()
+	AdminPoliciesTableLines(builder, policies.AdminPolicies, true)
 	TargetsTableLines(builder, ingresses, true)
+	AdminPoliciesTableLines(builder, baseline, true)
 	builder.Elements = append(builder.Elements, []string{"", "", "", "", ""})
+	AdminPoliciesTableLines(builder, policies.AdminPolicies, false)
 	TargetsTableLines(builder, egresses, false)
+	AdminPoliciesTableLines(builder, baseline, false)
+
+	table.AppendBulk(builder.Elements)
+
+	table.Render()
+	return tableString.String()
+}
+
+// ReachingPeersTable shows the peers allowed to reach a pod, and the policies they come from
+func ReachingPeersTable(reaching *matcher.ReachingPeers) string {
+	tableString := &strings.Builder{}
+	table := tablewriter.NewWriter(tableString)
+	table.SetAutoWrapText(false)
+	table.SetRowLine(true)
+	table.SetAutoMergeCells(true)
+	table.SetHeader([]string{"Source rules", "Peer", "Port/Protocol"})
 
+	var sourceRules []string
+	for _, target := range reaching.Targets {
+		for _, sr := range target.SourceRules {
+			sourceRules = append(sourceRules, fmt.Sprintf("%s/%s", sr.Namespace, sr.Name))
+		}
+	}
+	if len(sourceRules) == 0 {
+		sourceRules = []string{"no ingress policies apply"}
+	}
+	builder := &SliceBuilder{Prefix: []string{strings.Join(sourceRules, "\n")}}
+	PeerMatcherTableLines(builder, reaching.Peer)
 	table.AppendBulk(builder.Elements)
 
 	table.Render()
@@ -54,35 +88,64 @@ func TargetsTableLines(builder *SliceBuilder, targets []*matcher.Target, isIngre
 		rules := strings.Join(sourceRules, "\n")
 		builder.Prefix = []string{ruleType, target, rules}
 
-		switch a := ingress.Peer.(type) {
-		case *matcher.AllPeerMatcher:
-			builder.Append("all pods, all ips", "all ports, all protocols")
-		case *matcher.NonePeerMatcher:
-			builder.Append("no pods, no ips", "no ports, no protocols")
-		case *matcher.SpecificPeerMatcher:
-			switch ip := a.IP.(type) {
-			case *matcher.AllIPMatcher:
-				builder.Append("all ips", "all ports, all protocols")
-			case *matcher.NoneIPMatcher:
-				builder.Append("no ips", "no ports, no protocols")
-			case *matcher.SpecificIPMatcher:
-				SpecificIPMatcherTableLines(builder, ip)
-			default:
-				panic(errors.Errorf("invalid IPMatcher type %T", ip))
-			}
-			switch internal := a.Internal.(type) {
-			case *matcher.AllInternalMatcher:
-				builder.Append("all pods", "all ports, all protocols")
-			case *matcher.NoneInternalMatcher:
-				builder.Append("no pods", "no ports, no protocols")
-			case *matcher.SpecificInternalMatcher:
-				SpecificInternalMatcherTableLines(builder, internal)
-			default:
-				panic(errors.Errorf("invalid InternalMatcher type %T", internal))
-			}
+		PeerMatcherTableLines(builder, ingress.Peer)
+	}
+}
+
+// AdminPoliciesTableLines adds a row for each rule of each AdminNetworkPolicy or BaselineAdminNetworkPolicy,
+// in evaluation order
+func AdminPoliciesTableLines(builder *SliceBuilder, adminPolicies []*matcher.AdminPolicy, isIngress bool) {
+	ruleType := "Egress"
+	if isIngress {
+		ruleType = "Ingress"
+	}
+	for _, adminPolicy := range adminPolicies {
+		target := fmt.Sprintf("%s %s", adminPolicy.Tier(), adminPolicy.Name)
+		if !adminPolicy.IsBaseline {
+			target += fmt.Sprintf(" (priority %d)", adminPolicy.Priority)
+		}
+		target += fmt.Sprintf("\nnamespaces: %s\npods: %s",
+			NamespaceMatcherTableLines(adminPolicy.Subject.Namespace), PodMatcherTableLines(adminPolicy.Subject.Pod))
+		rules := adminPolicy.Egress
+		if isIngress {
+			rules = adminPolicy.Ingress
+		}
+		for _, rule := range rules {
+			builder.Prefix = []string{ruleType, target, fmt.Sprintf("rule %d '%s': %s", rule.Index, rule.Name, rule.Action)}
+			PeerMatcherTableLines(builder, rule.Peer)
+		}
+	}
+}
+
+func PeerMatcherTableLines(builder *SliceBuilder, peer matcher.PeerMatcher) {
+	switch a := peer.(type) {
+	case *matcher.AllPeerMatcher:
+		builder.Append("all pods, all ips", "all ports, all protocols")
+	case *matcher.NonePeerMatcher:
+		builder.Append("no pods, no ips", "no ports, no protocols")
+	case *matcher.SpecificPeerMatcher:
+		switch ip := a.IP.(type) {
+		case *matcher.AllIPMatcher:
+			builder.Append("all ips", "all ports, all protocols")
+		case *matcher.NoneIPMatcher:
+			builder.Append("no ips", "no ports, no protocols")
+		case *matcher.SpecificIPMatcher:
+			SpecificIPMatcherTableLines(builder, ip)
+		default:
+			panic(errors.Errorf("invalid IPMatcher type %T", ip))
+		}
+		switch internal := a.Internal.(type) {
+		case *matcher.AllInternalMatcher:
+			builder.Append("all pods", "all ports, all protocols")
+		case *matcher.NoneInternalMatcher:
+			builder.Append("no pods", "no ports, no protocols")
+		case *matcher.SpecificInternalMatcher:
+			SpecificInternalMatcherTableLines(builder, internal)
 		default:
-			panic(errors.Errorf("invalid PeerMatcher type %T", a))
+			panic(errors.Errorf("invalid InternalMatcher type %T", internal))
 		}
+	default:
+		panic(errors.Errorf("invalid PeerMatcher type %T", a))
 	}
 }
 
@@ -97,30 +160,36 @@ func SpecificIPMatcherTableLines(builder *SliceBuilder, ip *matcher.SpecificIPMa
 
 func SpecificInternalMatcherTableLines(builder *SliceBuilder, internal *matcher.SpecificInternalMatcher) {
 	for _, nsPodMatcher := range internal.NamespacePods {
-		var namespaces string
-		switch ns := nsPodMatcher.Namespace.(type) {
-		case *matcher.AllNamespaceMatcher:
-			namespaces = "all"
-		case *matcher.LabelSelectorNamespaceMatcher:
-			namespaces = kube.LabelSelectorTableLines(ns.Selector)
-		case *matcher.ExactNamespaceMatcher:
-			namespaces = ns.Namespace
-		default:
-			panic(errors.Errorf("invalid NamespaceMatcher type %T", ns))
-		}
-		var pods string
-		switch p := nsPodMatcher.Pod.(type) {
-		case *matcher.AllPodMatcher:
-			pods = "all"
-		case *matcher.LabelSelectorPodMatcher:
-			pods = kube.LabelSelectorTableLines(p.Selector)
-		default:
-			panic(errors.Errorf("invalid PodMatcher type %T", p))
-		}
+		namespaces := NamespaceMatcherTableLines(nsPodMatcher.Namespace)
+		pods := PodMatcherTableLines(nsPodMatcher.Pod)
 		builder.Append("namespace: "+namespaces+"\n"+"pods: "+pods, strings.Join(PortMatcherTableLines(nsPodMatcher.Port), "\n"))
 	}
 }
 
+func NamespaceMatcherTableLines(nm matcher.NamespaceMatcher) string {
+	switch ns := nm.(type) {
+	case *matcher.AllNamespaceMatcher:
+		return "all"
+	case *matcher.LabelSelectorNamespaceMatcher:
+		return kube.LabelSelectorTableLines(ns.Selector)
+	case *matcher.ExactNamespaceMatcher:
+		return ns.Namespace
+	default:
+		panic(errors.Errorf("invalid NamespaceMatcher type %T", ns))
+	}
+}
+
+func PodMatcherTableLines(pm matcher.PodMatcher) string {
+	switch p := pm.(type) {
+	case *matcher.AllPodMatcher:
+		return "all"
+	case *matcher.LabelSelectorPodMatcher:
+		return kube.LabelSelectorTableLines(p.Selector)
+	default:
+		panic(errors.Errorf("invalid PodMatcher type %T", p))
+	}
+}
+
 func PortMatcherTableLines(pm matcher.PortMatcher) []string {
 	switch port := pm.(type) {
 	case *matcher.AllPortMatcher:
@@ -136,6 +205,9 @@ func PortMatcherTableLines(pm matcher.PortMatcher) []string {
 				pps = append(pps, "port "+portProtocol.Port.String()+" on protocol "+string(portProtocol.Protocol))
 			}
 		}
+		for _, portRange := range port.PortRanges {
+			pps = append(pps, fmt.Sprintf("ports [%d, %d] on protocol %s", portRange.From, portRange.To, portRange.Protocol))
+		}
 		return pps
 	default:
 		panic(errors.Errorf("invalid PortMatcher type %T", port))
@@ -1,7 +1,8 @@
 package generator
 
 import (
-	"fmt"
+	"github.com/mattfenwick/cyclonus/pkg/kube"
+	v1 "k8s.io/api/core/v1"
 	. "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -116,13 +117,13 @@ func BuildPolicy(setters ...Setter) *Netpol {
 //     - except cidr
 // - egress: DNS (udp/53)
 type BreadthGenerator struct {
-	PodIP    string
+	PodIPs   []string
 	AllowDNS bool
 }
 
-func NewBreadthGenerator(allowDNS bool, podIP string) *BreadthGenerator {
+func NewBreadthGenerator(allowDNS bool, podIPs ...string) *BreadthGenerator {
 	return &BreadthGenerator{
-		PodIP:    podIP,
+		PodIPs:   podIPs,
 		AllowDNS: allowDNS,
 	}
 }
@@ -173,11 +174,15 @@ func (e *BreadthGenerator) Policies() [][]Setter {
 		addPolicy(prefix+"pods by label, namespace by label", SetPeers(isIngress, []NetworkPolicyPeer{{PodSelector: podCMatchLabelsSelector, NamespaceSelector: nsXMatchLabelsSelector}}))
 		addPolicy(prefix+"pods by label, all namespaces", SetPeers(isIngress, []NetworkPolicyPeer{{PodSelector: podCMatchLabelsSelector, NamespaceSelector: emptySelector}}))
 
-		// TODO normalize these CIDRs
-		cidr24 := fmt.Sprintf("%s/24", e.PodIP)
-		cidr28 := fmt.Sprintf("%s/28", e.PodIP)
-		addPolicy(prefix+"ipblock", SetPeers(isIngress, []NetworkPolicyPeer{{IPBlock: &IPBlock{CIDR: cidr24}}}))
-		addPolicy(prefix+"ipblock with except", SetPeers(isIngress, []NetworkPolicyPeer{{IPBlock: &IPBlock{CIDR: cidr24, Except: []string{cidr28}}}}))
+		for _, podIP := range e.PodIPs {
+			suffix := ""
+			if kube.GetIPFamily(podIP) == v1.IPv6Protocol {
+				suffix = " (IPv6)"
+			}
+			cidr, except := ipBlockCIDRs(podIP)
+			addPolicy(prefix+"ipblock"+suffix, SetPeers(isIngress, []NetworkPolicyPeer{{IPBlock: &IPBlock{CIDR: cidr}}}))
+			addPolicy(prefix+"ipblock with except"+suffix, SetPeers(isIngress, []NetworkPolicyPeer{{IPBlock: &IPBlock{CIDR: cidr, Except: []string{except}}}}))
+		}
 	}
 
 	return policies
@@ -13,7 +13,7 @@ Conflicts:
    - deny all, plus allow layered on top
    - deny all ips, allow all pods
    - deny all pods, allow all ips
-     - allow all ips with 0.0.0.0/0
+     - allow all ips with 0.0.0.0/0 (or ::/0 for IPv6)
      - is there another way to allow all ips?
    - allow CIDR, deny smaller CIDR
 
@@ -81,6 +81,34 @@ var (
 		Rules: []*Rule{DenyAllByIPRule},
 	}
 
+	AllowAllByIPv6Rule = &Rule{
+		Peers: []networkingv1.NetworkPolicyPeer{
+			{
+				IPBlock: &networkingv1.IPBlock{
+					CIDR: "::/0",
+				},
+			},
+		},
+	}
+
+	AllowAllByIPv6 = &NetpolPeers{
+		Rules: []*Rule{AllowAllByIPv6Rule},
+	}
+
+	DenyAllByIPv6Rule = &Rule{
+		Peers: []networkingv1.NetworkPolicyPeer{
+			{
+				IPBlock: &networkingv1.IPBlock{
+					CIDR: "::/127",
+				},
+			},
+		},
+	}
+
+	DenyAllByIPv6 = &NetpolPeers{
+		Rules: []*Rule{DenyAllByIPv6Rule},
+	}
+
 	DenyAllByPodRule = &Rule{
 		Peers: []networkingv1.NetworkPolicyPeer{
 			{
@@ -229,6 +257,32 @@ func DenyAllIngressByPod(source *NetpolTarget) []*Netpol {
 	}
 }
 
+func DenyAllEgressAllowAllEgressByIPv6(source *NetpolTarget) []*Netpol {
+	return []*Netpol{
+		{Name: "deny-all-egress", Target: source, Egress: DenyAll},
+		{Name: "allow-all-egress-by-ipv6", Target: source, Egress: AllowAllByIPv6},
+	}
+}
+
+func DenyAllIngressAllowAllIngressByIPv6(source *NetpolTarget) []*Netpol {
+	return []*Netpol{
+		{Name: "deny-all-ingress", Target: source, Ingress: DenyAll},
+		{Name: "allow-all-ingress-by-ipv6", Target: source, Ingress: AllowAllByIPv6},
+	}
+}
+
+func DenyAllEgressByIPv6(source *NetpolTarget) []*Netpol {
+	return []*Netpol{
+		{Name: "deny-all-egress-by-ipv6", Target: source, Egress: DenyAllByIPv6},
+	}
+}
+
+func DenyAllIngressByIPv6(source *NetpolTarget) []*Netpol {
+	return []*Netpol{
+		{Name: "deny-all-ingress-by-ipv6", Target: source, Ingress: DenyAllByIPv6},
+	}
+}
+
 type ConflictGenerator struct {
 	AllowDNS    bool
 	Source      *NetpolTarget
@@ -262,6 +316,12 @@ func (c *ConflictGenerator) NetworkPolicies(source *NetpolTarget, dest *NetpolTa
 
 		DenyAllIngressByIP(source),
 		DenyAllIngressByPod(source),
+
+		// on a dual-stack cluster, these allow or deny only IPv6 traffic
+		DenyAllEgressAllowAllEgressByIPv6(source),
+		DenyAllIngressAllowAllIngressByIPv6(source),
+		DenyAllEgressByIPv6(source),
+		DenyAllIngressByIPv6(source),
 	}
 
 	var testCases []*TestCase
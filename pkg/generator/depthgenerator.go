@@ -38,13 +38,13 @@ var basePolicy = &Netpol{
 }
 
 type DepthGenerator struct {
-	PodIP    string
+	PodIPs   []string
 	AllowDNS bool
 }
 
-func NewDepthGenerator(allowDNS bool, podIP string) *DepthGenerator {
+func NewDepthGenerator(allowDNS bool, podIPs ...string) *DepthGenerator {
 	return &DepthGenerator{
-		PodIP:    podIP,
+		PodIPs:   podIPs,
 		AllowDNS: allowDNS,
 	}
 }
@@ -97,7 +97,7 @@ func (e *DepthGenerator) Policies() []*Netpol {
 
 		// ns/pod peer, ipblock peer
 		policies = append(policies, BuildPolicy(SetPeers(isIngress, emptySliceOfPeers)))
-		for _, peers := range DefaultPeers(e.PodIP) {
+		for _, peers := range DefaultPeers(e.PodIPs...) {
 			policies = append(policies, BuildPolicy(SetPeers(isIngress, []NetworkPolicyPeer{peers})))
 		}
 	}
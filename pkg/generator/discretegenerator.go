@@ -6,11 +6,11 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-func NewDefaultDiscreteGenerator(allowDNS bool, podIP string) *DiscreteGenerator {
+func NewDefaultDiscreteGenerator(allowDNS bool, podIPs ...string) *DiscreteGenerator {
 	return &DiscreteGenerator{
 		AllowDNS:   allowDNS,
 		Ports:      []NetworkPolicyPort{emptyPort, sctpOnAnyPort, implicitTCPOnPort80, explicitUDPOnPort80, namedPort81TPCP},
-		PodPeers:   DefaultPeers(podIP),
+		PodPeers:   DefaultPeers(podIPs...),
 		Targets:    DefaultTargets(),
 		Namespaces: DefaultNamespaces(),
 		// ingress
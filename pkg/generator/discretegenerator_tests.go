@@ -3,6 +3,7 @@ package generator
 import (
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	. "k8s.io/api/networking/v1"
 )
 
 func RunDiscreteGeneratorTests() {
@@ -11,5 +12,15 @@ func RunDiscreteGeneratorTests() {
 			cases := NewDefaultDiscreteGenerator(true, "1.2.3.4").GenerateTestCases()
 			Expect(len(cases)).To(Equal(43))
 		})
+
+		It("Builds ipBlocks around each of a dual-stack pod's IPs", func() {
+			peers := DefaultIPBlockPeers("10.0.1.15", "fd00::1:15")
+			Expect(peers).To(Equal([]NetworkPolicyPeer{
+				{IPBlock: &IPBlock{CIDR: "10.0.1.0/24"}},
+				{IPBlock: &IPBlock{CIDR: "10.0.1.0/24", Except: []string{"10.0.1.0/28"}}},
+				{IPBlock: &IPBlock{CIDR: "fd00::/64"}},
+				{IPBlock: &IPBlock{CIDR: "fd00::/64", Except: []string{"fd00::1:0/120"}}},
+			}))
+		})
 	})
 }
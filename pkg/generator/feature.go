@@ -49,6 +49,7 @@ const (
 	PeerFeatureNumberedPort       = "numbered port"
 	PeerFeatureNamedPort          = "named port"
 	PeerFeatureNilPort            = "nil port"
+	PeerFeaturePortRange          = "port range"
 	PeerFeatureNilProtocol        = "nil protocol"
 	PeerFeatureTCPProtocol        = "policy on TCP"
 	PeerFeatureUDPProtocol        = "policy on UDP"
@@ -289,6 +290,9 @@ func DefaultSinglePortFeature(isIngress bool, npPort NetworkPolicyPort, features
 			panic("invalid intstr value")
 		}
 	}
+	if npPort.EndPort != nil {
+		features[PeerFeaturePortRange] = true
+	}
 	if npPort.Protocol == nil {
 		features[PeerFeatureNilProtocol] = true
 	} else {
@@ -6,11 +6,11 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-func NewDefaultFragmentGenerator(allowDNS bool, namespaces []string, podIP string) *FragmentGenerator {
+func NewDefaultFragmentGenerator(allowDNS bool, namespaces []string, podIPs ...string) *FragmentGenerator {
 	return &FragmentGenerator{
 		AllowDNS:         allowDNS,
 		Ports:            DefaultPorts(),
-		PodPeers:         DefaultPeers(podIP),
+		PodPeers:         DefaultPeers(podIPs...),
 		Targets:          DefaultTargets(),
 		Namespaces:       namespaces,
 		TypicalPorts:     TypicalPorts,
@@ -1,7 +1,9 @@
 package generator
 
 import (
-	"fmt"
+	"github.com/mattfenwick/cyclonus/pkg/kube"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
 	. "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -110,25 +112,48 @@ var (
 	}
 )
 
-func DefaultIPBlockPeers(podIP string) []NetworkPolicyPeer {
-	cidr24 := fmt.Sprintf("%s/24", podIP)
-	//cidr26 := fmt.Sprintf("%s/26", podIP)
-	cidr28 := fmt.Sprintf("%s/28", podIP)
-	//cidr30 := fmt.Sprintf("%s/30", podIP)
-	return []NetworkPolicyPeer{
-		{
-			IPBlock: &IPBlock{
-				CIDR:   cidr24,
-				Except: nil,
-			},
-		},
-		{
-			IPBlock: &IPBlock{
-				CIDR:   cidr24,
-				Except: []string{cidr28},
+// ipBlockPrefixLengths are the prefix lengths of the ipBlocks built around a pod's IP, and of their excepts
+var ipBlockPrefixLengths = map[v1.IPFamily]struct{ CIDR, Except int }{
+	v1.IPv4Protocol: {CIDR: 24, Except: 28},
+	v1.IPv6Protocol: {CIDR: 64, Except: 120},
+}
+
+// ipBlockCIDRs builds a CIDR containing podIP, and a smaller CIDR within it -- also containing podIP -- to
+// use as an except
+func ipBlockCIDRs(podIP string) (string, string) {
+	prefixLengths := ipBlockPrefixLengths[kube.GetIPFamily(podIP)]
+	cidr, err := kube.CIDRContainingIP(podIP, prefixLengths.CIDR)
+	if err != nil {
+		panic(errors.Wrapf(err, "unable to build ipblock for pod ip '%s'", podIP))
+	}
+	except, err := kube.CIDRContainingIP(podIP, prefixLengths.Except)
+	if err != nil {
+		panic(errors.Wrapf(err, "unable to build ipblock except for pod ip '%s'", podIP))
+	}
+	return cidr, except
+}
+
+// DefaultIPBlockPeers builds ipBlock peers, with and without an except, around each of a pod's IPs -- one
+// per family on a dual-stack cluster
+func DefaultIPBlockPeers(podIPs ...string) []NetworkPolicyPeer {
+	var peers []NetworkPolicyPeer
+	for _, podIP := range podIPs {
+		cidr, except := ipBlockCIDRs(podIP)
+		peers = append(peers,
+			NetworkPolicyPeer{
+				IPBlock: &IPBlock{
+					CIDR:   cidr,
+					Except: nil,
+				},
 			},
-		},
+			NetworkPolicyPeer{
+				IPBlock: &IPBlock{
+					CIDR:   cidr,
+					Except: []string{except},
+				},
+			})
 	}
+	return peers
 }
 
 func DefaultPodPeers() []NetworkPolicyPeer {
@@ -149,8 +174,8 @@ func DefaultPodPeers() []NetworkPolicyPeer {
 	return peers
 }
 
-func DefaultPeers(podIP string) []NetworkPolicyPeer {
-	return append(DefaultPodPeers(), DefaultIPBlockPeers(podIP)...)
+func DefaultPeers(podIPs ...string) []NetworkPolicyPeer {
+	return append(DefaultPodPeers(), DefaultIPBlockPeers(podIPs...)...)
 }
 
 var (
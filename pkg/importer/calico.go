@@ -0,0 +1,443 @@
+package importer
+
+import (
+	"fmt"
+	"github.com/mattfenwick/cyclonus/pkg/kube"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// These types mirror the subset of projectcalico.org/v3 NetworkPolicy and GlobalNetworkPolicy needed for
+// translation.  Unsupported fields are kept as opaque values, so that their presence can be reported.
+
+type CalicoNetworkPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              CalicoPolicySpec `json:"spec"`
+}
+
+type CalicoGlobalNetworkPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              CalicoPolicySpec `json:"spec"`
+}
+
+type CalicoPolicySpec struct {
+	Order    *float64     `json:"order,omitempty"`
+	Selector string       `json:"selector,omitempty"`
+	Types    []string     `json:"types,omitempty"`
+	Ingress  []CalicoRule `json:"ingress,omitempty"`
+	Egress   []CalicoRule `json:"egress,omitempty"`
+	// NamespaceSelector is only used by GlobalNetworkPolicy
+	NamespaceSelector string `json:"namespaceSelector,omitempty"`
+
+	ServiceAccountSelector string `json:"serviceAccountSelector,omitempty"`
+	DoNotTrack             bool   `json:"doNotTrack,omitempty"`
+	PreDNAT                bool   `json:"preDNAT,omitempty"`
+	ApplyOnForward         bool   `json:"applyOnForward,omitempty"`
+}
+
+type CalicoRuleAction string
+
+const (
+	CalicoRuleActionAllow CalicoRuleAction = "Allow"
+	CalicoRuleActionDeny  CalicoRuleAction = "Deny"
+	CalicoRuleActionLog   CalicoRuleAction = "Log"
+	CalicoRuleActionPass  CalicoRuleAction = "Pass"
+)
+
+type CalicoRule struct {
+	Action      CalicoRuleAction    `json:"action"`
+	IPVersion   *int                `json:"ipVersion,omitempty"`
+	Protocol    *intstr.IntOrString `json:"protocol,omitempty"`
+	Source      CalicoEntityRule    `json:"source,omitempty"`
+	Destination CalicoEntityRule    `json:"destination,omitempty"`
+
+	NotProtocol *intstr.IntOrString `json:"notProtocol,omitempty"`
+	ICMP        interface{}         `json:"icmp,omitempty"`
+	NotICMP     interface{}         `json:"notICMP,omitempty"`
+	HTTP        interface{}         `json:"http,omitempty"`
+}
+
+type CalicoEntityRule struct {
+	Nets              []string             `json:"nets,omitempty"`
+	NotNets           []string             `json:"notNets,omitempty"`
+	Selector          string               `json:"selector,omitempty"`
+	NamespaceSelector string               `json:"namespaceSelector,omitempty"`
+	Ports             []intstr.IntOrString `json:"ports,omitempty"`
+
+	NotSelector     string               `json:"notSelector,omitempty"`
+	NotPorts        []intstr.IntOrString `json:"notPorts,omitempty"`
+	ServiceAccounts interface{}          `json:"serviceAccounts,omitempty"`
+	Services        interface{}          `json:"services,omitempty"`
+}
+
+func (e CalicoEntityRule) isEmpty() bool {
+	return len(e.Nets) == 0 && len(e.NotNets) == 0 && e.Selector == "" && e.NamespaceSelector == "" &&
+		len(e.Ports) == 0 && e.NotSelector == "" && len(e.NotPorts) == 0 && e.ServiceAccounts == nil && e.Services == nil
+}
+
+func ImportCalicoNetworkPolicy(policy *CalicoNetworkPolicy) *Result {
+	netpol := newNetworkPolicy(CalicoNetworkPolicyPrefix, policy.Namespace, policy.Name)
+	w := &warnings{policy: netpol}
+	if policy.Spec.NamespaceSelector != "" {
+		w.add("namespaceSelector is only valid on GlobalNetworkPolicy; ignored")
+	}
+	return &Result{Policies: translateCalicoSpec(policy.Spec, netpol, false, w), Warnings: w.warnings}
+}
+
+// ImportCalicoGlobalNetworkPolicy produces a NetworkPolicy for every namespace in the options which
+// the policy's namespaceSelector matches
+func ImportCalicoGlobalNetworkPolicy(policy *CalicoGlobalNetworkPolicy, options *Options) *Result {
+	w := &warnings{policy: newNetworkPolicy(CalicoGlobalNetworkPolicyPrefix, "", policy.Name)}
+	namespaceSelectors, err := ParseCalicoSelector(policy.Spec.NamespaceSelector)
+	if err != nil {
+		w.add("policy dropped: namespaceSelector: %s", err.Error())
+		return &Result{Warnings: w.warnings}
+	}
+	if options == nil || len(options.Namespaces) == 0 {
+		w.add("policy dropped: no namespaces known to apply global policy to")
+		return &Result{Warnings: w.warnings}
+	}
+
+	var namespaces []string
+	for ns, labels := range options.Namespaces {
+		for _, namespaceSelector := range namespaceSelectors {
+			if kube.IsLabelsMatchLabelSelector(labels, namespaceSelector) {
+				namespaces = append(namespaces, ns)
+				break
+			}
+		}
+	}
+	sort.Strings(namespaces)
+
+	result := &Result{}
+	for i, ns := range namespaces {
+		netpol := newNetworkPolicy(CalicoGlobalNetworkPolicyPrefix, ns, policy.Name)
+		nsWarnings := &warnings{policy: netpol}
+		result.Policies = append(result.Policies, translateCalicoSpec(policy.Spec, netpol, true, nsWarnings)...)
+		// the same constructs are unsupported in every namespace: only report them once
+		if i == 0 {
+			result.Warnings = nsWarnings.warnings
+		}
+	}
+	return result
+}
+
+// translateCalicoSpec fills in the NetworkPolicy's spec, and returns nothing if the policy can't be translated at
+// all.  If the selector has several alternatives, a copy of the policy is returned for each of them.
+func translateCalicoSpec(spec CalicoPolicySpec, netpol *networkingv1.NetworkPolicy, isGlobal bool, w *warnings) []*networkingv1.NetworkPolicy {
+	podSelectors, err := ParseCalicoSelector(spec.Selector)
+	if err != nil {
+		w.add("policy dropped: selector: %s", err.Error())
+		return nil
+	}
+	netpol.Spec.PodSelector = podSelectors[0]
+
+	if spec.ServiceAccountSelector != "" {
+		w.add("serviceAccountSelector ignored: imported policy applies to more pods than the original")
+	}
+	if spec.DoNotTrack || spec.PreDNAT || spec.ApplyOnForward {
+		w.add("doNotTrack, preDNAT and applyOnForward apply to host endpoints, which aren't modeled; policy dropped")
+		return nil
+	}
+
+	// Calico's default: ingress if there are ingress rules -- or no rules at all -- and egress if there are egress rules
+	types := spec.Types
+	if len(types) == 0 {
+		if len(spec.Ingress) > 0 || len(spec.Egress) == 0 {
+			types = append(types, "Ingress")
+		}
+		if len(spec.Egress) > 0 {
+			types = append(types, "Egress")
+		}
+	}
+	for _, policyType := range types {
+		switch policyType {
+		case "Ingress":
+			netpol.Spec.PolicyTypes = append(netpol.Spec.PolicyTypes, networkingv1.PolicyTypeIngress)
+		case "Egress":
+			netpol.Spec.PolicyTypes = append(netpol.Spec.PolicyTypes, networkingv1.PolicyTypeEgress)
+		default:
+			w.add("unknown policy type '%s' ignored", policyType)
+		}
+	}
+
+	for i, rule := range spec.Ingress {
+		if len(rule.Destination.Nets) > 0 || len(rule.Destination.NotNets) > 0 || rule.Destination.Selector != "" ||
+			rule.Destination.NamespaceSelector != "" || rule.Destination.NotSelector != "" || len(rule.Destination.NotPorts) > 0 ||
+			rule.Destination.ServiceAccounts != nil || rule.Destination.Services != nil {
+			w.add("ingress[%d] dropped: destination may only restrict ports", i)
+			continue
+		}
+		peers, ports, ok := translateCalicoRule(rule, rule.Source, rule.Destination.Ports, "ingress", i, isGlobal, w)
+		if ok {
+			netpol.Spec.Ingress = append(netpol.Spec.Ingress, networkingv1.NetworkPolicyIngressRule{From: peers, Ports: ports})
+		}
+	}
+	for i, rule := range spec.Egress {
+		if !rule.Source.isEmpty() {
+			w.add("egress[%d] dropped: source may not be restricted", i)
+			continue
+		}
+		peers, ports, ok := translateCalicoRule(rule, rule.Destination, rule.Destination.Ports, "egress", i, isGlobal, w)
+		if ok {
+			netpol.Spec.Egress = append(netpol.Spec.Egress, networkingv1.NetworkPolicyEgressRule{To: peers, Ports: ports})
+		}
+	}
+
+	policies := []*networkingv1.NetworkPolicy{netpol}
+	for i, podSelector := range podSelectors[1:] {
+		alternative := netpol.DeepCopy()
+		alternative.Name = fmt.Sprintf("%s.%d", netpol.Name, i+2)
+		alternative.Spec.PodSelector = podSelector
+		policies = append(policies, alternative)
+	}
+	return policies
+}
+
+func translateCalicoRule(rule CalicoRule, peer CalicoEntityRule, ports []intstr.IntOrString, direction string, index int, isGlobal bool, w *warnings) ([]networkingv1.NetworkPolicyPeer, []networkingv1.NetworkPolicyPort, bool) {
+	switch rule.Action {
+	case CalicoRuleActionAllow:
+	case CalicoRuleActionLog:
+		// logging doesn't affect whether traffic is allowed
+		return nil, nil, false
+	default:
+		w.add("%s[%d] dropped: action '%s' is not supported; imported policy may allow more than the original", direction, index, rule.Action)
+		return nil, nil, false
+	}
+	if rule.NotProtocol != nil || rule.ICMP != nil || rule.NotICMP != nil || rule.HTTP != nil {
+		w.add("%s[%d] dropped: notProtocol, icmp, notICMP and http are not supported", direction, index)
+		return nil, nil, false
+	}
+	if rule.IPVersion != nil {
+		w.add("%s[%d]: ipVersion ignored; imported policy may allow more than the original", direction, index)
+	}
+	if direction == "ingress" && (len(rule.Source.Ports) > 0 || len(rule.Source.NotPorts) > 0) {
+		w.add("%s[%d] dropped: source ports are not supported", direction, index)
+		return nil, nil, false
+	}
+
+	netpolPeers, err := translateCalicoEntity(peer, isGlobal)
+	if err != nil {
+		w.add("%s[%d] dropped: %s", direction, index, err.Error())
+		return nil, nil, false
+	}
+	netpolPorts, err := translateCalicoPorts(rule.Protocol, ports)
+	if err != nil {
+		w.add("%s[%d] dropped: %s", direction, index, err.Error())
+		return nil, nil, false
+	}
+	return netpolPeers, netpolPorts, true
+}
+
+func translateCalicoEntity(entity CalicoEntityRule, isGlobal bool) ([]networkingv1.NetworkPolicyPeer, error) {
+	if entity.NotSelector != "" || len(entity.NotPorts) > 0 || entity.ServiceAccounts != nil || entity.Services != nil {
+		return nil, errors.Errorf("notSelector, notPorts, serviceAccounts and services are not supported")
+	}
+	hasSelector := entity.Selector != "" || entity.NamespaceSelector != ""
+	if len(entity.Nets) > 0 && hasSelector {
+		return nil, errors.Errorf("nets can't be combined with selectors")
+	}
+	if len(entity.NotNets) > 0 && len(entity.Nets) == 0 {
+		return nil, errors.Errorf("notNets without nets is not supported")
+	}
+
+	if len(entity.Nets) > 0 {
+		var peers []networkingv1.NetworkPolicyPeer
+		for _, cidr := range entity.Nets {
+			ipBlock := &networkingv1.IPBlock{CIDR: cidr}
+			for _, notNet := range entity.NotNets {
+				isWithin, err := kube.IsCIDRWithinCIDR(notNet, cidr)
+				if err != nil {
+					return nil, err
+				}
+				if isWithin {
+					ipBlock.Except = append(ipBlock.Except, notNet)
+				}
+			}
+			peers = append(peers, networkingv1.NetworkPolicyPeer{IPBlock: ipBlock})
+		}
+		return peers, nil
+	}
+
+	if !hasSelector {
+		return nil, nil
+	}
+	// a peer for each combination of the selectors' alternatives
+	peers := []networkingv1.NetworkPolicyPeer{{}}
+	if entity.Selector != "" || !isGlobal {
+		podSelectors, err := ParseCalicoSelector(entity.Selector)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "selector")
+		}
+		var podPeers []networkingv1.NetworkPolicyPeer
+		for _, peer := range peers {
+			for i := range podSelectors {
+				peer.PodSelector = &podSelectors[i]
+				podPeers = append(podPeers, peer)
+			}
+		}
+		peers = podPeers
+	}
+	// in a global policy, a selector without a namespaceSelector matches pods in every namespace
+	if entity.NamespaceSelector != "" || isGlobal {
+		namespaceSelectors, err := ParseCalicoSelector(entity.NamespaceSelector)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "namespaceSelector")
+		}
+		var namespacePeers []networkingv1.NetworkPolicyPeer
+		for _, peer := range peers {
+			for i := range namespaceSelectors {
+				peer.NamespaceSelector = &namespaceSelectors[i]
+				namespacePeers = append(namespacePeers, peer)
+			}
+		}
+		peers = namespacePeers
+	}
+	return peers, nil
+}
+
+func translateCalicoPorts(protocol *intstr.IntOrString, ports []intstr.IntOrString) ([]networkingv1.NetworkPolicyPort, error) {
+	if protocol == nil {
+		if len(ports) > 0 {
+			return nil, errors.Errorf("ports require a protocol")
+		}
+		return nil, nil
+	}
+	var netpolProtocol v1.Protocol
+	switch strings.ToUpper(protocol.String()) {
+	case "TCP", "6":
+		netpolProtocol = v1.ProtocolTCP
+	case "UDP", "17":
+		netpolProtocol = v1.ProtocolUDP
+	case "SCTP", "132":
+		netpolProtocol = v1.ProtocolSCTP
+	default:
+		return nil, errors.Errorf("protocol '%s' is not supported", protocol.String())
+	}
+
+	if len(ports) == 0 {
+		return []networkingv1.NetworkPolicyPort{{Protocol: &netpolProtocol}}, nil
+	}
+	var netpolPorts []networkingv1.NetworkPolicyPort
+	for _, port := range ports {
+		netpolPort := networkingv1.NetworkPolicyPort{Protocol: &netpolProtocol}
+		if port.Type == intstr.Int {
+			p := port
+			netpolPort.Port = &p
+		} else if pieces := strings.Split(port.StrVal, ":"); len(pieces) == 2 {
+			start, startErr := strconv.Atoi(pieces[0])
+			end, endErr := strconv.Atoi(pieces[1])
+			if startErr != nil || endErr != nil {
+				return nil, errors.Errorf("invalid port range '%s'", port.StrVal)
+			}
+			p := intstr.FromInt(start)
+			endPort := int32(end)
+			netpolPort.Port, netpolPort.EndPort = &p, &endPort
+		} else if number, err := strconv.Atoi(port.StrVal); err == nil {
+			p := intstr.FromInt(number)
+			netpolPort.Port = &p
+		} else {
+			p := port
+			netpolPort.Port = &p
+		}
+		netpolPorts = append(netpolPorts, netpolPort)
+	}
+	return netpolPorts, nil
+}
+
+var (
+	calicoQuoted          = `(?:'([^']*)'|"([^"]*)")`
+	calicoKey             = `([A-Za-z0-9_./-]+)`
+	calicoEqualRegex      = regexp.MustCompile(`^` + calicoKey + `\s*(==|!=)\s*` + calicoQuoted + `$`)
+	calicoInRegex         = regexp.MustCompile(`^` + calicoKey + `\s+(in|not in)\s*\{([^}]*)\}$`)
+	calicoHasRegex        = regexp.MustCompile(`^(!?)\s*has\(\s*` + calicoKey + `\s*\)$`)
+	calicoSetElementRegex = regexp.MustCompile(calicoQuoted)
+)
+
+// ParseCalicoSelector translates the subset of Calico's selector syntax which maps onto label selectors:
+// conjunctions (&&) of ==, !=, in, not in, has() and !has() terms, and all().  An empty selector selects everything.
+// Calico's != and not in also match endpoints without the label, but a NotIn expression doesn't: so each of those
+// terms splits the selector into two alternatives, one of which requires the label to be absent.  The selector
+// matches an endpoint if any of the returned label selectors does.
+func ParseCalicoSelector(selector string) ([]metav1.LabelSelector, error) {
+	alternatives := []metav1.LabelSelector{{}}
+	selector = strings.TrimSpace(selector)
+	if selector == "" || selector == "all()" {
+		return alternatives, nil
+	}
+	for _, term := range strings.Split(selector, "&&") {
+		term = strings.TrimSpace(term)
+		if term == "all()" {
+			continue
+		}
+		if match := calicoEqualRegex.FindStringSubmatch(term); match != nil {
+			value := match[3] + match[4]
+			if match[2] == "==" {
+				for i := range alternatives {
+					if alternatives[i].MatchLabels == nil {
+						alternatives[i].MatchLabels = map[string]string{}
+					}
+					alternatives[i].MatchLabels[match[1]] = value
+				}
+			} else {
+				alternatives = splitCalicoNegation(alternatives, match[1], []string{value})
+			}
+		} else if match := calicoInRegex.FindStringSubmatch(term); match != nil {
+			var values []string
+			for _, element := range calicoSetElementRegex.FindAllStringSubmatch(match[3], -1) {
+				values = append(values, element[1]+element[2])
+			}
+			if match[2] == "not in" {
+				alternatives = splitCalicoNegation(alternatives, match[1], values)
+			} else {
+				alternatives = addCalicoRequirement(alternatives, metav1.LabelSelectorRequirement{
+					Key: match[1], Operator: metav1.LabelSelectorOpIn, Values: values,
+				})
+			}
+		} else if match := calicoHasRegex.FindStringSubmatch(term); match != nil {
+			operator := metav1.LabelSelectorOpExists
+			if match[1] == "!" {
+				operator = metav1.LabelSelectorOpDoesNotExist
+			}
+			alternatives = addCalicoRequirement(alternatives, metav1.LabelSelectorRequirement{
+				Key: match[2], Operator: operator,
+			})
+		} else {
+			return nil, errors.Errorf("unsupported selector term '%s' in '%s'", term, selector)
+		}
+	}
+	return alternatives, nil
+}
+
+func addCalicoRequirement(alternatives []metav1.LabelSelector, requirement metav1.LabelSelectorRequirement) []metav1.LabelSelector {
+	for i := range alternatives {
+		alternatives[i].MatchExpressions = append(alternatives[i].MatchExpressions, requirement)
+	}
+	return alternatives
+}
+
+// splitCalicoNegation replaces each alternative with one where the label has none of the values, and one where it's
+// absent
+func splitCalicoNegation(alternatives []metav1.LabelSelector, key string, values []string) []metav1.LabelSelector {
+	var split []metav1.LabelSelector
+	for _, alternative := range alternatives {
+		absent := alternative.DeepCopy()
+		absent.MatchExpressions = append(absent.MatchExpressions, metav1.LabelSelectorRequirement{
+			Key: key, Operator: metav1.LabelSelectorOpDoesNotExist,
+		})
+		alternative.MatchExpressions = append(alternative.MatchExpressions, metav1.LabelSelectorRequirement{
+			Key: key, Operator: metav1.LabelSelectorOpNotIn, Values: values,
+		})
+		split = append(split, alternative, *absent)
+	}
+	return split
+}
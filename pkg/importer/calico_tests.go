@@ -0,0 +1,273 @@
+package importer
+
+import (
+	"github.com/mattfenwick/cyclonus/pkg/linter"
+	"github.com/mattfenwick/cyclonus/pkg/matcher"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func mustImportYaml(yaml string, options *Options) *Result {
+	result, err := ImportYaml([]byte(yaml), options)
+	Expect(err).To(BeNil())
+	return result
+}
+
+func internalTraffic(fromNs string, fromLabels map[string]string, toNs string, toLabels map[string]string, port int, protocol v1.Protocol) *matcher.Traffic {
+	return &matcher.Traffic{
+		Source: &matcher.TrafficPeer{
+			Internal: &matcher.InternalPeer{PodLabels: fromLabels, NamespaceLabels: map[string]string{"ns": fromNs}, Namespace: fromNs},
+			IP:       "192.168.0.1",
+		},
+		Destination: &matcher.TrafficPeer{
+			Internal: &matcher.InternalPeer{PodLabels: toLabels, NamespaceLabels: map[string]string{"ns": toNs}, Namespace: toNs},
+			IP:       "192.168.0.2",
+		},
+		ResolvedPort: port,
+		Protocol:     protocol,
+	}
+}
+
+func RunCalicoTests() {
+	Describe("Calico selectors", func() {
+		It("should parse conjunctions of supported terms", func() {
+			selectors, err := ParseCalicoSelector(`role == 'db' && env in {'dev', 'prod'} && has(team) && !has(legacy) && all()`)
+			Expect(err).To(BeNil())
+			Expect(selectors).To(Equal([]metav1.LabelSelector{{
+				MatchLabels: map[string]string{"role": "db"},
+				MatchExpressions: []metav1.LabelSelectorRequirement{
+					{Key: "env", Operator: metav1.LabelSelectorOpIn, Values: []string{"dev", "prod"}},
+					{Key: "team", Operator: metav1.LabelSelectorOpExists},
+					{Key: "legacy", Operator: metav1.LabelSelectorOpDoesNotExist},
+				},
+			}}))
+		})
+
+		It("should split != and not in into alternatives with and without the label", func() {
+			selectors, err := ParseCalicoSelector(`role == 'db' && tier != "backend" && env not in {'dev'}`)
+			Expect(err).To(BeNil())
+			notIn := func(key string, value string) metav1.LabelSelectorRequirement {
+				return metav1.LabelSelectorRequirement{Key: key, Operator: metav1.LabelSelectorOpNotIn, Values: []string{value}}
+			}
+			absent := func(key string) metav1.LabelSelectorRequirement {
+				return metav1.LabelSelectorRequirement{Key: key, Operator: metav1.LabelSelectorOpDoesNotExist}
+			}
+			role := map[string]string{"role": "db"}
+			Expect(selectors).To(Equal([]metav1.LabelSelector{
+				{MatchLabels: role, MatchExpressions: []metav1.LabelSelectorRequirement{notIn("tier", "backend"), notIn("env", "dev")}},
+				{MatchLabels: role, MatchExpressions: []metav1.LabelSelectorRequirement{notIn("tier", "backend"), absent("env")}},
+				{MatchLabels: role, MatchExpressions: []metav1.LabelSelectorRequirement{absent("tier"), notIn("env", "dev")}},
+				{MatchLabels: role, MatchExpressions: []metav1.LabelSelectorRequirement{absent("tier"), absent("env")}},
+			}))
+		})
+
+		It("should reject disjunctions", func() {
+			_, err := ParseCalicoSelector(`role == 'db' || role == 'cache'`)
+			Expect(err).ToNot(BeNil())
+		})
+	})
+
+	Describe("Calico network policies", func() {
+		It("should translate allow rules, and warn about deny rules", func() {
+			result := mustImportYaml(`
+apiVersion: projectcalico.org/v3
+kind: NetworkPolicy
+metadata: {name: allow-frontend, namespace: x}
+spec:
+  selector: role == 'db'
+  ingress:
+  - action: Deny
+    source:
+      selector: role == 'untrusted'
+  - action: Allow
+    protocol: TCP
+    source:
+      selector: role == 'frontend'
+    destination:
+      ports: [6379, "8000:9000"]
+  - action: Allow
+    source:
+      nets: [10.0.0.0/16]
+      notNets: [10.0.1.0/24]`, nil)
+			Expect(result.Policies).To(HaveLen(1))
+			netpol := result.Policies[0]
+			Expect(netpol.Name).To(Equal("calico.allow-frontend"))
+			Expect(netpol.Spec.PolicyTypes).To(Equal([]networkingv1.PolicyType{networkingv1.PolicyTypeIngress}))
+			Expect(netpol.Spec.PodSelector).To(Equal(metav1.LabelSelector{MatchLabels: map[string]string{"role": "db"}}))
+
+			tcp, port6379, port8000, endPort := v1.ProtocolTCP, intstr.FromInt(6379), intstr.FromInt(8000), int32(9000)
+			Expect(netpol.Spec.Ingress).To(Equal([]networkingv1.NetworkPolicyIngressRule{
+				{
+					From: []networkingv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"role": "frontend"}}}},
+					Ports: []networkingv1.NetworkPolicyPort{
+						{Protocol: &tcp, Port: &port6379},
+						{Protocol: &tcp, Port: &port8000, EndPort: &endPort},
+					},
+				},
+				{From: []networkingv1.NetworkPolicyPeer{{IPBlock: &networkingv1.IPBlock{CIDR: "10.0.0.0/16", Except: []string{"10.0.1.0/24"}}}}},
+			}))
+
+			Expect(result.Warnings).To(HaveLen(1))
+			Expect(result.Warnings[0].Check).To(Equal(linter.CheckSourceUnsupportedDialectConstruct))
+			Expect(result.Warnings[0].SourcePolicy).To(Equal(netpol))
+			Expect(result.Warnings[0].Detail).To(ContainSubstring("ingress[0] dropped: action 'Deny'"))
+
+			policy := matcher.BuildNetworkPolicies(result.Policies)
+			db, frontend := map[string]string{"role": "db"}, map[string]string{"role": "frontend"}
+			Expect(policy.IsTrafficAllowed(internalTraffic("x", frontend, "x", db, 6379, v1.ProtocolTCP)).IsAllowed()).To(BeTrue())
+			Expect(policy.IsTrafficAllowed(internalTraffic("x", frontend, "x", db, 80, v1.ProtocolTCP)).IsAllowed()).To(BeFalse())
+		})
+
+		It("should default to egress if there are egress rules, and drop unsupported rules", func() {
+			result := mustImportYaml(`
+apiVersion: projectcalico.org/v3
+kind: NetworkPolicy
+metadata: {name: egress, namespace: x}
+spec:
+  selector: all()
+  egress:
+  - action: Allow
+    protocol: UDP
+    destination:
+      namespaceSelector: name == 'kube-system'
+      ports: [53]
+  - action: Allow
+    protocol: ICMP
+  - action: Allow
+    destination:
+      services: {name: kubernetes, namespace: default}`, nil)
+			Expect(result.Policies).To(HaveLen(1))
+			netpol := result.Policies[0]
+			Expect(netpol.Spec.PolicyTypes).To(Equal([]networkingv1.PolicyType{networkingv1.PolicyTypeEgress}))
+			Expect(netpol.Spec.Egress).To(HaveLen(1))
+			Expect(netpol.Spec.Egress[0].To).To(Equal([]networkingv1.NetworkPolicyPeer{{
+				PodSelector:       &metav1.LabelSelector{},
+				NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"name": "kube-system"}},
+			}}))
+			Expect(result.Warnings).To(HaveLen(2))
+		})
+
+		It("should default to ingress if there are no rules, and to both if there are both kinds of rules", func() {
+			result := mustImportYaml(`
+apiVersion: projectcalico.org/v3
+kind: NetworkPolicy
+metadata: {name: deny-all, namespace: x}
+spec:
+  selector: all()
+---
+apiVersion: projectcalico.org/v3
+kind: NetworkPolicy
+metadata: {name: both, namespace: x}
+spec:
+  selector: all()
+  ingress:
+  - action: Allow
+  egress:
+  - action: Allow`, nil)
+			Expect(result.Policies).To(HaveLen(2))
+			Expect(result.Policies[0].Spec.PolicyTypes).To(Equal([]networkingv1.PolicyType{networkingv1.PolicyTypeIngress}))
+			Expect(result.Policies[1].Spec.PolicyTypes).To(Equal([]networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress}))
+		})
+
+		It("should match endpoints without the label of a != selector", func() {
+			result := mustImportYaml(`
+apiVersion: projectcalico.org/v3
+kind: NetworkPolicy
+metadata: {name: not-legacy, namespace: x}
+spec:
+  selector: tier != 'legacy'
+  ingress:
+  - action: Allow
+    source:
+      selector: role != 'untrusted'`, nil)
+			Expect(result.Warnings).To(BeEmpty())
+			Expect(result.Policies).To(HaveLen(2))
+			Expect(result.Policies[1].Name).To(Equal("calico.not-legacy.2"))
+			Expect(result.Policies[0].Spec.Ingress[0].From).To(HaveLen(2))
+
+			policy := matcher.BuildNetworkPolicies(result.Policies)
+			unlabelled, untrusted, legacy := map[string]string{}, map[string]string{"role": "untrusted"}, map[string]string{"tier": "legacy"}
+			Expect(policy.IsTrafficAllowed(internalTraffic("x", unlabelled, "x", unlabelled, 80, v1.ProtocolTCP)).IsAllowed()).To(BeTrue())
+			Expect(policy.IsTrafficAllowed(internalTraffic("x", untrusted, "x", unlabelled, 80, v1.ProtocolTCP)).IsAllowed()).To(BeFalse())
+			Expect(policy.IsTrafficAllowed(internalTraffic("x", untrusted, "x", legacy, 80, v1.ProtocolTCP)).IsAllowed()).To(BeTrue())
+			Expect(policy.TargetsApplyingToPod(true, "x", unlabelled)).To(HaveLen(1))
+		})
+	})
+
+	Describe("Calico global network policies", func() {
+		It("should produce a policy for each matching namespace", func() {
+			result := mustImportYaml(`
+apiVersion: projectcalico.org/v3
+kind: GlobalNetworkPolicy
+metadata: {name: allow-monitoring}
+spec:
+  namespaceSelector: env == 'prod'
+  selector: has(app)
+  ingress:
+  - action: Allow
+    source:
+      selector: app == 'prometheus'
+  - action: Pass`, &Options{Namespaces: map[string]map[string]string{
+				"x": {"env": "prod"},
+				"y": {"env": "prod"},
+				"z": {"env": "dev"},
+			}})
+			Expect(result.Policies).To(HaveLen(2))
+			Expect(result.Policies[0].Namespace).To(Equal("x"))
+			Expect(result.Policies[1].Namespace).To(Equal("y"))
+			Expect(result.Policies[0].Name).To(Equal("calico-global.allow-monitoring"))
+			Expect(result.Policies[0].Spec.Ingress[0].From).To(Equal([]networkingv1.NetworkPolicyPeer{{
+				PodSelector:       &metav1.LabelSelector{MatchLabels: map[string]string{"app": "prometheus"}},
+				NamespaceSelector: &metav1.LabelSelector{},
+			}}))
+			Expect(result.Warnings).To(HaveLen(1))
+		})
+
+		It("should drop a global policy if no namespaces are known", func() {
+			result := mustImportYaml(`
+apiVersion: projectcalico.org/v3
+kind: GlobalNetworkPolicy
+metadata: {name: deny-all}
+spec:
+  selector: all()`, nil)
+			Expect(result.Policies).To(BeEmpty())
+			Expect(result.Warnings).To(HaveLen(1))
+		})
+	})
+
+	Describe("Yaml streams", func() {
+		It("should import every document, applying global policies to the stream's namespaces, and reject unsupported kinds", func() {
+			result := mustImportYaml(`
+apiVersion: projectcalico.org/v3
+kind: NetworkPolicy
+metadata: {name: a, namespace: x}
+spec: {selector: all()}
+---
+apiVersion: cilium.io/v2
+kind: CiliumNetworkPolicy
+metadata: {name: b, namespace: x}
+spec:
+  endpointSelector: {}
+  ingress: []
+---
+apiVersion: projectcalico.org/v3
+kind: GlobalNetworkPolicy
+metadata: {name: c}
+spec: {selector: all()}
+`, nil)
+			Expect(result.Policies).To(HaveLen(3))
+			Expect(result.Policies[2].Namespace).To(Equal("x"))
+			Expect(result.Policies[2].Name).To(Equal("calico-global.c"))
+
+			_, err := ImportYaml([]byte(`
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata: {name: a, namespace: x}`), nil)
+			Expect(err).ToNot(BeNil())
+		})
+	})
+}
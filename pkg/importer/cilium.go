@@ -0,0 +1,367 @@
+package importer
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"strconv"
+	"strings"
+)
+
+// These types mirror the subset of cilium.io/v2 CiliumNetworkPolicy needed for translation.  Unsupported
+// fields are kept as opaque values, so that their presence can be reported.
+
+const (
+	// ciliumNamespaceLabel selects endpoints by namespace name
+	ciliumNamespaceLabel = "io.kubernetes.pod.namespace"
+	// ciliumNamespaceLabelsPrefix selects endpoints by namespace labels
+	ciliumNamespaceLabelsPrefix = "io.cilium.k8s.namespace.labels."
+	// namespaceNameLabel is set automatically on every namespace since kubernetes 1.21
+	namespaceNameLabel = "kubernetes.io/metadata.name"
+)
+
+type CiliumNetworkPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              *CiliumRule  `json:"spec,omitempty"`
+	Specs             []CiliumRule `json:"specs,omitempty"`
+}
+
+type CiliumRule struct {
+	EndpointSelector metav1.LabelSelector `json:"endpointSelector"`
+	Ingress          []CiliumIngressRule  `json:"ingress,omitempty"`
+	Egress           []CiliumEgressRule   `json:"egress,omitempty"`
+
+	NodeSelector *metav1.LabelSelector `json:"nodeSelector,omitempty"`
+	IngressDeny  []interface{}         `json:"ingressDeny,omitempty"`
+	EgressDeny   []interface{}         `json:"egressDeny,omitempty"`
+}
+
+type CiliumCIDRRule struct {
+	CIDR   string   `json:"cidr"`
+	Except []string `json:"except,omitempty"`
+}
+
+type CiliumIngressRule struct {
+	FromEndpoints []metav1.LabelSelector `json:"fromEndpoints,omitempty"`
+	FromCIDR      []string               `json:"fromCIDR,omitempty"`
+	FromCIDRSet   []CiliumCIDRRule       `json:"fromCIDRSet,omitempty"`
+	FromEntities  []string               `json:"fromEntities,omitempty"`
+	ToPorts       []CiliumPortRule       `json:"toPorts,omitempty"`
+
+	FromRequires   interface{} `json:"fromRequires,omitempty"`
+	FromGroups     interface{} `json:"fromGroups,omitempty"`
+	FromNodes      interface{} `json:"fromNodes,omitempty"`
+	ICMPs          interface{} `json:"icmps,omitempty"`
+	Authentication interface{} `json:"authentication,omitempty"`
+}
+
+type CiliumEgressRule struct {
+	ToEndpoints []metav1.LabelSelector `json:"toEndpoints,omitempty"`
+	ToCIDR      []string               `json:"toCIDR,omitempty"`
+	ToCIDRSet   []CiliumCIDRRule       `json:"toCIDRSet,omitempty"`
+	ToEntities  []string               `json:"toEntities,omitempty"`
+	ToPorts     []CiliumPortRule       `json:"toPorts,omitempty"`
+
+	ToRequires     interface{} `json:"toRequires,omitempty"`
+	ToGroups       interface{} `json:"toGroups,omitempty"`
+	ToNodes        interface{} `json:"toNodes,omitempty"`
+	ToFQDNs        interface{} `json:"toFQDNs,omitempty"`
+	ToServices     interface{} `json:"toServices,omitempty"`
+	ICMPs          interface{} `json:"icmps,omitempty"`
+	Authentication interface{} `json:"authentication,omitempty"`
+}
+
+type CiliumPortRule struct {
+	Ports []CiliumPortProtocol `json:"ports,omitempty"`
+
+	Rules          interface{} `json:"rules,omitempty"`
+	TerminatingTLS interface{} `json:"terminatingTLS,omitempty"`
+	OriginatingTLS interface{} `json:"originatingTLS,omitempty"`
+	ServerNames    interface{} `json:"serverNames,omitempty"`
+	Listener       interface{} `json:"listener,omitempty"`
+}
+
+type CiliumPortProtocol struct {
+	Port     string `json:"port"`
+	EndPort  int32  `json:"endPort,omitempty"`
+	Protocol string `json:"protocol,omitempty"`
+}
+
+// ciliumPeers is the translatable part of a rule's peers -- endpoints, CIDRs and entities
+type ciliumPeers struct {
+	Endpoints []metav1.LabelSelector
+	CIDRs     []string
+	CIDRSets  []CiliumCIDRRule
+	Entities  []string
+}
+
+func (c ciliumPeers) isEmpty() bool {
+	return len(c.Endpoints) == 0 && len(c.CIDRs) == 0 && len(c.CIDRSets) == 0 && len(c.Entities) == 0
+}
+
+// ImportCiliumNetworkPolicy translates each of the policy's rules into a separate NetworkPolicy
+func ImportCiliumNetworkPolicy(policy *CiliumNetworkPolicy) *Result {
+	var rules []CiliumRule
+	if policy.Spec != nil {
+		rules = append(rules, *policy.Spec)
+	}
+	rules = append(rules, policy.Specs...)
+
+	result := &Result{}
+	for i, rule := range rules {
+		name := policy.Name
+		if len(rules) > 1 {
+			name = fmt.Sprintf("%s-%d", policy.Name, i)
+		}
+		netpol := newNetworkPolicy(CiliumNetworkPolicyPrefix, policy.Namespace, name)
+		w := &warnings{policy: netpol}
+		if translateCiliumRule(rule, netpol, w) {
+			result.Policies = append(result.Policies, netpol)
+		}
+		result.Warnings = append(result.Warnings, w.warnings...)
+	}
+	return result
+}
+
+// translateCiliumRule fills in the NetworkPolicy's spec, and returns false if the rule can't be translated at all
+func translateCiliumRule(rule CiliumRule, netpol *networkingv1.NetworkPolicy, w *warnings) bool {
+	if rule.NodeSelector != nil {
+		w.add("policy dropped: nodeSelector selects nodes, which aren't modeled")
+		return false
+	}
+	podSelector, namespaceSelector, err := translateCiliumSelector(rule.EndpointSelector, netpol.Namespace)
+	if err != nil || namespaceSelector != nil {
+		w.add("policy dropped: endpointSelector must select pods in the policy's namespace")
+		return false
+	}
+	netpol.Spec.PodSelector = *podSelector
+
+	// an ingress or egress section -- even an empty one -- turns on enforcement in that direction
+	if rule.Ingress != nil || rule.IngressDeny != nil {
+		netpol.Spec.PolicyTypes = append(netpol.Spec.PolicyTypes, networkingv1.PolicyTypeIngress)
+	}
+	if rule.Egress != nil || rule.EgressDeny != nil {
+		netpol.Spec.PolicyTypes = append(netpol.Spec.PolicyTypes, networkingv1.PolicyTypeEgress)
+	}
+	if len(rule.IngressDeny) > 0 {
+		w.add("ingressDeny dropped: deny rules are not supported; imported policy may allow more than the original")
+	}
+	if len(rule.EgressDeny) > 0 {
+		w.add("egressDeny dropped: deny rules are not supported; imported policy may allow more than the original")
+	}
+
+	for i, ingress := range rule.Ingress {
+		if ingress.FromRequires != nil || ingress.ICMPs != nil || ingress.Authentication != nil {
+			w.add("ingress[%d] dropped: fromRequires, icmps and authentication are not supported", i)
+			continue
+		}
+		peers := ciliumPeers{Endpoints: ingress.FromEndpoints, CIDRs: ingress.FromCIDR, CIDRSets: ingress.FromCIDRSet, Entities: ingress.FromEntities}
+		if ingress.FromGroups != nil || ingress.FromNodes != nil {
+			// without any other peers, the rule would turn into an allow-all
+			if peers.isEmpty() {
+				w.add("ingress[%d] dropped: fromGroups and fromNodes are not supported", i)
+				continue
+			}
+			w.add("ingress[%d]: fromGroups and fromNodes dropped", i)
+		}
+		from, fromOk := translateCiliumPeers(peers, netpol.Namespace, "ingress", i, w)
+		ports, portsOk := translateCiliumPorts(ingress.ToPorts, "ingress", i, w)
+		if fromOk && portsOk {
+			netpol.Spec.Ingress = append(netpol.Spec.Ingress, networkingv1.NetworkPolicyIngressRule{From: from, Ports: ports})
+		}
+	}
+	for i, egress := range rule.Egress {
+		if egress.ToRequires != nil || egress.ICMPs != nil || egress.Authentication != nil {
+			w.add("egress[%d] dropped: toRequires, icmps and authentication are not supported", i)
+			continue
+		}
+		peers := ciliumPeers{Endpoints: egress.ToEndpoints, CIDRs: egress.ToCIDR, CIDRSets: egress.ToCIDRSet, Entities: egress.ToEntities}
+		if egress.ToGroups != nil || egress.ToNodes != nil || egress.ToFQDNs != nil || egress.ToServices != nil {
+			// without any other peers, the rule would turn into an allow-all
+			if peers.isEmpty() {
+				w.add("egress[%d] dropped: toGroups, toNodes, toFQDNs and toServices are not supported", i)
+				continue
+			}
+			w.add("egress[%d]: toGroups, toNodes, toFQDNs and toServices dropped", i)
+		}
+		to, toOk := translateCiliumPeers(peers, netpol.Namespace, "egress", i, w)
+		ports, portsOk := translateCiliumPorts(egress.ToPorts, "egress", i, w)
+		if toOk && portsOk {
+			netpol.Spec.Egress = append(netpol.Spec.Egress, networkingv1.NetworkPolicyEgressRule{To: to, Ports: ports})
+		}
+	}
+	return true
+}
+
+// translateCiliumPeers returns false if every peer of a rule which had peers was dropped: in that case,
+// the rule must not turn into an allow-all
+func translateCiliumPeers(peers ciliumPeers, namespace string, direction string, index int, w *warnings) ([]networkingv1.NetworkPolicyPeer, bool) {
+	if peers.isEmpty() {
+		return nil, true
+	}
+	var netpolPeers []networkingv1.NetworkPolicyPeer
+	for j, endpoint := range peers.Endpoints {
+		podSelector, namespaceSelector, err := translateCiliumSelector(endpoint, namespace)
+		if err != nil {
+			w.add("%s[%d] endpoint %d dropped: %s", direction, index, j, err.Error())
+			continue
+		}
+		netpolPeers = append(netpolPeers, networkingv1.NetworkPolicyPeer{PodSelector: podSelector, NamespaceSelector: namespaceSelector})
+	}
+	for _, cidr := range peers.CIDRs {
+		netpolPeers = append(netpolPeers, networkingv1.NetworkPolicyPeer{IPBlock: &networkingv1.IPBlock{CIDR: cidr}})
+	}
+	for _, cidrSet := range peers.CIDRSets {
+		netpolPeers = append(netpolPeers, networkingv1.NetworkPolicyPeer{IPBlock: &networkingv1.IPBlock{CIDR: cidrSet.CIDR, Except: cidrSet.Except}})
+	}
+	for _, entity := range peers.Entities {
+		switch entity {
+		case "all":
+			return nil, true
+		case "cluster":
+			netpolPeers = append(netpolPeers, networkingv1.NetworkPolicyPeer{NamespaceSelector: &metav1.LabelSelector{}})
+		case "world":
+			netpolPeers = append(netpolPeers,
+				networkingv1.NetworkPolicyPeer{IPBlock: &networkingv1.IPBlock{CIDR: "0.0.0.0/0"}},
+				networkingv1.NetworkPolicyPeer{IPBlock: &networkingv1.IPBlock{CIDR: "::/0"}})
+		default:
+			w.add("%s[%d] entity '%s' dropped: only all, cluster and world are supported", direction, index, entity)
+		}
+	}
+	if len(netpolPeers) == 0 {
+		w.add("%s[%d] dropped: none of its peers could be translated", direction, index)
+		return nil, false
+	}
+	return netpolPeers, true
+}
+
+// translateCiliumSelector splits an endpoint selector into pod and namespace selectors.  The namespace selector
+// is nil if the endpoint is in the policy's namespace.
+func translateCiliumSelector(selector metav1.LabelSelector, namespace string) (*metav1.LabelSelector, *metav1.LabelSelector, error) {
+	podSelector := &metav1.LabelSelector{}
+	var namespaceSelector *metav1.LabelSelector
+	getNamespaceSelector := func() *metav1.LabelSelector {
+		if namespaceSelector == nil {
+			namespaceSelector = &metav1.LabelSelector{}
+		}
+		return namespaceSelector
+	}
+
+	for key, value := range selector.MatchLabels {
+		key, err := stripCiliumLabelSource(key)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch {
+		case key == ciliumNamespaceLabel:
+			if value != namespace {
+				addMatchLabel(getNamespaceSelector(), namespaceNameLabel, value)
+			}
+		case strings.HasPrefix(key, ciliumNamespaceLabelsPrefix):
+			addMatchLabel(getNamespaceSelector(), strings.TrimPrefix(key, ciliumNamespaceLabelsPrefix), value)
+		default:
+			addMatchLabel(podSelector, key, value)
+		}
+	}
+	for _, expression := range selector.MatchExpressions {
+		key, err := stripCiliumLabelSource(expression.Key)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch {
+		case key == ciliumNamespaceLabel:
+			expression.Key = namespaceNameLabel
+			if expression.Operator == metav1.LabelSelectorOpExists {
+				// every endpoint is in some namespace
+				getNamespaceSelector()
+				continue
+			}
+			ns := getNamespaceSelector()
+			ns.MatchExpressions = append(ns.MatchExpressions, expression)
+		case strings.HasPrefix(key, ciliumNamespaceLabelsPrefix):
+			expression.Key = strings.TrimPrefix(key, ciliumNamespaceLabelsPrefix)
+			ns := getNamespaceSelector()
+			ns.MatchExpressions = append(ns.MatchExpressions, expression)
+		default:
+			expression.Key = key
+			podSelector.MatchExpressions = append(podSelector.MatchExpressions, expression)
+		}
+	}
+	return podSelector, namespaceSelector, nil
+}
+
+// stripCiliumLabelSource removes the 'k8s:' and 'any:' label source prefixes; other sources, such as 'reserved:',
+// don't refer to pod labels
+func stripCiliumLabelSource(key string) (string, error) {
+	for _, source := range []string{"k8s:", "any:"} {
+		if strings.HasPrefix(key, source) {
+			return strings.TrimPrefix(key, source), nil
+		}
+	}
+	if source := strings.SplitN(key, ":", 2); len(source) == 2 && !strings.Contains(source[0], "/") {
+		return "", errors.Errorf("label source '%s' is not supported", source[0])
+	}
+	return key, nil
+}
+
+func addMatchLabel(selector *metav1.LabelSelector, key string, value string) {
+	if selector.MatchLabels == nil {
+		selector.MatchLabels = map[string]string{}
+	}
+	selector.MatchLabels[key] = value
+}
+
+// translateCiliumPorts returns false if every port of a rule which had ports was dropped
+func translateCiliumPorts(portRules []CiliumPortRule, direction string, index int, w *warnings) ([]networkingv1.NetworkPolicyPort, bool) {
+	var netpolPorts []networkingv1.NetworkPolicyPort
+	for j, portRule := range portRules {
+		if portRule.Rules != nil || portRule.TerminatingTLS != nil || portRule.OriginatingTLS != nil || portRule.ServerNames != nil || portRule.Listener != nil {
+			w.add("%s[%d] toPorts[%d]: L7 rules, TLS, serverNames and listener dropped; imported policy may allow more than the original", direction, index, j)
+		}
+		if len(portRule.Ports) == 0 {
+			// no ports: all ports on all protocols
+			return nil, true
+		}
+		for _, port := range portRule.Ports {
+			var protocols []v1.Protocol
+			switch strings.ToUpper(port.Protocol) {
+			case "", "ANY":
+				protocols = []v1.Protocol{v1.ProtocolTCP, v1.ProtocolUDP, v1.ProtocolSCTP}
+			case "TCP", "UDP", "SCTP":
+				protocols = []v1.Protocol{v1.Protocol(strings.ToUpper(port.Protocol))}
+			default:
+				w.add("%s[%d] toPorts[%d]: protocol '%s' dropped", direction, index, j, port.Protocol)
+				continue
+			}
+
+			var netpolPort *intstr.IntOrString
+			if number, err := strconv.Atoi(port.Port); err == nil {
+				if number != 0 {
+					p := intstr.FromInt(number)
+					netpolPort = &p
+				}
+			} else if port.Port != "" {
+				p := intstr.FromString(port.Port)
+				netpolPort = &p
+			}
+			var endPort *int32
+			if port.EndPort != 0 && netpolPort != nil {
+				e := port.EndPort
+				endPort = &e
+			}
+			for _, protocol := range protocols {
+				p := protocol
+				netpolPorts = append(netpolPorts, networkingv1.NetworkPolicyPort{Protocol: &p, Port: netpolPort, EndPort: endPort})
+			}
+		}
+	}
+	if len(portRules) > 0 && len(netpolPorts) == 0 {
+		w.add("%s[%d] dropped: none of its ports could be translated", direction, index)
+		return nil, false
+	}
+	return netpolPorts, true
+}
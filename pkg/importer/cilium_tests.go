@@ -0,0 +1,168 @@
+package importer
+
+import (
+	"github.com/mattfenwick/cyclonus/pkg/matcher"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func RunCiliumTests() {
+	Describe("Cilium network policies", func() {
+		It("should translate endpoints in the same and in other namespaces", func() {
+			result := mustImportYaml(`
+apiVersion: cilium.io/v2
+kind: CiliumNetworkPolicy
+metadata: {name: allow-web, namespace: x}
+spec:
+  endpointSelector:
+    matchLabels: {app: web}
+  ingress:
+  - fromEndpoints:
+    - matchLabels: {"k8s:app": frontend}
+    - matchLabels: {"k8s:io.kubernetes.pod.namespace": "y", app: monitor}
+    - matchLabels: {"io.cilium.k8s.namespace.labels.team": "ops"}
+    toPorts:
+    - ports:
+      - {port: "80", protocol: TCP}
+      - {port: "8443", protocol: ANY}`, nil)
+			Expect(result.Warnings).To(BeEmpty())
+			Expect(result.Policies).To(HaveLen(1))
+			netpol := result.Policies[0]
+			Expect(netpol.Name).To(Equal("cilium.allow-web"))
+			Expect(netpol.Spec.PolicyTypes).To(Equal([]networkingv1.PolicyType{networkingv1.PolicyTypeIngress}))
+			Expect(netpol.Spec.Ingress).To(HaveLen(1))
+			Expect(netpol.Spec.Ingress[0].From).To(Equal([]networkingv1.NetworkPolicyPeer{
+				{PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "frontend"}}},
+				{
+					PodSelector:       &metav1.LabelSelector{MatchLabels: map[string]string{"app": "monitor"}},
+					NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"kubernetes.io/metadata.name": "y"}},
+				},
+				{
+					PodSelector:       &metav1.LabelSelector{},
+					NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "ops"}},
+				},
+			}))
+			tcp, udp, sctp := v1.ProtocolTCP, v1.ProtocolUDP, v1.ProtocolSCTP
+			port80, port8443 := intstr.FromInt(80), intstr.FromInt(8443)
+			Expect(netpol.Spec.Ingress[0].Ports).To(Equal([]networkingv1.NetworkPolicyPort{
+				{Protocol: &tcp, Port: &port80},
+				{Protocol: &tcp, Port: &port8443},
+				{Protocol: &udp, Port: &port8443},
+				{Protocol: &sctp, Port: &port8443},
+			}))
+
+			policy := matcher.BuildNetworkPolicies(result.Policies)
+			web, frontend := map[string]string{"app": "web"}, map[string]string{"app": "frontend"}
+			Expect(policy.IsTrafficAllowed(internalTraffic("x", frontend, "x", web, 80, v1.ProtocolTCP)).IsAllowed()).To(BeTrue())
+			Expect(policy.IsTrafficAllowed(internalTraffic("y", frontend, "x", web, 80, v1.ProtocolTCP)).IsAllowed()).To(BeFalse())
+		})
+
+		It("should translate CIDRs and entities, and warn about L7 and deny rules", func() {
+			result := mustImportYaml(`
+apiVersion: cilium.io/v2
+kind: CiliumNetworkPolicy
+metadata: {name: egress, namespace: x}
+specs:
+- endpointSelector: {}
+  egress:
+  - toCIDRSet:
+    - {cidr: 10.0.0.0/8, except: [10.1.0.0/16]}
+    toPorts:
+    - ports: [{port: "443", protocol: TCP}]
+      rules:
+        http: [{method: GET}]
+  - toEntities: [world]
+  - toEntities: [host]
+  egressDeny:
+  - toEntities: [cluster]
+- endpointSelector: {}
+  ingress:
+  - fromEntities: [cluster]`, nil)
+			Expect(result.Policies).To(HaveLen(2))
+			egress := result.Policies[0]
+			Expect(egress.Name).To(Equal("cilium.egress-0"))
+			Expect(egress.Spec.PolicyTypes).To(Equal([]networkingv1.PolicyType{networkingv1.PolicyTypeEgress}))
+			Expect(egress.Spec.Egress).To(HaveLen(2))
+			Expect(egress.Spec.Egress[0].To).To(Equal([]networkingv1.NetworkPolicyPeer{
+				{IPBlock: &networkingv1.IPBlock{CIDR: "10.0.0.0/8", Except: []string{"10.1.0.0/16"}}},
+			}))
+			Expect(egress.Spec.Egress[1].To).To(HaveLen(2))
+
+			ingress := result.Policies[1]
+			Expect(ingress.Name).To(Equal("cilium.egress-1"))
+			Expect(ingress.Spec.Ingress[0].From).To(Equal([]networkingv1.NetworkPolicyPeer{{NamespaceSelector: &metav1.LabelSelector{}}}))
+
+			var details []string
+			for _, warning := range result.Warnings {
+				details = append(details, warning.Detail)
+			}
+			Expect(details).To(ConsistOf(
+				ContainSubstring("egressDeny dropped"),
+				ContainSubstring("egress[0] toPorts[0]: L7 rules"),
+				ContainSubstring("egress[2] entity 'host' dropped"),
+				ContainSubstring("egress[2] dropped"),
+			))
+		})
+
+		It("should drop an egress rule whose only peers are FQDNs, rather than allowing everything", func() {
+			result := mustImportYaml(`
+apiVersion: cilium.io/v2
+kind: CiliumNetworkPolicy
+metadata: {name: fqdn, namespace: x}
+spec:
+  endpointSelector: {}
+  egress:
+  - toFQDNs: [{matchName: example.com}]
+    toPorts:
+    - ports: [{port: "443", protocol: TCP}]
+  - toFQDNs: [{matchName: example.com}]
+    toCIDR: [192.168.0.0/16]`, nil)
+			Expect(result.Policies).To(HaveLen(1))
+			netpol := result.Policies[0]
+			Expect(netpol.Spec.PolicyTypes).To(Equal([]networkingv1.PolicyType{networkingv1.PolicyTypeEgress}))
+			Expect(netpol.Spec.Egress).To(HaveLen(1))
+			Expect(netpol.Spec.Egress[0].To).To(Equal([]networkingv1.NetworkPolicyPeer{{IPBlock: &networkingv1.IPBlock{CIDR: "192.168.0.0/16"}}}))
+			Expect(result.Warnings).To(HaveLen(2))
+			Expect(result.Warnings[0].Detail).To(ContainSubstring("egress[0] dropped"))
+			Expect(result.Warnings[1].Detail).To(ContainSubstring("egress[1]: toGroups, toNodes, toFQDNs and toServices dropped"))
+
+			policy := matcher.BuildNetworkPolicies(result.Policies)
+			traffic := internalTraffic("x", map[string]string{}, "x", map[string]string{}, 443, v1.ProtocolTCP)
+			traffic.Destination = &matcher.TrafficPeer{IP: "8.8.8.8"}
+			Expect(policy.IsTrafficAllowed(traffic).IsAllowed()).To(BeFalse())
+		})
+
+		It("should drop an ingress rule whose only peers are nodes", func() {
+			result := mustImportYaml(`
+apiVersion: cilium.io/v2
+kind: CiliumNetworkPolicy
+metadata: {name: nodes, namespace: x}
+spec:
+  endpointSelector: {}
+  ingress:
+  - fromNodes: [{matchLabels: {role: worker}}]`, nil)
+			Expect(result.Policies).To(HaveLen(1))
+			Expect(result.Policies[0].Spec.PolicyTypes).To(Equal([]networkingv1.PolicyType{networkingv1.PolicyTypeIngress}))
+			Expect(result.Policies[0].Spec.Ingress).To(BeEmpty())
+			Expect(result.Warnings).To(HaveLen(1))
+			Expect(result.Warnings[0].Detail).To(ContainSubstring("ingress[0] dropped: fromGroups and fromNodes are not supported"))
+		})
+
+		It("should drop a policy selecting endpoints in other namespaces", func() {
+			result := mustImportYaml(`
+apiVersion: cilium.io/v2
+kind: CiliumNetworkPolicy
+metadata: {name: a, namespace: x}
+spec:
+  endpointSelector:
+    matchLabels: {"k8s:io.kubernetes.pod.namespace": "y"}
+  ingress: [{}]`, nil)
+			Expect(result.Policies).To(BeEmpty())
+			Expect(result.Warnings).To(HaveLen(1))
+		})
+	})
+}
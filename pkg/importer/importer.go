@@ -0,0 +1,159 @@
+package importer
+
+import (
+	"fmt"
+	"github.com/mattfenwick/cyclonus/pkg/kube"
+	"github.com/mattfenwick/cyclonus/pkg/linter"
+	"github.com/pkg/errors"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+	"strings"
+)
+
+// The importer translates CNI-specific policies -- Calico's NetworkPolicy and GlobalNetworkPolicy, and
+// Cilium's CiliumNetworkPolicy -- into NetworkPolicies, so that they can be run through the same matcher,
+// explainer and synthetic probes as native policies.
+//
+// Only the subset which maps onto NetworkPolicy semantics is translated: allow rules on pod/namespace selectors,
+// CIDRs and L4 ports.  Everything else -- deny rules, L7 rules, entities, service accounts, etc. -- is dropped,
+// and reported as a linter warning explaining whether the imported policy is now more or less permissive
+// than the original.
+
+const (
+	CalicoNetworkPolicyPrefix       = "calico"
+	CalicoGlobalNetworkPolicyPrefix = "calico-global"
+	CiliumNetworkPolicyPrefix       = "cilium"
+)
+
+type Options struct {
+	// Namespaces maps namespace names to labels: cluster-scoped policies are translated into one
+	//   NetworkPolicy for each namespace they apply to.  Namespaces of namespaced policies are added with no labels.
+	Namespaces map[string]map[string]string
+}
+
+type Result struct {
+	Policies []*networkingv1.NetworkPolicy
+	Warnings []*linter.Warning
+}
+
+func (r *Result) append(other *Result) {
+	r.Policies = append(r.Policies, other.Policies...)
+	r.Warnings = append(r.Warnings, other.Warnings...)
+}
+
+// IsSupportedKind returns true for the apiVersion/kind combinations which can be imported
+func IsSupportedKind(typeMeta metav1.TypeMeta) bool {
+	switch {
+	case strings.HasPrefix(typeMeta.APIVersion, "projectcalico.org/"):
+		return typeMeta.Kind == "NetworkPolicy" || typeMeta.Kind == "GlobalNetworkPolicy"
+	case strings.HasPrefix(typeMeta.APIVersion, "cilium.io/"):
+		return typeMeta.Kind == "CiliumNetworkPolicy"
+	default:
+		return false
+	}
+}
+
+// ImportYaml translates every Calico and Cilium policy in a (possibly multi-document) yaml stream.  Cluster-scoped
+// policies are imported last, so that they also apply to the namespaces of the stream's namespaced policies.
+func ImportYaml(bytes []byte, options *Options) (*Result, error) {
+	type document struct {
+		index    int
+		bytes    []byte
+		typeMeta metav1.TypeMeta
+	}
+	var namespaced, global []*document
+	for _, doc := range kube.SplitYamlDocuments(bytes) {
+		if doc.IsEmpty() {
+			continue
+		}
+		var typeMeta metav1.TypeMeta
+		if err := yaml.Unmarshal(doc.Bytes, &typeMeta); err != nil {
+			return nil, errors.Wrapf(err, "unable to unmarshal kind from document %d", doc.Index)
+		}
+		if typeMeta.Kind == "GlobalNetworkPolicy" {
+			global = append(global, &document{index: doc.Index, bytes: doc.Bytes, typeMeta: typeMeta})
+		} else {
+			namespaced = append(namespaced, &document{index: doc.Index, bytes: doc.Bytes, typeMeta: typeMeta})
+		}
+	}
+
+	result := &Result{}
+	for _, doc := range namespaced {
+		docResult, err := importDocument(doc.bytes, doc.typeMeta, options)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "document %d", doc.index)
+		}
+		result.append(docResult)
+	}
+
+	globalOptions := &Options{Namespaces: map[string]map[string]string{}}
+	if options != nil {
+		for ns, labels := range options.Namespaces {
+			globalOptions.Namespaces[ns] = labels
+		}
+	}
+	for _, policy := range result.Policies {
+		if _, ok := globalOptions.Namespaces[policy.Namespace]; !ok {
+			globalOptions.Namespaces[policy.Namespace] = map[string]string{}
+		}
+	}
+	for _, doc := range global {
+		docResult, err := importDocument(doc.bytes, doc.typeMeta, globalOptions)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "document %d", doc.index)
+		}
+		result.append(docResult)
+	}
+	return result, nil
+}
+
+func importDocument(doc []byte, typeMeta metav1.TypeMeta, options *Options) (*Result, error) {
+	if !IsSupportedKind(typeMeta) {
+		return nil, errors.Errorf("unsupported apiVersion/kind %s/%s", typeMeta.APIVersion, typeMeta.Kind)
+	}
+	switch typeMeta.Kind {
+	case "NetworkPolicy":
+		var policy *CalicoNetworkPolicy
+		if err := yaml.Unmarshal(doc, &policy); err != nil {
+			return nil, errors.Wrapf(err, "unable to unmarshal calico network policy")
+		}
+		return ImportCalicoNetworkPolicy(policy), nil
+	case "GlobalNetworkPolicy":
+		var policy *CalicoGlobalNetworkPolicy
+		if err := yaml.Unmarshal(doc, &policy); err != nil {
+			return nil, errors.Wrapf(err, "unable to unmarshal calico global network policy")
+		}
+		return ImportCalicoGlobalNetworkPolicy(policy, options), nil
+	default:
+		var policy *CiliumNetworkPolicy
+		if err := yaml.Unmarshal(doc, &policy); err != nil {
+			return nil, errors.Wrapf(err, "unable to unmarshal cilium network policy")
+		}
+		return ImportCiliumNetworkPolicy(policy), nil
+	}
+}
+
+// warnings collects the unsupported constructs found while translating a single policy
+type warnings struct {
+	policy   *networkingv1.NetworkPolicy
+	warnings []*linter.Warning
+}
+
+func (w *warnings) add(format string, args ...interface{}) {
+	w.warnings = append(w.warnings, &linter.Warning{
+		Check:        linter.CheckSourceUnsupportedDialectConstruct,
+		SourcePolicy: w.policy,
+		Detail:       fmt.Sprintf(format, args...),
+	})
+}
+
+func newNetworkPolicy(prefix string, namespace string, name string) *networkingv1.NetworkPolicy {
+	return &networkingv1.NetworkPolicy{
+		TypeMeta: metav1.TypeMeta{Kind: "NetworkPolicy", APIVersion: "networking.k8s.io/v1"},
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      prefix + "." + name,
+		},
+	}
+}
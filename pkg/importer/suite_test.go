@@ -0,0 +1,15 @@
+package importer
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestModel(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunCalicoTests()
+	RunCiliumTests()
+	RunSpecs(t, "importer suite")
+}
@@ -0,0 +1,102 @@
+package kube
+
+import (
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// These types mirror the policy.networking.k8s.io/v1alpha1 AdminNetworkPolicy and BaselineAdminNetworkPolicy
+// CRDs from sigs.k8s.io/network-policy-api, so that they can be read from yaml without a CRD client.
+
+type AdminNetworkPolicyRuleAction string
+
+const (
+	AdminNetworkPolicyRuleActionAllow AdminNetworkPolicyRuleAction = "Allow"
+	AdminNetworkPolicyRuleActionDeny  AdminNetworkPolicyRuleAction = "Deny"
+	AdminNetworkPolicyRuleActionPass  AdminNetworkPolicyRuleAction = "Pass"
+)
+
+type AdminNetworkPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              AdminNetworkPolicySpec `json:"spec"`
+}
+
+type AdminNetworkPolicySpec struct {
+	// Priority: lower numbers are evaluated first
+	Priority int32                           `json:"priority"`
+	Subject  AdminNetworkPolicySubject       `json:"subject"`
+	Ingress  []AdminNetworkPolicyIngressRule `json:"ingress,omitempty"`
+	Egress   []AdminNetworkPolicyEgressRule  `json:"egress,omitempty"`
+}
+
+// AdminNetworkPolicySubject selects pods: exactly one of Namespaces or Pods must be set
+type AdminNetworkPolicySubject struct {
+	Namespaces *metav1.LabelSelector `json:"namespaces,omitempty"`
+	Pods       *NamespacedPod        `json:"pods,omitempty"`
+}
+
+type NamespacedPod struct {
+	NamespaceSelector metav1.LabelSelector `json:"namespaceSelector"`
+	PodSelector       metav1.LabelSelector `json:"podSelector"`
+}
+
+type AdminNetworkPolicyIngressRule struct {
+	Name   string                          `json:"name,omitempty"`
+	Action AdminNetworkPolicyRuleAction    `json:"action"`
+	From   []AdminNetworkPolicyIngressPeer `json:"from"`
+	Ports  *[]AdminNetworkPolicyPort       `json:"ports,omitempty"`
+}
+
+type AdminNetworkPolicyEgressRule struct {
+	Name   string                         `json:"name,omitempty"`
+	Action AdminNetworkPolicyRuleAction   `json:"action"`
+	To     []AdminNetworkPolicyEgressPeer `json:"to"`
+	Ports  *[]AdminNetworkPolicyPort      `json:"ports,omitempty"`
+}
+
+// AdminNetworkPolicyIngressPeer: exactly one field must be set
+type AdminNetworkPolicyIngressPeer struct {
+	Namespaces *metav1.LabelSelector `json:"namespaces,omitempty"`
+	Pods       *NamespacedPod        `json:"pods,omitempty"`
+}
+
+// AdminNetworkPolicyEgressPeer: exactly one field must be set
+type AdminNetworkPolicyEgressPeer struct {
+	Namespaces *metav1.LabelSelector `json:"namespaces,omitempty"`
+	Pods       *NamespacedPod        `json:"pods,omitempty"`
+	Nodes      *metav1.LabelSelector `json:"nodes,omitempty"`
+	Networks   []string              `json:"networks,omitempty"`
+}
+
+// AdminNetworkPolicyPort: exactly one field must be set
+type AdminNetworkPolicyPort struct {
+	PortNumber *Port      `json:"portNumber,omitempty"`
+	NamedPort  *string    `json:"namedPort,omitempty"`
+	PortRange  *PortRange `json:"portRange,omitempty"`
+}
+
+type Port struct {
+	Protocol v1.Protocol `json:"protocol"`
+	Port     int32       `json:"port"`
+}
+
+type PortRange struct {
+	Protocol v1.Protocol `json:"protocol,omitempty"`
+	Start    int32       `json:"start"`
+	End      int32       `json:"end"`
+}
+
+// BaselineAdminNetworkPolicy is a cluster singleton, named 'default'
+type BaselineAdminNetworkPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              BaselineAdminNetworkPolicySpec `json:"spec"`
+}
+
+type BaselineAdminNetworkPolicySpec struct {
+	Subject AdminNetworkPolicySubject `json:"subject"`
+	// Rule actions are restricted to Allow and Deny
+	Ingress []AdminNetworkPolicyIngressRule `json:"ingress,omitempty"`
+	Egress  []AdminNetworkPolicyEgressRule  `json:"egress,omitempty"`
+}
@@ -2,10 +2,67 @@ package kube
 
 import (
 	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
 	"net"
 )
 
+// IPFamilies are the families of a dual-stack cluster, in the order in which they're reported
+var IPFamilies = []v1.IPFamily{v1.IPv4Protocol, v1.IPv6Protocol}
+
+// GetIPFamily returns the family of an IP address, or "" if it isn't one
+func GetIPFamily(ip string) v1.IPFamily {
+	parsed := net.ParseIP(ip)
+	switch {
+	case parsed == nil:
+		return ""
+	case parsed.To4() != nil:
+		return v1.IPv4Protocol
+	default:
+		return v1.IPv6Protocol
+	}
+}
+
+// GetCIDRFamily returns the family of a CIDR, or "" if it isn't one
+func GetCIDRFamily(cidr string) v1.IPFamily {
+	ip, _, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return ""
+	}
+	return GetIPFamily(ip.String())
+}
+
+// GetPodIPs reads all of a pod's IPs -- one per family on a dual-stack cluster -- falling back to the primary IP
+// for clusters which don't report PodIPs
+func GetPodIPs(status v1.PodStatus) []string {
+	var ips []string
+	for _, podIP := range status.PodIPs {
+		ips = append(ips, podIP.IP)
+	}
+	if len(ips) == 0 && status.PodIP != "" {
+		ips = []string{status.PodIP}
+	}
+	return ips
+}
+
+// CIDRContainingIP returns the network of the given prefix length which contains an IP, such as 10.0.1.0/24
+// for 10.0.1.15 and 24
+func CIDRContainingIP(ip string, prefixLength int) (string, error) {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return "", errors.Errorf("unable to parse IP '%s'", ip)
+	}
+	bits := 128
+	if parsed.To4() != nil {
+		parsed, bits = parsed.To4(), 32
+	}
+	if prefixLength < 0 || prefixLength > bits {
+		return "", errors.Errorf("invalid prefix length %d for IP '%s'", prefixLength, ip)
+	}
+	network := &net.IPNet{IP: parsed.Mask(net.CIDRMask(prefixLength, bits)), Mask: net.CIDRMask(prefixLength, bits)}
+	return network.String(), nil
+}
+
 func IsIPInCIDR(ip string, cidr string) (bool, error) {
 	_, cidrNet, err := net.ParseCIDR(cidr)
 	if err != nil {
@@ -37,3 +94,31 @@ func IsIPAddressMatchForIPBlock(ip string, ipBlock *networkingv1.IPBlock) (bool,
 	}
 	return true, nil
 }
+
+// IsCIDRWithinCIDR returns true if every address in inner is also in outer
+func IsCIDRWithinCIDR(inner string, outer string) (bool, error) {
+	_, innerNet, err := net.ParseCIDR(inner)
+	if err != nil {
+		return false, errors.Wrapf(err, "unable to parse CIDR '%s'", inner)
+	}
+	_, outerNet, err := net.ParseCIDR(outer)
+	if err != nil {
+		return false, errors.Wrapf(err, "unable to parse CIDR '%s'", outer)
+	}
+	innerOnes, innerBits := innerNet.Mask.Size()
+	outerOnes, outerBits := outerNet.Mask.Size()
+	return innerBits == outerBits && innerOnes >= outerOnes && outerNet.Contains(innerNet.IP), nil
+}
+
+// AreCIDRsOverlapping returns true if at least one address is in both CIDRs
+func AreCIDRsOverlapping(a string, b string) (bool, error) {
+	isAWithinB, err := IsCIDRWithinCIDR(a, b)
+	if err != nil {
+		return false, err
+	}
+	isBWithinA, err := IsCIDRWithinCIDR(b, a)
+	if err != nil {
+		return false, err
+	}
+	return isAWithinB || isBWithinA, nil
+}
@@ -4,6 +4,7 @@ import (
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/api/networking/v1"
 )
 
@@ -151,5 +152,53 @@ func RunIPAddressTests() {
 				Expect(isMatchWitExcept).To(Equal(c.IsMatch))
 			}
 		})
+
+		It("Determines whether a CIDR is within another CIDR", func() {
+			testCases := []struct {
+				Inner     string
+				Outer     string
+				IsWithin  bool
+				IsOverlap bool
+			}{
+				{Inner: "1.2.3.0/28", Outer: "1.2.3.0/24", IsWithin: true, IsOverlap: true},
+				{Inner: "1.2.3.0/24", Outer: "1.2.3.0/28", IsWithin: false, IsOverlap: true},
+				{Inner: "1.2.3.0/24", Outer: "1.2.3.0/24", IsWithin: true, IsOverlap: true},
+				{Inner: "1.2.4.0/24", Outer: "1.2.3.0/24", IsWithin: false, IsOverlap: false},
+				{Inner: "2001:db8::/48", Outer: "2001:db8::/32", IsWithin: true, IsOverlap: true},
+				{Inner: "1.2.3.0/24", Outer: "::/0", IsWithin: false, IsOverlap: false},
+			}
+			for _, c := range testCases {
+				log.Infof("looking at %+v", c)
+				isWithin, err := IsCIDRWithinCIDR(c.Inner, c.Outer)
+				Expect(err).To(BeNil())
+				Expect(isWithin).To(Equal(c.IsWithin))
+				isOverlap, err := AreCIDRsOverlapping(c.Inner, c.Outer)
+				Expect(err).To(BeNil())
+				Expect(isOverlap).To(Equal(c.IsOverlap))
+			}
+		})
+
+		It("Determines IP families and the CIDRs containing IPs", func() {
+			Expect(GetIPFamily("10.0.1.15")).To(Equal(corev1.IPv4Protocol))
+			Expect(GetIPFamily("fd00::1:15")).To(Equal(corev1.IPv6Protocol))
+			Expect(GetIPFamily("TODO")).To(Equal(corev1.IPFamily("")))
+			Expect(GetCIDRFamily("::/0")).To(Equal(corev1.IPv6Protocol))
+
+			Expect(CIDRContainingIP("10.0.1.15", 24)).To(Equal("10.0.1.0/24"))
+			Expect(CIDRContainingIP("10.0.1.15", 28)).To(Equal("10.0.1.0/28"))
+			Expect(CIDRContainingIP("fd00::1:15", 64)).To(Equal("fd00::/64"))
+			Expect(CIDRContainingIP("fd00::1:15", 120)).To(Equal("fd00::1:0/120"))
+			_, err := CIDRContainingIP("10.0.1.15", 64)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("Reads all of a pod's IPs", func() {
+			Expect(GetPodIPs(corev1.PodStatus{PodIP: "10.0.1.15"})).To(Equal([]string{"10.0.1.15"}))
+			Expect(GetPodIPs(corev1.PodStatus{
+				PodIP:  "10.0.1.15",
+				PodIPs: []corev1.PodIP{{IP: "10.0.1.15"}, {IP: "fd00::1:15"}},
+			})).To(Equal([]string{"10.0.1.15", "fd00::1:15"}))
+			Expect(GetPodIPs(corev1.PodStatus{})).To(BeEmpty())
+		})
 	})
 }
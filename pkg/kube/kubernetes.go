@@ -46,6 +46,14 @@ func (k *Kubernetes) GetNamespace(namespace string) (*v1.Namespace, error) {
 	return ns, errors.Wrapf(err, "unable to get namespace %s", namespace)
 }
 
+func (k *Kubernetes) GetAllNamespaces() ([]v1.Namespace, error) {
+	nsList, err := k.ClientSet.CoreV1().Namespaces().List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to list namespaces")
+	}
+	return nsList.Items, nil
+}
+
 func (k *Kubernetes) SetNamespaceLabels(namespace string, labels map[string]string) (*v1.Namespace, error) {
 	ns, err := k.GetNamespace(namespace)
 	if err != nil {
@@ -0,0 +1,293 @@
+package kube
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	yamlv3 "gopkg.in/yaml.v3"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"regexp"
+	"sigs.k8s.io/yaml"
+	"strings"
+)
+
+// SourceLocation is where a resource was read from, so that findings about it can point back at the yaml
+type SourceLocation struct {
+	File string `json:"file"`
+	// Document is the 0-based index of the yaml document within the file
+	Document int `json:"document"`
+	// Line is the 1-based line at which the resource starts; 0 if unknown
+	Line int `json:"line,omitempty"`
+	// ItemPath locates the resource within its document: empty if it's the whole document, an index into a
+	// top-level list, or 'items' and an index into a List kind
+	ItemPath []interface{} `json:"-"`
+}
+
+func (s *SourceLocation) String() string {
+	if s.Line > 0 {
+		return fmt.Sprintf("%s:%d", s.File, s.Line)
+	}
+	return fmt.Sprintf("%s (document %d)", s.File, s.Document)
+}
+
+// NetworkPolicySources maps policies to where they were read from; policies from the cluster or from
+// examples have no source location
+type NetworkPolicySources map[*networkingv1.NetworkPolicy]*SourceLocation
+
+func (n NetworkPolicySources) Add(other NetworkPolicySources) {
+	for policy, location := range other {
+		n[policy] = location
+	}
+}
+
+// YamlDocument is a single document of a (possibly multi-document) yaml stream
+type YamlDocument struct {
+	// Index is the 0-based index of the document, counting empty documents
+	Index int
+	// Line is the 1-based line of the document's first line of content
+	Line int
+	// Separator is the original text between the previous document's content and this document's content,
+	// including the '---' line; it's empty for the first document
+	Separator string
+	Bytes     []byte
+}
+
+var yamlDocumentSeparator = regexp.MustCompile(`^---(\s+#.*)?\s*$`)
+
+// IsEmpty returns true if the document has no content other than whitespace and comments
+func (d *YamlDocument) IsEmpty() bool {
+	return d.Line == 0
+}
+
+// lineOf converts the line of a node parsed from the document into a line of the file
+func (d *YamlDocument) lineOf(node *yamlv3.Node) int {
+	return d.Line - d.contentOffset() + node.Line - 1
+}
+
+// contentOffset is the number of lines before the document's first line of content
+func (d *YamlDocument) contentOffset() int {
+	for i, line := range strings.Split(string(d.Bytes), "\n") {
+		if isYamlContentLine(line) {
+			return i
+		}
+	}
+	return 0
+}
+
+func isYamlContentLine(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return trimmed != "" && !strings.HasPrefix(trimmed, "#")
+}
+
+// SplitYamlDocuments splits a yaml stream on '---' separators, keeping track of where each document starts.
+// Concatenating each document's Separator and Bytes gives back the original stream.
+func SplitYamlDocuments(bytes []byte) []*YamlDocument {
+	var docs []*YamlDocument
+	current := &YamlDocument{}
+	var lines []string
+	finish := func() {
+		if current.Index > 0 && len(lines) > 0 {
+			current.Separator += "\n"
+		}
+		current.Bytes = []byte(strings.Join(lines, "\n"))
+		docs = append(docs, current)
+	}
+	for i, line := range strings.Split(string(bytes), "\n") {
+		if yamlDocumentSeparator.MatchString(line) {
+			finish()
+			separator := line
+			if i > 0 {
+				separator = "\n" + line
+			}
+			current, lines = &YamlDocument{Index: current.Index + 1, Separator: separator}, nil
+			continue
+		}
+		if current.Line == 0 && isYamlContentLine(line) {
+			current.Line = i + 1
+		}
+		lines = append(lines, line)
+	}
+	finish()
+	return docs
+}
+
+// isNetworkPolicyKind: resources without a kind are assumed to be NetworkPolicies, but NetworkPolicy kinds of
+// other API groups -- such as Calico's projectcalico.org/v3 or Cilium's -- aren't
+func isNetworkPolicyKind(kind string, apiVersion string) bool {
+	return (kind == "" || kind == "NetworkPolicy") && (apiVersion == "" || apiVersion == networkPolicyAPIVersion)
+}
+
+const networkPolicyAPIVersion = "networking.k8s.io/v1"
+
+func isListKind(kind string) bool {
+	return kind == "List" || kind == "NetworkPolicyList"
+}
+
+// Manifests are the resources of a rendered manifest stream -- such as the output of 'helm template' or
+// 'kustomize build' -- which matter for network policies: the policies themselves, and the namespaces and
+// workloads they apply to.  Resources of other kinds are skipped.
+type Manifests struct {
+	NetworkPolicies []*networkingv1.NetworkPolicy
+	Sources         NetworkPolicySources
+	Namespaces      []*v1.Namespace
+	Pods            []*v1.Pod
+	Deployments     []*appsv1.Deployment
+	StatefulSets    []*appsv1.StatefulSet
+}
+
+func NewManifests() *Manifests {
+	return &Manifests{Sources: NetworkPolicySources{}}
+}
+
+func (m *Manifests) Add(other *Manifests) {
+	m.NetworkPolicies = append(m.NetworkPolicies, other.NetworkPolicies...)
+	m.Sources.Add(other.Sources)
+	m.Namespaces = append(m.Namespaces, other.Namespaces...)
+	m.Pods = append(m.Pods, other.Pods...)
+	m.Deployments = append(m.Deployments, other.Deployments...)
+	m.StatefulSets = append(m.StatefulSets, other.StatefulSets...)
+}
+
+// HasWorkloads returns true if there are any namespaces or workloads, from which to derive an inventory
+func (m *Manifests) HasWorkloads() bool {
+	return len(m.Namespaces)+len(m.Pods)+len(m.Deployments)+len(m.StatefulSets) > 0
+}
+
+// yamlMappingValue returns the value at key of a mapping node, or nil
+func yamlMappingValue(node *yamlv3.Node, key string) *yamlv3.Node {
+	for i := 0; node.Kind == yamlv3.MappingNode && i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func yamlKind(node *yamlv3.Node) string {
+	if kind := yamlMappingValue(node, "kind"); kind != nil {
+		return kind.Value
+	}
+	return ""
+}
+
+func yamlAPIVersion(node *yamlv3.Node) string {
+	if apiVersion := yamlMappingValue(node, "apiVersion"); apiVersion != nil {
+		return apiVersion.Value
+	}
+	return ""
+}
+
+// ParseNetworkPolicies reads NetworkPolicies from a yaml or json file, which may contain several documents,
+// each of which is a single policy, a list of policies, or a List kind.  Resources of other kinds are skipped,
+// so that policies can be read from directories of manifests.
+func ParseNetworkPolicies(file string, bytes []byte) ([]*networkingv1.NetworkPolicy, NetworkPolicySources, error) {
+	manifests, err := ParseManifests(file, bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	return manifests.NetworkPolicies, manifests.Sources, nil
+}
+
+// ParseManifests reads a yaml or json file in the same way as ParseNetworkPolicies, but also keeps Namespaces,
+// Pods, Deployments and StatefulSets.  Resources without a kind are assumed to be NetworkPolicies.
+func ParseManifests(file string, bytes []byte) (*Manifests, error) {
+	manifests := NewManifests()
+	for _, doc := range SplitYamlDocuments(bytes) {
+		if doc.IsEmpty() {
+			continue
+		}
+		var node yamlv3.Node
+		if err := yamlv3.Unmarshal(doc.Bytes, &node); err != nil {
+			return nil, errors.Wrapf(err, "unable to parse document %d at %s", doc.Index, file)
+		}
+		if len(node.Content) == 0 {
+			continue
+		}
+
+		root := node.Content[0]
+		items := []*yamlv3.Node{root}
+		itemPaths := [][]interface{}{nil}
+		switch {
+		case root.Kind == yamlv3.SequenceNode:
+			items, itemPaths = root.Content, nil
+			for i := range items {
+				itemPaths = append(itemPaths, []interface{}{i})
+			}
+		case isListKind(yamlKind(root)):
+			items, itemPaths = nil, nil
+			if list := yamlMappingValue(root, "items"); list != nil && list.Kind == yamlv3.SequenceNode {
+				items = list.Content
+			}
+			for i := range items {
+				itemPaths = append(itemPaths, []interface{}{"items", i})
+			}
+		}
+
+		for i, item := range items {
+			kind, apiVersion := yamlKind(item), yamlAPIVersion(item)
+			var target interface{}
+			switch {
+			case isNetworkPolicyKind(kind, apiVersion):
+				target = &networkingv1.NetworkPolicy{}
+			case kind == "" || kind == "NetworkPolicy":
+				log.Warnf("skipping %s %s in document %d at %s: only %s NetworkPolicies are supported", apiVersion, kind, doc.Index, file, networkPolicyAPIVersion)
+				continue
+			case kind == "Namespace":
+				target = &v1.Namespace{}
+			case kind == "Pod":
+				target = &v1.Pod{}
+			case kind == "Deployment":
+				target = &appsv1.Deployment{}
+			case kind == "StatefulSet":
+				target = &appsv1.StatefulSet{}
+			default:
+				log.Debugf("skipping %s in document %d at %s", kind, doc.Index, file)
+				continue
+			}
+			if yamlIsNull(item) {
+				continue
+			}
+			// each item is unmarshaled on its own, with its strings quoted: sigs.k8s.io/yaml follows yaml 1.1,
+			// which reads 'y' and 'n' as booleans -- and only tells them apart by the target type, which
+			// doesn't help for maps such as labels
+			quoteYamlStrings(item)
+			itemBytes, err := yamlv3.Marshal(item)
+			if err != nil {
+				return nil, errors.Wrapf(err, "unable to serialize item %d of document %d at %s", i, doc.Index, file)
+			}
+			if err := yaml.Unmarshal(itemBytes, target); err != nil {
+				return nil, errors.Wrapf(err, "unable to unmarshal %s from document %d at %s", kind, doc.Index, file)
+			}
+			switch resource := target.(type) {
+			case *networkingv1.NetworkPolicy:
+				manifests.Sources[resource] = &SourceLocation{File: file, Document: doc.Index, Line: doc.lineOf(item), ItemPath: itemPaths[i]}
+				manifests.NetworkPolicies = append(manifests.NetworkPolicies, resource)
+			case *v1.Namespace:
+				manifests.Namespaces = append(manifests.Namespaces, resource)
+			case *v1.Pod:
+				manifests.Pods = append(manifests.Pods, resource)
+			case *appsv1.Deployment:
+				manifests.Deployments = append(manifests.Deployments, resource)
+			case *appsv1.StatefulSet:
+				manifests.StatefulSets = append(manifests.StatefulSets, resource)
+			}
+		}
+	}
+	return manifests, nil
+}
+
+func yamlIsNull(node *yamlv3.Node) bool {
+	return node.Kind == yamlv3.ScalarNode && node.Tag == "!!null"
+}
+
+// quoteYamlStrings double-quotes every plain string scalar, so that it's read as a string under yaml 1.1 too
+func quoteYamlStrings(node *yamlv3.Node) {
+	if node.Kind == yamlv3.ScalarNode && node.Tag == "!!str" && node.Style == 0 {
+		node.Style = yamlv3.DoubleQuotedStyle
+	}
+	for _, child := range node.Content {
+		quoteYamlStrings(child)
+	}
+}
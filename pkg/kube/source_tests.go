@@ -0,0 +1,188 @@
+package kube
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var multiDocumentPolicies = `# leading comment
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: first
+  namespace: x
+spec:
+  podSelector: {}
+  policyTypes: [Ingress]
+---
+---
+- apiVersion: networking.k8s.io/v1
+  kind: NetworkPolicy
+  metadata:
+    name: second
+    namespace: x
+  spec:
+    podSelector: {}
+    policyTypes: [Egress]
+- apiVersion: networking.k8s.io/v1
+  kind: NetworkPolicy
+  metadata:
+    name: third
+    namespace: y
+  spec:
+    podSelector: {}
+    policyTypes: [Ingress]
+`
+
+var listAndOtherKinds = `apiVersion: v1
+kind: Service
+metadata:
+  name: web
+---
+apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: config
+- apiVersion: networking.k8s.io/v1
+  kind: NetworkPolicy
+  metadata:
+    name: in-list
+    namespace: x
+  spec:
+    podSelector: {}
+`
+
+var renderedChart = `---
+# Source: web/templates/namespace.yaml
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: web
+  labels:
+    team: y
+---
+# Source: web/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+---
+# Source: web/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: web
+spec:
+  template:
+    metadata:
+      labels:
+        app: web
+    spec:
+      containers:
+      - name: web
+        ports:
+        - containerPort: 8080
+          name: http
+---
+# Source: web/templates/networkpolicy.yaml
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: allow-http
+  namespace: web
+spec:
+  podSelector:
+    matchLabels:
+      app: web
+  policyTypes:
+  - Ingress
+`
+
+func RunSourceTests() {
+	Describe("SourceLocation", func() {
+		It("Should split yaml documents, counting empty documents", func() {
+			docs := SplitYamlDocuments([]byte(multiDocumentPolicies))
+			Expect(docs).To(HaveLen(3))
+			Expect(docs[0].Line).To(Equal(2))
+			Expect(docs[1].IsEmpty()).To(BeTrue())
+			Expect(docs[2].Index).To(Equal(2))
+			Expect(docs[2].Line).To(Equal(12))
+		})
+
+		It("Should keep the separators of yaml documents", func() {
+			for _, stream := range []string{"---\na: 1\n", "a: 1\n--- # b\nb: 2", "---\n---\n", "a: 1\n---"} {
+				var joined string
+				for _, doc := range SplitYamlDocuments([]byte(stream)) {
+					joined += doc.Separator + string(doc.Bytes)
+				}
+				Expect(joined).To(Equal(stream))
+			}
+		})
+
+		It("Should remember the file, document and line of each policy", func() {
+			policies, sources, err := ParseNetworkPolicies("policies.yaml", []byte(multiDocumentPolicies))
+			Expect(err).To(Succeed())
+			Expect(policies).To(HaveLen(3))
+			Expect(sources[policies[0]]).To(Equal(&SourceLocation{File: "policies.yaml", Document: 0, Line: 2}))
+			Expect(sources[policies[1]]).To(Equal(&SourceLocation{File: "policies.yaml", Document: 2, Line: 12, ItemPath: []interface{}{0}}))
+			Expect(sources[policies[2]]).To(Equal(&SourceLocation{File: "policies.yaml", Document: 2, Line: 20, ItemPath: []interface{}{1}}))
+			Expect(policies[2].Name).To(Equal("third"))
+			Expect(sources[policies[2]].String()).To(Equal("policies.yaml:20"))
+		})
+
+		It("Should read json lists", func() {
+			policies, sources, err := ParseNetworkPolicies("policies.json", []byte("[{\"metadata\": {\"name\": \"a\"}},\n {\"metadata\": {\"name\": \"b\"}}]"))
+			Expect(err).To(Succeed())
+			Expect(policies).To(HaveLen(2))
+			Expect(sources[policies[1]]).To(Equal(&SourceLocation{File: "policies.json", Document: 0, Line: 2, ItemPath: []interface{}{1}}))
+		})
+
+		It("Should read List kinds, and skip other kinds", func() {
+			policies, sources, err := ParseNetworkPolicies("manifests.yaml", []byte(listAndOtherKinds))
+			Expect(err).To(Succeed())
+			Expect(policies).To(HaveLen(1))
+			Expect(policies[0].Name).To(Equal("in-list"))
+			Expect(sources[policies[0]]).To(Equal(&SourceLocation{File: "manifests.yaml", Document: 1, Line: 13, ItemPath: []interface{}{"items", 1}}))
+		})
+
+		It("Should skip NetworkPolicies of other API groups", func() {
+			policies, _, err := ParseNetworkPolicies("cni.yaml", []byte(`apiVersion: projectcalico.org/v3
+kind: NetworkPolicy
+metadata:
+  name: calico
+  namespace: x
+spec:
+  selector: role == 'db'
+---
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: kube
+  namespace: x
+spec:
+  podSelector: {}
+`))
+			Expect(err).To(Succeed())
+			Expect(policies).To(HaveLen(1))
+			Expect(policies[0].Name).To(Equal("kube"))
+		})
+
+		It("Should read the namespaces, workloads and policies of a mixed manifest stream", func() {
+			manifests, err := ParseManifests("chart.yaml", []byte(renderedChart))
+			Expect(err).To(Succeed())
+			Expect(manifests.NetworkPolicies).To(HaveLen(1))
+			Expect(manifests.Sources[manifests.NetworkPolicies[0]].Line).To(Equal(35))
+			Expect(manifests.Namespaces).To(HaveLen(1))
+			Expect(manifests.Namespaces[0].Labels).To(Equal(map[string]string{"team": "y"}))
+			Expect(manifests.Deployments).To(HaveLen(1))
+			Expect(manifests.Deployments[0].Spec.Template.Spec.Containers[0].Ports[0].Name).To(Equal("http"))
+			Expect(manifests.Pods).To(BeEmpty())
+			Expect(manifests.StatefulSets).To(BeEmpty())
+			Expect(manifests.HasWorkloads()).To(BeTrue())
+		})
+	})
+}
@@ -11,5 +11,7 @@ func TestModel(t *testing.T) {
 	RegisterFailHandler(Fail)
 	RunIPAddressTests()
 	RunLabelSelectorTests()
+	RunSourceTests()
+	RunValidationTests()
 	RunSpecs(t, "network policy matcher suite")
 }
@@ -0,0 +1,160 @@
+package kube
+
+import (
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"net"
+)
+
+// ValidateNetworkPolicy finds every problem for which the API server would reject a policy, following upstream's
+// ValidateNetworkPolicy.  The one difference is that a missing namespace is allowed, since policies read from
+// files are created in the default namespace.
+func ValidateNetworkPolicy(policy *networkingv1.NetworkPolicy) field.ErrorList {
+	allErrs := ValidateNetworkPolicyMeta(&policy.ObjectMeta, field.NewPath("metadata"))
+	return append(allErrs, ValidateNetworkPolicySpec(&policy.Spec, field.NewPath("spec"))...)
+}
+
+func ValidateNetworkPolicyMeta(meta *metav1.ObjectMeta, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if meta.Name == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("name"), "name is required"))
+	} else {
+		for _, msg := range validation.IsDNS1123Subdomain(meta.Name) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("name"), meta.Name, msg))
+		}
+	}
+	if meta.Namespace != "" {
+		for _, msg := range validation.IsDNS1123Label(meta.Namespace) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("namespace"), meta.Namespace, msg))
+		}
+	}
+	return append(allErrs, metav1validation.ValidateLabels(meta.Labels, fldPath.Child("labels"))...)
+}
+
+func ValidateNetworkPolicySpec(spec *networkingv1.NetworkPolicySpec, fldPath *field.Path) field.ErrorList {
+	allErrs := metav1validation.ValidateLabelSelector(&spec.PodSelector, fldPath.Child("podSelector"))
+	for i, ingress := range spec.Ingress {
+		ingressPath := fldPath.Child("ingress").Index(i)
+		for j, port := range ingress.Ports {
+			allErrs = append(allErrs, ValidateNetworkPolicyPort(&port, ingressPath.Child("ports").Index(j))...)
+		}
+		for j, from := range ingress.From {
+			allErrs = append(allErrs, ValidateNetworkPolicyPeer(&from, ingressPath.Child("from").Index(j))...)
+		}
+	}
+	for i, egress := range spec.Egress {
+		egressPath := fldPath.Child("egress").Index(i)
+		for j, port := range egress.Ports {
+			allErrs = append(allErrs, ValidateNetworkPolicyPort(&port, egressPath.Child("ports").Index(j))...)
+		}
+		for j, to := range egress.To {
+			allErrs = append(allErrs, ValidateNetworkPolicyPeer(&to, egressPath.Child("to").Index(j))...)
+		}
+	}
+
+	allowed := []string{string(networkingv1.PolicyTypeIngress), string(networkingv1.PolicyTypeEgress)}
+	if len(spec.PolicyTypes) > len(allowed) {
+		return append(allErrs, field.Invalid(fldPath.Child("policyTypes"), &spec.PolicyTypes, "may not specify more than two policyTypes"))
+	}
+	for i, policyType := range spec.PolicyTypes {
+		if policyType != networkingv1.PolicyTypeIngress && policyType != networkingv1.PolicyTypeEgress {
+			allErrs = append(allErrs, field.NotSupported(fldPath.Child("policyTypes").Index(i), policyType, allowed))
+		}
+	}
+	return allErrs
+}
+
+// Details of the endPort errors, so that they can be told apart from endPort being out of range
+const (
+	EndPortWithoutPortDetail    = "may not be specified when `port` is not specified"
+	EndPortNonNumericPortDetail = "may not be specified when `port` is non-numeric"
+	EndPortBeforePortDetail     = "must be greater than or equal to `port`"
+)
+
+func ValidateNetworkPolicyPort(port *networkingv1.NetworkPolicyPort, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if port.Protocol != nil && *port.Protocol != v1.ProtocolTCP && *port.Protocol != v1.ProtocolUDP && *port.Protocol != v1.ProtocolSCTP {
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("protocol"), *port.Protocol, []string{string(v1.ProtocolTCP), string(v1.ProtocolUDP), string(v1.ProtocolSCTP)}))
+	}
+	if port.Port == nil {
+		if port.EndPort != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("endPort"), *port.EndPort, EndPortWithoutPortDetail))
+		}
+		return allErrs
+	}
+	if port.Port.Type == intstr.Int {
+		for _, msg := range validation.IsValidPortNum(int(port.Port.IntVal)) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("port"), port.Port.IntVal, msg))
+		}
+		if port.EndPort != nil {
+			if *port.EndPort < port.Port.IntVal {
+				allErrs = append(allErrs, field.Invalid(fldPath.Child("endPort"), *port.EndPort, EndPortBeforePortDetail))
+			}
+			for _, msg := range validation.IsValidPortNum(int(*port.EndPort)) {
+				allErrs = append(allErrs, field.Invalid(fldPath.Child("endPort"), *port.EndPort, msg))
+			}
+		}
+	} else {
+		if port.EndPort != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("endPort"), *port.EndPort, EndPortNonNumericPortDetail))
+		}
+		for _, msg := range validation.IsValidPortName(port.Port.StrVal) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("port"), port.Port.StrVal, msg))
+		}
+	}
+	return allErrs
+}
+
+func ValidateNetworkPolicyPeer(peer *networkingv1.NetworkPolicyPeer, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	peerCount := 0
+	if peer.PodSelector != nil {
+		peerCount++
+		allErrs = append(allErrs, metav1validation.ValidateLabelSelector(peer.PodSelector, fldPath.Child("podSelector"))...)
+	}
+	if peer.NamespaceSelector != nil {
+		peerCount++
+		allErrs = append(allErrs, metav1validation.ValidateLabelSelector(peer.NamespaceSelector, fldPath.Child("namespaceSelector"))...)
+	}
+	if peer.IPBlock != nil {
+		peerCount++
+		allErrs = append(allErrs, ValidateIPBlock(peer.IPBlock, fldPath.Child("ipBlock"))...)
+	}
+	if peerCount == 0 {
+		allErrs = append(allErrs, field.Required(fldPath, "must specify a peer"))
+	} else if peerCount > 1 && peer.IPBlock != nil {
+		allErrs = append(allErrs, field.Forbidden(fldPath, "may not specify both ipBlock and another peer"))
+	}
+	return allErrs
+}
+
+// ValidateIPBlock checks that the CIDR and excepts parse, and that every except is a strict subset of the CIDR
+func ValidateIPBlock(ipBlock *networkingv1.IPBlock, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if ipBlock.CIDR == "" {
+		return append(allErrs, field.Required(fldPath.Child("cidr"), ""))
+	}
+	_, cidr, err := net.ParseCIDR(ipBlock.CIDR)
+	if err != nil {
+		return append(allErrs, field.Invalid(fldPath.Child("cidr"), ipBlock.CIDR, "not a valid CIDR"))
+	}
+	cidrOnes, _ := cidr.Mask.Size()
+	for i, except := range ipBlock.Except {
+		exceptPath := fldPath.Child("except").Index(i)
+		_, exceptCIDR, err := net.ParseCIDR(except)
+		if err != nil {
+			allErrs = append(allErrs, field.Invalid(exceptPath, except, "not a valid CIDR"))
+			continue
+		}
+		exceptOnes, _ := exceptCIDR.Mask.Size()
+		if !cidr.Contains(exceptCIDR.IP) || cidrOnes >= exceptOnes {
+			allErrs = append(allErrs, field.Invalid(exceptPath, except, "must be a strict subset of `cidr`"))
+		}
+	}
+	return allErrs
+}
@@ -0,0 +1,121 @@
+package kube
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func RunValidationTests() {
+	Describe("NetworkPolicy validation", func() {
+		fields := func(errs field.ErrorList) []string {
+			var paths []string
+			for _, err := range errs {
+				paths = append(paths, err.Field)
+			}
+			return paths
+		}
+		policyWithSpec := func(spec networkingv1.NetworkPolicySpec) *networkingv1.NetworkPolicy {
+			return &networkingv1.NetworkPolicy{ObjectMeta: metav1.ObjectMeta{Name: "abc"}, Spec: spec}
+		}
+		sctp := v1.ProtocolSCTP
+
+		It("accepts a valid policy without a namespace", func() {
+			port := intstr.FromString("http")
+			Expect(ValidateNetworkPolicy(policyWithSpec(networkingv1.NetworkPolicySpec{
+				PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+				Ingress: []networkingv1.NetworkPolicyIngressRule{{
+					Ports: []networkingv1.NetworkPolicyPort{{Protocol: &sctp, Port: &port}},
+					From:  []networkingv1.NetworkPolicyPeer{{IPBlock: &networkingv1.IPBlock{CIDR: "10.0.0.0/8", Except: []string{"10.1.0.0/16"}}}},
+				}},
+				PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			}))).To(BeEmpty())
+		})
+
+		It("rejects bad metadata", func() {
+			errs := ValidateNetworkPolicy(&networkingv1.NetworkPolicy{ObjectMeta: metav1.ObjectMeta{Namespace: "Not_A_Label", Name: "abc"}})
+			Expect(fields(errs)).To(Equal([]string{"metadata.namespace"}))
+
+			errs = ValidateNetworkPolicy(&networkingv1.NetworkPolicy{})
+			Expect(fields(errs)).To(Equal([]string{"metadata.name"}))
+		})
+
+		It("reports every violation, with its field path", func() {
+			longName := intstr.FromString("a-very-long-port-name")
+			badPort := intstr.FromInt(70000)
+			badProtocol := v1.Protocol("ICMP")
+			errs := ValidateNetworkPolicy(policyWithSpec(networkingv1.NetworkPolicySpec{
+				PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "not valid!"}},
+				Ingress: []networkingv1.NetworkPolicyIngressRule{{
+					Ports: []networkingv1.NetworkPolicyPort{{Port: &longName}, {Protocol: &badProtocol, Port: &badPort}},
+					From: []networkingv1.NetworkPolicyPeer{
+						{},
+						{IPBlock: &networkingv1.IPBlock{CIDR: "10.0.0.0/33"}},
+						{IPBlock: &networkingv1.IPBlock{CIDR: "10.0.0.0/8", Except: []string{"not-a-cidr", "11.0.0.0/16", "10.0.0.0/8"}}},
+					},
+				}},
+			}))
+			Expect(fields(errs)).To(Equal([]string{
+				"spec.podSelector.matchLabels",
+				"spec.ingress[0].ports[0].port",
+				"spec.ingress[0].ports[1].protocol",
+				"spec.ingress[0].ports[1].port",
+				"spec.ingress[0].from[0]",
+				"spec.ingress[0].from[1].ipBlock.cidr",
+				"spec.ingress[0].from[2].ipBlock.except[0]",
+				"spec.ingress[0].from[2].ipBlock.except[1]",
+				"spec.ingress[0].from[2].ipBlock.except[2]",
+			}))
+		})
+
+		It("rejects a peer with an ip block and a selector", func() {
+			errs := ValidateNetworkPolicy(policyWithSpec(networkingv1.NetworkPolicySpec{
+				Egress: []networkingv1.NetworkPolicyEgressRule{{To: []networkingv1.NetworkPolicyPeer{{
+					IPBlock:           &networkingv1.IPBlock{CIDR: "10.0.0.0/8"},
+					NamespaceSelector: &metav1.LabelSelector{},
+				}}}},
+			}))
+			Expect(fields(errs)).To(Equal([]string{"spec.egress[0].to[0]"}))
+			Expect(errs[0].Type).To(Equal(field.ErrorTypeForbidden))
+		})
+
+		It("rejects bad port ranges and policy types", func() {
+			port := intstr.FromInt(100)
+			named := intstr.FromString("http")
+			endBefore, endTooBig := int32(99), int32(70000)
+			errs := ValidateNetworkPolicy(policyWithSpec(networkingv1.NetworkPolicySpec{
+				Ingress: []networkingv1.NetworkPolicyIngressRule{{Ports: []networkingv1.NetworkPolicyPort{
+					{Port: &port, EndPort: &endBefore},
+					{Port: &port, EndPort: &endTooBig},
+					{Port: &named, EndPort: &endTooBig},
+					{EndPort: &endTooBig},
+				}}},
+				PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, "Sideways"},
+			}))
+			Expect(fields(errs)).To(Equal([]string{
+				"spec.ingress[0].ports[0].endPort",
+				"spec.ingress[0].ports[1].endPort",
+				"spec.ingress[0].ports[2].endPort",
+				"spec.ingress[0].ports[3].endPort",
+				"spec.policyTypes[1]",
+			}))
+		})
+
+		It("rejects a label selector with a bad operator", func() {
+			errs := ValidateNetworkPolicy(policyWithSpec(networkingv1.NetworkPolicySpec{
+				PodSelector: metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+					{Key: "app", Operator: "Equals", Values: []string{"web"}},
+					{Key: "app", Operator: metav1.LabelSelectorOpIn},
+				}},
+			}))
+			Expect(fields(errs)).To(Equal([]string{
+				"spec.podSelector.matchExpressions[0].operator",
+				"spec.podSelector.matchExpressions[1].values",
+			}))
+		})
+	})
+}
@@ -2,11 +2,14 @@ package linter
 
 import (
 	"fmt"
+	"github.com/mattfenwick/cyclonus/pkg/connectivity/probe"
+	"github.com/mattfenwick/cyclonus/pkg/kube"
 	"github.com/mattfenwick/cyclonus/pkg/matcher"
 	"github.com/mattfenwick/cyclonus/pkg/utils"
 	"github.com/olekukonko/tablewriter"
 	v1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"strings"
 )
 
@@ -32,6 +35,15 @@ const (
 	CheckSourceMissingPolicyTypeEgress  Check = "CheckSourceMissingPolicyTypeEgress"
 	// duplicate names
 	CheckSourceDuplicatePolicyName Check = "CheckSourceDuplicatePolicyName"
+	// a port range (EndPort) must start at a numbered port
+	CheckSourcePortRangeMissingNumberedPort Check = "CheckSourcePortRangeMissingNumberedPort"
+	// a port range (EndPort) must not end before it starts
+	CheckSourcePortRangeEndBeforeStart Check = "CheckSourcePortRangeEndBeforeStart"
+	// the API server would reject the policy, for a reason not covered by the other source checks -- such as an
+	// invalid CIDR, an except outside of its CIDR, or an invalid label selector
+	CheckSourceRejectedByAPIServer Check = "CheckSourceRejectedByAPIServer"
+	// a construct from a CNI-specific policy (Calico, Cilium) which can't be translated, and was dropped
+	CheckSourceUnsupportedDialectConstruct Check = "CheckSourceUnsupportedDialectConstruct"
 
 	CheckDNSBlockedOnTCP         Check = "CheckDNSBlockedOnTCP"
 	CheckDNSBlockedOnUDP         Check = "CheckDNSBlockedOnUDP"
@@ -39,26 +51,57 @@ const (
 	CheckTargetAllEgressBlocked  Check = "CheckTargetAllEgressBlocked"
 	CheckTargetAllIngressAllowed Check = "CheckTargetAllIngressAllowed"
 	CheckTargetAllEgressAllowed  Check = "CheckTargetAllEgressAllowed"
+	// a peer, IP block or port can never change the outcome, since another rule on the same target already allows a superset
+	CheckTargetShadowedPeer    Check = "CheckTargetShadowedPeer"
+	CheckTargetShadowedIPBlock Check = "CheckTargetShadowedIPBlock"
+	CheckTargetShadowedPort    Check = "CheckTargetShadowedPort"
+
+	// a target, peer or named port which matches no pod of the cluster inventory -- often a typo'd label
+	CheckInventoryTargetMatchesNothing    Check = "CheckInventoryTargetMatchesNothing"
+	CheckInventoryPeerMatchesNothing      Check = "CheckInventoryPeerMatchesNothing"
+	CheckInventoryNamedPortMatchesNothing Check = "CheckInventoryNamedPortMatchesNothing"
+	// a pod which isn't selected by any policy, even though other namespaces have a default-deny
+	CheckInventoryPodNotSelectedIngress Check = "CheckInventoryPodNotSelectedIngress"
+	CheckInventoryPodNotSelectedEgress  Check = "CheckInventoryPodNotSelectedEgress"
 )
 
 type Warning struct {
 	Check        Check
+	Severity     Severity
 	Target       *matcher.Target
 	SourcePolicy *networkingv1.NetworkPolicy
+	// ShadowedBy is the policy responsible for a shadowed peer, IP block or port
+	ShadowedBy *networkingv1.NetworkPolicy
+	// Pod is the inventory pod, for warnings about pods rather than policies
+	Pod    *probe.Pod
+	Detail string
+}
+
+// Namespace is the namespace of the target, of the pod, or of the source policy
+func (w *Warning) Namespace() string {
+	if w.Target != nil {
+		return w.Target.Namespace
+	}
+	if w.Pod != nil {
+		return w.Pod.Namespace
+	}
+	return w.SourcePolicy.Namespace
 }
 
 func WarningsTable(warnings []*Warning) string {
 	str := &strings.Builder{}
 	table := tablewriter.NewWriter(str)
-	table.SetHeader([]string{"Source/Resolved", "Type", "Target", "Source Policies"})
+	table.SetHeader([]string{"Source/Resolved", "Severity", "Type", "Target", "Source Policies", "Details"})
 	table.SetRowLine(true)
 	table.SetReflowDuringAutoWrap(false)
 	table.SetAutoWrapText(false)
 
 	for _, warning := range warnings {
-		if warning.SourcePolicy != nil {
+		if warning.Pod != nil {
+			table.Append([]string{"Inventory", string(warning.Severity), string(warning.Check), "pod: " + warning.Pod.PodString().String(), "", warning.Detail})
+		} else if warning.Target == nil {
 			p := warning.SourcePolicy
-			table.Append([]string{"Source", string(warning.Check), "", p.Namespace + "/" + p.Name})
+			table.Append([]string{"Source", string(warning.Severity), string(warning.Check), "", p.Namespace + "/" + p.Name, warning.Detail})
 		} else {
 			t := warning.Target
 			var source []string
@@ -66,7 +109,7 @@ func WarningsTable(warnings []*Warning) string {
 				source = append(source, policy.Namespace+"/"+policy.Name)
 			}
 			target := fmt.Sprintf("namespace: %s\n\npod selector:\n%s", t.Namespace, utils.YamlString(t.PodSelector))
-			table.Append([]string{"Resolved", string(warning.Check), target, strings.Join(source, "\n")})
+			table.Append([]string{"Resolved", string(warning.Severity), string(warning.Check), target, strings.Join(source, "\n"), warning.Detail})
 		}
 	}
 
@@ -74,13 +117,47 @@ func WarningsTable(warnings []*Warning) string {
 	return str.String()
 }
 
+// WarningReport is the structured form of a Warning.  Target is nil for warnings about source policies.
+type WarningReport struct {
+	Check          Check                  `json:"check"`
+	Severity       Severity               `json:"severity"`
+	Target         *matcher.TargetSummary `json:"target,omitempty"`
+	Pod            string                 `json:"pod,omitempty"`
+	SourcePolicies []string               `json:"sourcePolicies"`
+	ShadowedBy     string                 `json:"shadowedBy,omitempty"`
+	Detail         string                 `json:"detail,omitempty"`
+}
+
+func WarningsReport(warnings []*Warning) []*WarningReport {
+	reports := []*WarningReport{}
+	for _, warning := range warnings {
+		report := &WarningReport{Check: warning.Check, Severity: warning.Severity, Detail: warning.Detail}
+		if warning.Pod != nil {
+			report.Pod = warning.Pod.PodString().String()
+			report.SourcePolicies = []string{}
+		} else if warning.Target == nil {
+			report.SourcePolicies = []string{warning.SourcePolicy.Namespace + "/" + warning.SourcePolicy.Name}
+		} else {
+			report.Target = warning.Target.Summary()
+			report.SourcePolicies = report.Target.SourcePolicies
+		}
+		if warning.ShadowedBy != nil {
+			report.ShadowedBy = warning.ShadowedBy.Namespace + "/" + warning.ShadowedBy.Name
+		}
+		reports = append(reports, report)
+	}
+	return reports
+}
+
+// Lint runs the source checks on every policy, and the resolved checks on the valid ones
 func Lint(kubePolicies []*networkingv1.NetworkPolicy, skip map[Check]bool) []*Warning {
-	policies := matcher.BuildNetworkPolicies(kubePolicies)
+	policies, _ := matcher.BuildValidNetworkPolicies(kubePolicies)
 	warnings := append(LintSourcePolicies(kubePolicies), LintResolvedPolicies(policies)...)
 
 	var filtered []*Warning
 	for _, warning := range warnings {
 		if _, ok := skip[warning.Check]; !ok {
+			warning.Severity = DefaultSeverities[warning.Check]
 			filtered = append(filtered, warning)
 		}
 	}
@@ -117,11 +194,15 @@ func LintSourcePolicies(kubePolicies []*networkingv1.NetworkPolicy) []*Warning {
 				ingress = true
 			}
 		}
-		if len(policy.Spec.Ingress) > 0 && !ingress {
-			ws = append(ws, &Warning{Check: CheckSourceMissingPolicyTypeIngress, SourcePolicy: policy})
-		}
-		if len(policy.Spec.Egress) > 0 && !egress {
-			ws = append(ws, &Warning{Check: CheckSourceMissingPolicyTypeEgress, SourcePolicy: policy})
+		// without any policy types, the API server's defaults cover the rules: CheckSourceMissingPolicyTypes
+		// reports that case
+		if len(policy.Spec.PolicyTypes) > 0 {
+			if len(policy.Spec.Ingress) > 0 && !ingress {
+				ws = append(ws, &Warning{Check: CheckSourceMissingPolicyTypeIngress, SourcePolicy: policy})
+			}
+			if len(policy.Spec.Egress) > 0 && !egress {
+				ws = append(ws, &Warning{Check: CheckSourceMissingPolicyTypeEgress, SourcePolicy: policy})
+			}
 		}
 
 		for _, ingressRule := range policy.Spec.Ingress {
@@ -130,6 +211,29 @@ func LintSourcePolicies(kubePolicies []*networkingv1.NetworkPolicy) []*Warning {
 		for _, egressRule := range policy.Spec.Egress {
 			ws = append(ws, LintNetworkPolicyPorts(policy, egressRule.Ports)...)
 		}
+
+		ws = append(ws, LintValidation(policy)...)
+	}
+	return ws
+}
+
+// portRangeErrorDetails are the endPort validation errors which CheckSourcePortRangeMissingNumberedPort and
+// CheckSourcePortRangeEndBeforeStart already report
+var portRangeErrorDetails = map[string]bool{
+	kube.EndPortWithoutPortDetail:    true,
+	kube.EndPortNonNumericPortDetail: true,
+	kube.EndPortBeforePortDetail:     true,
+}
+
+// LintValidation reports every problem for which the API server would reject a policy, other than those port
+// range problems which have their own checks
+func LintValidation(policy *networkingv1.NetworkPolicy) []*Warning {
+	var ws []*Warning
+	for _, err := range kube.ValidateNetworkPolicy(policy) {
+		if strings.HasSuffix(err.Field, ".endPort") && portRangeErrorDetails[err.Detail] {
+			continue
+		}
+		ws = append(ws, &Warning{Check: CheckSourceRejectedByAPIServer, SourcePolicy: policy, Detail: err.Error()})
 	}
 	return ws
 }
@@ -140,6 +244,13 @@ func LintNetworkPolicyPorts(policy *networkingv1.NetworkPolicy, ports []networki
 		if port.Protocol == nil {
 			ws = append(ws, &Warning{Check: CheckSourcePortMissingProtocol, SourcePolicy: policy})
 		}
+		if port.EndPort != nil {
+			if port.Port == nil || port.Port.Type != intstr.Int {
+				ws = append(ws, &Warning{Check: CheckSourcePortRangeMissingNumberedPort, SourcePolicy: policy})
+			} else if *port.EndPort < port.Port.IntVal {
+				ws = append(ws, &Warning{Check: CheckSourcePortRangeEndBeforeStart, SourcePolicy: policy})
+			}
+		}
 	}
 	return ws
 }
@@ -171,5 +282,5 @@ func LintResolvedPolicies(policies *matcher.Policy) []*Warning {
 		}
 	}
 
-	return ws
+	return append(ws, LintShadowedRules(policies)...)
 }
@@ -0,0 +1,85 @@
+package linter
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func RunChecksTests() {
+	Describe("Source checks", func() {
+		checksOf := func(warnings []*Warning) []Check {
+			var checks []Check
+			for _, warning := range warnings {
+				checks = append(checks, warning.Check)
+			}
+			return checks
+		}
+
+		It("should report port range problems with their own checks, and not also as rejected by the API server", func() {
+			warnings := LintSourcePolicies(mustParsePolicies(`
+metadata: {name: a, namespace: x}
+spec:
+  podSelector: {}
+  ingress:
+  - ports:
+    - {protocol: TCP, port: 100, endPort: 99}
+    - {protocol: TCP, port: http, endPort: 99}
+  egress:
+  - ports:
+    - {protocol: TCP, endPort: 99}
+  policyTypes: [Ingress, Egress]`))
+			Expect(checksOf(warnings)).To(Equal([]Check{
+				CheckSourcePortRangeEndBeforeStart,
+				CheckSourcePortRangeMissingNumberedPort,
+				CheckSourcePortRangeMissingNumberedPort,
+			}))
+		})
+
+		It("should report an out of range endPort as rejected by the API server", func() {
+			warnings := LintSourcePolicies(mustParsePolicies(`
+metadata: {name: a, namespace: x}
+spec:
+  podSelector: {}
+  ingress:
+  - ports:
+    - {protocol: TCP, port: 100, endPort: 70000}
+  policyTypes: [Ingress]`))
+			Expect(checksOf(warnings)).To(Equal([]Check{CheckSourceRejectedByAPIServer}))
+			Expect(warnings[0].Detail).To(ContainSubstring("spec.ingress[0].ports[0].endPort"))
+			Expect(warnings[0].Detail).To(ContainSubstring("must be between 1 and 65535"))
+		})
+
+		It("should report every invalid except of an ip block", func() {
+			warnings := LintSourcePolicies(mustParsePolicies(`
+metadata: {name: a, namespace: x}
+spec:
+  podSelector: {}
+  egress:
+  - to:
+    - ipBlock: {cidr: 10.0.0.0/8, except: [not-a-cidr, 11.0.0.0/16]}
+  policyTypes: [Egress]`))
+			Expect(checksOf(warnings)).To(Equal([]Check{CheckSourceRejectedByAPIServer, CheckSourceRejectedByAPIServer}))
+			Expect(warnings[0].Detail).To(ContainSubstring("except[0]"))
+			Expect(warnings[1].Detail).To(ContainSubstring("except[1]"))
+		})
+
+		It("should only report missing ingress and egress policy types if there are policy types", func() {
+			warnings := LintSourcePolicies(mustParsePolicies(`
+metadata: {name: defaults, namespace: x}
+spec:
+  podSelector: {}
+  egress:
+  - {}
+---
+metadata: {name: missing-egress, namespace: x}
+spec:
+  podSelector: {}
+  egress:
+  - {}
+  policyTypes: [Ingress]`))
+			Expect(checksOf(warnings)).To(Equal([]Check{CheckSourceMissingPolicyTypes, CheckSourceMissingPolicyTypeEgress}))
+			Expect(warnings[0].SourcePolicy.Name).To(Equal("defaults"))
+			Expect(warnings[1].SourcePolicy.Name).To(Equal("missing-egress"))
+		})
+	})
+}
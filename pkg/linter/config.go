@@ -0,0 +1,182 @@
+package linter
+
+import (
+	"github.com/pkg/errors"
+	"sigs.k8s.io/yaml"
+)
+
+type Severity string
+
+const (
+	SeverityInfo    Severity = "info"
+	SeverityWarning Severity = "warning"
+	SeverityError   Severity = "error"
+)
+
+var AllSeverities = []Severity{SeverityInfo, SeverityWarning, SeverityError}
+
+func (s Severity) rank() int {
+	for i, severity := range AllSeverities {
+		if s == severity {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s Severity) IsValid() bool {
+	return s.rank() >= 0
+}
+
+// IsAtLeast returns true if s is as severe as, or more severe than, other
+func (s Severity) IsAtLeast(other Severity) bool {
+	return s.rank() >= other.rank()
+}
+
+// DefaultSeverities: errors are policies which don't mean what they appear to, or which the API server rejects;
+// warnings are likely mistakes; info is everything else
+var DefaultSeverities = map[Check]Severity{
+	CheckSourceMissingNamespace:             SeverityWarning,
+	CheckSourcePortMissingProtocol:          SeverityInfo,
+	CheckSourceMissingPolicyTypes:           SeverityWarning,
+	CheckSourceMissingPolicyTypeIngress:     SeverityError,
+	CheckSourceMissingPolicyTypeEgress:      SeverityError,
+	CheckSourceDuplicatePolicyName:          SeverityError,
+	CheckSourcePortRangeMissingNumberedPort: SeverityError,
+	CheckSourcePortRangeEndBeforeStart:      SeverityError,
+	CheckSourceRejectedByAPIServer:          SeverityError,
+	CheckSourceUnsupportedDialectConstruct:  SeverityWarning,
+
+	CheckDNSBlockedOnTCP:         SeverityWarning,
+	CheckDNSBlockedOnUDP:         SeverityWarning,
+	CheckTargetAllIngressBlocked: SeverityInfo,
+	CheckTargetAllEgressBlocked:  SeverityInfo,
+	CheckTargetAllIngressAllowed: SeverityWarning,
+	CheckTargetAllEgressAllowed:  SeverityInfo,
+	CheckTargetShadowedPeer:      SeverityInfo,
+	CheckTargetShadowedIPBlock:   SeverityInfo,
+	CheckTargetShadowedPort:      SeverityInfo,
+
+	CheckInventoryTargetMatchesNothing:    SeverityWarning,
+	CheckInventoryPeerMatchesNothing:      SeverityWarning,
+	CheckInventoryNamedPortMatchesNothing: SeverityWarning,
+	CheckInventoryPodNotSelectedIngress:   SeverityInfo,
+	CheckInventoryPodNotSelectedEgress:    SeverityInfo,
+}
+
+// Config enables and disables checks, and overrides their severities -- globally, or per namespace.
+// A namespace's settings take precedence over the global settings.
+//
+// For example:
+//
+//	failOn: warning
+//	checks:
+//	  CheckSourcePortMissingProtocol: {enabled: false}
+//	  CheckTargetAllEgressAllowed: {severity: error}
+//	namespaces:
+//	  kube-system:
+//	    checks:
+//	      CheckTargetAllEgressAllowed: {enabled: false}
+type Config struct {
+	// FailOn is the severity at or above which linting fails; if empty, linting never fails
+	FailOn     Severity                   `json:"failOn,omitempty"`
+	Checks     map[Check]CheckConfig      `json:"checks,omitempty"`
+	Namespaces map[string]NamespaceConfig `json:"namespaces,omitempty"`
+}
+
+type CheckConfig struct {
+	Enabled  *bool    `json:"enabled,omitempty"`
+	Severity Severity `json:"severity,omitempty"`
+}
+
+type NamespaceConfig struct {
+	Checks map[Check]CheckConfig `json:"checks,omitempty"`
+}
+
+func NewDefaultConfig() *Config {
+	return &Config{}
+}
+
+func ParseConfig(bytes []byte) (*Config, error) {
+	config := &Config{}
+	if err := yaml.UnmarshalStrict(bytes, config); err != nil {
+		return nil, errors.Wrapf(err, "unable to unmarshal lint config")
+	}
+	return config, config.Validate()
+}
+
+func (c *Config) Validate() error {
+	if c.FailOn != "" && !c.FailOn.IsValid() {
+		return errors.Errorf("invalid failOn severity '%s', expected one of %+v", c.FailOn, AllSeverities)
+	}
+	validateChecks := func(checks map[Check]CheckConfig) error {
+		for check, checkConfig := range checks {
+			if _, ok := DefaultSeverities[check]; !ok {
+				return errors.Errorf("unknown check '%s'", check)
+			}
+			if checkConfig.Severity != "" && !checkConfig.Severity.IsValid() {
+				return errors.Errorf("invalid severity '%s' for check '%s', expected one of %+v", checkConfig.Severity, check, AllSeverities)
+			}
+		}
+		return nil
+	}
+	if err := validateChecks(c.Checks); err != nil {
+		return err
+	}
+	for ns, nsConfig := range c.Namespaces {
+		if err := validateChecks(nsConfig.Checks); err != nil {
+			return errors.WithMessagef(err, "namespace %s", ns)
+		}
+	}
+	return nil
+}
+
+// resolve returns whether a check is enabled in a namespace, and its severity there
+func (c *Config) resolve(check Check, namespace string) (bool, Severity) {
+	enabled, severity := true, DefaultSeverities[check]
+	apply := func(checkConfig CheckConfig, ok bool) {
+		if !ok {
+			return
+		}
+		if checkConfig.Enabled != nil {
+			enabled = *checkConfig.Enabled
+		}
+		if checkConfig.Severity != "" {
+			severity = checkConfig.Severity
+		}
+	}
+	checkConfig, ok := c.Checks[check]
+	apply(checkConfig, ok)
+	if nsConfig, nsOk := c.Namespaces[namespace]; nsOk {
+		checkConfig, ok = nsConfig.Checks[check]
+		apply(checkConfig, ok)
+	}
+	return enabled, severity
+}
+
+// Apply drops warnings from disabled checks, and sets the severity of the rest
+func (c *Config) Apply(warnings []*Warning) []*Warning {
+	var applied []*Warning
+	for _, warning := range warnings {
+		enabled, severity := c.resolve(warning.Check, warning.Namespace())
+		if !enabled {
+			continue
+		}
+		warning.Severity = severity
+		applied = append(applied, warning)
+	}
+	return applied
+}
+
+// IsFailure returns true if any warning is at or above the FailOn severity
+func (c *Config) IsFailure(warnings []*Warning) bool {
+	if c.FailOn == "" {
+		return false
+	}
+	for _, warning := range warnings {
+		if warning.Severity.IsAtLeast(c.FailOn) {
+			return true
+		}
+	}
+	return false
+}
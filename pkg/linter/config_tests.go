@@ -0,0 +1,79 @@
+package linter
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func RunConfigTests() {
+	Describe("Lint config", func() {
+		sourceWarning := func(check Check, namespace string) *Warning {
+			return &Warning{Check: check, SourcePolicy: &networkingv1.NetworkPolicy{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "abc"}}}
+		}
+
+		It("should use the default severities, and never fail, without a config", func() {
+			warnings := NewDefaultConfig().Apply([]*Warning{
+				sourceWarning(CheckSourcePortMissingProtocol, "x"),
+				sourceWarning(CheckSourceDuplicatePolicyName, "x"),
+			})
+			Expect(warnings).To(HaveLen(2))
+			Expect(warnings[0].Severity).To(Equal(SeverityInfo))
+			Expect(warnings[1].Severity).To(Equal(SeverityError))
+			Expect(NewDefaultConfig().IsFailure(warnings)).To(BeFalse())
+		})
+
+		It("should let a namespace's settings take precedence over the global settings", func() {
+			config, err := ParseConfig([]byte(`
+failOn: warning
+checks:
+  CheckSourcePortMissingProtocol: {severity: warning}
+  CheckSourceMissingNamespace: {enabled: false}
+namespaces:
+  kube-system:
+    checks:
+      CheckSourcePortMissingProtocol: {enabled: false}
+      CheckSourceMissingNamespace: {enabled: true, severity: error}`))
+			Expect(err).To(Succeed())
+
+			warnings := config.Apply([]*Warning{
+				sourceWarning(CheckSourcePortMissingProtocol, "x"),
+				sourceWarning(CheckSourceMissingNamespace, "x"),
+				sourceWarning(CheckSourcePortMissingProtocol, "kube-system"),
+				sourceWarning(CheckSourceMissingNamespace, "kube-system"),
+			})
+			Expect(warnings).To(HaveLen(2))
+			Expect(warnings[0].Check).To(Equal(CheckSourcePortMissingProtocol))
+			Expect(warnings[0].Severity).To(Equal(SeverityWarning))
+			Expect(warnings[1].Check).To(Equal(CheckSourceMissingNamespace))
+			Expect(warnings[1].Namespace()).To(Equal("kube-system"))
+			Expect(warnings[1].Severity).To(Equal(SeverityError))
+		})
+
+		It("should fail on warnings at or above the failOn severity", func() {
+			config, err := ParseConfig([]byte(`failOn: warning`))
+			Expect(err).To(Succeed())
+			Expect(config.IsFailure(config.Apply([]*Warning{sourceWarning(CheckSourcePortMissingProtocol, "x")}))).To(BeFalse())
+			Expect(config.IsFailure(config.Apply([]*Warning{sourceWarning(CheckSourceMissingNamespace, "x")}))).To(BeTrue())
+			Expect(config.IsFailure(config.Apply([]*Warning{sourceWarning(CheckSourceDuplicatePolicyName, "x")}))).To(BeTrue())
+		})
+
+		It("should reject unknown checks, invalid severities and unknown fields", func() {
+			_, err := ParseConfig([]byte(`failOn: critical`))
+			Expect(err).To(MatchError(ContainSubstring("invalid failOn severity 'critical'")))
+			_, err = ParseConfig([]byte(`
+namespaces:
+  x:
+    checks:
+      CheckNothing: {enabled: false}`))
+			Expect(err).To(MatchError(ContainSubstring("namespace x: unknown check 'CheckNothing'")))
+			_, err = ParseConfig([]byte(`
+checks:
+  CheckDNSBlockedOnTCP: {severity: fatal}`))
+			Expect(err).To(MatchError(ContainSubstring("invalid severity 'fatal' for check 'CheckDNSBlockedOnTCP'")))
+			_, err = ParseConfig([]byte(`failsOn: error`))
+			Expect(err).ToNot(Succeed())
+		})
+	})
+}
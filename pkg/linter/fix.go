@@ -0,0 +1,274 @@
+package linter
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/mattfenwick/cyclonus/pkg/kube"
+	"github.com/mattfenwick/cyclonus/pkg/matcher"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"strings"
+)
+
+// FixableChecks are the source checks with an unambiguous fix, which doesn't change behavior: filling in the
+// field with the value the API server defaults it to.  Adding a missing Ingress or Egress policy type would
+// change behavior -- rules which the API server ignored would be enforced -- so those fixes are only reported.
+var FixableChecks = map[Check]bool{
+	CheckSourceMissingNamespace:    true,
+	CheckSourcePortMissingProtocol: true,
+	CheckSourceMissingPolicyTypes:  true,
+}
+
+// Fix sets a single field of a policy
+type Fix struct {
+	Check  Check
+	Policy *networkingv1.NetworkPolicy
+	// Path is a list of map keys (strings) and list indices (ints), from the root of the policy
+	Path []interface{}
+	// Value is a string or a list of strings
+	Value interface{}
+	// ChangesBehavior fixes aren't applied: they're only reported
+	ChangesBehavior bool
+}
+
+// FieldPath renders Path in the style of 'spec.ingress[0].ports[1].protocol'
+func (f *Fix) FieldPath() string {
+	str := &strings.Builder{}
+	for _, element := range f.Path {
+		switch e := element.(type) {
+		case int:
+			str.WriteString(fmt.Sprintf("[%d]", e))
+		default:
+			if str.Len() > 0 {
+				str.WriteString(".")
+			}
+			str.WriteString(fmt.Sprintf("%s", e))
+		}
+	}
+	return str.String()
+}
+
+func (f *Fix) ValueString() string {
+	if values, ok := f.Value.([]string); ok {
+		return "[" + strings.Join(values, ", ") + "]"
+	}
+	return fmt.Sprintf("%s", f.Value)
+}
+
+// FixedPolicyTypes returns a policy's types after fixing: if there are none, the API server's defaults --
+// Ingress, plus Egress if there are egress rules; otherwise, Ingress and Egress are added if there are rules
+// for them.
+func FixedPolicyTypes(policy *networkingv1.NetworkPolicy) []networkingv1.PolicyType {
+	if len(policy.Spec.PolicyTypes) == 0 {
+		return matcher.DefaultPolicyTypes(policy)
+	}
+	types := append([]networkingv1.PolicyType{}, policy.Spec.PolicyTypes...)
+	if len(policy.Spec.Ingress) > 0 && !hasPolicyType(types, networkingv1.PolicyTypeIngress) {
+		types = append(types, networkingv1.PolicyTypeIngress)
+	}
+	if len(policy.Spec.Egress) > 0 && !hasPolicyType(types, networkingv1.PolicyTypeEgress) {
+		types = append(types, networkingv1.PolicyTypeEgress)
+	}
+	return types
+}
+
+func hasPolicyType(types []networkingv1.PolicyType, policyType networkingv1.PolicyType) bool {
+	for _, t := range types {
+		if t == policyType {
+			return true
+		}
+	}
+	return false
+}
+
+func policyTypeStrings(types []networkingv1.PolicyType) []string {
+	var strs []string
+	for _, t := range types {
+		strs = append(strs, string(t))
+	}
+	return strs
+}
+
+// FixNetworkPolicy finds the fixes for a policy's fixable source checks
+func FixNetworkPolicy(policy *networkingv1.NetworkPolicy) []*Fix {
+	var fixes []*Fix
+	if policy.Namespace == "" {
+		fixes = append(fixes, &Fix{Check: CheckSourceMissingNamespace, Policy: policy, Path: []interface{}{"metadata", "namespace"}, Value: v1.NamespaceDefault})
+	}
+
+	types := FixedPolicyTypes(policy)
+	typesPath := []interface{}{"spec", "policyTypes"}
+	if len(policy.Spec.PolicyTypes) == 0 {
+		fixes = append(fixes, &Fix{Check: CheckSourceMissingPolicyTypes, Policy: policy, Path: typesPath, Value: policyTypeStrings(types)})
+	} else {
+		if !hasPolicyType(policy.Spec.PolicyTypes, networkingv1.PolicyTypeIngress) && hasPolicyType(types, networkingv1.PolicyTypeIngress) {
+			fixes = append(fixes, &Fix{Check: CheckSourceMissingPolicyTypeIngress, Policy: policy, Path: typesPath, Value: policyTypeStrings(types), ChangesBehavior: true})
+		}
+		if !hasPolicyType(policy.Spec.PolicyTypes, networkingv1.PolicyTypeEgress) && hasPolicyType(types, networkingv1.PolicyTypeEgress) {
+			fixes = append(fixes, &Fix{Check: CheckSourceMissingPolicyTypeEgress, Policy: policy, Path: typesPath, Value: policyTypeStrings(types), ChangesBehavior: true})
+		}
+	}
+
+	fixPorts := func(direction string, ruleIndex int, ports []networkingv1.NetworkPolicyPort) {
+		for portIndex, port := range ports {
+			if port.Protocol == nil {
+				fixes = append(fixes, &Fix{
+					Check:  CheckSourcePortMissingProtocol,
+					Policy: policy,
+					Path:   []interface{}{"spec", direction, ruleIndex, "ports", portIndex, "protocol"},
+					Value:  string(v1.ProtocolTCP),
+				})
+			}
+		}
+	}
+	for i, rule := range policy.Spec.Ingress {
+		fixPorts("ingress", i, rule.Ports)
+	}
+	for i, rule := range policy.Spec.Egress {
+		fixPorts("egress", i, rule.Ports)
+	}
+	return fixes
+}
+
+// FixYaml fixes every policy of a (possibly multi-document) yaml file, and returns every fix found -- including
+// those which change behavior, which aren't applied.  Only documents with applied fixes are rewritten, preserving
+// their comments and key order; the rest are left untouched.
+func FixYaml(file string, yamlBytes []byte) ([]byte, []*Fix, error) {
+	policies, sources, err := kube.ParseNetworkPolicies(file, yamlBytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	fixesByDocument := map[int][]*Fix{}
+	var allFixes []*Fix
+	for _, policy := range policies {
+		fixes := FixNetworkPolicy(policy)
+		document := sources[policy].Document
+		for _, fix := range fixes {
+			if !fix.ChangesBehavior {
+				fixesByDocument[document] = append(fixesByDocument[document], fix)
+			}
+		}
+		allFixes = append(allFixes, fixes...)
+	}
+
+	// keep each document's original separator, so that only the fixed documents change
+	var out strings.Builder
+	for _, doc := range kube.SplitYamlDocuments(yamlBytes) {
+		out.WriteString(doc.Separator)
+		fixes := fixesByDocument[doc.Index]
+		if len(fixes) == 0 {
+			out.Write(doc.Bytes)
+			continue
+		}
+		fixed, err := applyFixes(doc.Bytes, fixes, sources)
+		if err != nil {
+			return nil, nil, errors.WithMessagef(err, "unable to fix document %d at %s", doc.Index, file)
+		}
+		if strings.HasSuffix(string(doc.Bytes), "\n") {
+			fixed += "\n"
+		}
+		out.WriteString(fixed)
+	}
+	return []byte(out.String()), allFixes, nil
+}
+
+// applyFixes rewrites a document, locating each fix's policy within the document by its item path
+func applyFixes(doc []byte, fixes []*Fix, sources kube.NetworkPolicySources) (string, error) {
+	var node yaml.Node
+	if err := yaml.Unmarshal(doc, &node); err != nil {
+		return "", errors.Wrapf(err, "unable to parse yaml")
+	}
+	for _, fix := range fixes {
+		path := append(append([]interface{}{}, sources[fix.Policy].ItemPath...), fix.Path...)
+		if err := setYamlPath(node.Content[0], path, yamlValueNode(fix.Value)); err != nil {
+			return "", errors.WithMessagef(err, "unable to set %s", fix.FieldPath())
+		}
+	}
+
+	buffer := &bytes.Buffer{}
+	encoder := yaml.NewEncoder(buffer)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&node); err != nil {
+		return "", errors.Wrapf(err, "unable to serialize yaml")
+	}
+	if err := encoder.Close(); err != nil {
+		return "", errors.Wrapf(err, "unable to serialize yaml")
+	}
+	return strings.TrimSuffix(buffer.String(), "\n"), nil
+}
+
+func yamlValueNode(value interface{}) *yaml.Node {
+	if values, ok := value.([]string); ok {
+		node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for _, v := range values {
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: v})
+		}
+		return node
+	}
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: fmt.Sprintf("%s", value)}
+}
+
+// setYamlPath sets the value at path, creating the final key -- and any missing maps on the way -- if needed
+func setYamlPath(node *yaml.Node, path []interface{}, value *yaml.Node) error {
+	for i, element := range path {
+		isLast := i == len(path)-1
+		switch e := element.(type) {
+		case int:
+			if node.Kind != yaml.SequenceNode || e >= len(node.Content) {
+				return errors.Errorf("expected a list with at least %d items", e+1)
+			}
+			if isLast {
+				node.Content[e] = value
+				return nil
+			}
+			node = node.Content[e]
+		case string:
+			if node.Kind != yaml.MappingNode {
+				return errors.Errorf("expected a map at key %s", e)
+			}
+			var child *yaml.Node
+			for j := 0; j+1 < len(node.Content); j += 2 {
+				if node.Content[j].Value == e {
+					if isLast {
+						node.Content[j+1] = value
+						return nil
+					}
+					child = node.Content[j+1]
+					break
+				}
+			}
+			if child == nil {
+				child = value
+				if !isLast {
+					child = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+				}
+				node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: e}, child)
+				if isLast {
+					return nil
+				}
+			}
+			node = child
+		}
+	}
+	return nil
+}
+
+// VerifyFixes checks that the fixed policies allow exactly the same traffic as the untouched originals.  Fixing
+// doesn't touch the problems which make policies invalid, so invalid policies are an error.
+func VerifyFixes(original []*networkingv1.NetworkPolicy, fixed []*networkingv1.NetworkPolicy) error {
+	originalPolicy, policyErrors := matcher.BuildValidNetworkPolicies(original)
+	if len(policyErrors) > 0 {
+		return policyErrors[0]
+	}
+	fixedPolicy, policyErrors := matcher.BuildValidNetworkPolicies(fixed)
+	if len(policyErrors) > 0 {
+		return policyErrors[0]
+	}
+	isEquivalent, traffic := matcher.AreEquivalent(originalPolicy, fixedPolicy)
+	if !isEquivalent {
+		return errors.Errorf("fixed policies are not equivalent to the originals, differing on traffic:\n%s", traffic.Table())
+	}
+	return nil
+}
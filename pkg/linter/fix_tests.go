@@ -0,0 +1,110 @@
+package linter
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	networkingv1 "k8s.io/api/networking/v1"
+	"strings"
+)
+
+func RunFixTests() {
+	Describe("Fixing source problems", func() {
+		fixable := `# web policy
+metadata:
+  name: web
+spec:
+  podSelector: {matchLabels: {app: web}}
+  ingress:
+  - ports:
+    - port: 80 # http
+  policyTypes: [Ingress]
+`
+		untouched := `metadata: {name: db, namespace: x}
+spec:
+  podSelector: {matchLabels: {app: db}}
+  policyTypes: [Ingress]
+`
+		changesBehavior := `metadata: {name: egress, namespace: x}
+spec:
+  podSelector: {}
+  egress:
+  - to:
+    - podSelector: {}
+  policyTypes: [Ingress]
+`
+		file := strings.Join([]string{fixable, untouched, changesBehavior}, "---\n")
+
+		It("should fill in missing fields, keeping comments, and leave documents without fixes untouched", func() {
+			fixed, fixes, err := FixYaml("policies.yaml", []byte(file))
+			Expect(err).To(Succeed())
+			var fields []string
+			for _, fix := range fixes {
+				fields = append(fields, fix.FieldPath()+"="+fix.ValueString())
+			}
+			Expect(fields).To(Equal([]string{
+				"metadata.namespace=default",
+				"spec.ingress[0].ports[0].protocol=TCP",
+				"spec.policyTypes=[Ingress, Egress]",
+			}))
+
+			docs := strings.Split(string(fixed), "\n---\n")
+			Expect(docs).To(HaveLen(3))
+			Expect(docs[0] + "\n").To(Equal(`# web policy
+metadata:
+  name: web
+  namespace: default
+spec:
+  podSelector: {matchLabels: {app: web}}
+  ingress:
+  - ports:
+    - port: 80 # http
+      protocol: TCP
+  policyTypes: [Ingress]
+`))
+			Expect(docs[1] + "\n").To(Equal(untouched))
+		})
+
+		It("should only report fixes which change behavior", func() {
+			fixed, fixes, err := FixYaml("policies.yaml", []byte(file))
+			Expect(err).To(Succeed())
+			Expect(fixes[2].Check).To(Equal(CheckSourceMissingPolicyTypeEgress))
+			Expect(fixes[2].ChangesBehavior).To(BeTrue())
+			Expect(strings.Split(string(fixed), "\n---\n")[2]).To(Equal(changesBehavior))
+		})
+
+		It("should keep the original document separators", func() {
+			withSeparators := "---\n" + untouched + "--- # fixable\n" + fixable + "---\n"
+			unfixed, _, err := FixYaml("policies.yaml", []byte("---\n"+untouched+"---\n"))
+			Expect(err).To(Succeed())
+			Expect(string(unfixed)).To(Equal("---\n" + untouched + "---\n"))
+
+			fixed, _, err := FixYaml("policies.yaml", []byte(withSeparators))
+			Expect(err).To(Succeed())
+			Expect(string(fixed)).To(HavePrefix("---\n" + untouched + "--- # fixable\n# web policy\n"))
+			Expect(string(fixed)).To(HaveSuffix("  policyTypes: [Ingress]\n---\n"))
+		})
+
+		It("should verify fixed policies against the untouched originals", func() {
+			original := mustParsePolicies(file)
+			fixed, _, err := FixYaml("policies.yaml", []byte(file))
+			Expect(err).To(Succeed())
+			Expect(VerifyFixes(original, mustParsePolicies(string(fixed)))).To(Succeed())
+
+			withEgress := mustParsePolicies(file)
+			withEgress[2].Spec.PolicyTypes = append(withEgress[2].Spec.PolicyTypes, networkingv1.PolicyTypeEgress)
+			Expect(VerifyFixes(original, withEgress)).To(MatchError(ContainSubstring("fixed policies are not equivalent to the originals")))
+		})
+
+		It("should reject invalid policies", func() {
+			invalid := mustParsePolicies(`
+metadata: {name: a, namespace: x}
+spec:
+  podSelector: {}
+  ingress:
+  - from:
+    - ipBlock: {cidr: 10.0.0.0/33}
+  policyTypes: [Ingress]`)
+			Expect(VerifyFixes(invalid, invalid)).ToNot(Succeed())
+		})
+	})
+}
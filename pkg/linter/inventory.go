@@ -0,0 +1,243 @@
+package linter
+
+import (
+	"fmt"
+	"github.com/mattfenwick/cyclonus/pkg/connectivity/probe"
+	"github.com/mattfenwick/cyclonus/pkg/kube"
+	"github.com/mattfenwick/cyclonus/pkg/matcher"
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sort"
+	"strings"
+)
+
+// LintInventory checks policies against the namespaces and pods which actually exist: targets, peers and named
+// ports which match nothing, and pods which aren't selected by any policy although other namespaces have a
+// default-deny.  Targets, and peers without a namespace selector, are only checked in namespaces which are part
+// of the inventory, since an inventory of part of a cluster says nothing about the rest.  Targets of invalid
+// policies are skipped.
+func LintInventory(kubePolicies []*networkingv1.NetworkPolicy, resources *probe.Resources) []*Warning {
+	policies, _ := matcher.BuildValidNetworkPolicies(kubePolicies)
+
+	ws := lintInventoryTargets(policies, resources)
+	for _, policy := range kubePolicies {
+		ws = append(ws, lintInventoryRules(policy, resources)...)
+	}
+	ingress, egress := policies.SortedTargets()
+	ws = append(ws, lintInventoryUnselectedPods(ingress, resources, CheckInventoryPodNotSelectedIngress, "ingress")...)
+	ws = append(ws, lintInventoryUnselectedPods(egress, resources, CheckInventoryPodNotSelectedEgress, "egress")...)
+
+	for _, warning := range ws {
+		warning.Severity = DefaultSeverities[warning.Check]
+	}
+	return ws
+}
+
+func isInventoryNamespace(resources *probe.Resources, namespace string) bool {
+	_, ok := resources.Namespaces[namespace]
+	return ok
+}
+
+func inventoryPodsMatchingTarget(resources *probe.Resources, namespace string, podSelector metav1.LabelSelector) []*probe.Pod {
+	var pods []*probe.Pod
+	for _, pod := range resources.Pods {
+		if pod.Namespace == namespace && kube.IsLabelsMatchLabelSelector(pod.Labels, podSelector) {
+			pods = append(pods, pod)
+		}
+	}
+	return pods
+}
+
+// inventoryNamespacesMatchingPeer: a peer without a namespace selector is in the policy's namespace
+func inventoryNamespacesMatchingPeer(resources *probe.Resources, policyNamespace string, peer networkingv1.NetworkPolicyPeer) map[string]bool {
+	namespaces := map[string]bool{}
+	if peer.NamespaceSelector == nil {
+		namespaces[policyNamespace] = true
+		return namespaces
+	}
+	for ns, labels := range resources.Namespaces {
+		if kube.IsLabelsMatchLabelSelector(labels, *peer.NamespaceSelector) {
+			namespaces[ns] = true
+		}
+	}
+	return namespaces
+}
+
+func inventoryPodsMatchingPeer(resources *probe.Resources, policyNamespace string, peer networkingv1.NetworkPolicyPeer) []*probe.Pod {
+	namespaces := inventoryNamespacesMatchingPeer(resources, policyNamespace, peer)
+	var pods []*probe.Pod
+	for _, pod := range resources.Pods {
+		if !namespaces[pod.Namespace] {
+			continue
+		}
+		if peer.PodSelector == nil || kube.IsLabelsMatchLabelSelector(pod.Labels, *peer.PodSelector) {
+			pods = append(pods, pod)
+		}
+	}
+	return pods
+}
+
+// inventoryPodsMatchingPeers is every pod which a rule's peers could match; IP blocks may include pod IPs,
+// so a rule with an IP block -- or without peers -- could match any pod
+func inventoryPodsMatchingPeers(resources *probe.Resources, policyNamespace string, peers []networkingv1.NetworkPolicyPeer) []*probe.Pod {
+	if len(peers) == 0 {
+		return resources.Pods
+	}
+	var pods []*probe.Pod
+	for _, peer := range peers {
+		if peer.IPBlock != nil {
+			return resources.Pods
+		}
+		pods = append(pods, inventoryPodsMatchingPeer(resources, policyNamespace, peer)...)
+	}
+	return pods
+}
+
+func lintInventoryTargets(policies *matcher.Policy, resources *probe.Resources) []*Warning {
+	var ws []*Warning
+	ingress, egress := policies.SortedTargets()
+	seen := map[string]bool{}
+	for _, target := range append(ingress, egress...) {
+		if seen[target.GetPrimaryKey()] || !isInventoryNamespace(resources, target.Namespace) {
+			continue
+		}
+		seen[target.GetPrimaryKey()] = true
+		if len(inventoryPodsMatchingTarget(resources, target.Namespace, target.PodSelector)) == 0 {
+			ws = append(ws, &Warning{
+				Check:  CheckInventoryTargetMatchesNothing,
+				Target: target,
+				Detail: fmt.Sprintf("no pods in namespace %s match pod selector '%s'", target.Namespace, formatPodSelector(target.PodSelector)),
+			})
+		}
+	}
+	return ws
+}
+
+func lintInventoryRules(policy *networkingv1.NetworkPolicy, resources *probe.Resources) []*Warning {
+	var ws []*Warning
+	for i, rule := range policy.Spec.Ingress {
+		ws = append(ws, lintInventoryPeers(policy, resources, i, rule.From, true)...)
+		// ingress ports are served by the target's pods
+		var servers []*probe.Pod
+		if isInventoryNamespace(resources, policy.Namespace) {
+			servers = inventoryPodsMatchingTarget(resources, policy.Namespace, policy.Spec.PodSelector)
+		}
+		ws = append(ws, lintInventoryNamedPorts(policy, i, rule.Ports, servers, true)...)
+	}
+	for i, rule := range policy.Spec.Egress {
+		ws = append(ws, lintInventoryPeers(policy, resources, i, rule.To, false)...)
+		// egress ports are served by the peers' pods
+		ws = append(ws, lintInventoryNamedPorts(policy, i, rule.Ports, inventoryPodsMatchingPeers(resources, policy.Namespace, rule.To), false)...)
+	}
+	return ws
+}
+
+func lintInventoryPeers(policy *networkingv1.NetworkPolicy, resources *probe.Resources, ruleIndex int, peers []networkingv1.NetworkPolicyPeer, isIngress bool) []*Warning {
+	var ws []*Warning
+	for peerIndex, peer := range peers {
+		if peer.IPBlock != nil || (peer.NamespaceSelector == nil && !isInventoryNamespace(resources, policy.Namespace)) {
+			continue
+		}
+		if len(inventoryPodsMatchingPeer(resources, policy.Namespace, peer)) > 0 {
+			continue
+		}
+		reason := "no pods match"
+		if len(inventoryNamespacesMatchingPeer(resources, policy.Namespace, peer)) == 0 {
+			reason = "no namespaces match"
+		}
+		leaf := &ruleLeaf{Policy: policy, RuleIndex: ruleIndex, PeerIndex: peerIndex}
+		ws = append(ws, &Warning{
+			Check:        CheckInventoryPeerMatchesNothing,
+			SourcePolicy: policy,
+			Detail:       fmt.Sprintf("%s/%s %s: %s", policy.Namespace, policy.Name, leaf.Path(isIngress), reason),
+		})
+	}
+	return ws
+}
+
+// lintInventoryNamedPorts checks named ports against the container ports of the pods which could serve them;
+// if there are no such pods, that's already reported as a target or peer matching nothing
+func lintInventoryNamedPorts(policy *networkingv1.NetworkPolicy, ruleIndex int, ports []networkingv1.NetworkPolicyPort, servers []*probe.Pod, isIngress bool) []*Warning {
+	if len(servers) == 0 {
+		return nil
+	}
+	direction := "egress"
+	if isIngress {
+		direction = "ingress"
+	}
+	var ws []*Warning
+	for portIndex, port := range ports {
+		if port.Port == nil || port.Port.Type != intstr.String {
+			continue
+		}
+		protocol := v1.ProtocolTCP
+		if port.Protocol != nil {
+			protocol = *port.Protocol
+		}
+		if isNamedPortServed(servers, port.Port.StrVal, protocol) {
+			continue
+		}
+		ws = append(ws, &Warning{
+			Check:        CheckInventoryNamedPortMatchesNothing,
+			SourcePolicy: policy,
+			Detail: fmt.Sprintf("%s/%s %s[%d].ports[%d]: no container port named '%s' on %s among %d candidate pods",
+				policy.Namespace, policy.Name, direction, ruleIndex, portIndex, port.Port.StrVal, protocol, len(servers)),
+		})
+	}
+	return ws
+}
+
+func isNamedPortServed(pods []*probe.Pod, name string, protocol v1.Protocol) bool {
+	for _, pod := range pods {
+		for _, container := range pod.Containers {
+			if container.PortName == name && container.Protocol == protocol {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// lintInventoryUnselectedPods finds pods which no target selects, when some other namespace has a default-deny:
+// a target selecting all of its pods.  These pods allow all traffic in that direction, which is often an oversight.
+func lintInventoryUnselectedPods(targets []*matcher.Target, resources *probe.Resources, check Check, direction string) []*Warning {
+	defaultDeny := map[string]bool{}
+	for _, target := range targets {
+		if kube.IsLabelSelectorEmpty(target.PodSelector) {
+			defaultDeny[target.Namespace] = true
+		}
+	}
+	if len(defaultDeny) == 0 {
+		return nil
+	}
+	var namespaces []string
+	for ns := range defaultDeny {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+
+	var ws []*Warning
+	for _, pod := range resources.Pods {
+		if defaultDeny[pod.Namespace] || isPodSelected(targets, pod) {
+			continue
+		}
+		ws = append(ws, &Warning{
+			Check: check,
+			Pod:   pod,
+			Detail: fmt.Sprintf("pod %s isn't selected by any %s policy, but namespaces [%s] have a default-deny %s",
+				pod.PodString().String(), direction, strings.Join(namespaces, ", "), direction),
+		})
+	}
+	return ws
+}
+
+func isPodSelected(targets []*matcher.Target, pod *probe.Pod) bool {
+	for _, target := range targets {
+		if target.IsMatch(pod.Namespace, pod.Labels) {
+			return true
+		}
+	}
+	return false
+}
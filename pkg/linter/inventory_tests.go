@@ -0,0 +1,84 @@
+package linter
+
+import (
+	"github.com/mattfenwick/cyclonus/pkg/connectivity/probe"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+)
+
+func RunInventoryTests() {
+	Describe("Inventory checks", func() {
+		containers := func() []*probe.Container {
+			return []*probe.Container{probe.NewDefaultContainer(80, v1.ProtocolTCP, false)}
+		}
+		resources := &probe.Resources{
+			Namespaces: map[string]map[string]string{"x": {"ns": "x"}, "y": {"ns": "y"}},
+			Pods: []*probe.Pod{
+				probe.NewPod("x", "a", map[string]string{"app": "web"}, "10.0.0.1", containers()),
+				probe.NewPod("x", "b", map[string]string{"app": "db"}, "10.0.0.2", containers()),
+				probe.NewPod("y", "a", map[string]string{"app": "web"}, "10.0.0.3", containers()),
+			},
+		}
+		policies := mustParsePolicies(`
+metadata: {name: deny-all, namespace: x}
+spec:
+  podSelector: {}
+  policyTypes: [Ingress]
+---
+metadata: {name: typo, namespace: x}
+spec:
+  podSelector: {matchLabels: {app: wbe}}
+  policyTypes: [Ingress]
+---
+metadata: {name: web, namespace: x}
+spec:
+  podSelector: {matchLabels: {app: web}}
+  ingress:
+  - from:
+    - podSelector: {matchLabels: {app: db}}
+    - podSelector: {matchLabels: {app: cache}}
+    - namespaceSelector: {matchLabels: {ns: nope}}
+    - ipBlock: {cidr: 10.0.0.0/8}
+    ports:
+    - {protocol: TCP, port: serve-80-tcp}
+    - {protocol: TCP, port: http}
+    - {protocol: UDP, port: serve-80-tcp}
+  policyTypes: [Ingress]
+---
+metadata: {name: outside-inventory, namespace: z}
+spec:
+  podSelector: {matchLabels: {app: ghost}}
+  ingress:
+  - from:
+    - podSelector: {matchLabels: {app: ghost}}
+  policyTypes: [Ingress]`)
+
+		It("should report targets, peers and named ports which match nothing, and unselected pods", func() {
+			details := map[Check][]string{}
+			for _, warning := range LintInventory(policies, resources) {
+				Expect(warning.Severity).To(Equal(DefaultSeverities[warning.Check]))
+				details[warning.Check] = append(details[warning.Check], warning.Detail)
+			}
+			Expect(details).To(Equal(map[Check][]string{
+				CheckInventoryTargetMatchesNothing: {"no pods in namespace x match pod selector 'app=wbe'"},
+				CheckInventoryPeerMatchesNothing: {
+					"x/web ingress[0].from[1]: no pods match",
+					"x/web ingress[0].from[2]: no namespaces match",
+				},
+				CheckInventoryNamedPortMatchesNothing: {
+					"x/web ingress[0].ports[1]: no container port named 'http' on TCP among 1 candidate pods",
+					"x/web ingress[0].ports[2]: no container port named 'serve-80-tcp' on UDP among 1 candidate pods",
+				},
+				CheckInventoryPodNotSelectedIngress: {"pod y/a isn't selected by any ingress policy, but namespaces [x] have a default-deny ingress"},
+			}))
+		})
+
+		It("should not report unselected pods if no namespace has a default-deny", func() {
+			for _, warning := range LintInventory(policies[1:], resources) {
+				Expect(warning.Check).ToNot(Equal(CheckInventoryPodNotSelectedIngress))
+				Expect(warning.Check).ToNot(Equal(CheckInventoryPodNotSelectedEgress))
+			}
+		})
+	})
+}
@@ -0,0 +1,220 @@
+package linter
+
+import (
+	"fmt"
+	"github.com/mattfenwick/cyclonus/pkg/kube"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// The SARIF types are the subset of the SARIF 2.1.0 format (https://docs.oasis-open.org/sarif/sarif/v2.1.0/)
+// needed to upload lint findings to code scanning, which annotates the offending yaml.
+
+const (
+	SARIFVersion = "2.1.0"
+	SARIFSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+)
+
+type SARIFLog struct {
+	Schema  string      `json:"$schema"`
+	Version string      `json:"version"`
+	Runs    []*SARIFRun `json:"runs"`
+}
+
+type SARIFRun struct {
+	Tool    SARIFTool      `json:"tool"`
+	Results []*SARIFResult `json:"results"`
+}
+
+type SARIFTool struct {
+	Driver SARIFDriver `json:"driver"`
+}
+
+type SARIFDriver struct {
+	Name           string       `json:"name"`
+	InformationURI string       `json:"informationUri"`
+	Rules          []*SARIFRule `json:"rules"`
+}
+
+type SARIFRule struct {
+	ID                   string                 `json:"id"`
+	ShortDescription     SARIFMessage           `json:"shortDescription"`
+	DefaultConfiguration SARIFRuleConfiguration `json:"defaultConfiguration"`
+}
+
+type SARIFRuleConfiguration struct {
+	Level string `json:"level"`
+}
+
+type SARIFMessage struct {
+	Text string `json:"text"`
+}
+
+type SARIFResult struct {
+	RuleID    string           `json:"ruleId"`
+	Level     string           `json:"level"`
+	Message   SARIFMessage     `json:"message"`
+	Locations []*SARIFLocation `json:"locations,omitempty"`
+}
+
+type SARIFLocation struct {
+	PhysicalLocation SARIFPhysicalLocation `json:"physicalLocation"`
+}
+
+type SARIFPhysicalLocation struct {
+	ArtifactLocation SARIFArtifactLocation `json:"artifactLocation"`
+	Region           *SARIFRegion          `json:"region,omitempty"`
+}
+
+type SARIFArtifactLocation struct {
+	URI       string `json:"uri"`
+	URIBaseID string `json:"uriBaseId,omitempty"`
+}
+
+// SARIFSourceRoot is the base of artifact URIs under the working directory, which code scanning resolves to the
+// root of the checkout
+const SARIFSourceRoot = "%SRCROOT%"
+
+type SARIFRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+var CheckDescriptions = map[Check]string{
+	CheckSourceMissingNamespace:             "policy has no namespace, and will be created in the default namespace",
+	CheckSourcePortMissingProtocol:          "port has no protocol, and will default to TCP",
+	CheckSourceMissingPolicyTypes:           "policy doesn't list its policy types",
+	CheckSourceMissingPolicyTypeIngress:     "policy has ingress rules, but not the Ingress policy type",
+	CheckSourceMissingPolicyTypeEgress:      "policy has egress rules, but not the Egress policy type",
+	CheckSourceDuplicatePolicyName:          "policy has the same namespace and name as another policy",
+	CheckSourcePortRangeMissingNumberedPort: "port range doesn't start at a numbered port",
+	CheckSourcePortRangeEndBeforeStart:      "port range ends before it starts",
+	CheckSourceRejectedByAPIServer:          "policy would be rejected by the API server",
+	CheckSourceUnsupportedDialectConstruct:  "CNI-specific policy construct can't be translated, and was dropped",
+
+	CheckDNSBlockedOnTCP:         "egress to DNS on TCP port 53 is blocked",
+	CheckDNSBlockedOnUDP:         "egress to DNS on UDP port 53 is blocked",
+	CheckTargetAllIngressBlocked: "all ingress is blocked",
+	CheckTargetAllEgressBlocked:  "all egress is blocked",
+	CheckTargetAllIngressAllowed: "all ingress is allowed",
+	CheckTargetAllEgressAllowed:  "all egress is allowed",
+	CheckTargetShadowedPeer:      "peer is shadowed by another rule, and can't change the outcome",
+	CheckTargetShadowedIPBlock:   "IP block is shadowed by another rule, and can't change the outcome",
+	CheckTargetShadowedPort:      "port is shadowed by another rule, and can't change the outcome",
+
+	CheckInventoryTargetMatchesNothing:    "target's pod selector matches no pods in the inventory",
+	CheckInventoryPeerMatchesNothing:      "peer matches no pods in the inventory",
+	CheckInventoryNamedPortMatchesNothing: "named port matches no container port in the inventory",
+	CheckInventoryPodNotSelectedIngress:   "pod isn't selected by any ingress policy, although other namespaces have a default-deny ingress",
+	CheckInventoryPodNotSelectedEgress:    "pod isn't selected by any egress policy, although other namespaces have a default-deny egress",
+}
+
+func (s Severity) SARIFLevel() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	default:
+		return "note"
+	}
+}
+
+// WarningsSARIF builds a SARIF log with a rule for every check, and a result for every warning.  Results are
+// located at the yaml of their source policy -- or, for resolved warnings, of every policy contributing to the
+// target; warnings about policies without a source location have no locations.
+func WarningsSARIF(warnings []*Warning, sources kube.NetworkPolicySources) *SARIFLog {
+	var checks []string
+	for check := range DefaultSeverities {
+		checks = append(checks, string(check))
+	}
+	sort.Strings(checks)
+	rules := []*SARIFRule{}
+	for _, check := range checks {
+		rules = append(rules, &SARIFRule{
+			ID:                   check,
+			ShortDescription:     SARIFMessage{Text: CheckDescriptions[Check(check)]},
+			DefaultConfiguration: SARIFRuleConfiguration{Level: DefaultSeverities[Check(check)].SARIFLevel()},
+		})
+	}
+
+	results := []*SARIFResult{}
+	for _, warning := range warnings {
+		var policies []*networkingv1.NetworkPolicy
+		var message string
+		if warning.Pod != nil {
+			message = fmt.Sprintf("pod %s: %s", warning.Pod.PodString().String(), CheckDescriptions[warning.Check])
+		} else if warning.Target == nil {
+			policies = []*networkingv1.NetworkPolicy{warning.SourcePolicy}
+			message = fmt.Sprintf("%s/%s: %s", warning.SourcePolicy.Namespace, warning.SourcePolicy.Name, CheckDescriptions[warning.Check])
+		} else {
+			policies = warning.Target.SourceRules
+			message = fmt.Sprintf("target in namespace %s with pod selector '%s': %s", warning.Target.Namespace, formatPodSelector(warning.Target.PodSelector), CheckDescriptions[warning.Check])
+		}
+		if warning.Detail != "" {
+			message += "; " + warning.Detail
+		}
+		if warning.ShadowedBy != nil {
+			message += fmt.Sprintf("; shadowed by %s/%s", warning.ShadowedBy.Namespace, warning.ShadowedBy.Name)
+		}
+
+		result := &SARIFResult{
+			RuleID:  string(warning.Check),
+			Level:   warning.Severity.SARIFLevel(),
+			Message: SARIFMessage{Text: message},
+		}
+		for _, policy := range policies {
+			if location, ok := sources[policy]; ok {
+				result.Locations = append(result.Locations, sarifLocation(location))
+			}
+		}
+		results = append(results, result)
+	}
+
+	return &SARIFLog{
+		Schema:  SARIFSchema,
+		Version: SARIFVersion,
+		Runs: []*SARIFRun{{
+			Tool: SARIFTool{Driver: SARIFDriver{
+				Name:           "cyclonus",
+				InformationURI: "https://github.com/mattfenwick/cyclonus",
+				Rules:          rules,
+			}},
+			Results: results,
+		}},
+	}
+}
+
+func formatPodSelector(selector metav1.LabelSelector) string {
+	if kube.IsLabelSelectorEmpty(selector) {
+		return "all pods"
+	}
+	return metav1.FormatLabelSelector(&selector)
+}
+
+func sarifLocation(location *kube.SourceLocation) *SARIFLocation {
+	sarif := &SARIFLocation{PhysicalLocation: SARIFPhysicalLocation{ArtifactLocation: sarifArtifactLocation(location.File)}}
+	if location.Line > 0 {
+		sarif.PhysicalLocation.Region = &SARIFRegion{StartLine: location.Line}
+	}
+	return sarif
+}
+
+// sarifArtifactLocation locates files under the working directory relative to the source root, and any other
+// files by their absolute file URI
+func sarifArtifactLocation(file string) SARIFArtifactLocation {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return SARIFArtifactLocation{URI: filepath.ToSlash(file)}
+	}
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, abs); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return SARIFArtifactLocation{URI: filepath.ToSlash(rel), URIBaseID: SARIFSourceRoot}
+		}
+	}
+	return SARIFArtifactLocation{URI: (&url.URL{Scheme: "file", Path: filepath.ToSlash(abs)}).String()}
+}
@@ -0,0 +1,89 @@
+package linter
+
+import (
+	"github.com/mattfenwick/cyclonus/pkg/kube"
+	"github.com/mattfenwick/cyclonus/pkg/matcher"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"os"
+	"path/filepath"
+)
+
+func RunSARIFTests() {
+	Describe("SARIF output", func() {
+		policiesYaml := `apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata: {name: a, namespace: x}
+spec:
+  podSelector: {matchLabels: {app: web}}
+  ingress:
+  - ports:
+    - port: 80
+  policyTypes: [Ingress]
+---
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata: {name: b, namespace: x}
+spec:
+  podSelector: {matchLabels: {app: web}}
+  ingress:
+  - {}
+  policyTypes: [Ingress]`
+
+		It("should have a rule, with a description, for every check", func() {
+			rules := WarningsSARIF(nil, kube.NetworkPolicySources{}).Runs[0].Tool.Driver.Rules
+			Expect(rules).To(HaveLen(len(DefaultSeverities)))
+			for _, rule := range rules {
+				Expect(rule.ShortDescription.Text).ToNot(BeEmpty(), rule.ID)
+				Expect(rule.DefaultConfiguration.Level).To(Equal(DefaultSeverities[Check(rule.ID)].SARIFLevel()))
+			}
+		})
+
+		It("should locate source warnings at their policy, and resolved warnings at every policy of the target", func() {
+			policies, sources, err := kube.ParseNetworkPolicies("./policies/web.yaml", []byte(policiesYaml))
+			Expect(err).To(Succeed())
+			warnings := NewDefaultConfig().Apply(append(
+				LintSourcePolicies(policies),
+				LintResolvedPolicies(matcher.BuildNetworkPolicies(policies))...))
+			sarif := WarningsSARIF(warnings, sources)
+			Expect(sarif.Version).To(Equal(SARIFVersion))
+
+			results := map[string]*SARIFResult{}
+			for _, result := range sarif.Runs[0].Results {
+				results[result.RuleID] = result
+			}
+
+			missingProtocol := results[string(CheckSourcePortMissingProtocol)]
+			Expect(missingProtocol.Level).To(Equal("note"))
+			Expect(missingProtocol.Message.Text).To(Equal("x/a: port has no protocol, and will default to TCP"))
+			Expect(missingProtocol.Locations).To(Equal([]*SARIFLocation{
+				{PhysicalLocation: SARIFPhysicalLocation{ArtifactLocation: SARIFArtifactLocation{URI: "policies/web.yaml", URIBaseID: SARIFSourceRoot}, Region: &SARIFRegion{StartLine: 1}}},
+			}))
+
+			allAllowed := results[string(CheckTargetAllIngressAllowed)]
+			Expect(allAllowed.Level).To(Equal("warning"))
+			Expect(allAllowed.Message.Text).To(Equal("target in namespace x with pod selector 'app=web': all ingress is allowed"))
+			var lines []int
+			for _, location := range allAllowed.Locations {
+				lines = append(lines, location.PhysicalLocation.Region.StartLine)
+			}
+			Expect(lines).To(Equal([]int{1, 11}))
+		})
+
+		It("should locate files relative to the source root if they're under the working directory", func() {
+			wd, err := os.Getwd()
+			Expect(err).To(Succeed())
+			Expect(sarifArtifactLocation(filepath.Join(wd, "policies", "web.yaml"))).To(Equal(
+				SARIFArtifactLocation{URI: "policies/web.yaml", URIBaseID: SARIFSourceRoot}))
+			Expect(sarifArtifactLocation(filepath.Join(wd, "..", "web.yaml"))).To(Equal(
+				SARIFArtifactLocation{URI: "file://" + filepath.ToSlash(filepath.Join(filepath.Dir(wd), "web.yaml"))}))
+		})
+
+		It("should leave out locations of policies without a source", func() {
+			policies := mustParsePolicies(policiesYaml)
+			sarif := WarningsSARIF(NewDefaultConfig().Apply(LintSourcePolicies(policies)), kube.NetworkPolicySources{})
+			Expect(sarif.Runs[0].Results).To(HaveLen(1))
+			Expect(sarif.Runs[0].Results[0].Locations).To(BeNil())
+		})
+	})
+}
@@ -0,0 +1,240 @@
+package linter
+
+import (
+	"fmt"
+	"github.com/mattfenwick/cyclonus/pkg/matcher"
+	networkingv1 "k8s.io/api/networking/v1"
+)
+
+// ruleLeaf is a single peer of a single ingress/egress rule of a source policy -- or a whole rule, if it has no peers
+type ruleLeaf struct {
+	Policy    *networkingv1.NetworkPolicy
+	RuleIndex int
+	// PeerIndex is -1 if the rule has no peers
+	PeerIndex int
+	IsIPBlock bool
+	Peer      matcher.PeerMatcher
+}
+
+func (l *ruleLeaf) Path(isIngress bool) string {
+	direction, peers := "egress", "to"
+	if isIngress {
+		direction, peers = "ingress", "from"
+	}
+	if l.PeerIndex < 0 {
+		return fmt.Sprintf("%s[%d]", direction, l.RuleIndex)
+	}
+	return fmt.Sprintf("%s[%d].%s[%d]", direction, l.RuleIndex, peers, l.PeerIndex)
+}
+
+func (l *ruleLeaf) IsSameRule(other *ruleLeaf) bool {
+	return l.Policy == other.Policy && l.RuleIndex == other.RuleIndex
+}
+
+// mustBuildPeerMatcher builds part of a source rule of a target; since the target was built, its rules are valid
+func mustBuildPeerMatcher(namespace string, ports []networkingv1.NetworkPolicyPort, peers []networkingv1.NetworkPolicyPeer) matcher.PeerMatcher {
+	peer, err := matcher.BuildPeerMatcher(namespace, ports, peers)
+	if err != nil {
+		panic(err)
+	}
+	return peer
+}
+
+func mustBuildPortMatcher(ports []networkingv1.NetworkPolicyPort) matcher.PortMatcher {
+	port, err := matcher.BuildPortMatcher(ports)
+	if err != nil {
+		panic(err)
+	}
+	return port
+}
+
+func buildRuleLeaves(namespace string, policy *networkingv1.NetworkPolicy, ruleIndex int, ports []networkingv1.NetworkPolicyPort, peers []networkingv1.NetworkPolicyPeer) []*ruleLeaf {
+	if len(peers) == 0 {
+		return []*ruleLeaf{{
+			Policy:    policy,
+			RuleIndex: ruleIndex,
+			PeerIndex: -1,
+			Peer:      mustBuildPeerMatcher(namespace, ports, nil),
+		}}
+	}
+	var leaves []*ruleLeaf
+	for peerIndex, peer := range peers {
+		leaves = append(leaves, &ruleLeaf{
+			Policy:    policy,
+			RuleIndex: ruleIndex,
+			PeerIndex: peerIndex,
+			IsIPBlock: peer.IPBlock != nil,
+			Peer:      mustBuildPeerMatcher(namespace, ports, []networkingv1.NetworkPolicyPeer{peer}),
+		})
+	}
+	return leaves
+}
+
+// targetRules holds the rules and leaves, in order, of each source policy of a target
+type targetRules struct {
+	Target *matcher.Target
+	Leaves []*ruleLeaf
+	Ports  map[*networkingv1.NetworkPolicy][][]networkingv1.NetworkPolicyPort
+}
+
+func buildTargetRules(target *matcher.Target, isIngress bool) *targetRules {
+	rules := &targetRules{Target: target, Ports: map[*networkingv1.NetworkPolicy][][]networkingv1.NetworkPolicyPort{}}
+	for _, policy := range target.SourceRules {
+		if isIngress {
+			for i, rule := range policy.Spec.Ingress {
+				rules.Leaves = append(rules.Leaves, buildRuleLeaves(target.Namespace, policy, i, rule.Ports, rule.From)...)
+				rules.Ports[policy] = append(rules.Ports[policy], rule.Ports)
+			}
+		} else {
+			for i, rule := range policy.Spec.Egress {
+				rules.Leaves = append(rules.Leaves, buildRuleLeaves(target.Namespace, policy, i, rule.Ports, rule.To)...)
+				rules.Ports[policy] = append(rules.Ports[policy], rule.Ports)
+			}
+		}
+	}
+	return rules
+}
+
+// shadowingLeaf finds a leaf, other than leaves[index], which allows everything that peer allows.
+// When two leaves allow exactly the same thing, only the later one is considered shadowed; so for an index
+// of -1, a leaf allowing exactly the same thing as peer doesn't count.
+func shadowingLeaf(leaves []*ruleLeaf, index int, peer matcher.PeerMatcher, skip func(*ruleLeaf) bool) *ruleLeaf {
+	for j, other := range leaves {
+		if j == index || skip(other) || !matcher.IsPeerMatcherSubset(peer, other.Peer) {
+			continue
+		}
+		if j > index && matcher.IsPeerMatcherSubset(other.Peer, peer) {
+			continue
+		}
+		return other
+	}
+	return nil
+}
+
+// LintShadowedRules finds peers, IP blocks and ports which can never change the outcome, because
+// another rule on the same target -- from the same or a different source policy -- already allows a superset.
+func LintShadowedRules(policies *matcher.Policy) []*Warning {
+	var ws []*Warning
+	ingress, egress := policies.SortedTargets()
+	for _, target := range ingress {
+		ws = append(ws, lintShadowedTargetRules(buildTargetRules(target, true), true)...)
+	}
+	for _, target := range egress {
+		ws = append(ws, lintShadowedTargetRules(buildTargetRules(target, false), false)...)
+	}
+	return ws
+}
+
+func lintShadowedTargetRules(rules *targetRules, isIngress bool) []*Warning {
+	var ws []*Warning
+	leaves := rules.Leaves
+	isLeafShadowed := map[*ruleLeaf]bool{}
+	never := func(*ruleLeaf) bool { return false }
+	for i, leaf := range leaves {
+		other := shadowingLeaf(leaves, i, leaf.Peer, never)
+		if other == nil {
+			continue
+		}
+		isLeafShadowed[leaf] = true
+		check := CheckTargetShadowedPeer
+		if leaf.IsIPBlock {
+			check = CheckTargetShadowedIPBlock
+		}
+		ws = append(ws, &Warning{
+			Check:        check,
+			Target:       rules.Target,
+			SourcePolicy: leaf.Policy,
+			ShadowedBy:   other.Policy,
+			Detail: fmt.Sprintf("%s/%s %s is shadowed by %s/%s %s",
+				leaf.Policy.Namespace, leaf.Policy.Name, leaf.Path(isIngress),
+				other.Policy.Namespace, other.Policy.Name, other.Path(isIngress)),
+		})
+	}
+
+	// ports: only look at rules which have at least one peer that isn't shadowed already
+	for _, policy := range rules.Target.SourceRules {
+		for ruleIndex, ports := range rules.Ports[policy] {
+			var ruleLeaves []*ruleLeaf
+			isRuleShadowed := true
+			for _, leaf := range leaves {
+				if leaf.Policy == policy && leaf.RuleIndex == ruleIndex {
+					ruleLeaves = append(ruleLeaves, leaf)
+					isRuleShadowed = isRuleShadowed && isLeafShadowed[leaf]
+				}
+			}
+			if isRuleShadowed {
+				continue
+			}
+			ws = append(ws, lintShadowedPorts(rules, policy, ruleIndex, ports, ruleLeaves, isIngress)...)
+		}
+	}
+	return ws
+}
+
+func lintShadowedPorts(rules *targetRules, policy *networkingv1.NetworkPolicy, ruleIndex int, ports []networkingv1.NetworkPolicyPort, ruleLeaves []*ruleLeaf, isIngress bool) []*Warning {
+	var ws []*Warning
+	direction := "egress"
+	if isIngress {
+		direction = "ingress"
+	}
+	path := func(p *networkingv1.NetworkPolicy, r int, k int) string {
+		return fmt.Sprintf("%s/%s %s[%d].ports[%d]", p.Namespace, p.Name, direction, r, k)
+	}
+	for k, port := range ports {
+		portMatcher := mustBuildPortMatcher([]networkingv1.NetworkPolicyPort{port})
+		// 1. shadowed by another port in the same rule
+		var shadowingPort = -1
+		for m, other := range ports {
+			otherMatcher := mustBuildPortMatcher([]networkingv1.NetworkPolicyPort{other})
+			if m == k || !matcher.IsPortMatcherSubset(portMatcher, otherMatcher) {
+				continue
+			}
+			if m > k && matcher.IsPortMatcherSubset(otherMatcher, portMatcher) {
+				continue
+			}
+			shadowingPort = m
+			break
+		}
+		if shadowingPort >= 0 {
+			ws = append(ws, &Warning{
+				Check:        CheckTargetShadowedPort,
+				Target:       rules.Target,
+				SourcePolicy: policy,
+				ShadowedBy:   policy,
+				Detail:       fmt.Sprintf("%s is shadowed by %s", path(policy, ruleIndex, k), path(policy, ruleIndex, shadowingPort)),
+			})
+			continue
+		}
+		// 2. shadowed, for every peer of the rule, by other rules
+		var shadowing *ruleLeaf
+		for _, leaf := range ruleLeaves {
+			var peers []networkingv1.NetworkPolicyPeer
+			if leaf.PeerIndex >= 0 {
+				peers = []networkingv1.NetworkPolicyPeer{rulePeers(policy, ruleIndex, isIngress)[leaf.PeerIndex]}
+			}
+			peer := mustBuildPeerMatcher(rules.Target.Namespace, []networkingv1.NetworkPolicyPort{port}, peers)
+			shadowing = shadowingLeaf(rules.Leaves, -1, peer, leaf.IsSameRule)
+			if shadowing == nil {
+				break
+			}
+		}
+		if shadowing != nil {
+			ws = append(ws, &Warning{
+				Check:        CheckTargetShadowedPort,
+				Target:       rules.Target,
+				SourcePolicy: policy,
+				ShadowedBy:   shadowing.Policy,
+				Detail: fmt.Sprintf("%s is shadowed by %s/%s %s",
+					path(policy, ruleIndex, k), shadowing.Policy.Namespace, shadowing.Policy.Name, shadowing.Path(isIngress)),
+			})
+		}
+	}
+	return ws
+}
+
+func rulePeers(policy *networkingv1.NetworkPolicy, ruleIndex int, isIngress bool) []networkingv1.NetworkPolicyPeer {
+	if isIngress {
+		return policy.Spec.Ingress[ruleIndex].From
+	}
+	return policy.Spec.Egress[ruleIndex].To
+}
@@ -0,0 +1,122 @@
+package linter
+
+import (
+	"github.com/mattfenwick/cyclonus/pkg/kube"
+	"github.com/mattfenwick/cyclonus/pkg/matcher"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	networkingv1 "k8s.io/api/networking/v1"
+)
+
+func mustParsePolicies(policiesYaml string) []*networkingv1.NetworkPolicy {
+	policies, _, err := kube.ParseNetworkPolicies("policies.yaml", []byte(policiesYaml))
+	Expect(err).To(Succeed())
+	return policies
+}
+
+func RunShadowingTests() {
+	Describe("Shadowed rules", func() {
+		It("should report a peer shadowed by another policy, and only the later of two identical peers", func() {
+			policies := mustParsePolicies(`
+metadata: {name: a, namespace: x}
+spec:
+  podSelector: {}
+  ingress:
+  - from:
+    - podSelector: {matchLabels: {app: web}}
+    - podSelector: {matchLabels: {app: db}}
+  policyTypes: [Ingress]
+---
+metadata: {name: b, namespace: x}
+spec:
+  podSelector: {}
+  ingress:
+  - from:
+    - namespaceSelector: {matchLabels: {team: red}}
+      podSelector: {matchLabels: {app: web}}
+    - podSelector: {}
+    - podSelector: {}
+  policyTypes: [Ingress]`)
+			warnings := LintShadowedRules(matcher.BuildNetworkPolicies(policies))
+			Expect(warnings).To(HaveLen(3))
+			for _, warning := range warnings {
+				Expect(warning.Check).To(Equal(CheckTargetShadowedPeer))
+				Expect(warning.Target.Namespace).To(Equal("x"))
+			}
+			Expect(warnings[0].SourcePolicy).To(Equal(policies[0]))
+			Expect(warnings[0].ShadowedBy).To(Equal(policies[1]))
+			Expect(warnings[0].Detail).To(Equal("x/a ingress[0].from[0] is shadowed by x/b ingress[0].from[1]"))
+			Expect(warnings[1].Detail).To(Equal("x/a ingress[0].from[1] is shadowed by x/b ingress[0].from[1]"))
+			Expect(warnings[2].SourcePolicy).To(Equal(policies[1]))
+			Expect(warnings[2].Detail).To(Equal("x/b ingress[0].from[2] is shadowed by x/b ingress[0].from[1]"))
+		})
+
+		It("should report an IP block shadowed by a larger IP block", func() {
+			policies := mustParsePolicies(`
+metadata: {name: a, namespace: x}
+spec:
+  podSelector: {}
+  egress:
+  - to:
+    - ipBlock: {cidr: 10.0.0.0/16}
+    - ipBlock: {cidr: 10.0.0.0/8, except: [10.1.0.0/16]}
+    - ipBlock: {cidr: 10.1.0.0/24}
+  policyTypes: [Egress]`)
+			warnings := LintShadowedRules(matcher.BuildNetworkPolicies(policies))
+			Expect(warnings).To(HaveLen(1))
+			Expect(warnings[0].Check).To(Equal(CheckTargetShadowedIPBlock))
+			Expect(warnings[0].ShadowedBy).To(Equal(policies[0]))
+			Expect(warnings[0].Detail).To(Equal("x/a egress[0].to[0] is shadowed by x/a egress[0].to[1]"))
+		})
+
+		It("should report ports shadowed by a port range in the same rule, or by another rule for every peer", func() {
+			policies := mustParsePolicies(`
+metadata: {name: a, namespace: x}
+spec:
+  podSelector: {}
+  ingress:
+  - from:
+    - podSelector: {matchLabels: {app: web}}
+    ports:
+    - {protocol: TCP, port: 80}
+    - {protocol: TCP, port: 443}
+    - {protocol: TCP, port: 8000, endPort: 9000}
+    - {protocol: TCP, port: 8080}
+  - from:
+    - podSelector: {}
+    ports:
+    - {protocol: TCP, port: 80}
+  policyTypes: [Ingress]`)
+			warnings := LintShadowedRules(matcher.BuildNetworkPolicies(policies))
+			var details []string
+			for _, warning := range warnings {
+				Expect(warning.Check).To(Equal(CheckTargetShadowedPort))
+				Expect(warning.SourcePolicy).To(Equal(policies[0]))
+				details = append(details, warning.Detail)
+			}
+			Expect(details).To(Equal([]string{
+				"x/a ingress[0].ports[0] is shadowed by x/a ingress[1].from[0]",
+				"x/a ingress[0].ports[3] is shadowed by x/a ingress[0].ports[2]",
+			}))
+		})
+
+		It("should not report ports of a rule whose peers are all shadowed", func() {
+			policies := mustParsePolicies(`
+metadata: {name: a, namespace: x}
+spec:
+  podSelector: {}
+  ingress:
+  - from:
+    - podSelector: {matchLabels: {app: web}}
+    ports:
+    - {protocol: TCP, port: 80}
+    - {protocol: TCP, port: 80}
+  - {}
+  policyTypes: [Ingress]`)
+			warnings := LintShadowedRules(matcher.BuildNetworkPolicies(policies))
+			Expect(warnings).To(HaveLen(1))
+			Expect(warnings[0].Check).To(Equal(CheckTargetShadowedPeer))
+			Expect(warnings[0].Detail).To(Equal("x/a ingress[0].from[0] is shadowed by x/a ingress[1]"))
+		})
+	})
+}
@@ -0,0 +1,19 @@
+package linter
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestLinter(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunShadowingTests()
+	RunConfigTests()
+	RunChecksTests()
+	RunSARIFTests()
+	RunInventoryTests()
+	RunFixTests()
+	RunSpecs(t, "network policy linter suite")
+}
@@ -0,0 +1,310 @@
+package matcher
+
+import (
+	"fmt"
+	"github.com/mattfenwick/cyclonus/pkg/kube"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sort"
+)
+
+// Tier is the level of policy which decided whether traffic is allowed:
+//  1. AdminNetworkPolicies, by priority: the first matching rule decides, unless it's a Pass
+//  2. NetworkPolicies: if any target applies to the pod
+//  3. BaselineAdminNetworkPolicy: the first matching rule decides
+//  4. otherwise, traffic is allowed by default
+type Tier string
+
+const (
+	TierAdminNetworkPolicy         Tier = "AdminNetworkPolicy"
+	TierNetworkPolicy              Tier = "NetworkPolicy"
+	TierBaselineAdminNetworkPolicy Tier = "BaselineAdminNetworkPolicy"
+	TierDefault                    Tier = "Default"
+)
+
+// AdminPolicy models an AdminNetworkPolicy or a BaselineAdminNetworkPolicy
+type AdminPolicy struct {
+	Name       string
+	Priority   int
+	IsBaseline bool
+	Subject    *SubjectMatcher
+	Ingress    []*AdminRule
+	Egress     []*AdminRule
+}
+
+func (a *AdminPolicy) Tier() Tier {
+	if a.IsBaseline {
+		return TierBaselineAdminNetworkPolicy
+	}
+	return TierAdminNetworkPolicy
+}
+
+// FirstMatchingRule returns the first rule whose peer and port match the traffic, or nil
+func (a *AdminPolicy) FirstMatchingRule(isIngress bool, peer *TrafficPeer, portInt int, portName string, protocol v1.Protocol) *AdminRule {
+	rules := a.Egress
+	if isIngress {
+		rules = a.Ingress
+	}
+	for _, rule := range rules {
+		if rule.Peer.Allows(peer, portInt, portName, protocol) {
+			return rule
+		}
+	}
+	return nil
+}
+
+// SubjectMatcher models AdminNetworkPolicySubject: pods in matching namespaces
+type SubjectMatcher struct {
+	Namespace NamespaceMatcher
+	Pod       PodMatcher
+}
+
+func (s *SubjectMatcher) Allows(namespace string, namespaceLabels map[string]string, podLabels map[string]string) bool {
+	return s.Namespace.Allows(namespace, namespaceLabels) && s.Pod.Allows(podLabels)
+}
+
+type AdminRule struct {
+	Policy *AdminPolicy
+	Name   string
+	// Index is the position of the rule in its policy's ingress or egress rules
+	Index  int
+	Action kube.AdminNetworkPolicyRuleAction
+	Peer   PeerMatcher
+}
+
+func (r *AdminRule) String() string {
+	return fmt.Sprintf("%s (priority %d) rule %d '%s'", r.Policy.Name, r.Policy.Priority, r.Index, r.Name)
+}
+
+// AddAdminPolicy adds an AdminNetworkPolicy, keeping them in priority order -- or sets the
+// BaselineAdminNetworkPolicy, of which there's at most one.
+func (p *Policy) AddAdminPolicy(adminPolicy *AdminPolicy) {
+	if adminPolicy.IsBaseline {
+		p.BaselinePolicy = adminPolicy
+		return
+	}
+	p.AdminPolicies = append(p.AdminPolicies, adminPolicy)
+	sort.SliceStable(p.AdminPolicies, func(i, j int) bool {
+		if p.AdminPolicies[i].Priority != p.AdminPolicies[j].Priority {
+			return p.AdminPolicies[i].Priority < p.AdminPolicies[j].Priority
+		}
+		return p.AdminPolicies[i].Name < p.AdminPolicies[j].Name
+	})
+}
+
+// AdminPoliciesApplyingToPod returns the AdminNetworkPolicies, in priority order, whose subject matches the pod
+func (p *Policy) AdminPoliciesApplyingToPod(namespace string, namespaceLabels map[string]string, podLabels map[string]string) []*AdminPolicy {
+	var policies []*AdminPolicy
+	for _, adminPolicy := range p.AdminPolicies {
+		if adminPolicy.Subject.Allows(namespace, namespaceLabels, podLabels) {
+			policies = append(policies, adminPolicy)
+		}
+	}
+	return policies
+}
+
+// BuildNetworkPoliciesWithAdmin builds policies along with admin policies; it fails on the first invalid policy
+func BuildNetworkPoliciesWithAdmin(netpols []*networkingv1.NetworkPolicy, anps []*kube.AdminNetworkPolicy, banp *kube.BaselineAdminNetworkPolicy) (*Policy, error) {
+	policy, policyErrors := BuildValidNetworkPolicies(netpols)
+	if len(policyErrors) > 0 {
+		return nil, policyErrors[0]
+	}
+	for _, anp := range anps {
+		adminPolicy, err := BuildAdminNetworkPolicy(anp)
+		if err != nil {
+			return nil, err
+		}
+		policy.AddAdminPolicy(adminPolicy)
+	}
+	if banp != nil {
+		adminPolicy, err := BuildBaselineAdminNetworkPolicy(banp)
+		if err != nil {
+			return nil, err
+		}
+		policy.AddAdminPolicy(adminPolicy)
+	}
+	return policy, nil
+}
+
+func BuildAdminNetworkPolicy(anp *kube.AdminNetworkPolicy) (*AdminPolicy, error) {
+	subject, err := BuildSubjectMatcher(anp.Spec.Subject)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "invalid AdminNetworkPolicy %s", anp.Name)
+	}
+	adminPolicy := &AdminPolicy{
+		Name:     anp.Name,
+		Priority: int(anp.Spec.Priority),
+		Subject:  subject,
+	}
+	if adminPolicy.Ingress, err = buildAdminIngressRules(adminPolicy, anp.Spec.Ingress); err != nil {
+		return nil, errors.WithMessagef(err, "invalid AdminNetworkPolicy %s", anp.Name)
+	}
+	if adminPolicy.Egress, err = buildAdminEgressRules(adminPolicy, anp.Spec.Egress); err != nil {
+		return nil, errors.WithMessagef(err, "invalid AdminNetworkPolicy %s", anp.Name)
+	}
+	return adminPolicy, nil
+}
+
+func BuildBaselineAdminNetworkPolicy(banp *kube.BaselineAdminNetworkPolicy) (*AdminPolicy, error) {
+	subject, err := BuildSubjectMatcher(banp.Spec.Subject)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "invalid BaselineAdminNetworkPolicy %s", banp.Name)
+	}
+	adminPolicy := &AdminPolicy{
+		Name:       banp.Name,
+		IsBaseline: true,
+		Subject:    subject,
+	}
+	if adminPolicy.Ingress, err = buildAdminIngressRules(adminPolicy, banp.Spec.Ingress); err != nil {
+		return nil, errors.WithMessagef(err, "invalid BaselineAdminNetworkPolicy %s", banp.Name)
+	}
+	if adminPolicy.Egress, err = buildAdminEgressRules(adminPolicy, banp.Spec.Egress); err != nil {
+		return nil, errors.WithMessagef(err, "invalid BaselineAdminNetworkPolicy %s", banp.Name)
+	}
+	for _, rule := range append(adminPolicy.Ingress, adminPolicy.Egress...) {
+		if rule.Action == kube.AdminNetworkPolicyRuleActionPass {
+			return nil, errors.Errorf("invalid BaselineAdminNetworkPolicy %s: action %s not allowed", banp.Name, rule.Action)
+		}
+	}
+	return adminPolicy, nil
+}
+
+func BuildSubjectMatcher(subject kube.AdminNetworkPolicySubject) (*SubjectMatcher, error) {
+	if subject.Namespaces != nil {
+		return &SubjectMatcher{Namespace: buildAdminNamespaceMatcher(*subject.Namespaces), Pod: &AllPodMatcher{}}, nil
+	}
+	if subject.Pods != nil {
+		return &SubjectMatcher{
+			Namespace: buildAdminNamespaceMatcher(subject.Pods.NamespaceSelector),
+			Pod:       buildAdminPodMatcher(subject.Pods.PodSelector),
+		}, nil
+	}
+	return nil, errors.Errorf("invalid AdminNetworkPolicySubject: one of Namespaces and Pods must be set")
+}
+
+func buildAdminIngressRules(adminPolicy *AdminPolicy, rules []kube.AdminNetworkPolicyIngressRule) ([]*AdminRule, error) {
+	var adminRules []*AdminRule
+	for i, rule := range rules {
+		port, err := BuildAdminPortMatcher(rule.Ports)
+		if err != nil {
+			return nil, err
+		}
+		peer := &SpecificPeerMatcher{IP: &NoneIPMatcher{}, Internal: &NoneInternalMatcher{}}
+		for _, from := range rule.From {
+			if err := addAdminPeer(peer, port, from.Namespaces, from.Pods, nil); err != nil {
+				return nil, err
+			}
+		}
+		adminRules = append(adminRules, &AdminRule{Policy: adminPolicy, Name: rule.Name, Index: i, Action: rule.Action, Peer: peer})
+	}
+	return adminRules, nil
+}
+
+// buildAdminEgressRules ignores node peers, since traffic to nodes isn't modeled
+func buildAdminEgressRules(adminPolicy *AdminPolicy, rules []kube.AdminNetworkPolicyEgressRule) ([]*AdminRule, error) {
+	var adminRules []*AdminRule
+	for i, rule := range rules {
+		port, err := BuildAdminPortMatcher(rule.Ports)
+		if err != nil {
+			return nil, err
+		}
+		peer := &SpecificPeerMatcher{IP: &NoneIPMatcher{}, Internal: &NoneInternalMatcher{}}
+		for _, to := range rule.To {
+			if err := addAdminPeer(peer, port, to.Namespaces, to.Pods, to.Networks); err != nil {
+				return nil, err
+			}
+		}
+		adminRules = append(adminRules, &AdminRule{Policy: adminPolicy, Name: rule.Name, Index: i, Action: rule.Action, Peer: peer})
+	}
+	return adminRules, nil
+}
+
+func addAdminPeer(peer *SpecificPeerMatcher, port PortMatcher, namespaces *metav1.LabelSelector, pods *kube.NamespacedPod, networks []string) error {
+	var nsPods []*NamespacePodMatcher
+	if namespaces != nil {
+		nsPods = append(nsPods, &NamespacePodMatcher{
+			Namespace: buildAdminNamespaceMatcher(*namespaces),
+			Pod:       &AllPodMatcher{},
+			Port:      port,
+		})
+	}
+	if pods != nil {
+		nsPods = append(nsPods, &NamespacePodMatcher{
+			Namespace: buildAdminNamespaceMatcher(pods.NamespaceSelector),
+			Pod:       buildAdminPodMatcher(pods.PodSelector),
+			Port:      port,
+		})
+	}
+	for _, nsPod := range nsPods {
+		internal, err := NewSpecificInternalMatcher(nsPod)
+		if err != nil {
+			return err
+		}
+		if peer.Internal, err = CombineInternalMatchers(peer.Internal, internal); err != nil {
+			return err
+		}
+	}
+	for _, cidr := range networks {
+		block := &IPBlockMatcher{IPBlock: &networkingv1.IPBlock{CIDR: cidr}, Port: port}
+		ip, err := NewSpecificIPMatcher(&NonePortMatcher{}, block)
+		if err != nil {
+			return err
+		}
+		if peer.IP, err = CombineIPMatchers(peer.IP, ip); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unlike NetworkPolicy peers, admin policy selectors are never nil: an empty selector selects everything
+func buildAdminNamespaceMatcher(selector metav1.LabelSelector) NamespaceMatcher {
+	if kube.IsLabelSelectorEmpty(selector) {
+		return &AllNamespaceMatcher{}
+	}
+	return &LabelSelectorNamespaceMatcher{Selector: selector}
+}
+
+func buildAdminPodMatcher(selector metav1.LabelSelector) PodMatcher {
+	if kube.IsLabelSelectorEmpty(selector) {
+		return &AllPodMatcher{}
+	}
+	return &LabelSelectorPodMatcher{Selector: selector}
+}
+
+// BuildAdminPortMatcher: a named port matches on any protocol, since the protocol comes from the
+// destination pod's container port; port numbers and ranges without a protocol are TCP
+func BuildAdminPortMatcher(ports *[]kube.AdminNetworkPolicyPort) (PortMatcher, error) {
+	if ports == nil {
+		return &AllPortMatcher{}, nil
+	}
+	matcher := &SpecificPortMatcher{}
+	for _, p := range *ports {
+		switch {
+		case p.PortNumber != nil:
+			port := intstr.FromInt(int(p.PortNumber.Port))
+			protocol := v1.ProtocolTCP
+			if p.PortNumber.Protocol != "" {
+				protocol = p.PortNumber.Protocol
+			}
+			matcher.Ports = append(matcher.Ports, &PortProtocolMatcher{Port: &port, Protocol: protocol})
+		case p.NamedPort != nil:
+			port := intstr.FromString(*p.NamedPort)
+			for _, protocol := range []v1.Protocol{v1.ProtocolTCP, v1.ProtocolUDP, v1.ProtocolSCTP} {
+				matcher.Ports = append(matcher.Ports, &PortProtocolMatcher{Port: &port, Protocol: protocol})
+			}
+		case p.PortRange != nil:
+			protocol := v1.ProtocolTCP
+			if p.PortRange.Protocol != "" {
+				protocol = p.PortRange.Protocol
+			}
+			matcher.PortRanges = append(matcher.PortRanges, &PortRangeMatcher{From: int(p.PortRange.Start), To: int(p.PortRange.End), Protocol: protocol})
+		default:
+			return nil, errors.Errorf("invalid AdminNetworkPolicyPort: one of PortNumber, NamedPort and PortRange must be set")
+		}
+	}
+	return matcher, nil
+}
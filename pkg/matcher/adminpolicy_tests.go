@@ -0,0 +1,171 @@
+package matcher
+
+import (
+	"github.com/mattfenwick/cyclonus/pkg/kube"
+	"github.com/mattfenwick/cyclonus/pkg/utils"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+func mustParseAdminNetworkPolicy(anpYaml string) *kube.AdminNetworkPolicy {
+	var anp *kube.AdminNetworkPolicy
+	utils.DoOrDie(yaml.Unmarshal([]byte(anpYaml), &anp))
+	return anp
+}
+
+func mustParseBaselineAdminNetworkPolicy(banpYaml string) *kube.BaselineAdminNetworkPolicy {
+	var banp *kube.BaselineAdminNetworkPolicy
+	utils.DoOrDie(yaml.Unmarshal([]byte(banpYaml), &banp))
+	return banp
+}
+
+func RunAdminPolicyTests() {
+	Describe("Admin network policy tiers", func() {
+		allowFromY := mustParsePolicies(`
+metadata: {name: allow-from-y, namespace: x}
+spec:
+  podSelector: {}
+  ingress:
+  - from:
+    - namespaceSelector: {matchLabels: {ns: "y"}}
+  policyTypes: [Ingress]`)
+		denyFromY := mustParseAdminNetworkPolicy(`
+metadata: {name: deny-from-y}
+spec:
+  priority: 20
+  subject:
+    namespaces: {matchLabels: {ns: x}}
+  ingress:
+  - name: deny-y
+    action: Deny
+    from:
+    - namespaces: {matchLabels: {ns: "y"}}`)
+		passDNS := mustParseAdminNetworkPolicy(`
+metadata: {name: pass-dns}
+spec:
+  priority: 10
+  subject:
+    namespaces: {}
+  ingress:
+  - name: pass-dns
+    action: Pass
+    from:
+    - namespaces: {}
+    ports:
+    - portNumber: {protocol: UDP, port: 53}`)
+		allowFromZ := mustParseAdminNetworkPolicy(`
+metadata: {name: allow-from-z}
+spec:
+  priority: 30
+  subject:
+    pods:
+      namespaceSelector: {}
+      podSelector: {matchLabels: {pod: a}}
+  ingress:
+  - name: allow-z
+    action: Allow
+    from:
+    - namespaces: {matchLabels: {ns: z}}`)
+		baseline := mustParseBaselineAdminNetworkPolicy(`
+metadata: {name: default}
+spec:
+  subject:
+    namespaces: {}
+  ingress:
+  - name: deny-all
+    action: Deny
+    from:
+    - namespaces: {}`)
+
+		traffic := func(fromNs string, toNs string, port int, protocol v1.Protocol) *Traffic {
+			return &Traffic{
+				Source: &TrafficPeer{
+					Internal: &InternalPeer{PodLabels: map[string]string{"pod": "b"}, NamespaceLabels: map[string]string{"ns": fromNs}, Namespace: fromNs},
+					IP:       "1.2.3.4",
+				},
+				Destination: &TrafficPeer{
+					Internal: &InternalPeer{PodLabels: map[string]string{"pod": "a"}, NamespaceLabels: map[string]string{"ns": toNs}, Namespace: toNs},
+					IP:       "1.2.3.5",
+				},
+				ResolvedPort: port,
+				Protocol:     protocol,
+			}
+		}
+
+		It("should deny traffic allowed by a network policy, if an admin network policy denies it", func() {
+			policy, err := BuildNetworkPoliciesWithAdmin(allowFromY, []*kube.AdminNetworkPolicy{denyFromY}, nil)
+			Expect(err).To(Succeed())
+			result := policy.IsTrafficAllowed(traffic("y", "x", 80, v1.ProtocolTCP))
+			Expect(result.IsAllowed()).To(BeFalse())
+			Expect(result.Ingress.Tier).To(Equal(TierAdminNetworkPolicy))
+			Expect(result.Ingress.AdminRule.Name).To(Equal("deny-y"))
+		})
+
+		It("should allow traffic blocked by a network policy, if an admin network policy allows it", func() {
+			policy, err := BuildNetworkPoliciesWithAdmin(allowFromY, []*kube.AdminNetworkPolicy{allowFromZ}, nil)
+			Expect(err).To(Succeed())
+			Expect(BuildNetworkPolicies(allowFromY).IsTrafficAllowed(traffic("z", "x", 80, v1.ProtocolTCP)).IsAllowed()).To(BeFalse())
+			result := policy.IsTrafficAllowed(traffic("z", "x", 80, v1.ProtocolTCP))
+			Expect(result.IsAllowed()).To(BeTrue())
+			Expect(result.Ingress.Tier).To(Equal(TierAdminNetworkPolicy))
+		})
+
+		It("should evaluate admin network policies in priority order, and hand off to network policies on a pass", func() {
+			policy, err := BuildNetworkPoliciesWithAdmin(allowFromY, []*kube.AdminNetworkPolicy{denyFromY, passDNS}, nil)
+			Expect(err).To(Succeed())
+			Expect(policy.AdminPolicies[0].Name).To(Equal("pass-dns"))
+
+			result := policy.IsTrafficAllowed(traffic("y", "x", 53, v1.ProtocolUDP))
+			Expect(result.IsAllowed()).To(BeTrue())
+			Expect(result.Ingress.Tier).To(Equal(TierNetworkPolicy))
+			Expect(result.Ingress.PassingAdminRule.Name).To(Equal("pass-dns"))
+
+			Expect(policy.IsTrafficAllowed(traffic("y", "x", 53, v1.ProtocolTCP)).IsAllowed()).To(BeFalse())
+		})
+
+		It("should fall back to the baseline admin network policy only if no network policy applies", func() {
+			policy, err := BuildNetworkPoliciesWithAdmin(allowFromY, nil, baseline)
+			Expect(err).To(Succeed())
+
+			selected := policy.IsTrafficAllowed(traffic("y", "x", 80, v1.ProtocolTCP))
+			Expect(selected.IsAllowed()).To(BeTrue())
+			Expect(selected.Ingress.Tier).To(Equal(TierNetworkPolicy))
+
+			unselected := policy.IsTrafficAllowed(traffic("y", "w", 80, v1.ProtocolTCP))
+			Expect(unselected.IsAllowed()).To(BeFalse())
+			Expect(unselected.Ingress.Tier).To(Equal(TierBaselineAdminNetworkPolicy))
+			Expect(unselected.Table()).To(ContainSubstring(string(TierBaselineAdminNetworkPolicy)))
+		})
+
+		It("should allow by default if no policies apply", func() {
+			policy, err := BuildNetworkPoliciesWithAdmin(nil, []*kube.AdminNetworkPolicy{denyFromY}, nil)
+			Expect(err).To(Succeed())
+			result := policy.IsTrafficAllowed(traffic("z", "w", 80, v1.ProtocolTCP))
+			Expect(result.IsAllowed()).To(BeTrue())
+			Expect(result.Ingress.Tier).To(Equal(TierDefault))
+		})
+
+		It("should default the protocol of an admin network policy port number to TCP", func() {
+			denyPort80 := mustParseAdminNetworkPolicy(`
+metadata: {name: deny-port-80}
+spec:
+  priority: 20
+  subject:
+    namespaces: {}
+  ingress:
+  - name: deny-80
+    action: Deny
+    from:
+    - namespaces: {}
+    ports:
+    - portNumber: {port: 80}`)
+			policy, err := BuildNetworkPoliciesWithAdmin(nil, []*kube.AdminNetworkPolicy{denyPort80}, nil)
+			Expect(err).To(Succeed())
+			Expect(policy.IsTrafficAllowed(traffic("y", "x", 80, v1.ProtocolTCP)).IsAllowed()).To(BeFalse())
+			Expect(policy.IsTrafficAllowed(traffic("y", "x", 80, v1.ProtocolUDP)).IsAllowed()).To(BeTrue())
+			Expect(policy.IsTrafficAllowed(traffic("y", "x", 81, v1.ProtocolTCP)).IsAllowed()).To(BeTrue())
+		})
+	})
+}
@@ -0,0 +1,170 @@
+package matcher
+
+import (
+	"fmt"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+type benchmarkPod struct {
+	Namespace string
+	Labels    map[string]string
+}
+
+// benchmarkPolicies builds 3000 policies and 3000 pods: 100 namespaces with 30 apps each, a policy selecting each
+// app, and one selecting every pod of the namespace
+func benchmarkPolicies() (*Policy, []*benchmarkPod) {
+	tcp := v1.ProtocolTCP
+	port80 := intstr.FromInt(80)
+	var kubePolicies []*networkingv1.NetworkPolicy
+	var pods []*benchmarkPod
+	for i := 0; i < 100; i++ {
+		ns := fmt.Sprintf("ns-%d", i)
+		for app := 0; app < 30; app++ {
+			labels := map[string]string{"app": fmt.Sprintf("app-%d", app), "env": "prod"}
+			pods = append(pods, &benchmarkPod{Namespace: ns, Labels: labels})
+			kubePolicies = append(kubePolicies, &networkingv1.NetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: fmt.Sprintf("allow-app-%d", app)},
+				Spec: networkingv1.NetworkPolicySpec{
+					PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": fmt.Sprintf("app-%d", app)}},
+					Ingress: []networkingv1.NetworkPolicyIngressRule{{
+						Ports: []networkingv1.NetworkPolicyPort{{Protocol: &tcp, Port: &port80}},
+						From:  []networkingv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": fmt.Sprintf("app-%d", (app+1)%30)}}}},
+					}},
+					PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+				},
+			})
+		}
+		kubePolicies = append(kubePolicies, &networkingv1.NetworkPolicy{
+			ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: "deny-egress"},
+			Spec:       networkingv1.NetworkPolicySpec{PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress}},
+		})
+	}
+	return BuildNetworkPolicies(kubePolicies), pods
+}
+
+func BenchmarkTargetsApplyingToPod(b *testing.B) {
+	policies, pods := benchmarkPolicies()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, pod := range pods {
+			policies.TargetsApplyingToPod(true, pod.Namespace, pod.Labels)
+			policies.TargetsApplyingToPod(false, pod.Namespace, pod.Labels)
+		}
+	}
+}
+
+// BenchmarkTargetsApplyingToPodUnindexed is the baseline for BenchmarkTargetsApplyingToPod: the same lookups,
+// checking every target
+func BenchmarkTargetsApplyingToPodUnindexed(b *testing.B) {
+	policies, pods := benchmarkPolicies()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, pod := range pods {
+			for _, isIngress := range []bool{true, false} {
+				dict, _ := policies.targets(isIngress)
+				var targets []*Target
+				for _, target := range dict {
+					if target.IsMatch(pod.Namespace, pod.Labels) {
+						targets = append(targets, target)
+					}
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkIsTrafficAllowed(b *testing.B) {
+	policies, pods := benchmarkPolicies()
+	var traffics []*Traffic
+	for i, pod := range pods {
+		destination := pods[(i+1)%len(pods)]
+		traffics = append(traffics, &Traffic{
+			Source:       &TrafficPeer{Internal: &InternalPeer{Namespace: pod.Namespace, PodLabels: pod.Labels}, IP: "10.0.0.1"},
+			Destination:  &TrafficPeer{Internal: &InternalPeer{Namespace: destination.Namespace, PodLabels: destination.Labels}, IP: "10.0.0.2"},
+			ResolvedPort: 80,
+			Protocol:     v1.ProtocolTCP,
+		})
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, traffic := range traffics {
+			policies.IsTrafficAllowed(traffic)
+		}
+	}
+}
+
+// equivalenceBenchmarkPolicies builds a typical set of policies for each of a number of namespaces: a default
+// deny, allowing the namespace's own pods, allowing a frontend team into the web pods, allowing DNS, and allowing
+// a database CIDR
+func equivalenceBenchmarkPolicies(namespaces int) []*networkingv1.NetworkPolicy {
+	tcp, udp := v1.ProtocolTCP, v1.ProtocolUDP
+	port80, port443, port53, port5432 := intstr.FromInt(80), intstr.FromInt(443), intstr.FromInt(53), intstr.FromInt(5432)
+	var policies []*networkingv1.NetworkPolicy
+	for i := 0; i < namespaces; i++ {
+		ns := fmt.Sprintf("ns-%d", i)
+		policies = append(policies,
+			&networkingv1.NetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: "default-deny"},
+				Spec:       networkingv1.NetworkPolicySpec{PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress}},
+			},
+			&networkingv1.NetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: "allow-same-namespace"},
+				Spec: networkingv1.NetworkPolicySpec{
+					Ingress:     []networkingv1.NetworkPolicyIngressRule{{From: []networkingv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{}}}}},
+					PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+				},
+			},
+			&networkingv1.NetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: "allow-frontend"},
+				Spec: networkingv1.NetworkPolicySpec{
+					PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+					Ingress: []networkingv1.NetworkPolicyIngressRule{{
+						Ports: []networkingv1.NetworkPolicyPort{{Protocol: &tcp, Port: &port80}, {Protocol: &tcp, Port: &port443}},
+						From:  []networkingv1.NetworkPolicyPeer{{NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "frontend"}}}},
+					}},
+					PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+				},
+			},
+			&networkingv1.NetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: "allow-dns"},
+				Spec: networkingv1.NetworkPolicySpec{
+					Egress: []networkingv1.NetworkPolicyEgressRule{{
+						Ports: []networkingv1.NetworkPolicyPort{{Protocol: &udp, Port: &port53}},
+						To: []networkingv1.NetworkPolicyPeer{{
+							NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"kubernetes.io/metadata.name": "kube-system"}},
+							PodSelector:       &metav1.LabelSelector{MatchLabels: map[string]string{"k8s-app": "kube-dns"}},
+						}},
+					}},
+					PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+				},
+			},
+			&networkingv1.NetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: "allow-database"},
+				Spec: networkingv1.NetworkPolicySpec{
+					PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": fmt.Sprintf("app-%d", i%3)}},
+					Egress: []networkingv1.NetworkPolicyEgressRule{{
+						Ports: []networkingv1.NetworkPolicyPort{{Protocol: &tcp, Port: &port5432}},
+						To:    []networkingv1.NetworkPolicyPeer{{IPBlock: &networkingv1.IPBlock{CIDR: "10.0.0.0/8", Except: []string{"10.1.0.0/16"}}}},
+					}},
+					PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+				},
+			})
+	}
+	return policies
+}
+
+func BenchmarkAreEquivalent(b *testing.B) {
+	policies := BuildNetworkPolicies(equivalenceBenchmarkPolicies(10))
+	simplified := Simplify(policies)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if isEquivalent, traffic := AreEquivalent(policies, simplified); !isEquivalent {
+			b.Fatalf("expected simplified policies to be equivalent, found %+v", traffic)
+		}
+	}
+}
@@ -2,27 +2,50 @@ package matcher
 
 import (
 	"github.com/mattfenwick/cyclonus/pkg/kube"
-	"github.com/pkg/errors"
 	v1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 )
 
+// BuildNetworkPolicy builds a single policy which is known to be valid; see BuildNetworkPolicies
 func BuildNetworkPolicy(policy *networkingv1.NetworkPolicy) *Policy {
 	return BuildNetworkPolicies([]*networkingv1.NetworkPolicy{policy})
 }
 
+// BuildNetworkPolicies builds policies which are known to be valid -- such as examples and generated test
+// cases -- and panics on an invalid one.  Policies from users should be built with BuildValidNetworkPolicies.
 func BuildNetworkPolicies(netpols []*networkingv1.NetworkPolicy) *Policy {
+	np, policyErrors := BuildValidNetworkPolicies(netpols)
+	if len(policyErrors) > 0 {
+		panic(policyErrors[0])
+	}
+	return np
+}
+
+// BuildValidNetworkPolicies builds every valid policy, skipping the invalid ones and returning their errors;
+// it's up to the caller whether to go on without them.  Policies are validated as the API server would first,
+// and every violation is reported.
+func BuildValidNetworkPolicies(netpols []*networkingv1.NetworkPolicy) (*Policy, []*PolicyError) {
 	np := NewPolicy()
+	var policyErrors []*PolicyError
 	for _, policy := range netpols {
-		ingress, egress := BuildTarget(policy)
-		if ingress != nil {
-			np.AddTarget(true, ingress)
+		if errs := kube.ValidateNetworkPolicy(policy); len(errs) > 0 {
+			policyErrors = append(policyErrors, ValidationPolicyErrors(policy, errs)...)
+			continue
 		}
-		if egress != nil {
-			np.AddTarget(false, egress)
+		ingress, egress, err := BuildTarget(policy)
+		if err == nil && ingress != nil {
+			_, err = np.AddTarget(true, ingress)
+		}
+		if err == nil && egress != nil {
+			_, err = np.AddTarget(false, egress)
+		}
+		if err != nil {
+			policyErrors = append(policyErrors, asPolicyError(policy, err))
 		}
 	}
-	return np
+	return np, policyErrors
 }
 
 func getPolicyNamespace(policy *networkingv1.NetworkPolicy) string {
@@ -32,110 +55,196 @@ func getPolicyNamespace(policy *networkingv1.NetworkPolicy) string {
 	return policy.Namespace
 }
 
-func BuildTarget(netpol *networkingv1.NetworkPolicy) (*Target, *Target) {
+// DefaultPolicyTypes returns a policy's types or -- if it has none -- the API server's defaults: Ingress, plus
+// Egress if there are egress rules
+func DefaultPolicyTypes(netpol *networkingv1.NetworkPolicy) []networkingv1.PolicyType {
+	if len(netpol.Spec.PolicyTypes) > 0 {
+		return netpol.Spec.PolicyTypes
+	}
+	types := []networkingv1.PolicyType{networkingv1.PolicyTypeIngress}
+	if len(netpol.Spec.Egress) > 0 {
+		types = append(types, networkingv1.PolicyTypeEgress)
+	}
+	return types
+}
+
+// BuildTarget builds a policy's ingress and egress targets -- either of which is nil if the policy doesn't
+// have that type.  Errors are *PolicyError values.
+func BuildTarget(netpol *networkingv1.NetworkPolicy) (*Target, *Target, error) {
 	var ingress *Target
 	var egress *Target
-	if len(netpol.Spec.PolicyTypes) == 0 {
-		panic(errors.Errorf("invalid network policy: need at least 1 type"))
-	}
 	policyNamespace := getPolicyNamespace(netpol)
-	for _, pType := range netpol.Spec.PolicyTypes {
+	for i, pType := range DefaultPolicyTypes(netpol) {
 		switch pType {
 		case networkingv1.PolicyTypeIngress:
+			peer, err := buildIngressMatcher(policyNamespace, policyNamespace+"/"+netpol.Name, netpol.Spec.Ingress)
+			if err != nil {
+				return nil, nil, asPolicyError(netpol, err)
+			}
 			ingress = &Target{
 				Namespace:   policyNamespace,
 				PodSelector: netpol.Spec.PodSelector,
 				SourceRules: []*networkingv1.NetworkPolicy{netpol},
-				Peer:        BuildIngressMatcher(policyNamespace, netpol.Spec.Ingress),
+				Peer:        peer,
 			}
 		case networkingv1.PolicyTypeEgress:
+			peer, err := buildEgressMatcher(policyNamespace, policyNamespace+"/"+netpol.Name, netpol.Spec.Egress)
+			if err != nil {
+				return nil, nil, asPolicyError(netpol, err)
+			}
 			egress = &Target{
 				Namespace:   policyNamespace,
 				PodSelector: netpol.Spec.PodSelector,
 				SourceRules: []*networkingv1.NetworkPolicy{netpol},
-				Peer:        BuildEgressMatcher(policyNamespace, netpol.Spec.Egress),
+				Peer:        peer,
 			}
+		default:
+			return nil, nil, asPolicyError(netpol, newPolicyError(field.NewPath("spec", "policyTypes").Index(i), "unsupported policy type '%s'", pType))
 		}
 	}
-	return ingress, egress
+	return ingress, egress, nil
+}
+
+// BuildIngressMatcher builds the matcher for a policy's ingress rules; its leaves have no sources, since the
+// policy is unknown
+func BuildIngressMatcher(policyNamespace string, ingresses []networkingv1.NetworkPolicyIngressRule) (PeerMatcher, error) {
+	return buildIngressMatcher(policyNamespace, "", ingresses)
 }
 
-func BuildIngressMatcher(policyNamespace string, ingresses []networkingv1.NetworkPolicyIngressRule) PeerMatcher {
+// buildIngressMatcher records the rule, peer and port of each leaf matcher as its source, if policyName is set
+func buildIngressMatcher(policyNamespace string, policyName string, ingresses []networkingv1.NetworkPolicyIngressRule) (PeerMatcher, error) {
 	var matcher PeerMatcher = &NonePeerMatcher{}
-	for _, ingress := range ingresses {
-		matcher = CombinePeerMatchers(matcher, BuildPeerMatcher(policyNamespace, ingress.Ports, ingress.From))
+	for i, ingress := range ingresses {
+		path := field.NewPath("spec", "ingress").Index(i)
+		var source *RuleSource
+		if policyName != "" {
+			source = newRuleSource(policyName, true, i)
+		}
+		peer, err := buildPeerMatcher(policyNamespace, ingress.Ports, path.Child("ports"), ingress.From, path.Child("from"), source)
+		if err != nil {
+			return nil, err
+		}
+		if matcher, err = CombinePeerMatchers(matcher, peer); err != nil {
+			return nil, err
+		}
 	}
-	return matcher
+	return matcher, nil
+}
+
+// BuildEgressMatcher builds the matcher for a policy's egress rules; its leaves have no sources, since the
+// policy is unknown
+func BuildEgressMatcher(policyNamespace string, egresses []networkingv1.NetworkPolicyEgressRule) (PeerMatcher, error) {
+	return buildEgressMatcher(policyNamespace, "", egresses)
 }
 
-func BuildEgressMatcher(policyNamespace string, egresses []networkingv1.NetworkPolicyEgressRule) PeerMatcher {
+// buildEgressMatcher records the rule, peer and port of each leaf matcher as its source, if policyName is set
+func buildEgressMatcher(policyNamespace string, policyName string, egresses []networkingv1.NetworkPolicyEgressRule) (PeerMatcher, error) {
 	var matcher PeerMatcher = &NonePeerMatcher{}
-	for _, egress := range egresses {
-		matcher = CombinePeerMatchers(matcher, BuildPeerMatcher(policyNamespace, egress.Ports, egress.To))
+	for i, egress := range egresses {
+		path := field.NewPath("spec", "egress").Index(i)
+		var source *RuleSource
+		if policyName != "" {
+			source = newRuleSource(policyName, false, i)
+		}
+		peer, err := buildPeerMatcher(policyNamespace, egress.Ports, path.Child("ports"), egress.To, path.Child("to"), source)
+		if err != nil {
+			return nil, err
+		}
+		if matcher, err = CombinePeerMatchers(matcher, peer); err != nil {
+			return nil, err
+		}
 	}
-	return matcher
+	return matcher, nil
 }
 
-func BuildPeerMatcher(policyNamespace string, npPorts []networkingv1.NetworkPolicyPort, peers []networkingv1.NetworkPolicyPeer) PeerMatcher {
+// BuildPeerMatcher builds the matcher for a single rule; the fields of its errors are relative to the rule
+func BuildPeerMatcher(policyNamespace string, npPorts []networkingv1.NetworkPolicyPort, peers []networkingv1.NetworkPolicyPeer) (PeerMatcher, error) {
+	return buildPeerMatcher(policyNamespace, npPorts, field.NewPath("ports"), peers, field.NewPath("peers"), nil)
+}
+
+// buildPeerMatcher builds a rule's matcher; if source -- the rule -- isn't nil, each leaf records its peer or
+// port within the rule
+func buildPeerMatcher(policyNamespace string, npPorts []networkingv1.NetworkPolicyPort, portsPath *field.Path, peers []networkingv1.NetworkPolicyPeer, peersPath *field.Path, source *RuleSource) (PeerMatcher, error) {
 	// 1. build port matcher
-	port := BuildPortMatcher(npPorts)
+	port, err := buildPortMatcher(npPorts, portsPath, source)
+	if err != nil {
+		return nil, err
+	}
 	// 2. build Peers
 	if len(peers) == 0 {
 		switch port.(type) {
 		case *AllPortMatcher:
-			return &AllPeerMatcher{}
+			return &AllPeerMatcher{Sources: peerRuleSources(source, -1)}, nil
 		default:
 			matcher := &NamespacePodMatcher{
 				Namespace: &AllNamespaceMatcher{},
 				Pod:       &AllPodMatcher{},
 				Port:      port,
+				Sources:   peerRuleSources(source, -1),
 			}
-			return &SpecificPeerMatcher{
-				IP:       NewSpecificIPMatcher(port),
-				Internal: NewSpecificInternalMatcher(matcher),
+			ip, err := NewSpecificIPMatcher(port)
+			if err != nil {
+				return nil, err
+			}
+			internal, err := NewSpecificInternalMatcher(matcher)
+			if err != nil {
+				return nil, err
 			}
+			return &SpecificPeerMatcher{
+				IP:       ip,
+				Internal: internal,
+			}, nil
 		}
 	} else {
-		matcher := &SpecificPeerMatcher{
+		var matcher PeerMatcher = &SpecificPeerMatcher{
 			IP:       &NoneIPMatcher{},
 			Internal: &NoneInternalMatcher{},
 		}
-		for _, from := range peers {
-			ip, ns, pod := BuildIPBlockNamespacePodMatcher(policyNamespace, from)
+		for i, from := range peers {
 			// invalid netpol guards
-			if ip == nil && ns == nil && pod == nil {
-				panic(errors.Errorf("invalid NetworkPolicyPeer: all of IPBlock, NamespaceSelector, and PodSelector are nil"))
+			if from.IPBlock == nil && from.NamespaceSelector == nil && from.PodSelector == nil {
+				return nil, newPolicyError(peersPath.Index(i), "all of ipBlock, namespaceSelector, and podSelector are nil")
 			}
-			if ip != nil && (ns != nil || pod != nil) {
-				panic(errors.Errorf("invalid NetworkPolicyPeer: if NamespaceSelector or PodSelector is non-nil, IPBlock must be nil"))
+			if from.IPBlock != nil && (from.NamespaceSelector != nil || from.PodSelector != nil) {
+				return nil, newPolicyError(peersPath.Index(i), "if namespaceSelector or podSelector is non-nil, ipBlock must be nil")
 			}
+			ip, ns, pod := BuildIPBlockNamespacePodMatcher(policyNamespace, from)
 			// process a valid netpol
+			var peer *SpecificPeerMatcher
 			if ip != nil {
 				ip.Port = port
-				matcher.IP = CombineIPMatchers(matcher.IP, NewSpecificIPMatcher(&NonePortMatcher{}, ip))
+				ip.Sources = peerRuleSources(source, i)
+				ipMatcher, err := NewSpecificIPMatcher(&NonePortMatcher{}, ip)
+				if err != nil {
+					return nil, err
+				}
+				peer = &SpecificPeerMatcher{IP: ipMatcher, Internal: &NoneInternalMatcher{}}
 			} else {
+				var internal InternalMatcher
 				// special case: if all ports, namespaces, and pods are allowed
-				switch port.(type) {
-				case *AllPortMatcher:
-					switch ns.(type) {
-					case *AllNamespaceMatcher:
-						switch pod.(type) {
-						case *AllPodMatcher:
-							matcher.Internal = &AllInternalMatcher{}
-						}
+				_, isAllPorts := port.(*AllPortMatcher)
+				_, isAllNamespaces := ns.(*AllNamespaceMatcher)
+				_, isAllPods := pod.(*AllPodMatcher)
+				if isAllPorts && isAllNamespaces && isAllPods {
+					internal = &AllInternalMatcher{Sources: peerRuleSources(source, i)}
+				} else {
+					internal, err = NewSpecificInternalMatcher(&NamespacePodMatcher{
+						Namespace: ns,
+						Pod:       pod,
+						Port:      port,
+						Sources:   peerRuleSources(source, i),
+					})
+					if err != nil {
+						return nil, err
 					}
 				}
-				// it's okay to continue processing additional matchers after hitting the special case,
-				//   since nothing can override an AllInternalMatcher
-				internal := NewSpecificInternalMatcher(&NamespacePodMatcher{
-					Namespace: ns,
-					Pod:       pod,
-					Port:      port,
-				})
-				matcher.Internal = CombineInternalMatchers(matcher.Internal, internal)
+				peer = &SpecificPeerMatcher{IP: &NoneIPMatcher{}, Internal: internal}
+			}
+			if matcher, err = CombinePeerMatchers(matcher, peer); err != nil {
+				return nil, err
 			}
 		}
-		return matcher
+		return matcher, nil
 	}
 }
 
@@ -168,21 +277,56 @@ func BuildIPBlockNamespacePodMatcher(policyNamespace string, peer networkingv1.N
 	return nil, nsMatcher, podMatcher
 }
 
-func BuildPortMatcher(npPorts []networkingv1.NetworkPolicyPort) PortMatcher {
+// BuildPortMatcher builds the matcher for a rule's ports; the fields of its errors are relative to the ports
+func BuildPortMatcher(npPorts []networkingv1.NetworkPolicyPort) (PortMatcher, error) {
+	return buildPortMatcher(npPorts, field.NewPath("ports"), nil)
+}
+
+// peerRuleSources is the source of a rule's peer, or nil if the rule's unknown; peer is -1 for a rule without peers
+func peerRuleSources(source *RuleSource, peer int) []*RuleSource {
+	if source == nil {
+		return nil
+	}
+	return []*RuleSource{source.withPeer(peer)}
+}
+
+// portRuleSources is the source of a rule's port, or nil if the rule's unknown; port is -1 for a rule without ports
+func portRuleSources(source *RuleSource, port int) []*RuleSource {
+	if source == nil {
+		return nil
+	}
+	return []*RuleSource{source.withPort(port)}
+}
+
+func buildPortMatcher(npPorts []networkingv1.NetworkPolicyPort, path *field.Path, source *RuleSource) (PortMatcher, error) {
 	if len(npPorts) == 0 {
-		return &AllPortMatcher{}
+		return &AllPortMatcher{Sources: portRuleSources(source, -1)}, nil
 	} else {
 		matcher := &SpecificPortMatcher{}
-		for _, p := range npPorts {
+		for i, p := range npPorts {
 			protocol := v1.ProtocolTCP
 			if p.Protocol != nil {
 				protocol = *p.Protocol
 			}
-			matcher.Ports = append(matcher.Ports, &PortProtocolMatcher{
-				Port:     p.Port,
-				Protocol: protocol,
-			})
+			if p.EndPort == nil {
+				matcher.Ports = append(matcher.Ports, &PortProtocolMatcher{
+					Port:     p.Port,
+					Protocol: protocol,
+					Sources:  portRuleSources(source, i),
+				})
+			} else {
+				// invalid netpol guard: a range must start at a numbered port
+				if p.Port == nil || p.Port.Type != intstr.Int {
+					return nil, newPolicyError(path.Index(i).Child("endPort"), "endPort requires a numbered port")
+				}
+				matcher.PortRanges = append(matcher.PortRanges, &PortRangeMatcher{
+					From:     int(p.Port.IntVal),
+					To:       int(*p.EndPort),
+					Protocol: protocol,
+					Sources:  portRuleSources(source, i),
+				})
+			}
 		}
-		return matcher
+		return matcher, nil
 	}
 }
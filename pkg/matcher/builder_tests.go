@@ -23,10 +23,28 @@ var (
 	port103 = intstr.FromInt(103)
 )
 
+func mustBuildTarget(policy *networkingv1.NetworkPolicy) (*Target, *Target) {
+	ingress, egress, err := BuildTarget(policy)
+	Expect(err).To(Succeed())
+	return ingress, egress
+}
+
+func mustSpecificIPMatcher(portsForAllIPs PortMatcher, blocks ...*IPBlockMatcher) *SpecificIPMatcher {
+	ip, err := NewSpecificIPMatcher(portsForAllIPs, blocks...)
+	Expect(err).To(Succeed())
+	return ip
+}
+
+func mustSpecificInternalMatcher(matchers ...*NamespacePodMatcher) *SpecificInternalMatcher {
+	internal, err := NewSpecificInternalMatcher(matchers...)
+	Expect(err).To(Succeed())
+	return internal
+}
+
 func RunBuilderTests() {
 	Describe("BuildTarget: Allow none -- nil egress/ingress", func() {
 		It("allow-no-ingress", func() {
-			ingress, egress := BuildTarget(netpol.AllowNoIngress)
+			ingress, egress := mustBuildTarget(netpol.AllowNoIngress)
 
 			Expect(ingress.Peer).To(Equal(&NonePeerMatcher{}))
 			//Expect(target.Ingress).To(Equal(&PeerMatcher{Matchers: []*NamespacePodMatcher{}}))
@@ -34,14 +52,14 @@ func RunBuilderTests() {
 		})
 
 		It("allow-no-egress", func() {
-			ingress, egress := BuildTarget(netpol.AllowNoEgress)
+			ingress, egress := mustBuildTarget(netpol.AllowNoEgress)
 
 			Expect(egress.Peer).To(Equal(&NonePeerMatcher{}))
 			Expect(ingress).To(BeNil())
 		})
 
 		It("allow-neither", func() {
-			ingress, egress := BuildTarget(netpol.AllowNoIngressAllowNoEgress)
+			ingress, egress := mustBuildTarget(netpol.AllowNoIngressAllowNoEgress)
 
 			Expect(ingress.Peer).To(Equal(&NonePeerMatcher{}))
 			Expect(egress.Peer).To(Equal(&NonePeerMatcher{}))
@@ -50,7 +68,7 @@ func RunBuilderTests() {
 
 	Describe("BuildTarget: missing namespace gets treated as default namespace", func() {
 		It("missing namespace", func() {
-			ingress, egress := BuildTarget(&networkingv1.NetworkPolicy{
+			ingress, egress := mustBuildTarget(&networkingv1.NetworkPolicy{
 				ObjectMeta: metav1.ObjectMeta{
 					Name: "abc",
 				},
@@ -65,23 +83,106 @@ func RunBuilderTests() {
 		})
 	})
 
+	Describe("BuildTarget: missing policy types get the API server's defaults", func() {
+		It("defaults to ingress without egress rules", func() {
+			ingress, egress := mustBuildTarget(&networkingv1.NetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "x", Name: "abc"},
+			})
+
+			Expect(ingress.Peer).To(Equal(&NonePeerMatcher{}))
+			Expect(egress).To(BeNil())
+		})
+
+		It("defaults to ingress and egress with egress rules", func() {
+			ingress, egress := mustBuildTarget(&networkingv1.NetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "x", Name: "abc"},
+				Spec: networkingv1.NetworkPolicySpec{
+					Egress: []networkingv1.NetworkPolicyEgressRule{{}},
+				},
+			})
+
+			Expect(ingress.Peer).To(Equal(&NonePeerMatcher{}))
+			Expect(egress.Peer).To(Equal(&AllPeerMatcher{Sources: []*RuleSource{{Policy: "x/abc", Rule: 0, Peer: -1, Port: -1}}}))
+		})
+	})
+
+	Describe("BuildTarget: invalid policies", func() {
+		buildError := func(spec networkingv1.NetworkPolicySpec) *PolicyError {
+			_, _, err := BuildTarget(&networkingv1.NetworkPolicy{ObjectMeta: metav1.ObjectMeta{Namespace: "x", Name: "abc"}, Spec: spec})
+			Expect(err).To(HaveOccurred())
+			policyError, ok := err.(*PolicyError)
+			Expect(ok).To(BeTrue())
+			Expect(policyError.Namespace).To(Equal("x"))
+			Expect(policyError.Name).To(Equal("abc"))
+			return policyError
+		}
+
+		It("rejects a peer with nothing set", func() {
+			policyError := buildError(networkingv1.NetworkPolicySpec{
+				Ingress: []networkingv1.NetworkPolicyIngressRule{{From: []networkingv1.NetworkPolicyPeer{{}}}},
+			})
+			Expect(policyError.Field).To(Equal("spec.ingress[0].from[0]"))
+		})
+
+		It("rejects a peer with an ip block and a selector", func() {
+			policyError := buildError(networkingv1.NetworkPolicySpec{
+				PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+				Egress: []networkingv1.NetworkPolicyEgressRule{{}, {To: []networkingv1.NetworkPolicyPeer{
+					{PodSelector: netpol.SelectorEmpty},
+					{IPBlock: netpol.IPBlock_10_0_0_1_24, PodSelector: netpol.SelectorEmpty},
+				}}},
+			})
+			Expect(policyError.Field).To(Equal("spec.egress[1].to[1]"))
+		})
+
+		It("rejects a port range starting at a named port", func() {
+			named := intstr.FromString("hello")
+			endPort := int32(32768)
+			policyError := buildError(networkingv1.NetworkPolicySpec{
+				Ingress: []networkingv1.NetworkPolicyIngressRule{{Ports: []networkingv1.NetworkPolicyPort{{Port: &port80}, {Port: &named, EndPort: &endPort}}}},
+			})
+			Expect(policyError.Field).To(Equal("spec.ingress[0].ports[1].endPort"))
+		})
+
+		It("rejects an unknown policy type", func() {
+			policyError := buildError(networkingv1.NetworkPolicySpec{
+				PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, "Sideways"},
+			})
+			Expect(policyError.Field).To(Equal("spec.policyTypes[1]"))
+		})
+
+		It("skips invalid policies, building the rest", func() {
+			invalid := &networkingv1.NetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "x", Name: "invalid"},
+				Spec: networkingv1.NetworkPolicySpec{
+					Ingress: []networkingv1.NetworkPolicyIngressRule{{From: []networkingv1.NetworkPolicyPeer{{}}}},
+				},
+			}
+			policy, policyErrors := BuildValidNetworkPolicies([]*networkingv1.NetworkPolicy{netpol.AllowAllIngress, invalid})
+			Expect(policyErrors).To(HaveLen(1))
+			Expect(policyErrors[0].Policy).To(Equal(invalid))
+			Expect(policyErrors[0].Error()).To(Equal("invalid network policy x/invalid: spec.ingress[0].from[0]: Required value: must specify a peer"))
+			Expect(policy).To(Equal(BuildNetworkPolicy(netpol.AllowAllIngress)))
+		})
+	})
+
 	Describe("BuildTarget: Allow none -- empty ingress/egress", func() {
 		It("allow-no-ingress", func() {
-			ingress, egress := BuildTarget(netpol.AllowNoIngress_EmptyIngress)
+			ingress, egress := mustBuildTarget(netpol.AllowNoIngress_EmptyIngress)
 
 			Expect(ingress.Peer).To(Equal(&NonePeerMatcher{}))
 			Expect(egress).To(BeNil())
 		})
 
 		It("allow-no-egress", func() {
-			ingress, egress := BuildTarget(netpol.AllowNoEgress_EmptyEgress)
+			ingress, egress := mustBuildTarget(netpol.AllowNoEgress_EmptyEgress)
 
 			Expect(egress.Peer).To(Equal(&NonePeerMatcher{}))
 			Expect(ingress).To(BeNil())
 		})
 
 		It("allow-neither", func() {
-			ingress, egress := BuildTarget(netpol.AllowNoIngressAllowNoEgress_EmptyEgressEmptyIngress)
+			ingress, egress := mustBuildTarget(netpol.AllowNoIngressAllowNoEgress_EmptyEgressEmptyIngress)
 
 			Expect(ingress.Peer).To(Equal(&NonePeerMatcher{}))
 			Expect(egress.Peer).To(Equal(&NonePeerMatcher{}))
@@ -90,24 +191,24 @@ func RunBuilderTests() {
 
 	Describe("BuildTarget: Allow all", func() {
 		It("allow-all-ingress", func() {
-			ingress, egress := BuildTarget(netpol.AllowAllIngress)
+			ingress, egress := mustBuildTarget(netpol.AllowAllIngress)
 
 			Expect(egress).To(BeNil())
-			Expect(ingress.Peer).To(Equal(&AllPeerMatcher{}))
+			Expect(ingress.Peer).To(Equal(&AllPeerMatcher{Sources: []*RuleSource{{Policy: netpol.Namespace + "/allow-all-ingress", IsIngress: true, Rule: 0, Peer: -1, Port: -1}}}))
 		})
 
 		It("allow-all-egress", func() {
-			ingress, egress := BuildTarget(netpol.AllowAllEgress)
+			ingress, egress := mustBuildTarget(netpol.AllowAllEgress)
 
-			Expect(egress.Peer).To(Equal(&AllPeerMatcher{}))
+			Expect(egress.Peer).To(Equal(&AllPeerMatcher{Sources: []*RuleSource{{Policy: netpol.Namespace + "/allow-all-egress", Rule: 0, Peer: -1, Port: -1}}}))
 			Expect(ingress).To(BeNil())
 		})
 
 		It("allow-all-both", func() {
-			ingress, egress := BuildTarget(netpol.AllowAllIngressAllowAllEgress)
+			ingress, egress := mustBuildTarget(netpol.AllowAllIngressAllowAllEgress)
 
-			Expect(egress.Peer).To(Equal(&AllPeerMatcher{}))
-			Expect(ingress.Peer).To(Equal(&AllPeerMatcher{}))
+			Expect(egress.Peer).To(Equal(&AllPeerMatcher{Sources: []*RuleSource{{Policy: netpol.Namespace + "/allow-all-ingress-allow-all-egress", Rule: 0, Peer: -1, Port: -1}}}))
+			Expect(ingress.Peer).To(Equal(&AllPeerMatcher{Sources: []*RuleSource{{Policy: netpol.Namespace + "/allow-all-ingress-allow-all-egress", IsIngress: true, Rule: 0, Peer: -1, Port: -1}}}))
 		})
 	})
 
@@ -115,37 +216,41 @@ func RunBuilderTests() {
 
 	Describe("PeerMatcher from slice of ingress/egress rules", func() {
 		It("allows no ingress from an empty slice of ingress rules", func() {
-			peer := BuildIngressMatcher("abc", []networkingv1.NetworkPolicyIngressRule{})
+			peer, err := BuildIngressMatcher("abc", []networkingv1.NetworkPolicyIngressRule{})
+			Expect(err).To(Succeed())
 			Expect(peer).To(Equal(&NonePeerMatcher{}))
 		})
 
 		It("allows no egress from an empty slice of egress rules", func() {
-			peer := BuildEgressMatcher("abc", []networkingv1.NetworkPolicyEgressRule{})
+			peer, err := BuildEgressMatcher("abc", []networkingv1.NetworkPolicyEgressRule{})
+			Expect(err).To(Succeed())
 			Expect(peer).To(Equal(&NonePeerMatcher{}))
 		})
 
 		It("allows all ingress from an ingress containing a single empty rule", func() {
-			peer := BuildIngressMatcher("abc", []networkingv1.NetworkPolicyIngressRule{
+			peer, err := BuildIngressMatcher("abc", []networkingv1.NetworkPolicyIngressRule{
 				{
 					Ports: nil,
 					From:  nil,
 				},
 			})
+			Expect(err).To(Succeed())
 			Expect(peer).To(Equal(&AllPeerMatcher{}))
 		})
 
 		It("allows all egress from an ingress containing a single empty rule", func() {
-			peer := BuildEgressMatcher("abc", []networkingv1.NetworkPolicyEgressRule{
+			peer, err := BuildEgressMatcher("abc", []networkingv1.NetworkPolicyEgressRule{
 				{
 					Ports: nil,
 					To:    nil,
 				},
 			})
+			Expect(err).To(Succeed())
 			Expect(peer).To(Equal(&AllPeerMatcher{}))
 		})
 
 		It("allows to ips in IPBlock range and also to all pods/ips for DNS", func() {
-			peer := BuildEgressMatcher("abc", []networkingv1.NetworkPolicyEgressRule{
+			peer, err := BuildEgressMatcher("abc", []networkingv1.NetworkPolicyEgressRule{
 				{
 					Ports: []networkingv1.NetworkPolicyPort{{Port: &port80, Protocol: &tcp}},
 					To: []networkingv1.NetworkPolicyPeer{
@@ -161,6 +266,7 @@ func RunBuilderTests() {
 					Ports: []networkingv1.NetworkPolicyPort{{Port: &port53, Protocol: &udp}},
 				},
 			})
+			Expect(err).To(Succeed())
 			port53UDPMatcher := &SpecificPortMatcher{Ports: []*PortProtocolMatcher{{Port: &port53, Protocol: v1.ProtocolUDP}}}
 			port80TCPMatcher := &SpecificPortMatcher{Ports: []*PortProtocolMatcher{{Port: &port80, Protocol: v1.ProtocolTCP}}}
 			ip := &IPBlockMatcher{
@@ -168,8 +274,8 @@ func RunBuilderTests() {
 				Port:    port80TCPMatcher,
 			}
 			Expect(peer).To(Equal(&SpecificPeerMatcher{
-				IP: NewSpecificIPMatcher(port53UDPMatcher, ip),
-				Internal: NewSpecificInternalMatcher(&NamespacePodMatcher{
+				IP: mustSpecificIPMatcher(port53UDPMatcher, ip),
+				Internal: mustSpecificInternalMatcher(&NamespacePodMatcher{
 					Namespace: &ExactNamespaceMatcher{Namespace: "abc"},
 					Pod:       &AllPodMatcher{},
 					Port:      port80TCPMatcher,
@@ -185,12 +291,13 @@ func RunBuilderTests() {
 
 	Describe("PeerMatcher from slice of NetworkPolicyPeer", func() {
 		It("allows all source/destination from an empty slice", func() {
-			sds := BuildPeerMatcher("abc", []networkingv1.NetworkPolicyPort{}, []networkingv1.NetworkPolicyPeer{})
+			sds, err := BuildPeerMatcher("abc", []networkingv1.NetworkPolicyPort{}, []networkingv1.NetworkPolicyPeer{})
+			Expect(err).To(Succeed())
 			Expect(sds).To(Equal(&AllPeerMatcher{}))
 		})
 
 		It("allows all ips and all pods over a specific port from an empty peer slice", func() {
-			sds := BuildPeerMatcher("abc", []networkingv1.NetworkPolicyPort{{
+			sds, err := BuildPeerMatcher("abc", []networkingv1.NetworkPolicyPort{{
 				Protocol: &sctp,
 				Port:     &port103,
 			}}, []networkingv1.NetworkPolicyPeer{})
@@ -206,37 +313,40 @@ func RunBuilderTests() {
 				Port:      portMatcher,
 			}
 			Expect(sds).To(Equal(&SpecificPeerMatcher{
-				IP:       NewSpecificIPMatcher(portMatcher),
-				Internal: NewSpecificInternalMatcher(matcher),
+				IP:       mustSpecificIPMatcher(portMatcher),
+				Internal: mustSpecificInternalMatcher(matcher),
 			}))
+			Expect(err).To(Succeed())
 		})
 
 		It("allows ips, but no pods from a single IPBlock", func() {
-			peer := BuildPeerMatcher("abc", []networkingv1.NetworkPolicyPort{}, []networkingv1.NetworkPolicyPeer{
+			peer, err := BuildPeerMatcher("abc", []networkingv1.NetworkPolicyPort{}, []networkingv1.NetworkPolicyPeer{
 				{
 					PodSelector:       nil,
 					NamespaceSelector: nil,
 					IPBlock:           netpol.IPBlock_10_0_0_1_24,
 				},
 			})
+			Expect(err).To(Succeed())
 			ip := &IPBlockMatcher{
 				IPBlock: netpol.IPBlock_10_0_0_1_24,
 				Port:    &AllPortMatcher{},
 			}
 			Expect(peer).To(Equal(&SpecificPeerMatcher{
-				IP:       NewSpecificIPMatcher(&NonePortMatcher{}, ip),
+				IP:       mustSpecificIPMatcher(&NonePortMatcher{}, ip),
 				Internal: &NoneInternalMatcher{},
 			}))
 		})
 
 		It("allows all ns/pods/ports, but no ips from a single peer with empty pod/ns selectors", func() {
-			peer := BuildPeerMatcher("abc", []networkingv1.NetworkPolicyPort{}, []networkingv1.NetworkPolicyPeer{
+			peer, err := BuildPeerMatcher("abc", []networkingv1.NetworkPolicyPort{}, []networkingv1.NetworkPolicyPeer{
 				{
 					PodSelector:       netpol.SelectorEmpty,
 					NamespaceSelector: netpol.SelectorEmpty,
 					IPBlock:           nil,
 				},
 			})
+			Expect(err).To(Succeed())
 			Expect(peer).To(Equal(&SpecificPeerMatcher{
 				IP:       &NoneIPMatcher{},
 				Internal: &AllInternalMatcher{},
@@ -244,13 +354,14 @@ func RunBuilderTests() {
 		})
 
 		It("allows ns/pods, but no ips from a single namespace/pod", func() {
-			peer := BuildPeerMatcher("abc", []networkingv1.NetworkPolicyPort{}, []networkingv1.NetworkPolicyPeer{
+			peer, err := BuildPeerMatcher("abc", []networkingv1.NetworkPolicyPort{}, []networkingv1.NetworkPolicyPeer{
 				{
 					PodSelector:       netpol.SelectorEmpty,
 					NamespaceSelector: nil,
 					IPBlock:           nil,
 				},
 			})
+			Expect(err).To(Succeed())
 			matcher := &NamespacePodMatcher{
 				Namespace: &ExactNamespaceMatcher{Namespace: "abc"},
 				Pod:       &AllPodMatcher{},
@@ -412,19 +523,22 @@ func RunBuilderTests() {
 
 	Describe("Port from NetworkPolicyPort", func() {
 		It("allows all ports and all protocols from an empty slice", func() {
-			pm := BuildPortMatcher([]networkingv1.NetworkPolicyPort{})
+			pm, err := BuildPortMatcher([]networkingv1.NetworkPolicyPort{})
+			Expect(err).To(Succeed())
 			Expect(pm).To(Equal(&AllPortMatcher{}))
 		})
 
 		It("allow all ports on protocol", func() {
-			pm := BuildPortMatcher([]networkingv1.NetworkPolicyPort{netpol.AllowAllPortsOnProtocol})
+			pm, err := BuildPortMatcher([]networkingv1.NetworkPolicyPort{netpol.AllowAllPortsOnProtocol})
+			Expect(err).To(Succeed())
 			Expect(pm).To(Equal(&SpecificPortMatcher{Ports: []*PortProtocolMatcher{{Port: nil, Protocol: v1.ProtocolSCTP}}}))
 		})
 
 		It("allow numbered port on protocol", func() {
 			portNumber := intstr.FromInt(9001)
-			pm := BuildPortMatcher([]networkingv1.NetworkPolicyPort{netpol.AllowNumberedPortOnProtocol})
-			Expect(pm).To(Equal(&SpecificPortMatcher{[]*PortProtocolMatcher{{
+			pm, err := BuildPortMatcher([]networkingv1.NetworkPolicyPort{netpol.AllowNumberedPortOnProtocol})
+			Expect(err).To(Succeed())
+			Expect(pm).To(Equal(&SpecificPortMatcher{Ports: []*PortProtocolMatcher{{
 				Protocol: v1.ProtocolTCP,
 				Port:     &portNumber,
 			}}}))
@@ -432,13 +546,47 @@ func RunBuilderTests() {
 
 		It("allow named port on protocol", func() {
 			portName := intstr.FromString("hello")
-			pm := BuildPortMatcher([]networkingv1.NetworkPolicyPort{netpol.AllowNamedPortOnProtocol})
-			Expect(pm).To(Equal(&SpecificPortMatcher{[]*PortProtocolMatcher{{
+			pm, err := BuildPortMatcher([]networkingv1.NetworkPolicyPort{netpol.AllowNamedPortOnProtocol})
+			Expect(err).To(Succeed())
+			Expect(pm).To(Equal(&SpecificPortMatcher{Ports: []*PortProtocolMatcher{{
 				Protocol: v1.ProtocolUDP,
 				Port:     &portName,
 			}}}))
 		})
 
+		It("allow port range on protocol", func() {
+			port32000 := intstr.FromInt(32000)
+			endPort := int32(32768)
+			pm, err := BuildPortMatcher([]networkingv1.NetworkPolicyPort{{Protocol: &tcp, Port: &port32000, EndPort: &endPort}})
+			Expect(err).To(Succeed())
+			Expect(pm).To(Equal(&SpecificPortMatcher{PortRanges: []*PortRangeMatcher{{
+				From:     32000,
+				To:       32768,
+				Protocol: v1.ProtocolTCP,
+			}}}))
+			Expect(pm.Allows(32000, "", tcp)).To(BeTrue())
+			Expect(pm.Allows(32500, "", tcp)).To(BeTrue())
+			Expect(pm.Allows(32768, "", tcp)).To(BeTrue())
+			Expect(pm.Allows(31999, "", tcp)).To(BeFalse())
+			Expect(pm.Allows(32769, "", tcp)).To(BeFalse())
+			Expect(pm.Allows(32500, "", udp)).To(BeFalse())
+		})
+
+		It("should combine port ranges correctly", func() {
+			range1 := &PortRangeMatcher{From: 80, To: 90, Protocol: v1.ProtocolTCP}
+			range2 := &PortRangeMatcher{From: 100, To: 110, Protocol: v1.ProtocolTCP}
+			port80OnTcp := &PortProtocolMatcher{Port: &port80, Protocol: v1.ProtocolTCP}
+
+			m1 := &SpecificPortMatcher{Ports: []*PortProtocolMatcher{port80OnTcp}, PortRanges: []*PortRangeMatcher{range1}}
+			m2 := &SpecificPortMatcher{PortRanges: []*PortRangeMatcher{range1, range2}}
+
+			Expect(CombinePortMatchers(m1, m2)).To(Equal(&SpecificPortMatcher{
+				Ports:      []*PortProtocolMatcher{port80OnTcp},
+				PortRanges: []*PortRangeMatcher{range1, range2},
+			}))
+			Expect(CombinePortMatchers(m1, m1)).To(Equal(m1))
+		})
+
 		It("should combine matchers correctly", func() {
 			port99 := intstr.FromInt(99)
 			allPortsOnSctp := &PortProtocolMatcher{
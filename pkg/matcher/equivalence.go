@@ -0,0 +1,565 @@
+package matcher
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"math/big"
+	"net"
+	"sort"
+	"strings"
+)
+
+// AreEquivalent decides whether two policies allow exactly the same traffic, over all possible
+// namespaces, labels, IPs, ports and protocols -- not just over a concrete set of pods.
+//
+// It works by partitioning each dimension of Traffic into regions which no matcher in either
+// policy can tell apart -- peers by namespace name, namespace labels and pod labels, splitting on
+// every target and peer label selector; IPs by the boundaries of every CIDR and except block; and
+// ports by protocol, numbered port and port range boundaries, and named ports -- and then checking
+// representative Traffic.  If the policies differ, the first Traffic found which is treated
+// differently is returned.
+//
+// Checking every pair of peers would cost (L*I)^2 * P evaluations, for L label regions -- up to
+// exponential in the number of distinct selectors -- I IP intervals and P port regions, which is
+// too slow for realistic policy sets.  Instead, since traffic is allowed if both its ingress and its
+// egress are, each direction is checked separately, over classes of peers: peers to which the same
+// targets and admin policies apply are indistinguishable as the pod a direction is decided for, and
+// peers in the same peer selector and IP regions are indistinguishable as its other end.  That costs
+// T * R * P evaluations per direction, for T target classes and R peer classes.  Only where a
+// direction differs are the pairs of peers of those classes checked in full -- since one direction's
+// difference may be hidden by the other direction denying the traffic.  So checking equivalent
+// policies stays cheap, while policies which differ widely may cost up to the pairwise bound.
+func AreEquivalent(a *Policy, b *Policy) (bool, *Traffic) {
+	collector := newSymbolCollector()
+	collector.addPolicy(a)
+	collector.addPolicy(b)
+
+	peers := collector.peers()
+	ports := collector.ports()
+	for _, isIngress := range []bool{true, false} {
+		if traffic := findDirectionDifference(a, b, peers, ports, isIngress); traffic != nil {
+			return false, traffic
+		}
+	}
+	return true, nil
+}
+
+// findDirectionDifference checks a direction for each class of subjects -- destinations for ingress, sources for
+// egress -- against each class of peers, and returns traffic which the policies treat differently, if any
+func findDirectionDifference(a *Policy, b *Policy, peers []*symbolPeer, ports []*portRepresentative, isIngress bool) *Traffic {
+	subjectClasses := groupSymbolPeers(peers, func(peer *symbolPeer) string {
+		return subjectClassKey(a, isIngress, peer.peer) + "\n" + subjectClassKey(b, isIngress, peer.peer)
+	})
+	peerClasses := groupSymbolPeers(peers, func(peer *symbolPeer) string {
+		return peer.class
+	})
+	for _, subjects := range subjectClasses {
+		for _, others := range peerClasses {
+			for _, port := range ports {
+				traffic := directionTraffic(subjects[0].peer, others[0].peer, port, isIngress)
+				if a.IsIngressOrEgressAllowed(traffic, isIngress).IsAllowed() == b.IsIngressOrEgressAllowed(traffic, isIngress).IsAllowed() {
+					continue
+				}
+				for _, subject := range subjects {
+					for _, other := range others {
+						traffic := directionTraffic(subject.peer, other.peer, port, isIngress)
+						if a.IsTrafficAllowed(traffic).IsAllowed() != b.IsTrafficAllowed(traffic).IsAllowed() {
+							return traffic
+						}
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func directionTraffic(subject *TrafficPeer, other *TrafficPeer, port *portRepresentative, isIngress bool) *Traffic {
+	traffic := &Traffic{ResolvedPort: port.port, ResolvedPortName: port.portName, Protocol: port.protocol}
+	if isIngress {
+		traffic.Source, traffic.Destination = other, subject
+	} else {
+		traffic.Source, traffic.Destination = subject, other
+	}
+	return traffic
+}
+
+// subjectClassKey identifies the targets and admin policies of a policy which apply to a peer: these are all a
+// direction's decision depends on, besides the other end of the traffic and the port
+func subjectClassKey(policy *Policy, isIngress bool, peer *TrafficPeer) string {
+	if peer.Internal == nil {
+		return "external"
+	}
+	internal := peer.Internal
+	var keys []string
+	for _, target := range policy.TargetsApplyingToPod(isIngress, internal.Namespace, internal.PodLabels) {
+		keys = append(keys, target.GetPrimaryKey())
+	}
+	sort.Strings(keys)
+	for i, adminPolicy := range policy.AdminPolicies {
+		if adminPolicy.Subject.Allows(internal.Namespace, internal.NamespaceLabels, internal.PodLabels) {
+			keys = append(keys, fmt.Sprintf("admin-%d", i))
+		}
+	}
+	if policy.BaselinePolicy != nil && policy.BaselinePolicy.Subject.Allows(internal.Namespace, internal.NamespaceLabels, internal.PodLabels) {
+		keys = append(keys, "baseline")
+	}
+	return strings.Join(keys, "\n")
+}
+
+// groupSymbolPeers groups peers by key, keeping the order in which classes and peers are first found
+func groupSymbolPeers(peers []*symbolPeer, key func(*symbolPeer) string) [][]*symbolPeer {
+	indexes := map[string]int{}
+	var classes [][]*symbolPeer
+	for _, peer := range peers {
+		k := key(peer)
+		index, ok := indexes[k]
+		if !ok {
+			index = len(classes)
+			indexes[k] = index
+			classes = append(classes, nil)
+		}
+		classes[index] = append(classes[index], peer)
+	}
+	return classes
+}
+
+// PolicyCIDRs returns the CIDRs and except blocks of every IP block peer of a policy, including those of its admin
+// policies.  IPs which are in the same of these CIDRs are indistinguishable to the policy.
+func PolicyCIDRs(policy *Policy) []string {
+	collector := newSymbolCollector()
+	collector.addPolicy(policy)
+	return collector.cidrs
+}
+
+const (
+	symbolNamespaceKey   = "namespace"
+	symbolNamespaceLabel = "namespace-label/"
+	symbolPodLabel       = "pod-label/"
+	// symbolAbsent can't collide with a label value, since label values can't contain spaces
+	symbolAbsent = "<absent>"
+)
+
+// symbolBox is a conjunction of constraints over symbols: a symbol maps to the set of its values
+// which are allowed.  Symbols missing from the box are unconstrained.
+type symbolBox map[string]map[string]bool
+
+func (b symbolBox) copy() symbolBox {
+	c := symbolBox{}
+	for key, vals := range b {
+		c[key] = vals
+	}
+	return c
+}
+
+type portRepresentative struct {
+	port     int
+	portName string
+	protocol v1.Protocol
+}
+
+type symbolCollector struct {
+	// values seen for each symbol; the namespace name is a symbol, as is each label key
+	values    map[string]map[string]bool
+	selectors []func(domains map[string][]string) symbolBox
+	// isPeerSelector is true for the selectors of peers, rather than of targets and admin policy subjects
+	isPeerSelector []bool
+	addingPeer     bool
+	cidrs          []string
+	portNames      map[string]bool
+	// numbered ports split the port space into intervals, starting at each boundary
+	portBoundaries map[int]bool
+}
+
+func newSymbolCollector() *symbolCollector {
+	return &symbolCollector{
+		values:         map[string]map[string]bool{symbolNamespaceKey: {}},
+		portNames:      map[string]bool{"": true},
+		portBoundaries: map[int]bool{1: true},
+	}
+}
+
+func (s *symbolCollector) addValue(key string, value string) {
+	if _, ok := s.values[key]; !ok {
+		s.values[key] = map[string]bool{}
+	}
+	s.values[key][value] = true
+}
+
+func (s *symbolCollector) addNamespace(namespace string) {
+	s.addValue(symbolNamespaceKey, namespace)
+	ns := namespace
+	s.selectors = append(s.selectors, func(domains map[string][]string) symbolBox {
+		return symbolBox{symbolNamespaceKey: {ns: true}}
+	})
+	s.isPeerSelector = append(s.isPeerSelector, s.addingPeer)
+}
+
+func (s *symbolCollector) addLabelSelector(prefix string, selector metav1.LabelSelector) {
+	for key, val := range selector.MatchLabels {
+		s.addValue(prefix+key, val)
+	}
+	for _, exp := range selector.MatchExpressions {
+		s.addValue(prefix+exp.Key, symbolAbsent)
+		for _, val := range exp.Values {
+			s.addValue(prefix+exp.Key, val)
+		}
+	}
+	s.selectors = append(s.selectors, func(domains map[string][]string) symbolBox {
+		return labelSelectorBox(prefix, selector, domains)
+	})
+	s.isPeerSelector = append(s.isPeerSelector, s.addingPeer)
+}
+
+func (s *symbolCollector) addPolicy(policy *Policy) {
+	for _, targets := range []map[string]*Target{policy.Ingress, policy.Egress} {
+		for _, target := range targets {
+			s.addNamespace(target.Namespace)
+			s.addLabelSelector(symbolPodLabel, target.PodSelector)
+			s.addPeerMatcher(target.Peer)
+		}
+	}
+	adminPolicies := policy.AdminPolicies
+	if policy.BaselinePolicy != nil {
+		adminPolicies = append(append([]*AdminPolicy{}, adminPolicies...), policy.BaselinePolicy)
+	}
+	for _, adminPolicy := range adminPolicies {
+		s.addNamespaceMatcher(adminPolicy.Subject.Namespace)
+		s.addPodMatcher(adminPolicy.Subject.Pod)
+		for _, rule := range append(append([]*AdminRule{}, adminPolicy.Ingress...), adminPolicy.Egress...) {
+			s.addPeerMatcher(rule.Peer)
+		}
+	}
+}
+
+func (s *symbolCollector) addNamespaceMatcher(namespace NamespaceMatcher) {
+	switch ns := namespace.(type) {
+	case *ExactNamespaceMatcher:
+		s.addNamespace(ns.Namespace)
+	case *LabelSelectorNamespaceMatcher:
+		s.addLabelSelector(symbolNamespaceLabel, ns.Selector)
+	}
+}
+
+func (s *symbolCollector) addPodMatcher(pod PodMatcher) {
+	if p, ok := pod.(*LabelSelectorPodMatcher); ok {
+		s.addLabelSelector(symbolPodLabel, p.Selector)
+	}
+}
+
+func (s *symbolCollector) addPeerMatcher(peer PeerMatcher) {
+	s.addingPeer = true
+	defer func() { s.addingPeer = false }()
+	switch p := peer.(type) {
+	case *AllPeerMatcher, *NonePeerMatcher:
+	case *SpecificPeerMatcher:
+		if ip, ok := p.IP.(*SpecificIPMatcher); ok {
+			s.addPortMatcher(ip.PortsForAllIPs)
+			for _, block := range ip.IPBlocks {
+				s.cidrs = append(s.cidrs, block.IPBlock.CIDR)
+				s.cidrs = append(s.cidrs, block.IPBlock.Except...)
+				s.addPortMatcher(block.Port)
+			}
+		}
+		if internal, ok := p.Internal.(*SpecificInternalMatcher); ok {
+			for _, nsPod := range internal.NamespacePods {
+				s.addNamespaceMatcher(nsPod.Namespace)
+				s.addPodMatcher(nsPod.Pod)
+				s.addPortMatcher(nsPod.Port)
+			}
+		}
+	default:
+		panic(errors.Errorf("invalid PeerMatcher type %T", peer))
+	}
+}
+
+func (s *symbolCollector) addPortMatcher(port PortMatcher) {
+	specific, ok := port.(*SpecificPortMatcher)
+	if !ok {
+		return
+	}
+	for _, pp := range specific.Ports {
+		if pp.Port == nil {
+			continue
+		}
+		switch pp.Port.Type {
+		case intstr.Int:
+			s.portBoundaries[int(pp.Port.IntVal)] = true
+			s.portBoundaries[int(pp.Port.IntVal)+1] = true
+		case intstr.String:
+			s.portNames[pp.Port.StrVal] = true
+		}
+	}
+	for _, portRange := range specific.PortRanges {
+		s.portBoundaries[portRange.From] = true
+		s.portBoundaries[portRange.To+1] = true
+	}
+}
+
+// domains adds a value to each symbol which is different from every value seen for it
+func (s *symbolCollector) domains() map[string][]string {
+	domains := map[string][]string{}
+	for key, vals := range s.values {
+		var domain []string
+		for val := range vals {
+			domain = append(domain, val)
+		}
+		domain = append(domain, freshValue(vals))
+		if key != symbolNamespaceKey && !vals[symbolAbsent] {
+			domain = append(domain, symbolAbsent)
+		}
+		sort.Strings(domain)
+		domains[key] = domain
+	}
+	return domains
+}
+
+func freshValue(vals map[string]bool) string {
+	fresh := "other"
+	for i := 2; vals[fresh]; i++ {
+		fresh = fmt.Sprintf("other-%d", i)
+	}
+	return fresh
+}
+
+// symbolPeer is a representative peer, and its class: peers of the same class are in the same regions of every
+// peer selector, and the same IP region, so that no peer matcher can tell them apart
+type symbolPeer struct {
+	peer  *TrafficPeer
+	class string
+}
+
+// peers returns a representative external peer for each IP region, and a representative internal
+// peer for each combination of namespace/pod region and IP region
+func (s *symbolCollector) peers() []*symbolPeer {
+	domains := s.domains()
+	regions := []symbolBox{{}}
+	var peerBoxes []symbolBox
+	for i, selector := range s.selectors {
+		box := selector(domains)
+		regions = splitBoxes(regions, box, domains)
+		if s.isPeerSelector[i] {
+			peerBoxes = append(peerBoxes, box)
+		}
+	}
+
+	ips := ipRepresentatives(s.cidrs)
+	var peers []*symbolPeer
+	for i, ip := range ips {
+		peers = append(peers, &symbolPeer{peer: &TrafficPeer{IP: ip}, class: fmt.Sprintf("external %d", i)})
+	}
+	for _, region := range regions {
+		values := boxValues(region, domains)
+		internal := valuesRepresentative(values)
+		class := &strings.Builder{}
+		for _, box := range peerBoxes {
+			if box.contains(values) {
+				class.WriteByte('1')
+			} else {
+				class.WriteByte('0')
+			}
+		}
+		for i, ip := range ips {
+			peers = append(peers, &symbolPeer{peer: &TrafficPeer{Internal: internal, IP: ip}, class: fmt.Sprintf("%s %d", class.String(), i)})
+		}
+	}
+	return peers
+}
+
+func (s *symbolCollector) ports() []*portRepresentative {
+	var boundaries []int
+	for boundary := range s.portBoundaries {
+		if boundary <= 65535 {
+			boundaries = append(boundaries, boundary)
+		}
+	}
+	sort.Ints(boundaries)
+	var names []string
+	for name := range s.portNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var ports []*portRepresentative
+	for _, protocol := range []v1.Protocol{v1.ProtocolTCP, v1.ProtocolUDP, v1.ProtocolSCTP} {
+		for _, port := range boundaries {
+			for _, name := range names {
+				ports = append(ports, &portRepresentative{port: port, portName: name, protocol: protocol})
+			}
+		}
+	}
+	return ports
+}
+
+// labelSelectorBox models a label selector as a box.  This must agree with kube.IsLabelsMatchLabelSelector.
+func labelSelectorBox(prefix string, selector metav1.LabelSelector, domains map[string][]string) symbolBox {
+	box := symbolBox{}
+	restrict := func(key string, allowed func(string) bool) {
+		vals := map[string]bool{}
+		for _, val := range domains[prefix+key] {
+			if allowed(val) && (box[prefix+key] == nil || box[prefix+key][val]) {
+				vals[val] = true
+			}
+		}
+		box[prefix+key] = vals
+	}
+	for key, value := range selector.MatchLabels {
+		v := value
+		// a missing key reads as "", so it matches an empty value
+		restrict(key, func(val string) bool { return val == v || (v == "" && val == symbolAbsent) })
+	}
+	for _, exp := range selector.MatchExpressions {
+		values := map[string]bool{}
+		for _, val := range exp.Values {
+			values[val] = true
+		}
+		switch exp.Operator {
+		case metav1.LabelSelectorOpIn:
+			restrict(exp.Key, func(val string) bool { return values[val] })
+		case metav1.LabelSelectorOpNotIn:
+			restrict(exp.Key, func(val string) bool { return val != symbolAbsent && !values[val] })
+		case metav1.LabelSelectorOpExists:
+			restrict(exp.Key, func(val string) bool { return val != symbolAbsent })
+		case metav1.LabelSelectorOpDoesNotExist:
+			restrict(exp.Key, func(val string) bool { return val == symbolAbsent })
+		default:
+			panic(errors.Errorf("invalid operator %s", exp.Operator))
+		}
+	}
+	return box
+}
+
+// splitBoxes refines each region into the part inside the selector box and the parts outside of it,
+// dropping empty parts
+func splitBoxes(regions []symbolBox, selector symbolBox, domains map[string][]string) []symbolBox {
+	var keys []string
+	for key := range selector {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var split []symbolBox
+	for _, region := range regions {
+		// region minus selector: for each key in turn, take the values outside of the selector,
+		//   having constrained all previous keys to be inside of it
+		inside := region.copy()
+		isInsideEmpty := false
+		for _, key := range keys {
+			in, out := map[string]bool{}, map[string]bool{}
+			for _, val := range domains[key] {
+				if vals, ok := region[key]; ok && !vals[val] {
+					continue
+				}
+				if selector[key][val] {
+					in[val] = true
+				} else {
+					out[val] = true
+				}
+			}
+			if len(out) > 0 {
+				outside := inside.copy()
+				outside[key] = out
+				split = append(split, outside)
+			}
+			if len(in) == 0 {
+				isInsideEmpty = true
+				break
+			}
+			inside[key] = in
+		}
+		if !isInsideEmpty {
+			split = append(split, inside)
+		}
+	}
+	return split
+}
+
+// boxValues picks the smallest allowed value of each symbol of a region
+func boxValues(region symbolBox, domains map[string][]string) map[string]string {
+	values := map[string]string{}
+	for key, domain := range domains {
+		for _, val := range domain {
+			if vals, ok := region[key]; !ok || vals[val] {
+				values[key] = val
+				break
+			}
+		}
+	}
+	return values
+}
+
+// contains checks whether a point -- a value for every symbol -- is in the box
+func (b symbolBox) contains(values map[string]string) bool {
+	for key, vals := range b {
+		if !vals[values[key]] {
+			return false
+		}
+	}
+	return true
+}
+
+// valuesRepresentative builds a peer from a value of each symbol
+func valuesRepresentative(values map[string]string) *InternalPeer {
+	peer := &InternalPeer{NamespaceLabels: map[string]string{}, PodLabels: map[string]string{}}
+	for key, value := range values {
+		switch {
+		case key == symbolNamespaceKey:
+			peer.Namespace = value
+		case value == symbolAbsent:
+		case strings.HasPrefix(key, symbolNamespaceLabel):
+			peer.NamespaceLabels[strings.TrimPrefix(key, symbolNamespaceLabel)] = value
+		case strings.HasPrefix(key, symbolPodLabel):
+			peer.PodLabels[strings.TrimPrefix(key, symbolPodLabel)] = value
+		}
+	}
+	return peer
+}
+
+// ipRepresentatives splits the IPv4 space -- and the IPv6 space, if any IPv6 CIDRs are present --
+// into intervals at the start and end of every CIDR, and picks the first IP of each interval
+func ipRepresentatives(cidrs []string) []string {
+	boundaries := map[int]map[string]*big.Int{
+		net.IPv4len: {"0": big.NewInt(0)},
+	}
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(errors.Wrapf(err, "unable to parse CIDR '%s'", cidr))
+		}
+		ip := ipNet.IP
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+		}
+		size := len(ip)
+		if _, ok := boundaries[size]; !ok {
+			boundaries[size] = map[string]*big.Int{"0": big.NewInt(0)}
+		}
+		start := new(big.Int).SetBytes(ip)
+		ones, bits := ipNet.Mask.Size()
+		end := new(big.Int).Add(start, new(big.Int).Lsh(big.NewInt(1), uint(bits-ones)))
+		boundaries[size][start.String()] = start
+		if end.BitLen() <= size*8 {
+			boundaries[size][end.String()] = end
+		}
+	}
+
+	var ips []string
+	for _, size := range []int{net.IPv4len, net.IPv6len} {
+		var starts []*big.Int
+		for _, start := range boundaries[size] {
+			starts = append(starts, start)
+		}
+		sort.Slice(starts, func(i, j int) bool {
+			return starts[i].Cmp(starts[j]) < 0
+		})
+		for _, start := range starts {
+			ip := make(net.IP, size)
+			start.FillBytes(ip)
+			ips = append(ips, ip.String())
+		}
+	}
+	return ips
+}
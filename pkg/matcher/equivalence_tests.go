@@ -0,0 +1,183 @@
+package matcher
+
+import (
+	"github.com/mattfenwick/cyclonus/pkg/kube/netpol"
+	"github.com/mattfenwick/cyclonus/pkg/utils"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	networkingv1 "k8s.io/api/networking/v1"
+	"sigs.k8s.io/yaml"
+)
+
+func mustParsePolicies(yamls ...string) []*networkingv1.NetworkPolicy {
+	var policies []*networkingv1.NetworkPolicy
+	for _, policyYaml := range yamls {
+		var kubePolicy *networkingv1.NetworkPolicy
+		utils.DoOrDie(yaml.Unmarshal([]byte(policyYaml), &kubePolicy))
+		policies = append(policies, kubePolicy)
+	}
+	return policies
+}
+
+func RunEquivalenceTests() {
+	Describe("Policy equivalence", func() {
+		It("should find a policy set equivalent to itself", func() {
+			policy := BuildNetworkPolicies(netpol.AllExamples)
+			isEquivalent, traffic := AreEquivalent(policy, BuildNetworkPolicies(netpol.AllExamples))
+			Expect(isEquivalent).To(BeTrue())
+			Expect(traffic).To(BeNil())
+		})
+
+		It("should find match labels and an In expression equivalent", func() {
+			a := BuildNetworkPolicies(mustParsePolicies(`
+metadata: {name: a, namespace: x}
+spec:
+  podSelector: {matchLabels: {pod: a}}
+  ingress:
+  - from:
+    - podSelector: {matchLabels: {app: web}}
+  policyTypes: [Ingress]`))
+			b := BuildNetworkPolicies(mustParsePolicies(`
+metadata: {name: b, namespace: x}
+spec:
+  podSelector: {matchExpressions: [{key: pod, operator: In, values: [a]}]}
+  ingress:
+  - from:
+    - podSelector: {matchExpressions: [{key: app, operator: In, values: [web]}]}
+  policyTypes: [Ingress]`))
+			isEquivalent, _ := AreEquivalent(a, b)
+			Expect(isEquivalent).To(BeTrue())
+		})
+
+		It("should find split rules and split CIDRs equivalent", func() {
+			a := BuildNetworkPolicies(mustParsePolicies(`
+metadata: {name: a, namespace: x}
+spec:
+  podSelector: {}
+  egress:
+  - to:
+    - ipBlock: {cidr: 10.0.0.0/24}
+    - namespaceSelector: {matchLabels: {ns: y}}
+  policyTypes: [Egress]`))
+			b := BuildNetworkPolicies(mustParsePolicies(`
+metadata: {name: b1, namespace: x}
+spec:
+  podSelector: {}
+  egress:
+  - to:
+    - ipBlock: {cidr: 10.0.0.0/25}
+  - to:
+    - ipBlock: {cidr: 10.0.0.128/25}
+  policyTypes: [Egress]`, `
+metadata: {name: b2, namespace: x}
+spec:
+  podSelector: {}
+  egress:
+  - to:
+    - namespaceSelector: {matchLabels: {ns: y}}
+  policyTypes: [Egress]`))
+			isEquivalent, _ := AreEquivalent(a, b)
+			Expect(isEquivalent).To(BeTrue())
+		})
+
+		It("should find a counterexample for an except block", func() {
+			a := BuildNetworkPolicies(mustParsePolicies(`
+metadata: {name: a, namespace: x}
+spec:
+  podSelector: {}
+  ingress:
+  - from:
+    - ipBlock: {cidr: 10.0.0.0/24}
+  policyTypes: [Ingress]`))
+			b := BuildNetworkPolicies(mustParsePolicies(`
+metadata: {name: b, namespace: x}
+spec:
+  podSelector: {}
+  ingress:
+  - from:
+    - ipBlock: {cidr: 10.0.0.0/24, except: [10.0.0.8/30]}
+  policyTypes: [Ingress]`))
+			isEquivalent, traffic := AreEquivalent(a, b)
+			Expect(isEquivalent).To(BeFalse())
+			Expect(traffic.Source.IP).To(Equal("10.0.0.8"))
+			Expect(traffic.Destination.Namespace()).To(Equal("x"))
+			Expect(a.IsTrafficAllowed(traffic).IsAllowed()).To(BeTrue())
+			Expect(b.IsTrafficAllowed(traffic).IsAllowed()).To(BeFalse())
+		})
+
+		It("should find a counterexample for a port range", func() {
+			a := BuildNetworkPolicies(mustParsePolicies(`
+metadata: {name: a, namespace: x}
+spec:
+  podSelector: {}
+  ingress:
+  - ports:
+    - {port: 80, protocol: TCP}
+  policyTypes: [Ingress]`))
+			b := BuildNetworkPolicies(mustParsePolicies(`
+metadata: {name: b, namespace: x}
+spec:
+  podSelector: {}
+  ingress:
+  - ports:
+    - {port: 80, endPort: 81, protocol: TCP}
+  policyTypes: [Ingress]`))
+			isEquivalent, traffic := AreEquivalent(a, b)
+			Expect(isEquivalent).To(BeFalse())
+			Expect(traffic.ResolvedPort).To(Equal(81))
+		})
+
+		It("should find a counterexample for a namespace label selector", func() {
+			a := BuildNetworkPolicies(mustParsePolicies(`
+metadata: {name: a, namespace: x}
+spec:
+  podSelector: {}
+  ingress:
+  - from:
+    - namespaceSelector: {matchExpressions: [{key: team, operator: NotIn, values: [red]}]}
+  policyTypes: [Ingress]`))
+			b := BuildNetworkPolicies(mustParsePolicies(`
+metadata: {name: b, namespace: x}
+spec:
+  podSelector: {}
+  ingress:
+  - from:
+    - namespaceSelector: {matchLabels: {team: blue}}
+  policyTypes: [Ingress]`))
+			isEquivalent, traffic := AreEquivalent(a, b)
+			Expect(isEquivalent).To(BeFalse())
+			Expect(traffic.Source.Internal.NamespaceLabels["team"]).To(Equal("other"))
+		})
+
+		It("should find policies equivalent if an ingress difference is hidden by denied egress", func() {
+			denyEgress := []string{`
+metadata: {name: deny-unlabelled, namespace: x}
+spec:
+  podSelector: {matchExpressions: [{key: app, operator: DoesNotExist}]}
+  policyTypes: [Egress]`, `
+metadata: {name: deny-not-web, namespace: x}
+spec:
+  podSelector: {matchExpressions: [{key: app, operator: NotIn, values: [web]}]}
+  policyTypes: [Egress]`}
+			a := BuildNetworkPolicies(mustParsePolicies(append(denyEgress, `
+metadata: {name: a, namespace: x}
+spec:
+  podSelector: {}
+  ingress:
+  - from:
+    - podSelector: {matchLabels: {app: web}}
+  policyTypes: [Ingress]`)...))
+			b := BuildNetworkPolicies(mustParsePolicies(append(denyEgress, `
+metadata: {name: b, namespace: x}
+spec:
+  podSelector: {}
+  ingress:
+  - from:
+    - podSelector: {}
+  policyTypes: [Ingress]`)...))
+			isEquivalent, traffic := AreEquivalent(a, b)
+			Expect(isEquivalent).To(BeTrue())
+			Expect(traffic).To(BeNil())
+		})
+	})
+}
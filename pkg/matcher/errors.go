@@ -0,0 +1,49 @@
+package matcher
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// PolicyError is a problem with a NetworkPolicy which keeps it from being built
+type PolicyError struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// Field is the path to the invalid field, in the style of 'spec.ingress[0].from[1]'
+	Field  string                      `json:"field"`
+	Reason string                      `json:"reason"`
+	Policy *networkingv1.NetworkPolicy `json:"-"`
+}
+
+func (e *PolicyError) Error() string {
+	return fmt.Sprintf("invalid network policy %s/%s: %s: %s", e.Namespace, e.Name, e.Field, e.Reason)
+}
+
+// newPolicyError creates an error for a field; the policy is filled in by BuildTarget
+func newPolicyError(field fmt.Stringer, reason string, args ...interface{}) *PolicyError {
+	return &PolicyError{Field: field.String(), Reason: fmt.Sprintf(reason, args...)}
+}
+
+// ValidationPolicyErrors converts the problems which the API server would reject a policy for into errors
+func ValidationPolicyErrors(policy *networkingv1.NetworkPolicy, errs field.ErrorList) []*PolicyError {
+	var policyErrors []*PolicyError
+	for _, err := range errs {
+		policyErrors = append(policyErrors, asPolicyError(policy, &PolicyError{Field: err.Field, Reason: err.ErrorBody()}))
+	}
+	return policyErrors
+}
+
+// asPolicyError attaches a policy to an error from building it; errors which aren't about a particular
+// field, such as from combining matchers, are attributed to the whole spec
+func asPolicyError(policy *networkingv1.NetworkPolicy, err error) *PolicyError {
+	var policyError *PolicyError
+	if !errors.As(err, &policyError) {
+		policyError = &PolicyError{Field: "spec", Reason: err.Error()}
+	}
+	policyError.Namespace = policy.Namespace
+	policyError.Name = policy.Name
+	policyError.Policy = policy
+	return policyError
+}
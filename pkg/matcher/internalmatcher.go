@@ -11,28 +11,37 @@ type InternalMatcher interface {
 	Allows(peer *InternalPeer, portInt int, portName string, protocol v1.Protocol) bool
 }
 
-func CombineInternalMatchers(a InternalMatcher, b InternalMatcher) InternalMatcher {
+func CombineInternalMatchers(a InternalMatcher, b InternalMatcher) (InternalMatcher, error) {
 	switch l := a.(type) {
 	case *AllInternalMatcher:
-		return a
+		if r, ok := b.(*AllInternalMatcher); ok {
+			return &AllInternalMatcher{Sources: combineRuleSources(l.Sources, r.Sources)}, nil
+		}
+		return a, nil
 	case *NoneInternalMatcher:
-		return b
+		return b, nil
 	case *SpecificInternalMatcher:
 		switch r := b.(type) {
 		case *AllInternalMatcher:
-			return b
+			return b, nil
 		case *NoneInternalMatcher:
-			return a
+			return a, nil
 		case *SpecificInternalMatcher:
+			combined, err := NewSpecificInternalMatcher(l.SortedNamespacePods()...)
+			if err != nil {
+				return nil, err
+			}
 			for _, val := range r.NamespacePods {
-				l.Add(val)
+				if err := combined.Add(val); err != nil {
+					return nil, err
+				}
 			}
-			return l
+			return combined, nil
 		default:
-			panic(errors.Errorf("invalid InternalMatcher type %T", b))
+			return nil, errors.Errorf("invalid InternalMatcher type %T", b)
 		}
 	default:
-		panic(errors.Errorf("invalid InternalMatcher type %T", a))
+		return nil, errors.Errorf("invalid InternalMatcher type %T", a)
 	}
 }
 
@@ -50,7 +59,9 @@ func (n *NoneInternalMatcher) MarshalJSON() (b []byte, e error) {
 	})
 }
 
-type AllInternalMatcher struct{}
+type AllInternalMatcher struct {
+	Sources []*RuleSource
+}
 
 func (a *AllInternalMatcher) Allows(peer *InternalPeer, portInt int, portName string, protocol v1.Protocol) bool {
 	return true
@@ -66,12 +77,14 @@ type SpecificInternalMatcher struct {
 	NamespacePods map[string]*NamespacePodMatcher
 }
 
-func NewSpecificInternalMatcher(matchers ...*NamespacePodMatcher) *SpecificInternalMatcher {
+func NewSpecificInternalMatcher(matchers ...*NamespacePodMatcher) (*SpecificInternalMatcher, error) {
 	sim := &SpecificInternalMatcher{NamespacePods: map[string]*NamespacePodMatcher{}}
 	for _, matcher := range matchers {
-		sim.Add(matcher)
+		if err := sim.Add(matcher); err != nil {
+			return nil, err
+		}
 	}
-	return sim
+	return sim, nil
 }
 
 func (a *SpecificInternalMatcher) SortedNamespacePods() []*NamespacePodMatcher {
@@ -97,15 +110,20 @@ func (a *SpecificInternalMatcher) Allows(peer *InternalPeer, portInt int, portNa
 func (a *SpecificInternalMatcher) MarshalJSON() (b []byte, e error) {
 	return json.Marshal(map[string]interface{}{
 		"Type":          "specific internal",
-		"NamespacePods": a.NamespacePods,
+		"NamespacePods": a.SortedNamespacePods(),
 	})
 }
 
-func (a *SpecificInternalMatcher) Add(newMatcher *NamespacePodMatcher) {
+func (a *SpecificInternalMatcher) Add(newMatcher *NamespacePodMatcher) error {
 	key := newMatcher.PrimaryKey()
 	if oldMatcher, ok := a.NamespacePods[key]; ok {
-		a.NamespacePods[key] = oldMatcher.Combine(newMatcher.Port)
+		combined, err := oldMatcher.Combine(newMatcher)
+		if err != nil {
+			return err
+		}
+		a.NamespacePods[key] = combined
 	} else {
 		a.NamespacePods[key] = newMatcher
 	}
+	return nil
 }
@@ -16,6 +16,7 @@ import (
 type IPBlockMatcher struct {
 	IPBlock *networkingv1.IPBlock
 	Port    PortMatcher
+	Sources []*RuleSource
 }
 
 // PrimaryKey returns a content-based, deterministic key based on the IPBlock's
@@ -42,7 +43,12 @@ func (i *IPBlockMatcher) MarshalJSON() (b []byte, e error) {
 }
 
 func (i *IPBlockMatcher) Allows(ip string, portInt int, portName string, protocol v1.Protocol) bool {
+	// pods which haven't been created -- such as those derived from manifests -- have no IP to match
+	if ip == "" {
+		return false
+	}
 	isIpMatch, err := kube.IsIPAddressMatchForIPBlock(ip, i.IPBlock)
+	// policies are validated before they're built, so their CIDRs parse: this can only be a bad traffic IP
 	// TODO propagate this error instead of panic
 	if err != nil {
 		panic(err)
@@ -50,12 +56,17 @@ func (i *IPBlockMatcher) Allows(ip string, portInt int, portName string, protoco
 	return isIpMatch && i.Port.Allows(portInt, portName, protocol)
 }
 
-func (i *IPBlockMatcher) Combine(other *IPBlockMatcher) *IPBlockMatcher {
+func (i *IPBlockMatcher) Combine(other *IPBlockMatcher) (*IPBlockMatcher, error) {
 	if i.PrimaryKey() != other.PrimaryKey() {
-		panic(errors.Errorf("unable to combine IPBlockMatcher values with different primary keys: %s vs %s", i.PrimaryKey(), other.PrimaryKey()))
+		return nil, errors.Errorf("unable to combine IPBlockMatcher values with different primary keys: %s vs %s", i.PrimaryKey(), other.PrimaryKey())
+	}
+	port, err := CombinePortMatchers(i.Port, other.Port)
+	if err != nil {
+		return nil, err
 	}
 	return &IPBlockMatcher{
 		IPBlock: i.IPBlock,
-		Port:    CombinePortMatchers(i.Port, other.Port),
-	}
+		Port:    port,
+		Sources: combineRuleSources(i.Sources, other.Sources),
+	}, nil
 }
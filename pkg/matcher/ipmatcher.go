@@ -11,30 +11,35 @@ type IPMatcher interface {
 	Allows(ip string, portInt int, portName string, protocol v1.Protocol) bool
 }
 
-func CombineIPMatchers(a IPMatcher, b IPMatcher) IPMatcher {
+func CombineIPMatchers(a IPMatcher, b IPMatcher) (IPMatcher, error) {
 	switch l := a.(type) {
 	case *AllIPMatcher:
-		return a
+		if r, ok := b.(*AllIPMatcher); ok {
+			return &AllIPMatcher{Sources: combineRuleSources(l.Sources, r.Sources)}, nil
+		}
+		return a, nil
 	case *NoneIPMatcher:
-		return b
+		return b, nil
 	case *SpecificIPMatcher:
 		switch r := b.(type) {
 		case *AllIPMatcher:
-			return b
+			return b, nil
 		case *NoneIPMatcher:
-			return a
+			return a, nil
 		case *SpecificIPMatcher:
 			return l.Combine(r)
 		default:
-			panic(errors.Errorf("invalid IPMatcher type %T", b))
+			return nil, errors.Errorf("invalid IPMatcher type %T", b)
 		}
 	default:
-		panic(errors.Errorf("invalid IPMatcher type %T", a))
+		return nil, errors.Errorf("invalid IPMatcher type %T", a)
 	}
 }
 
 // TODO why have this?  it's not used anywhere ... is there a way to write a NetworkPolicy that would actually need this?
-type AllIPMatcher struct{}
+type AllIPMatcher struct {
+	Sources []*RuleSource
+}
 
 func (aip *AllIPMatcher) Allows(ip string, portInt int, portName string, protocol v1.Protocol) bool {
 	return true
@@ -63,15 +68,17 @@ type SpecificIPMatcher struct {
 	IPBlocks       map[string]*IPBlockMatcher
 }
 
-func NewSpecificIPMatcher(portsForAllIPs PortMatcher, blocks ...*IPBlockMatcher) *SpecificIPMatcher {
+func NewSpecificIPMatcher(portsForAllIPs PortMatcher, blocks ...*IPBlockMatcher) (*SpecificIPMatcher, error) {
 	sip := &SpecificIPMatcher{
 		PortsForAllIPs: portsForAllIPs,
 		IPBlocks:       map[string]*IPBlockMatcher{},
 	}
 	for _, block := range blocks {
-		sip.AddIPMatcher(block)
+		if err := sip.AddIPMatcher(block); err != nil {
+			return nil, err
+		}
 	}
-	return sip
+	return sip, nil
 }
 
 func (sip *SpecificIPMatcher) SortedIPBlocks() []*IPBlockMatcher {
@@ -101,32 +108,45 @@ func (sip *SpecificIPMatcher) MarshalJSON() (b []byte, e error) {
 	return json.Marshal(map[string]interface{}{
 		"Type":           "Specific IPs",
 		"PortsForAllIPs": sip.PortsForAllIPs,
-		"IPBlocks":       sip.IPBlocks,
+		"IPBlocks":       sip.SortedIPBlocks(),
 	})
 }
 
-func (sip *SpecificIPMatcher) Combine(other *SpecificIPMatcher) *SpecificIPMatcher {
+func (sip *SpecificIPMatcher) Combine(other *SpecificIPMatcher) (*SpecificIPMatcher, error) {
 	ipMatchers := map[string]*IPBlockMatcher{}
 	for key, ip := range sip.IPBlocks {
 		ipMatchers[key] = ip
 	}
 	for key, ip := range other.IPBlocks {
 		if matcher, ok := ipMatchers[key]; ok {
-			ipMatchers[key] = matcher.Combine(ip)
+			combined, err := matcher.Combine(ip)
+			if err != nil {
+				return nil, err
+			}
+			ipMatchers[key] = combined
 		} else {
 			ipMatchers[key] = ip
 		}
 	}
+	portsForAllIPs, err := CombinePortMatchers(sip.PortsForAllIPs, other.PortsForAllIPs)
+	if err != nil {
+		return nil, err
+	}
 	return &SpecificIPMatcher{
-		PortsForAllIPs: CombinePortMatchers(sip.PortsForAllIPs, other.PortsForAllIPs),
-		IPBlocks:       ipMatchers}
+		PortsForAllIPs: portsForAllIPs,
+		IPBlocks:       ipMatchers}, nil
 }
 
-func (sip *SpecificIPMatcher) AddIPMatcher(ip *IPBlockMatcher) {
+func (sip *SpecificIPMatcher) AddIPMatcher(ip *IPBlockMatcher) error {
 	key := ip.PrimaryKey()
 	if matcher, ok := sip.IPBlocks[key]; ok {
-		sip.IPBlocks[key] = matcher.Combine(ip)
+		combined, err := matcher.Combine(ip)
+		if err != nil {
+			return err
+		}
+		sip.IPBlocks[key] = combined
 	} else {
 		sip.IPBlocks[key] = ip
 	}
+	return nil
 }
@@ -0,0 +1,194 @@
+package matcher
+
+import (
+	"fmt"
+	"github.com/mattfenwick/cyclonus/pkg/utils"
+	"github.com/pkg/errors"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// ToNetworkPolicies is the inverse of BuildNetworkPolicies: it creates one NetworkPolicy per target
+// namespace + pod selector, covering both ingress and egress, which allows exactly the traffic
+// allowed by the Policy.  Peers with the same ports are grouped into a single rule.
+// A policy is named after its source rule, if there's only one; otherwise it's named 'simplified-<n>'.
+// Admin policies are not converted.
+func ToNetworkPolicies(policy *Policy) ([]*networkingv1.NetworkPolicy, error) {
+	var netpols []*networkingv1.NetworkPolicy
+	netpolsByKey := map[string]*networkingv1.NetworkPolicy{}
+	sourceNames := map[string]map[string]bool{}
+	getNetpol := func(target *Target) *networkingv1.NetworkPolicy {
+		pk := target.GetPrimaryKey()
+		if _, ok := netpolsByKey[pk]; !ok {
+			netpol := &networkingv1.NetworkPolicy{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "networking.k8s.io/v1", Kind: "NetworkPolicy"},
+				ObjectMeta: metav1.ObjectMeta{Namespace: target.Namespace},
+				Spec:       networkingv1.NetworkPolicySpec{PodSelector: target.PodSelector},
+			}
+			netpolsByKey[pk] = netpol
+			sourceNames[pk] = map[string]bool{}
+			netpols = append(netpols, netpol)
+		}
+		for _, rule := range target.SourceRules {
+			sourceNames[pk][rule.Name] = true
+		}
+		return netpolsByKey[pk]
+	}
+
+	ingress, egress := policy.SortedTargets()
+	for _, target := range ingress {
+		rules, err := peerMatcherToRules(target.Namespace, target.Peer)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "unable to convert ingress target %s", target.GetPrimaryKey())
+		}
+		netpol := getNetpol(target)
+		netpol.Spec.PolicyTypes = append(netpol.Spec.PolicyTypes, networkingv1.PolicyTypeIngress)
+		for _, rule := range rules {
+			netpol.Spec.Ingress = append(netpol.Spec.Ingress, networkingv1.NetworkPolicyIngressRule{Ports: rule.Ports, From: rule.Peers})
+		}
+	}
+	for _, target := range egress {
+		rules, err := peerMatcherToRules(target.Namespace, target.Peer)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "unable to convert egress target %s", target.GetPrimaryKey())
+		}
+		netpol := getNetpol(target)
+		netpol.Spec.PolicyTypes = append(netpol.Spec.PolicyTypes, networkingv1.PolicyTypeEgress)
+		for _, rule := range rules {
+			netpol.Spec.Egress = append(netpol.Spec.Egress, networkingv1.NetworkPolicyEgressRule{Ports: rule.Ports, To: rule.Peers})
+		}
+	}
+
+	counts := map[string]int{}
+	for pk, netpol := range netpolsByKey {
+		if len(sourceNames[pk]) == 1 {
+			for name := range sourceNames[pk] {
+				netpol.Name = name
+			}
+		}
+	}
+	for _, netpol := range netpols {
+		if netpol.Name == "" {
+			counts[netpol.Namespace]++
+			netpol.Name = fmt.Sprintf("simplified-%d", counts[netpol.Namespace])
+		}
+	}
+	return netpols, nil
+}
+
+type netpolRule struct {
+	Ports []networkingv1.NetworkPolicyPort
+	Peers []networkingv1.NetworkPolicyPeer
+}
+
+func peerMatcherToRules(namespace string, peer PeerMatcher) ([]*netpolRule, error) {
+	switch p := peer.(type) {
+	case *NonePeerMatcher:
+		return nil, nil
+	case *AllPeerMatcher:
+		return []*netpolRule{{}}, nil
+	case *SpecificPeerMatcher:
+		var rules []*netpolRule
+		rulesByPorts := map[string]*netpolRule{}
+		addPeer := func(port PortMatcher, netpolPeer *networkingv1.NetworkPolicyPeer) {
+			if _, ok := port.(*NonePortMatcher); ok {
+				return
+			}
+			ports := portMatcherToNetpolPorts(port)
+			key := utils.JsonString(ports)
+			if _, ok := rulesByPorts[key]; !ok {
+				rulesByPorts[key] = &netpolRule{Ports: ports}
+				rules = append(rules, rulesByPorts[key])
+			}
+			if netpolPeer != nil {
+				rulesByPorts[key].Peers = append(rulesByPorts[key].Peers, *netpolPeer)
+			}
+		}
+
+		switch ip := p.IP.(type) {
+		case *NoneIPMatcher:
+		case *AllIPMatcher:
+			addPeer(&AllPortMatcher{}, &networkingv1.NetworkPolicyPeer{IPBlock: &networkingv1.IPBlock{CIDR: "0.0.0.0/0"}})
+			addPeer(&AllPortMatcher{}, &networkingv1.NetworkPolicyPeer{IPBlock: &networkingv1.IPBlock{CIDR: "::/0"}})
+		case *SpecificIPMatcher:
+			// a rule with ports but no peers allows those ports for all IPs -- which includes all pods
+			if _, ok := ip.PortsForAllIPs.(*NonePortMatcher); !ok {
+				rules = append(rules, &netpolRule{Ports: portMatcherToNetpolPorts(ip.PortsForAllIPs)})
+			}
+			for _, block := range ip.SortedIPBlocks() {
+				addPeer(block.Port, &networkingv1.NetworkPolicyPeer{IPBlock: block.IPBlock})
+			}
+		default:
+			return nil, errors.Errorf("invalid IPMatcher type %T", p.IP)
+		}
+
+		switch internal := p.Internal.(type) {
+		case *NoneInternalMatcher:
+		case *AllInternalMatcher:
+			addPeer(&AllPortMatcher{}, &networkingv1.NetworkPolicyPeer{NamespaceSelector: &metav1.LabelSelector{}})
+		case *SpecificInternalMatcher:
+			for _, nsPod := range internal.SortedNamespacePods() {
+				netpolPeer, err := namespacePodMatcherToNetpolPeer(namespace, nsPod)
+				if err != nil {
+					return nil, err
+				}
+				addPeer(nsPod.Port, netpolPeer)
+			}
+		default:
+			return nil, errors.Errorf("invalid InternalMatcher type %T", p.Internal)
+		}
+		return rules, nil
+	default:
+		return nil, errors.Errorf("invalid PeerMatcher type %T", peer)
+	}
+}
+
+func namespacePodMatcherToNetpolPeer(namespace string, nsPod *NamespacePodMatcher) (*networkingv1.NetworkPolicyPeer, error) {
+	peer := &networkingv1.NetworkPolicyPeer{}
+	switch ns := nsPod.Namespace.(type) {
+	case *ExactNamespaceMatcher:
+		if ns.Namespace != namespace {
+			return nil, errors.Errorf("unable to select namespace %s from a policy in namespace %s", ns.Namespace, namespace)
+		}
+	case *LabelSelectorNamespaceMatcher:
+		selector := ns.Selector
+		peer.NamespaceSelector = &selector
+	case *AllNamespaceMatcher:
+		peer.NamespaceSelector = &metav1.LabelSelector{}
+	default:
+		return nil, errors.Errorf("invalid NamespaceMatcher type %T", nsPod.Namespace)
+	}
+	switch pod := nsPod.Pod.(type) {
+	case *AllPodMatcher:
+		if peer.NamespaceSelector == nil {
+			peer.PodSelector = &metav1.LabelSelector{}
+		}
+	case *LabelSelectorPodMatcher:
+		selector := pod.Selector
+		peer.PodSelector = &selector
+	default:
+		return nil, errors.Errorf("invalid PodMatcher type %T", nsPod.Pod)
+	}
+	return peer, nil
+}
+
+// portMatcherToNetpolPorts returns nil for all ports
+func portMatcherToNetpolPorts(port PortMatcher) []networkingv1.NetworkPolicyPort {
+	specific, ok := port.(*SpecificPortMatcher)
+	if !ok {
+		return nil
+	}
+	var ports []networkingv1.NetworkPolicyPort
+	for _, pp := range specific.Ports {
+		protocol := pp.Protocol
+		ports = append(ports, networkingv1.NetworkPolicyPort{Protocol: &protocol, Port: pp.Port})
+	}
+	for _, portRange := range specific.PortRanges {
+		protocol := portRange.Protocol
+		from := intstr.FromInt(portRange.From)
+		endPort := int32(portRange.To)
+		ports = append(ports, networkingv1.NetworkPolicyPort{Protocol: &protocol, Port: &from, EndPort: &endPort})
+	}
+	return ports
+}
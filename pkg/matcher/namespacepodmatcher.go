@@ -12,6 +12,7 @@ type NamespacePodMatcher struct {
 	Namespace NamespaceMatcher
 	Pod       PodMatcher
 	Port      PortMatcher
+	Sources   []*RuleSource `json:"-"`
 }
 
 func (ppm *NamespacePodMatcher) PrimaryKey() string {
@@ -24,12 +25,19 @@ func (ppm *NamespacePodMatcher) Allows(peer *InternalPeer, portInt int, portName
 		ppm.Port.Allows(portInt, portName, protocol)
 }
 
-func (ppm *NamespacePodMatcher) Combine(otherPort PortMatcher) *NamespacePodMatcher {
+// Combine creates a new NamespacePodMatcher with the ports and sources of both inputs; their primary keys must
+// match.  Neither input is modified.
+func (ppm *NamespacePodMatcher) Combine(other *NamespacePodMatcher) (*NamespacePodMatcher, error) {
+	port, err := CombinePortMatchers(ppm.Port, other.Port)
+	if err != nil {
+		return nil, err
+	}
 	return &NamespacePodMatcher{
 		Namespace: ppm.Namespace,
 		Pod:       ppm.Pod,
-		Port:      CombinePortMatchers(ppm.Port, otherPort),
-	}
+		Port:      port,
+		Sources:   combineRuleSources(ppm.Sources, other.Sources),
+	}, nil
 }
 
 // PodMatcher possibilities:
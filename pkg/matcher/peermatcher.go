@@ -10,25 +10,28 @@ type PeerMatcher interface {
 	Allows(peer *TrafficPeer, portInt int, portName string, protocol v1.Protocol) bool
 }
 
-func CombinePeerMatchers(a PeerMatcher, b PeerMatcher) PeerMatcher {
+func CombinePeerMatchers(a PeerMatcher, b PeerMatcher) (PeerMatcher, error) {
 	switch l := a.(type) {
 	case *NonePeerMatcher:
-		return b
+		return b, nil
 	case *AllPeerMatcher:
-		return a
+		if r, ok := b.(*AllPeerMatcher); ok {
+			return &AllPeerMatcher{Sources: combineRuleSources(l.Sources, r.Sources)}, nil
+		}
+		return a, nil
 	case *SpecificPeerMatcher:
 		switch r := b.(type) {
 		case *NonePeerMatcher:
-			return a
+			return a, nil
 		case *AllPeerMatcher:
-			return b
+			return b, nil
 		case *SpecificPeerMatcher:
 			return l.Combine(r)
 		default:
-			panic(errors.Errorf("invalid PeerMatcher type %T", b))
+			return nil, errors.Errorf("invalid PeerMatcher type %T", b)
 		}
 	default:
-		panic(errors.Errorf("invalid PeerMatcher type %T", a))
+		return nil, errors.Errorf("invalid PeerMatcher type %T", a)
 	}
 }
 
@@ -44,7 +47,10 @@ func (nem *NonePeerMatcher) MarshalJSON() (b []byte, e error) {
 	})
 }
 
-type AllPeerMatcher struct{}
+type AllPeerMatcher struct {
+	// Sources are the rules without peers or ports this was built from
+	Sources []*RuleSource
+}
 
 func (aem *AllPeerMatcher) Allows(peer *TrafficPeer, portInt int, portName string, protocol v1.Protocol) bool {
 	return true
@@ -82,9 +88,17 @@ func (em *SpecificPeerMatcher) Allows(peer *TrafficPeer, portInt int, portName s
 	return false
 }
 
-func (em *SpecificPeerMatcher) Combine(other *SpecificPeerMatcher) *SpecificPeerMatcher {
-	return &SpecificPeerMatcher{
-		IP:       CombineIPMatchers(em.IP, other.IP),
-		Internal: CombineInternalMatchers(em.Internal, other.Internal),
+func (em *SpecificPeerMatcher) Combine(other *SpecificPeerMatcher) (*SpecificPeerMatcher, error) {
+	ip, err := CombineIPMatchers(em.IP, other.IP)
+	if err != nil {
+		return nil, err
 	}
+	internal, err := CombineInternalMatchers(em.Internal, other.Internal)
+	if err != nil {
+		return nil, err
+	}
+	return &SpecificPeerMatcher{
+		IP:       ip,
+		Internal: internal,
+	}, nil
 }
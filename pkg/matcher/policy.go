@@ -8,21 +8,33 @@ import (
 	"strings"
 )
 
-// This is the root type
+// This is the root type.  Targets must be added with AddTarget, which maintains the indexes used to find the
+// targets applying to a pod.
 type Policy struct {
 	Ingress map[string]*Target
 	Egress  map[string]*Target
+	// AdminPolicies are evaluated before Ingress and Egress, in priority order
+	AdminPolicies []*AdminPolicy
+	// BaselinePolicy is evaluated if no Ingress or Egress target applies; it may be nil
+	BaselinePolicy *AdminPolicy
+
+	ingressIndex *targetIndex
+	egressIndex  *targetIndex
 }
 
 func NewPolicy() *Policy {
-	return &Policy{Ingress: map[string]*Target{}, Egress: map[string]*Target{}}
+	return &Policy{Ingress: map[string]*Target{}, Egress: map[string]*Target{}, ingressIndex: newTargetIndex(), egressIndex: newTargetIndex()}
 }
 
-func NewPolicyWithTargets(ingress []*Target, egress []*Target) *Policy {
+func NewPolicyWithTargets(ingress []*Target, egress []*Target) (*Policy, error) {
 	np := NewPolicy()
-	np.AddTargets(true, ingress)
-	np.AddTargets(false, egress)
-	return np
+	if err := np.AddTargets(true, ingress); err != nil {
+		return nil, err
+	}
+	if err := np.AddTargets(false, egress); err != nil {
+		return nil, err
+	}
+	return np, nil
 }
 
 func (p *Policy) SortedTargets() ([]*Target, []*Target) {
@@ -42,39 +54,45 @@ func (p *Policy) SortedTargets() ([]*Target, []*Target) {
 	return ingress, egress
 }
 
-func (p *Policy) AddTargets(isIngress bool, targets []*Target) {
+func (p *Policy) AddTargets(isIngress bool, targets []*Target) error {
 	for _, target := range targets {
-		p.AddTarget(isIngress, target)
+		if _, err := p.AddTarget(isIngress, target); err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
-func (p *Policy) AddTarget(isIngress bool, target *Target) *Target {
+func (p *Policy) AddTarget(isIngress bool, target *Target) (*Target, error) {
 	pk := target.GetPrimaryKey()
-	var dict map[string]*Target
-	if isIngress {
-		dict = p.Ingress
-	} else {
-		dict = p.Egress
-	}
+	dict, index := p.targets(isIngress)
 	if prev, ok := dict[pk]; ok {
-		combined := prev.Combine(target)
+		combined, err := prev.Combine(target)
+		if err != nil {
+			return nil, err
+		}
 		dict[pk] = combined
 	} else {
 		dict[pk] = target
+		index.add(target)
 	}
-	return dict[pk]
+	return dict[pk], nil
 }
 
-func (p *Policy) TargetsApplyingToPod(isIngress bool, namespace string, podLabels map[string]string) []*Target {
-	var targets []*Target
-	var dict map[string]*Target
+func (p *Policy) targets(isIngress bool) (map[string]*Target, *targetIndex) {
 	if isIngress {
-		dict = p.Ingress
-	} else {
-		dict = p.Egress
+		return p.Ingress, p.ingressIndex
 	}
-	for _, target := range dict {
-		if target.IsMatch(namespace, podLabels) {
+	return p.Egress, p.egressIndex
+}
+
+// TargetsApplyingToPod looks up the targets which may apply to the pod in the index -- by namespace, and then by
+// pod label -- and checks just those
+func (p *Policy) TargetsApplyingToPod(isIngress bool, namespace string, podLabels map[string]string) []*Target {
+	var targets []*Target
+	dict, index := p.targets(isIngress)
+	for _, pk := range index.candidates(namespace, podLabels) {
+		if target := dict[pk]; target.IsMatch(namespace, podLabels) {
 			targets = append(targets, target)
 		}
 	}
@@ -84,10 +102,23 @@ func (p *Policy) TargetsApplyingToPod(isIngress bool, namespace string, podLabel
 type DirectionResult struct {
 	AllowingTargets []*Target
 	DenyingTargets  []*Target
+	// AllowingRules are the rules, peers and ports of AllowingTargets which match the traffic
+	AllowingRules []*RuleSource
+	// Tier is the policy tier which decided
+	Tier Tier
+	// AdminRule is the deciding rule, if Tier is AdminNetworkPolicy or BaselineAdminNetworkPolicy
+	AdminRule *AdminRule
+	// PassingAdminRule is the AdminNetworkPolicy rule, if any, which passed the decision on to the lower tiers
+	PassingAdminRule *AdminRule
 }
 
 func (d *DirectionResult) IsAllowed() bool {
-	return len(d.AllowingTargets) > 0 || len(d.DenyingTargets) == 0
+	switch d.Tier {
+	case TierAdminNetworkPolicy, TierBaselineAdminNetworkPolicy:
+		return d.AdminRule.Action == kube.AdminNetworkPolicyRuleActionAllow
+	default:
+		return len(d.AllowingTargets) > 0 || len(d.DenyingTargets) == 0
+	}
 }
 
 type AllowedResult struct {
@@ -98,25 +129,49 @@ type AllowedResult struct {
 func (ar *AllowedResult) Table() string {
 	tableString := &strings.Builder{}
 	table := tablewriter.NewWriter(tableString)
+	table.SetAutoWrapText(false)
 	table.SetRowLine(true)
 	table.SetAutoMergeCells(true)
-	table.SetHeader([]string{"Type", "Action", "Target"})
+	table.SetHeader([]string{"Type", "Tier", "Action", "Target"})
 
-	addTargetsToTable(table, "Ingress", "Allow", ar.Ingress.AllowingTargets)
-	addTargetsToTable(table, "Ingress", "Deny", ar.Ingress.DenyingTargets)
-	table.Append([]string{"", "", ""})
-	addTargetsToTable(table, "Egress", "Allow", ar.Egress.AllowingTargets)
-	addTargetsToTable(table, "Egress", "Deny", ar.Egress.DenyingTargets)
-	table.SetFooter([]string{"Is allowed?", fmt.Sprintf("%t", ar.IsAllowed()), ""})
+	addDirectionResultToTable(table, "Ingress", ar.Ingress)
+	table.Append([]string{"", "", "", ""})
+	addDirectionResultToTable(table, "Egress", ar.Egress)
+	table.SetFooter([]string{"Is allowed?", "", fmt.Sprintf("%t", ar.IsAllowed()), ""})
 
 	table.Render()
 	return tableString.String()
 }
 
-func addTargetsToTable(table *tablewriter.Table, ruleType string, action string, targets []*Target) {
+func addDirectionResultToTable(table *tablewriter.Table, ruleType string, result *DirectionResult) {
+	if result.PassingAdminRule != nil {
+		table.Append([]string{ruleType, string(TierAdminNetworkPolicy), string(result.PassingAdminRule.Action), result.PassingAdminRule.String()})
+	}
+	switch result.Tier {
+	case TierAdminNetworkPolicy, TierBaselineAdminNetworkPolicy:
+		table.Append([]string{ruleType, string(result.Tier), string(result.AdminRule.Action), result.AdminRule.String()})
+	case TierDefault:
+		table.Append([]string{ruleType, string(result.Tier), "Allow", "no policies apply"})
+	default:
+		addTargetsToTable(table, ruleType, "Allow", result.AllowingTargets, result.AllowingRules)
+		addTargetsToTable(table, ruleType, "Deny", result.DenyingTargets, nil)
+	}
+}
+
+// addTargetsToTable adds a row for each target, listing the rules of its policies which allowed the traffic
+func addTargetsToTable(table *tablewriter.Table, ruleType string, action string, targets []*Target, rules []*RuleSource) {
 	for _, t := range targets {
 		targetString := fmt.Sprintf("namespace: %s\n%s", t.Namespace, kube.LabelSelectorTableLines(t.PodSelector))
-		table.Append([]string{ruleType, action, targetString})
+		policies := map[string]bool{}
+		for _, policy := range t.Summary().SourcePolicies {
+			policies[policy] = true
+		}
+		for _, rule := range rules {
+			if policies[rule.Policy] {
+				targetString += "\nallowed by " + rule.String()
+			}
+		}
+		table.Append([]string{ruleType, string(TierNetworkPolicy), action, targetString})
 	}
 }
 
@@ -124,9 +179,58 @@ func (ar *AllowedResult) IsAllowed() bool {
 	return ar.Ingress.IsAllowed() && ar.Egress.IsAllowed()
 }
 
+// AllowedResultReport is the structured form of an AllowedResult
+type AllowedResultReport struct {
+	Allowed bool                   `json:"allowed"`
+	Ingress *DirectionResultReport `json:"ingress"`
+	Egress  *DirectionResultReport `json:"egress"`
+}
+
+type DirectionResultReport struct {
+	Allowed          bool             `json:"allowed"`
+	Tier             Tier             `json:"tier"`
+	AdminRule        string           `json:"adminRule,omitempty"`
+	PassingAdminRule string           `json:"passingAdminRule,omitempty"`
+	AllowingTargets  []*TargetSummary `json:"allowingTargets"`
+	DenyingTargets   []*TargetSummary `json:"denyingTargets"`
+	AllowingRules    []*RuleSource    `json:"allowingRules"`
+}
+
+func (ar *AllowedResult) Report() *AllowedResultReport {
+	return &AllowedResultReport{
+		Allowed: ar.IsAllowed(),
+		Ingress: ar.Ingress.Report(),
+		Egress:  ar.Egress.Report(),
+	}
+}
+
+func (d *DirectionResult) Report() *DirectionResultReport {
+	report := &DirectionResultReport{
+		Allowed:         d.IsAllowed(),
+		Tier:            d.Tier,
+		AllowingTargets: []*TargetSummary{},
+		DenyingTargets:  []*TargetSummary{},
+		AllowingRules:   []*RuleSource{},
+	}
+	if d.AdminRule != nil {
+		report.AdminRule = d.AdminRule.String()
+	}
+	if d.PassingAdminRule != nil {
+		report.PassingAdminRule = d.PassingAdminRule.String()
+	}
+	for _, target := range d.AllowingTargets {
+		report.AllowingTargets = append(report.AllowingTargets, target.Summary())
+	}
+	for _, target := range d.DenyingTargets {
+		report.DenyingTargets = append(report.DenyingTargets, target.Summary())
+	}
+	report.AllowingRules = append(report.AllowingRules, d.AllowingRules...)
+	return report
+}
+
 // IsTrafficAllowed returns:
 // - whether the traffic is allowed
-// - which rules allowed the traffic
+// - which rules allowed the traffic -- down to their peers and ports
 // - which rules matched the traffic target
 func (p *Policy) IsTrafficAllowed(traffic *Traffic) *AllowedResult {
 	return &AllowedResult{
@@ -149,26 +253,51 @@ func (p *Policy) IsIngressOrEgressAllowed(traffic *Traffic, isIngress bool) *Dir
 	// 1. if target is external to cluster -> allow
 	//   this is because we can't stop external hosts from sending or receiving traffic
 	if target.Internal == nil {
-		return &DirectionResult{AllowingTargets: nil, DenyingTargets: nil}
+		return &DirectionResult{AllowingTargets: nil, DenyingTargets: nil, Tier: TierDefault}
+	}
+
+	// whether ingress or egress, named ports are resolved against the destination pod
+	portInt, portName := traffic.ResolvePort()
+
+	// 2. AdminNetworkPolicies, by priority: the first matching rule decides, unless it passes
+	var passing *AdminRule
+	for _, adminPolicy := range p.AdminPoliciesApplyingToPod(target.Internal.Namespace, target.Internal.NamespaceLabels, target.Internal.PodLabels) {
+		rule := adminPolicy.FirstMatchingRule(isIngress, peer, portInt, portName, traffic.Protocol)
+		if rule == nil {
+			continue
+		}
+		if rule.Action != kube.AdminNetworkPolicyRuleActionPass {
+			return &DirectionResult{Tier: TierAdminNetworkPolicy, AdminRule: rule}
+		}
+		passing = rule
+		break
 	}
 
 	matchingTargets := p.TargetsApplyingToPod(isIngress, target.Internal.Namespace, target.Internal.PodLabels)
 
-	// 2. No targets match => automatic allow
+	// 3. No targets match => BaselineAdminNetworkPolicy, then automatic allow
 	if len(matchingTargets) == 0 {
-		return &DirectionResult{AllowingTargets: nil, DenyingTargets: nil}
+		baseline := p.BaselinePolicy
+		if baseline != nil && baseline.Subject.Allows(target.Internal.Namespace, target.Internal.NamespaceLabels, target.Internal.PodLabels) {
+			if rule := baseline.FirstMatchingRule(isIngress, peer, portInt, portName, traffic.Protocol); rule != nil {
+				return &DirectionResult{Tier: TierBaselineAdminNetworkPolicy, AdminRule: rule, PassingAdminRule: passing}
+			}
+		}
+		return &DirectionResult{AllowingTargets: nil, DenyingTargets: nil, Tier: TierDefault, PassingAdminRule: passing}
 	}
 
-	// 3. Check if any matching targets allow this traffic
+	// 4. Check if any matching targets allow this traffic
 	var allowers []*Target
 	var deniers []*Target
+	var rules []*RuleSource
 	for _, target := range matchingTargets {
-		if target.Peer.Allows(peer, traffic.ResolvedPort, traffic.ResolvedPortName, traffic.Protocol) {
+		if target.Peer.Allows(peer, portInt, portName, traffic.Protocol) {
 			allowers = append(allowers, target)
+			rules = append(rules, MatchingRuleSources(target.Peer, peer, portInt, portName, traffic.Protocol)...)
 		} else {
 			deniers = append(deniers, target)
 		}
 	}
 
-	return &DirectionResult{AllowingTargets: allowers, DenyingTargets: deniers}
+	return &DirectionResult{AllowingTargets: allowers, DenyingTargets: deniers, AllowingRules: sortRuleSources(rules), Tier: TierNetworkPolicy, PassingAdminRule: passing}
 }
@@ -220,4 +220,89 @@ spec:
 			}).IsAllowed()).To(BeTrue())
 		})
 	})
+
+	Describe("Policy allowing ingress to named port resolved per destination pod", func() {
+		policyYaml := `
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: abc
+  namespace: x
+spec:
+  ingress:
+  - ports:
+    - port: http
+      protocol: TCP
+  podSelector: {}
+  policyTypes:
+  - Ingress`
+		var kubePolicy *networkingv1.NetworkPolicy
+		err := yaml.Unmarshal([]byte(policyYaml), &kubePolicy)
+		utils.DoOrDie(err)
+		policy := BuildNetworkPolicy(kubePolicy)
+
+		trafficTo := func(containerPorts []*ContainerPort, port int, portName string) *Traffic {
+			return &Traffic{
+				Source: &TrafficPeer{
+					IP: "1.2.3.4",
+				},
+				Destination: &TrafficPeer{
+					Internal: &InternalPeer{
+						PodLabels:       map[string]string{"pod": "a"},
+						NamespaceLabels: map[string]string{"ns": "x"},
+						Namespace:       "x",
+						ContainerPorts:  containerPorts,
+					},
+					IP: "192.168.242.249",
+				},
+				ResolvedPort:     port,
+				ResolvedPortName: portName,
+				Protocol:         v1.ProtocolTCP,
+			}
+		}
+		httpOn8080 := []*ContainerPort{{Name: "http", Port: 8080, Protocol: v1.ProtocolTCP}}
+		httpOn80 := []*ContainerPort{{Name: "http", Port: 80, Protocol: v1.ProtocolTCP}, {Name: "alt", Port: 8080, Protocol: v1.ProtocolTCP}}
+
+		It("Should allow a port whose name resolves to the named port on the destination", func() {
+			Expect(policy.IsTrafficAllowed(trafficTo(httpOn8080, 8080, "http")).IsAllowed()).To(BeTrue())
+			Expect(policy.IsTrafficAllowed(trafficTo(httpOn80, 80, "")).IsAllowed()).To(BeTrue())
+		})
+
+		It("Should not allow a port whose name resolves differently on the destination", func() {
+			Expect(policy.IsTrafficAllowed(trafficTo(httpOn80, 8080, "http")).IsAllowed()).To(BeFalse())
+		})
+
+		It("Should resolve a port given only by name against the destination", func() {
+			traffic := trafficTo(httpOn80, UnresolvedPort, "http")
+			port, name := traffic.ResolvePort()
+			Expect(port).To(Equal(80))
+			Expect(name).To(Equal("http"))
+			Expect(policy.IsTrafficAllowed(traffic).IsAllowed()).To(BeTrue())
+		})
+
+		It("Should fall back to the traffic's port name without a container port table", func() {
+			Expect(policy.IsTrafficAllowed(trafficTo(nil, 8080, "http")).IsAllowed()).To(BeTrue())
+		})
+	})
+	Describe("Allowed result report", func() {
+		It("Should report the denying targets and tiers", func() {
+			traffic := &Traffic{
+				Source: &TrafficPeer{IP: "1.2.3.4"},
+				Destination: &TrafficPeer{
+					Internal: &InternalPeer{PodLabels: map[string]string{"pod": "a"}, NamespaceLabels: map[string]string{"ns": "x"}, Namespace: "x"},
+					IP:       "192.168.242.249",
+				},
+				ResolvedPort: 80,
+				Protocol:     v1.ProtocolTCP,
+			}
+			report := allowAllOnSCTP.IsTrafficAllowed(traffic).Report()
+			Expect(report.Allowed).To(BeFalse())
+			Expect(report.Ingress.Tier).To(Equal(TierNetworkPolicy))
+			Expect(report.Ingress.AllowingTargets).To(BeEmpty())
+			Expect(report.Ingress.DenyingTargets).To(HaveLen(1))
+			Expect(report.Ingress.DenyingTargets[0].SourcePolicies).To(Equal([]string{"x/policy-207"}))
+			Expect(report.Egress.Allowed).To(BeTrue())
+			Expect(report.Egress.Tier).To(Equal(TierDefault))
+		})
+	})
 }
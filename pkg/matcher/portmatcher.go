@@ -11,25 +11,28 @@ type PortMatcher interface {
 	Allows(portInt int, portName string, protocol v1.Protocol) bool
 }
 
-func CombinePortMatchers(a PortMatcher, b PortMatcher) PortMatcher {
+func CombinePortMatchers(a PortMatcher, b PortMatcher) (PortMatcher, error) {
 	switch l := a.(type) {
 	case *AllPortMatcher:
-		return a
+		if r, ok := b.(*AllPortMatcher); ok {
+			return &AllPortMatcher{Sources: combineRuleSources(l.Sources, r.Sources)}, nil
+		}
+		return a, nil
 	case *NonePortMatcher:
-		return b
+		return b, nil
 	case *SpecificPortMatcher:
 		switch r := b.(type) {
 		case *AllPortMatcher:
-			return b
+			return b, nil
 		case *NonePortMatcher:
-			return a
+			return a, nil
 		case *SpecificPortMatcher:
-			return l.Combine(r)
+			return l.Combine(r), nil
 		default:
-			panic(errors.Errorf("invalid Port type %T", b))
+			return nil, errors.Errorf("invalid Port type %T", b)
 		}
 	default:
-		panic(errors.Errorf("invalid Port type %T", a))
+		return nil, errors.Errorf("invalid Port type %T", a)
 	}
 }
 
@@ -45,7 +48,10 @@ func (n *NonePortMatcher) MarshalJSON() (b []byte, e error) {
 	})
 }
 
-type AllPortMatcher struct{}
+type AllPortMatcher struct {
+	// Sources are the rules without ports this was built from
+	Sources []*RuleSource
+}
 
 func (ap *AllPortMatcher) Allows(portInt int, portName string, protocol v1.Protocol) bool {
 	return true
@@ -62,6 +68,7 @@ func (ap *AllPortMatcher) MarshalJSON() (b []byte, e error) {
 type PortProtocolMatcher struct {
 	Port     *intstr.IntOrString
 	Protocol v1.Protocol
+	Sources  []*RuleSource `json:"-"`
 }
 
 func (p *PortProtocolMatcher) Allows(portInt int, portName string, protocol v1.Protocol) bool {
@@ -84,9 +91,38 @@ func (p *PortProtocolMatcher) Equals(other *PortProtocolMatcher) bool {
 	return isIntStringEqual(*p.Port, *other.Port)
 }
 
-// SpecificPortMatcher models the case where traffic must match a named or numbered port
+// PortRangeMatcher models a NetworkPolicyPort with an EndPort: all numbered ports
+// from From to To, inclusive, on a single protocol.  Named ports never match a range.
+type PortRangeMatcher struct {
+	From     int
+	To       int
+	Protocol v1.Protocol
+	Sources  []*RuleSource
+}
+
+func (p *PortRangeMatcher) Allows(portInt int, portName string, protocol v1.Protocol) bool {
+	return p.From <= portInt && portInt <= p.To && p.Protocol == protocol
+}
+
+func (p *PortRangeMatcher) Equals(other *PortRangeMatcher) bool {
+	return p.From == other.From && p.To == other.To && p.Protocol == other.Protocol
+}
+
+func (p *PortRangeMatcher) MarshalJSON() (b []byte, e error) {
+	return json.Marshal(map[string]interface{}{
+		"Type":     "port range",
+		"From":     p.From,
+		"To":       p.To,
+		"Protocol": p.Protocol,
+	})
+}
+
+// SpecificPortMatcher models the case where traffic must match a named or numbered port,
+// or fall within a port range.  Named ports are matched against the port name as resolved
+// on the destination pod -- see Traffic.ResolvePort.
 type SpecificPortMatcher struct {
-	Ports []*PortProtocolMatcher
+	Ports      []*PortProtocolMatcher
+	PortRanges []*PortRangeMatcher
 }
 
 func (s *SpecificPortMatcher) Allows(portInt int, portName string, protocol v1.Protocol) bool {
@@ -95,30 +131,58 @@ func (s *SpecificPortMatcher) Allows(portInt int, portName string, protocol v1.P
 			return true
 		}
 	}
+	for _, matcher := range s.PortRanges {
+		if matcher.Allows(portInt, portName, protocol) {
+			return true
+		}
+	}
 	return false
 }
 
 func (s *SpecificPortMatcher) MarshalJSON() (b []byte, e error) {
 	return json.Marshal(map[string]interface{}{
-		"Type":  "specific ports",
-		"Ports": s.Ports,
+		"Type":       "specific ports",
+		"Ports":      s.Ports,
+		"PortRanges": s.PortRanges,
 	})
 }
 
+// Combine creates a new SpecificPortMatcher containing the ports and port ranges of both
+// inputs, merging the sources of exact duplicates.  Neither input is modified.
 func (s *SpecificPortMatcher) Combine(other *SpecificPortMatcher) *SpecificPortMatcher {
 	var pps []*PortProtocolMatcher
-	for _, pp := range s.Ports {
-		pps = append(pps, pp)
-	}
+	pps = append(pps, s.Ports...)
 	for _, otherPP := range other.Ports {
-		for _, pp := range pps {
+		found := false
+		for i, pp := range pps {
 			if pp.Equals(otherPP) {
+				pps[i] = &PortProtocolMatcher{Port: pp.Port, Protocol: pp.Protocol, Sources: combineRuleSources(pp.Sources, otherPP.Sources)}
+				found = true
 				break
 			}
+		}
+		if !found {
 			pps = append(pps, otherPP)
 		}
 	}
-	return &SpecificPortMatcher{Ports: pps}
+
+	var ranges []*PortRangeMatcher
+	ranges = append(ranges, s.PortRanges...)
+	for _, otherRange := range other.PortRanges {
+		found := false
+		for i, r := range ranges {
+			if r.Equals(otherRange) {
+				ranges[i] = &PortRangeMatcher{From: r.From, To: r.To, Protocol: r.Protocol, Sources: combineRuleSources(r.Sources, otherRange.Sources)}
+				found = true
+				break
+			}
+		}
+		if !found {
+			ranges = append(ranges, otherRange)
+		}
+	}
+
+	return &SpecificPortMatcher{Ports: pps, PortRanges: ranges}
 }
 
 func isPortMatch(a intstr.IntOrString, portInt int, portName string) bool {
@@ -0,0 +1,194 @@
+package matcher
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	"sort"
+)
+
+// RuleSource identifies the part of a NetworkPolicy which a leaf matcher was built from: an ingress or egress
+// rule, and one of its peers or ports.  Peer and Port are -1 when they don't apply: a peer matcher's source has
+// no port, a port matcher's source has no peer, and a rule without peers or ports has neither.
+type RuleSource struct {
+	Policy    string `json:"policy"`
+	IsIngress bool   `json:"isIngress"`
+	Rule      int    `json:"rule"`
+	Peer      int    `json:"peer"`
+	Port      int    `json:"port"`
+}
+
+func newRuleSource(policy string, isIngress bool, rule int) *RuleSource {
+	return &RuleSource{Policy: policy, IsIngress: isIngress, Rule: rule, Peer: -1, Port: -1}
+}
+
+func (r *RuleSource) withPeer(peer int) *RuleSource {
+	source := *r
+	source.Peer = peer
+	return &source
+}
+
+func (r *RuleSource) withPort(port int) *RuleSource {
+	source := *r
+	source.Port = port
+	return &source
+}
+
+// RulePath is the path of the rule, peer and port within the policy, such as 'ingress[1].from[0] port[2]'
+func (r *RuleSource) RulePath() string {
+	path := fmt.Sprintf("egress[%d]", r.Rule)
+	peers := "to"
+	if r.IsIngress {
+		path = fmt.Sprintf("ingress[%d]", r.Rule)
+		peers = "from"
+	}
+	if r.Peer >= 0 {
+		path += fmt.Sprintf(".%s[%d]", peers, r.Peer)
+	}
+	if r.Port >= 0 {
+		path += fmt.Sprintf(" port[%d]", r.Port)
+	}
+	return path
+}
+
+func (r *RuleSource) String() string {
+	return r.Policy + " " + r.RulePath()
+}
+
+func (r *RuleSource) isSameRule(other *RuleSource) bool {
+	return r.Policy == other.Policy && r.IsIngress == other.IsIngress && r.Rule == other.Rule
+}
+
+// combineRuleSources creates a new slice of both inputs' sources, or nil if there are none
+func combineRuleSources(a []*RuleSource, b []*RuleSource) []*RuleSource {
+	if len(a) == 0 && len(b) == 0 {
+		return nil
+	}
+	return append(append([]*RuleSource{}, a...), b...)
+}
+
+// pairRuleSources matches the sources of a peer leaf with those of the port leaves which allow traffic: only
+// a peer and a port of the same rule together allow it
+func pairRuleSources(peerSources []*RuleSource, portSources []*RuleSource) []*RuleSource {
+	var sources []*RuleSource
+	for _, peerSource := range peerSources {
+		for _, portSource := range portSources {
+			if peerSource.isSameRule(portSource) {
+				sources = append(sources, peerSource.withPort(portSource.Port))
+			}
+		}
+	}
+	return sources
+}
+
+// MatchingRuleSources finds the leaves of a PeerMatcher which allow traffic, and returns their sources -- sorted,
+// without duplicates.  Leaves which were absorbed while combining -- such as the ports of one rule, by another rule
+// of the same peer allowing all ports -- aren't found.  Matchers which weren't built from a policy have no sources.
+func MatchingRuleSources(matcher PeerMatcher, peer *TrafficPeer, portInt int, portName string, protocol v1.Protocol) []*RuleSource {
+	var sources []*RuleSource
+	switch m := matcher.(type) {
+	case *NonePeerMatcher:
+	case *AllPeerMatcher:
+		sources = m.Sources
+	case *SpecificPeerMatcher:
+		sources = append(sources, matchingIPRuleSources(m.IP, peer.IP, portInt, portName, protocol)...)
+		if !peer.IsExternal() {
+			sources = append(sources, matchingInternalRuleSources(m.Internal, peer.Internal, portInt, portName, protocol)...)
+		}
+	default:
+		panic(errors.Errorf("invalid PeerMatcher type %T", matcher))
+	}
+	return sortRuleSources(sources)
+}
+
+func sortRuleSources(sources []*RuleSource) []*RuleSource {
+	if len(sources) == 0 {
+		return nil
+	}
+	unique := map[RuleSource]bool{}
+	var sorted []*RuleSource
+	for _, source := range sources {
+		if !unique[*source] {
+			unique[*source] = true
+			sorted = append(sorted, source)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		switch {
+		case a.Policy != b.Policy:
+			return a.Policy < b.Policy
+		case a.IsIngress != b.IsIngress:
+			return a.IsIngress
+		case a.Rule != b.Rule:
+			return a.Rule < b.Rule
+		case a.Peer != b.Peer:
+			return a.Peer < b.Peer
+		default:
+			return a.Port < b.Port
+		}
+	})
+	return sorted
+}
+
+func matchingIPRuleSources(matcher IPMatcher, ip string, portInt int, portName string, protocol v1.Protocol) []*RuleSource {
+	switch m := matcher.(type) {
+	case *NoneIPMatcher:
+		return nil
+	case *AllIPMatcher:
+		return m.Sources
+	case *SpecificIPMatcher:
+		sources := matchingPortRuleSources(m.PortsForAllIPs, portInt, portName, protocol)
+		for _, block := range m.IPBlocks {
+			if block.Allows(ip, portInt, portName, protocol) {
+				sources = append(sources, pairRuleSources(block.Sources, matchingPortRuleSources(block.Port, portInt, portName, protocol))...)
+			}
+		}
+		return sources
+	default:
+		panic(errors.Errorf("invalid IPMatcher type %T", matcher))
+	}
+}
+
+func matchingInternalRuleSources(matcher InternalMatcher, peer *InternalPeer, portInt int, portName string, protocol v1.Protocol) []*RuleSource {
+	switch m := matcher.(type) {
+	case *NoneInternalMatcher:
+		return nil
+	case *AllInternalMatcher:
+		return m.Sources
+	case *SpecificInternalMatcher:
+		var sources []*RuleSource
+		for _, nsPod := range m.NamespacePods {
+			if nsPod.Allows(peer, portInt, portName, protocol) {
+				sources = append(sources, pairRuleSources(nsPod.Sources, matchingPortRuleSources(nsPod.Port, portInt, portName, protocol))...)
+			}
+		}
+		return sources
+	default:
+		panic(errors.Errorf("invalid InternalMatcher type %T", matcher))
+	}
+}
+
+func matchingPortRuleSources(matcher PortMatcher, portInt int, portName string, protocol v1.Protocol) []*RuleSource {
+	switch m := matcher.(type) {
+	case *NonePortMatcher:
+		return nil
+	case *AllPortMatcher:
+		return m.Sources
+	case *SpecificPortMatcher:
+		var sources []*RuleSource
+		for _, port := range m.Ports {
+			if port.Allows(portInt, portName, protocol) {
+				sources = append(sources, port.Sources...)
+			}
+		}
+		for _, portRange := range m.PortRanges {
+			if portRange.Allows(portInt, portName, protocol) {
+				sources = append(sources, portRange.Sources...)
+			}
+		}
+		return sources
+	default:
+		panic(errors.Errorf("invalid PortMatcher type %T", matcher))
+	}
+}
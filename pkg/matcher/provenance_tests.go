@@ -0,0 +1,160 @@
+package matcher
+
+import (
+	"github.com/mattfenwick/cyclonus/pkg/utils"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"sigs.k8s.io/yaml"
+)
+
+func RunProvenanceTests() {
+	serializedPolicies := []string{`
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: allow-web
+  namespace: x
+spec:
+  podSelector:
+    matchLabels:
+      app: api
+  ingress:
+  - ports:
+    - port: 9090
+    from:
+    - namespaceSelector:
+        matchLabels:
+          team: monitoring
+  - ports:
+    - port: 8080
+    - port: 81
+    - port: 80
+    from:
+    - podSelector:
+        matchLabels:
+          app: foo
+    - podSelector:
+        matchLabels:
+          app: web
+  - ports:
+    - port: 443
+  egress:
+  - ports:
+    - port: 53
+      protocol: UDP
+    to:
+    - ipBlock:
+        cidr: 10.0.0.0/8
+  policyTypes:
+  - Ingress
+  - Egress`, `
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: allow-web-too
+  namespace: x
+spec:
+  podSelector:
+    matchLabels:
+      app: api
+  ingress:
+  - ports:
+    - port: 80
+    from:
+    - podSelector:
+        matchLabels:
+          app: web
+  - from:
+    - podSelector:
+        matchLabels:
+          app: admin
+  - ports:
+    - port: 22
+    from:
+    - podSelector:
+        matchLabels:
+          app: admin
+  policyTypes:
+  - Ingress`}
+	var kubePolicies []*networkingv1.NetworkPolicy
+	for _, serialized := range serializedPolicies {
+		var kubePolicy *networkingv1.NetworkPolicy
+		utils.DoOrDie(yaml.Unmarshal([]byte(serialized), &kubePolicy))
+		kubePolicies = append(kubePolicies, kubePolicy)
+	}
+	policies := BuildNetworkPolicies(kubePolicies)
+
+	api := &TrafficPeer{Internal: &InternalPeer{Namespace: "x", PodLabels: map[string]string{"app": "api"}}, IP: "192.168.0.1"}
+	podInX := func(app string) *TrafficPeer {
+		return &TrafficPeer{Internal: &InternalPeer{Namespace: "x", PodLabels: map[string]string{"app": app}}, IP: "192.168.0.2"}
+	}
+	allowingRules := func(result *DirectionResult) []string {
+		var rules []string
+		for _, rule := range result.AllowingRules {
+			rules = append(rules, rule.String())
+		}
+		return rules
+	}
+
+	Describe("Rule provenance", func() {
+		It("should find the peer and port of each policy which allow traffic", func() {
+			result := policies.IsTrafficAllowed(&Traffic{Source: podInX("web"), Destination: api, ResolvedPort: 80, Protocol: v1.ProtocolTCP})
+			Expect(result.IsAllowed()).To(BeTrue())
+			Expect(allowingRules(result.Ingress)).To(Equal([]string{
+				"x/allow-web ingress[1].from[1] port[2]",
+				"x/allow-web-too ingress[0].from[0] port[0]",
+			}))
+			Expect(result.Table()).To(ContainSubstring("allowed by x/allow-web ingress[1].from[1] port[2]"))
+		})
+
+		It("should not pair a peer with a port of another rule", func() {
+			result := policies.IsTrafficAllowed(&Traffic{Source: podInX("web"), Destination: api, ResolvedPort: 8080, Protocol: v1.ProtocolTCP})
+			Expect(allowingRules(result.Ingress)).To(Equal([]string{"x/allow-web ingress[1].from[1] port[0]"}))
+		})
+
+		It("should find a rule without ports, and not the ports it absorbed", func() {
+			result := policies.IsTrafficAllowed(&Traffic{Source: podInX("admin"), Destination: api, ResolvedPort: 22, Protocol: v1.ProtocolTCP})
+			Expect(allowingRules(result.Ingress)).To(Equal([]string{"x/allow-web-too ingress[1].from[0]"}))
+		})
+
+		It("should find a rule without peers", func() {
+			result := policies.IsTrafficAllowed(&Traffic{Source: &TrafficPeer{IP: "8.8.8.8"}, Destination: api, ResolvedPort: 443, Protocol: v1.ProtocolTCP})
+			Expect(allowingRules(result.Ingress)).To(Equal([]string{"x/allow-web ingress[2] port[0]"}))
+		})
+
+		It("should find ip blocks", func() {
+			result := policies.IsTrafficAllowed(&Traffic{Source: api, Destination: &TrafficPeer{IP: "10.1.2.3"}, ResolvedPort: 53, Protocol: v1.ProtocolUDP})
+			Expect(result.IsAllowed()).To(BeTrue())
+			Expect(allowingRules(result.Egress)).To(Equal([]string{"x/allow-web egress[0].to[0] port[0]"}))
+		})
+
+		It("should find nothing for denied traffic", func() {
+			result := policies.IsTrafficAllowed(&Traffic{Source: podInX("foo"), Destination: api, ResolvedPort: 9090, Protocol: v1.ProtocolTCP})
+			Expect(result.IsAllowed()).To(BeFalse())
+			Expect(result.Ingress.AllowingRules).To(BeEmpty())
+		})
+
+		It("should keep the sources of simplified policies", func() {
+			simplified := Simplify(policies)
+			for _, traffic := range []*Traffic{
+				{Source: podInX("web"), Destination: api, ResolvedPort: 80, Protocol: v1.ProtocolTCP},
+				{Source: podInX("admin"), Destination: api, ResolvedPort: 22, Protocol: v1.ProtocolTCP},
+				{Source: &TrafficPeer{IP: "8.8.8.8"}, Destination: api, ResolvedPort: 443, Protocol: v1.ProtocolTCP},
+				{Source: api, Destination: &TrafficPeer{IP: "10.1.2.3"}, ResolvedPort: 53, Protocol: v1.ProtocolUDP},
+			} {
+				expected, actual := policies.IsTrafficAllowed(traffic), simplified.IsTrafficAllowed(traffic)
+				Expect(allowingRules(actual.Ingress)).To(Equal(allowingRules(expected.Ingress)))
+				Expect(allowingRules(actual.Egress)).To(Equal(allowingRules(expected.Egress)))
+				Expect(append(allowingRules(actual.Ingress), allowingRules(actual.Egress)...)).ToNot(BeEmpty())
+			}
+		})
+
+		It("should leave matchers built without a policy without sources", func() {
+			peer, err := BuildIngressMatcher("x", kubePolicies[0].Spec.Ingress)
+			Expect(err).To(Succeed())
+			Expect(MatchingRuleSources(peer, podInX("web"), 80, "", v1.ProtocolTCP)).To(BeEmpty())
+		})
+	})
+}
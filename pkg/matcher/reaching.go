@@ -0,0 +1,122 @@
+package matcher
+
+import (
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sort"
+)
+
+// ReachingPeers is a symbolic description of the peers which NetworkPolicies allow to send traffic to a pod: the
+// combination of the peers of every ingress target applying to the pod.  It doesn't account for admin policies,
+// or for the egress policies of the peers themselves.
+type ReachingPeers struct {
+	Namespace string
+	PodLabels map[string]string
+	// Targets are the ingress targets applying to the pod; if there are none, the pod is reachable by all peers
+	Targets []*Target
+	Peer    PeerMatcher
+}
+
+// PeersReachingPod describes the peers allowed to reach a pod on any port.  Each part of Peer keeps its own
+// port restrictions.
+func (p *Policy) PeersReachingPod(namespace string, podLabels map[string]string) (*ReachingPeers, error) {
+	targets := p.TargetsApplyingToPod(true, namespace, podLabels)
+	sort.Slice(targets, func(i, j int) bool {
+		return targets[i].GetPrimaryKey() < targets[j].GetPrimaryKey()
+	})
+	reaching := &ReachingPeers{Namespace: namespace, PodLabels: podLabels, Targets: targets, Peer: &AllPeerMatcher{}}
+	if len(targets) == 0 {
+		return reaching, nil
+	}
+	combined, err := CombineTargetsIgnoringPrimaryKey(namespace, metav1.LabelSelector{MatchLabels: podLabels}, targets)
+	if err != nil {
+		return nil, err
+	}
+	reaching.Peer = combined.Peer
+	return reaching, nil
+}
+
+// PeersReachingPodOnPort describes the peers allowed to reach a pod on a port and protocol: only the parts of
+// the combined peer which allow the port and protocol are kept.
+func (p *Policy) PeersReachingPodOnPort(namespace string, podLabels map[string]string, portInt int, portName string, protocol v1.Protocol) (*ReachingPeers, error) {
+	reaching, err := p.PeersReachingPod(namespace, podLabels)
+	if err != nil {
+		return nil, err
+	}
+	peer, err := NarrowPeerMatcherToPort(reaching.Peer, portInt, portName, protocol)
+	if err != nil {
+		return nil, err
+	}
+	reaching.Peer = peer
+	return reaching, nil
+}
+
+// NarrowPeerMatcherToPort drops the IP blocks and namespace/pod matchers of a peer which don't allow a port and
+// protocol.  The remaining ones are unmodified, so that they still show the rules they were built from.
+func NarrowPeerMatcherToPort(peer PeerMatcher, portInt int, portName string, protocol v1.Protocol) (PeerMatcher, error) {
+	switch p := peer.(type) {
+	case *AllPeerMatcher, *NonePeerMatcher:
+		return p, nil
+	case *SpecificPeerMatcher:
+		ip, err := narrowIPMatcherToPort(p.IP, portInt, portName, protocol)
+		if err != nil {
+			return nil, err
+		}
+		internal, err := narrowInternalMatcherToPort(p.Internal, portInt, portName, protocol)
+		if err != nil {
+			return nil, err
+		}
+		_, isNoneIP := ip.(*NoneIPMatcher)
+		_, isNoneInternal := internal.(*NoneInternalMatcher)
+		if isNoneIP && isNoneInternal {
+			return &NonePeerMatcher{}, nil
+		}
+		return &SpecificPeerMatcher{IP: ip, Internal: internal}, nil
+	default:
+		return nil, errors.Errorf("invalid PeerMatcher type %T", peer)
+	}
+}
+
+func narrowIPMatcherToPort(ip IPMatcher, portInt int, portName string, protocol v1.Protocol) (IPMatcher, error) {
+	switch i := ip.(type) {
+	case *AllIPMatcher, *NoneIPMatcher:
+		return i, nil
+	case *SpecificIPMatcher:
+		if i.PortsForAllIPs.Allows(portInt, portName, protocol) {
+			return &AllIPMatcher{}, nil
+		}
+		var blocks []*IPBlockMatcher
+		for _, block := range i.SortedIPBlocks() {
+			if block.Port.Allows(portInt, portName, protocol) {
+				blocks = append(blocks, block)
+			}
+		}
+		if len(blocks) == 0 {
+			return &NoneIPMatcher{}, nil
+		}
+		return NewSpecificIPMatcher(&NonePortMatcher{}, blocks...)
+	default:
+		return nil, errors.Errorf("invalid IPMatcher type %T", ip)
+	}
+}
+
+func narrowInternalMatcherToPort(internal InternalMatcher, portInt int, portName string, protocol v1.Protocol) (InternalMatcher, error) {
+	switch i := internal.(type) {
+	case *AllInternalMatcher, *NoneInternalMatcher:
+		return i, nil
+	case *SpecificInternalMatcher:
+		var matchers []*NamespacePodMatcher
+		for _, nsPod := range i.SortedNamespacePods() {
+			if nsPod.Port.Allows(portInt, portName, protocol) {
+				matchers = append(matchers, nsPod)
+			}
+		}
+		if len(matchers) == 0 {
+			return &NoneInternalMatcher{}, nil
+		}
+		return NewSpecificInternalMatcher(matchers...)
+	default:
+		return nil, errors.Errorf("invalid InternalMatcher type %T", internal)
+	}
+}
@@ -0,0 +1,97 @@
+package matcher
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func RunReachingTests() {
+	Describe("Peers reaching a pod", func() {
+		port8443 := intstr.FromInt(8443)
+		portMetrics := intstr.FromString("metrics")
+		tcp := v1.ProtocolTCP
+		api := &networkingv1.NetworkPolicy{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "payments", Name: "allow-api"},
+			Spec: networkingv1.NetworkPolicySpec{
+				PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "api"}},
+				Ingress: []networkingv1.NetworkPolicyIngressRule{
+					{
+						Ports: []networkingv1.NetworkPolicyPort{{Protocol: &tcp, Port: &port8443}},
+						From: []networkingv1.NetworkPolicyPeer{
+							{NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "web"}}},
+							{IPBlock: &networkingv1.IPBlock{CIDR: "10.0.0.0/8", Except: []string{"10.1.0.0/16"}}},
+						},
+					},
+					{
+						Ports: []networkingv1.NetworkPolicyPort{{Protocol: &tcp, Port: &portMetrics}},
+						From:  []networkingv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "prometheus"}}}},
+					},
+				},
+			},
+		}
+		policy := BuildNetworkPolicies([]*networkingv1.NetworkPolicy{api})
+
+		It("should allow all peers if no ingress policies apply", func() {
+			reaching, err := policy.PeersReachingPod("payments", map[string]string{"app": "db"})
+			Expect(err).To(BeNil())
+			Expect(reaching.Targets).To(BeEmpty())
+			Expect(reaching.Peer).To(Equal(&AllPeerMatcher{}))
+		})
+
+		It("should combine the peers of every rule on any port", func() {
+			reaching, err := policy.PeersReachingPod("payments", map[string]string{"app": "api"})
+			Expect(err).To(BeNil())
+			Expect(reaching.Targets).To(HaveLen(1))
+			peer := reaching.Peer.(*SpecificPeerMatcher)
+			Expect(peer.IP.(*SpecificIPMatcher).IPBlocks).To(HaveLen(1))
+			Expect(peer.Internal.(*SpecificInternalMatcher).NamespacePods).To(HaveLen(2))
+		})
+
+		It("should keep only the peers allowed on a port", func() {
+			reaching, err := policy.PeersReachingPodOnPort("payments", map[string]string{"app": "api"}, 8443, "https", tcp)
+			Expect(err).To(BeNil())
+			peer := reaching.Peer.(*SpecificPeerMatcher)
+			blocks := peer.IP.(*SpecificIPMatcher).SortedIPBlocks()
+			Expect(blocks).To(HaveLen(1))
+			Expect(blocks[0].IPBlock).To(Equal(&networkingv1.IPBlock{CIDR: "10.0.0.0/8", Except: []string{"10.1.0.0/16"}}))
+			nsPods := peer.Internal.(*SpecificInternalMatcher).SortedNamespacePods()
+			Expect(nsPods).To(HaveLen(1))
+			Expect(nsPods[0].Namespace).To(Equal(&LabelSelectorNamespaceMatcher{Selector: metav1.LabelSelector{MatchLabels: map[string]string{"team": "web"}}}))
+
+			metrics, err := policy.PeersReachingPodOnPort("payments", map[string]string{"app": "api"}, 9090, "metrics", tcp)
+			Expect(err).To(BeNil())
+			Expect(metrics.Peer.(*SpecificPeerMatcher).IP).To(Equal(&NoneIPMatcher{}))
+			Expect(metrics.Peer.(*SpecificPeerMatcher).Internal.(*SpecificInternalMatcher).NamespacePods).To(HaveLen(1))
+
+			udp, err := policy.PeersReachingPodOnPort("payments", map[string]string{"app": "api"}, 8443, "", v1.ProtocolUDP)
+			Expect(err).To(BeNil())
+			Expect(udp.Peer).To(Equal(&NonePeerMatcher{}))
+		})
+
+		It("should not modify the targets it combines", func() {
+			allowAll := &networkingv1.NetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "payments", Name: "allow-from-payments"},
+				Spec: networkingv1.NetworkPolicySpec{
+					Ingress: []networkingv1.NetworkPolicyIngressRule{{From: []networkingv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{}}}}},
+				},
+			}
+			policies := BuildNetworkPolicies([]*networkingv1.NetworkPolicy{api, allowAll})
+			for i := 0; i < 2; i++ {
+				reaching, err := policies.PeersReachingPod("payments", map[string]string{"app": "api"})
+				Expect(err).To(BeNil())
+				Expect(reaching.Peer.(*SpecificPeerMatcher).Internal.(*SpecificInternalMatcher).NamespacePods).To(HaveLen(3))
+			}
+			for _, target := range policies.Ingress {
+				expected := 1
+				if len(target.PodSelector.MatchLabels) > 0 {
+					expected = 2
+				}
+				Expect(target.Peer.(*SpecificPeerMatcher).Internal.(*SpecificInternalMatcher).NamespacePods).To(HaveLen(expected))
+			}
+		})
+	})
+}
@@ -0,0 +1,442 @@
+package matcher
+
+import (
+	"github.com/mattfenwick/cyclonus/pkg/kube"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// Simplify creates a new Policy with the same semantics, from which every matcher that can never
+// change the outcome has been removed: ports shadowed by all ports on a protocol or by a port range,
+// IP blocks and namespace/pod peers shadowed by a peer allowing a superset, and so on.
+// The input is not modified, and the kept matchers keep their rule sources.  Simplifying only drops matchers from a built policy, so it can't
+// produce conflicting matchers: errors are bugs, and panic.
+func Simplify(policy *Policy) *Policy {
+	simplified := NewPolicy()
+	ingress, egress := policy.SortedTargets()
+	for _, target := range ingress {
+		mustBeSimplified(simplified.AddTarget(true, SimplifyTarget(target)))
+	}
+	for _, target := range egress {
+		mustBeSimplified(simplified.AddTarget(false, SimplifyTarget(target)))
+	}
+	simplified.AdminPolicies = policy.AdminPolicies
+	simplified.BaselinePolicy = policy.BaselinePolicy
+	return simplified
+}
+
+func SimplifyTarget(target *Target) *Target {
+	return &Target{
+		Namespace:   target.Namespace,
+		PodSelector: target.PodSelector,
+		Peer:        SimplifyPeerMatcher(target.Peer),
+		SourceRules: target.SourceRules,
+	}
+}
+
+func SimplifyPeerMatcher(peer PeerMatcher) PeerMatcher {
+	switch p := peer.(type) {
+	case *AllPeerMatcher, *NonePeerMatcher:
+		return peer
+	case *SpecificPeerMatcher:
+		ip := SimplifyIPMatcher(p.IP)
+		var portsForAllIPs PortMatcher = &NonePortMatcher{}
+		switch i := ip.(type) {
+		case *AllIPMatcher:
+			// every peer has an IP
+			return &AllPeerMatcher{Sources: i.Sources}
+		case *SpecificIPMatcher:
+			portsForAllIPs = i.PortsForAllIPs
+		}
+		internal := SimplifyInternalMatcher(p.Internal, portsForAllIPs)
+		_, isNoneIP := ip.(*NoneIPMatcher)
+		_, isNoneInternal := internal.(*NoneInternalMatcher)
+		if isNoneIP && isNoneInternal {
+			return &NonePeerMatcher{}
+		}
+		return &SpecificPeerMatcher{IP: ip, Internal: internal}
+	default:
+		panic(errors.Errorf("invalid PeerMatcher type %T", peer))
+	}
+}
+
+func SimplifyIPMatcher(ip IPMatcher) IPMatcher {
+	switch i := ip.(type) {
+	case *AllIPMatcher, *NoneIPMatcher:
+		return ip
+	case *SpecificIPMatcher:
+		portsForAllIPs := SimplifyPortMatcher(i.PortsForAllIPs)
+		if allPorts, ok := portsForAllIPs.(*AllPortMatcher); ok {
+			return &AllIPMatcher{Sources: allPorts.Sources}
+		}
+		var blocks []*IPBlockMatcher
+		for _, block := range i.SortedIPBlocks() {
+			port := SimplifyPortMatcher(block.Port)
+			if IsPortMatcherSubset(port, portsForAllIPs) {
+				continue
+			}
+			blocks = append(blocks, &IPBlockMatcher{IPBlock: block.IPBlock, Port: port, Sources: block.Sources})
+		}
+		var kept []*IPBlockMatcher
+		for j, block := range blocks {
+			isShadowed := false
+			for k, other := range blocks {
+				if j != k && IsIPBlockMatcherSubset(block, other) && !(k > j && IsIPBlockMatcherSubset(other, block)) {
+					isShadowed = true
+					break
+				}
+			}
+			if !isShadowed {
+				kept = append(kept, block)
+			}
+		}
+		if _, ok := portsForAllIPs.(*NonePortMatcher); ok && len(kept) == 0 {
+			return &NoneIPMatcher{}
+		}
+		return mustBeSimplified(NewSpecificIPMatcher(portsForAllIPs, kept...)).(IPMatcher)
+	default:
+		panic(errors.Errorf("invalid IPMatcher type %T", ip))
+	}
+}
+
+// SimplifyInternalMatcher drops namespace/pod peers which are shadowed by another peer, or by
+// the ports allowed for all IPs -- since every pod has an IP.
+func SimplifyInternalMatcher(internal InternalMatcher, portsForAllIPs PortMatcher) InternalMatcher {
+	switch i := internal.(type) {
+	case *AllInternalMatcher, *NoneInternalMatcher:
+		return internal
+	case *SpecificInternalMatcher:
+		var matchers []*NamespacePodMatcher
+		for _, nsPod := range i.SortedNamespacePods() {
+			port := SimplifyPortMatcher(nsPod.Port)
+			if IsPortMatcherSubset(port, portsForAllIPs) {
+				continue
+			}
+			matcher := &NamespacePodMatcher{Namespace: nsPod.Namespace, Pod: nsPod.Pod, Port: port, Sources: nsPod.Sources}
+			if _, ok := matcher.Namespace.(*AllNamespaceMatcher); ok {
+				if _, ok := matcher.Pod.(*AllPodMatcher); ok {
+					if allPorts, ok := port.(*AllPortMatcher); ok {
+						return &AllInternalMatcher{Sources: pairRuleSources(nsPod.Sources, allPorts.Sources)}
+					}
+				}
+			}
+			matchers = append(matchers, matcher)
+		}
+		var kept []*NamespacePodMatcher
+		for j, matcher := range matchers {
+			isShadowed := false
+			for k, other := range matchers {
+				if j != k && IsNamespacePodMatcherSubset(matcher, other) {
+					isShadowed = true
+					break
+				}
+			}
+			if !isShadowed {
+				kept = append(kept, matcher)
+			}
+		}
+		if len(kept) == 0 {
+			return &NoneInternalMatcher{}
+		}
+		return mustBeSimplified(NewSpecificInternalMatcher(kept...)).(InternalMatcher)
+	default:
+		panic(errors.Errorf("invalid InternalMatcher type %T", internal))
+	}
+}
+
+func mustBeSimplified(value interface{}, err error) interface{} {
+	if err != nil {
+		panic(errors.WithMessagef(err, "unable to simplify"))
+	}
+	return value
+}
+
+// SimplifyPortMatcher drops ports shadowed by all ports on the same protocol, and numbered ports
+// and ranges shadowed by a port range.
+func SimplifyPortMatcher(port PortMatcher) PortMatcher {
+	specific, ok := port.(*SpecificPortMatcher)
+	if !ok {
+		return port
+	}
+	allOnProtocol := map[v1.Protocol]bool{}
+	var allOnProtocolSources []*RuleSource
+	for _, pp := range specific.Ports {
+		if pp.Port == nil {
+			allOnProtocol[pp.Protocol] = true
+			allOnProtocolSources = combineRuleSources(allOnProtocolSources, pp.Sources)
+		}
+	}
+	if allOnProtocol[v1.ProtocolTCP] && allOnProtocol[v1.ProtocolUDP] && allOnProtocol[v1.ProtocolSCTP] {
+		return &AllPortMatcher{Sources: allOnProtocolSources}
+	}
+
+	simplified := &SpecificPortMatcher{}
+	for i, portRange := range specific.PortRanges {
+		if allOnProtocol[portRange.Protocol] {
+			continue
+		}
+		isShadowed := false
+		for j, other := range specific.PortRanges {
+			if i != j && other.Protocol == portRange.Protocol && other.From <= portRange.From && portRange.To <= other.To &&
+				!(j > i && other.Equals(portRange)) {
+				isShadowed = true
+				break
+			}
+		}
+		if !isShadowed {
+			simplified.PortRanges = append(simplified.PortRanges, portRange)
+		}
+	}
+	for _, pp := range specific.Ports {
+		if pp.Port != nil && (allOnProtocol[pp.Protocol] || isPortInRanges(pp, simplified.PortRanges)) {
+			continue
+		}
+		isDuplicate := false
+		for _, prev := range simplified.Ports {
+			if prev.Equals(pp) {
+				isDuplicate = true
+				break
+			}
+		}
+		if !isDuplicate {
+			simplified.Ports = append(simplified.Ports, pp)
+		}
+	}
+	if len(simplified.Ports) == 0 && len(simplified.PortRanges) == 0 {
+		return &NonePortMatcher{}
+	}
+	return simplified
+}
+
+func isPortInRanges(pp *PortProtocolMatcher, ranges []*PortRangeMatcher) bool {
+	if pp.Port == nil || pp.Port.Type != intstr.Int {
+		return false
+	}
+	for _, portRange := range ranges {
+		if portRange.Protocol == pp.Protocol && portRange.From <= int(pp.Port.IntVal) && int(pp.Port.IntVal) <= portRange.To {
+			return true
+		}
+	}
+	return false
+}
+
+// IsPortMatcherSubset returns true if everything allowed by a is also allowed by b.  It is
+// conservative: a false result does not guarantee that a is not a subset of b.
+func IsPortMatcherSubset(a PortMatcher, b PortMatcher) bool {
+	switch l := a.(type) {
+	case *NonePortMatcher:
+		return true
+	case *AllPortMatcher:
+		_, ok := b.(*AllPortMatcher)
+		return ok
+	case *SpecificPortMatcher:
+		switch r := b.(type) {
+		case *AllPortMatcher:
+			return true
+		case *NonePortMatcher:
+			return false
+		case *SpecificPortMatcher:
+			for _, pp := range l.Ports {
+				if !isPortProtocolCovered(pp, r) {
+					return false
+				}
+			}
+			for _, portRange := range l.PortRanges {
+				if !isPortRangeCovered(portRange, r) {
+					return false
+				}
+			}
+			return true
+		default:
+			panic(errors.Errorf("invalid Port type %T", b))
+		}
+	default:
+		panic(errors.Errorf("invalid Port type %T", a))
+	}
+}
+
+func isPortProtocolCovered(pp *PortProtocolMatcher, ports *SpecificPortMatcher) bool {
+	for _, other := range ports.Ports {
+		if other.Protocol == pp.Protocol && (other.Port == nil || (pp.Port != nil && isIntStringEqual(*pp.Port, *other.Port))) {
+			return true
+		}
+	}
+	return isPortInRanges(pp, ports.PortRanges)
+}
+
+func isPortRangeCovered(portRange *PortRangeMatcher, ports *SpecificPortMatcher) bool {
+	for _, other := range ports.Ports {
+		if other.Protocol == portRange.Protocol && other.Port == nil {
+			return true
+		}
+	}
+	for _, other := range ports.PortRanges {
+		if other.Protocol == portRange.Protocol && other.From <= portRange.From && portRange.To <= other.To {
+			return true
+		}
+	}
+	return false
+}
+
+// IsNamespacePodMatcherSubset returns true if every pod and port allowed by a is also allowed by b.
+// It is conservative: selectors are only compared for equality.
+func IsNamespacePodMatcherSubset(a *NamespacePodMatcher, b *NamespacePodMatcher) bool {
+	_, isAllNamespaces := b.Namespace.(*AllNamespaceMatcher)
+	if !isAllNamespaces && a.Namespace.PrimaryKey() != b.Namespace.PrimaryKey() {
+		return false
+	}
+	_, isAllPods := b.Pod.(*AllPodMatcher)
+	if !isAllPods && a.Pod.PrimaryKey() != b.Pod.PrimaryKey() {
+		return false
+	}
+	return IsPortMatcherSubset(a.Port, b.Port)
+}
+
+// IsIPBlockMatcherSubset returns true if every IP and port allowed by a is also allowed by b:
+// a's CIDR must lie within b's, and each of b's excepts must either miss a's CIDR or lie
+// within one of a's excepts.
+func IsIPBlockMatcherSubset(a *IPBlockMatcher, b *IPBlockMatcher) bool {
+	if !IsPortMatcherSubset(a.Port, b.Port) {
+		return false
+	}
+	isWithin, err := kube.IsCIDRWithinCIDR(a.IPBlock.CIDR, b.IPBlock.CIDR)
+	if err != nil || !isWithin {
+		return false
+	}
+	for _, bExcept := range b.IPBlock.Except {
+		isOverlap, err := kube.AreCIDRsOverlapping(bExcept, a.IPBlock.CIDR)
+		if err != nil {
+			return false
+		}
+		if !isOverlap {
+			continue
+		}
+		isExcepted := false
+		for _, aExcept := range a.IPBlock.Except {
+			if isWithin, err := kube.IsCIDRWithinCIDR(bExcept, aExcept); err == nil && isWithin {
+				isExcepted = true
+				break
+			}
+		}
+		if !isExcepted {
+			return false
+		}
+	}
+	return true
+}
+
+// IsPeerMatcherSubset returns true if every peer and port allowed by a is also allowed by b.  It is
+// conservative: a false result does not guarantee that a is not a subset of b.
+func IsPeerMatcherSubset(a PeerMatcher, b PeerMatcher) bool {
+	switch l := a.(type) {
+	case *NonePeerMatcher:
+		return true
+	case *AllPeerMatcher:
+		_, ok := b.(*AllPeerMatcher)
+		return ok
+	case *SpecificPeerMatcher:
+		switch r := b.(type) {
+		case *AllPeerMatcher:
+			return true
+		case *NonePeerMatcher:
+			return false
+		case *SpecificPeerMatcher:
+			return IsIPMatcherSubset(l.IP, r.IP) && IsInternalMatcherSubset(l.Internal, r.IP, r.Internal)
+		default:
+			panic(errors.Errorf("invalid PeerMatcher type %T", b))
+		}
+	default:
+		panic(errors.Errorf("invalid PeerMatcher type %T", a))
+	}
+}
+
+// IsIPMatcherSubset returns true if every IP and port allowed by a is also allowed by b.  It is
+// conservative: IP blocks are only compared one at a time.
+func IsIPMatcherSubset(a IPMatcher, b IPMatcher) bool {
+	switch l := a.(type) {
+	case *NoneIPMatcher:
+		return true
+	case *AllIPMatcher:
+		_, ok := b.(*AllIPMatcher)
+		return ok
+	case *SpecificIPMatcher:
+		switch r := b.(type) {
+		case *AllIPMatcher:
+			return true
+		case *NoneIPMatcher:
+			return false
+		case *SpecificIPMatcher:
+			if !IsPortMatcherSubset(l.PortsForAllIPs, r.PortsForAllIPs) {
+				return false
+			}
+			for _, block := range l.IPBlocks {
+				if !isIPBlockMatcherCovered(block, r) {
+					return false
+				}
+			}
+			return true
+		default:
+			panic(errors.Errorf("invalid IPMatcher type %T", b))
+		}
+	default:
+		panic(errors.Errorf("invalid IPMatcher type %T", a))
+	}
+}
+
+func isIPBlockMatcherCovered(block *IPBlockMatcher, ip *SpecificIPMatcher) bool {
+	if IsPortMatcherSubset(block.Port, ip.PortsForAllIPs) {
+		return true
+	}
+	for _, other := range ip.IPBlocks {
+		if IsIPBlockMatcherSubset(block, other) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsInternalMatcherSubset returns true if every pod and port allowed by a is also allowed by
+// either bIP or bInternal -- since every pod has an IP.  It is conservative: namespace/pod matchers
+// are only compared one at a time.
+func IsInternalMatcherSubset(a InternalMatcher, bIP IPMatcher, bInternal InternalMatcher) bool {
+	if _, ok := bIP.(*AllIPMatcher); ok {
+		return true
+	}
+	var portsForAllIPs PortMatcher = &NonePortMatcher{}
+	if specificIP, ok := bIP.(*SpecificIPMatcher); ok {
+		portsForAllIPs = specificIP.PortsForAllIPs
+	}
+	switch l := a.(type) {
+	case *NoneInternalMatcher:
+		return true
+	case *AllInternalMatcher:
+		_, ok := bInternal.(*AllInternalMatcher)
+		return ok
+	case *SpecificInternalMatcher:
+		if _, ok := bInternal.(*AllInternalMatcher); ok {
+			return true
+		}
+		r, _ := bInternal.(*SpecificInternalMatcher)
+		for _, nsPod := range l.NamespacePods {
+			if IsPortMatcherSubset(nsPod.Port, portsForAllIPs) {
+				continue
+			}
+			isCovered := false
+			if r != nil {
+				for _, other := range r.NamespacePods {
+					if IsNamespacePodMatcherSubset(nsPod, other) {
+						isCovered = true
+						break
+					}
+				}
+			}
+			if !isCovered {
+				return false
+			}
+		}
+		return true
+	default:
+		panic(errors.Errorf("invalid InternalMatcher type %T", a))
+	}
+}
@@ -0,0 +1,168 @@
+package matcher
+
+import (
+	"github.com/mattfenwick/cyclonus/pkg/kube/netpol"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func mustSimplify(policy *Policy) []*networkingv1.NetworkPolicy {
+	netpols, err := ToNetworkPolicies(Simplify(policy))
+	Expect(err).To(BeNil())
+	return netpols
+}
+
+func RunSimplifierTests() {
+	Describe("Policy simplification", func() {
+		It("should round-trip the examples to equivalent policies", func() {
+			for _, example := range netpol.AllExamples {
+				policy := BuildNetworkPolicies([]*networkingv1.NetworkPolicy{example})
+				isEquivalent, traffic := AreEquivalent(policy, BuildNetworkPolicies(mustSimplify(policy)))
+				Expect(isEquivalent).To(BeTrue(), "example %s/%s, traffic %+v", example.Namespace, example.Name, traffic)
+			}
+		})
+
+		It("should drop peers subsumed by all peers", func() {
+			netpols := mustSimplify(BuildNetworkPolicies(mustParsePolicies(`
+metadata: {name: a, namespace: x}
+spec:
+  podSelector: {}
+  ingress:
+  - from:
+    - podSelector: {matchLabels: {app: web}}
+    - ipBlock: {cidr: 10.0.0.0/24}
+  - {}
+  policyTypes: [Ingress]`)))
+			Expect(netpols).To(HaveLen(1))
+			Expect(netpols[0].Name).To(Equal("a"))
+			Expect(netpols[0].Spec.Ingress).To(Equal([]networkingv1.NetworkPolicyIngressRule{{}}))
+		})
+
+		It("should merge duplicate IP blocks and drop IP blocks within other IP blocks", func() {
+			netpols := mustSimplify(BuildNetworkPolicies(mustParsePolicies(`
+metadata: {name: a, namespace: x}
+spec:
+  podSelector: {}
+  egress:
+  - to:
+    - ipBlock: {cidr: 10.0.0.0/16}
+    - ipBlock: {cidr: 10.0.1.0/24}
+  policyTypes: [Egress]`, `
+metadata: {name: b, namespace: x}
+spec:
+  podSelector: {}
+  egress:
+  - to:
+    - ipBlock: {cidr: 10.0.0.0/16}
+  policyTypes: [Egress]`)))
+			Expect(netpols).To(HaveLen(1))
+			Expect(netpols[0].Name).To(Equal("simplified-1"))
+			Expect(netpols[0].Spec.Egress).To(Equal([]networkingv1.NetworkPolicyEgressRule{
+				{To: []networkingv1.NetworkPolicyPeer{{IPBlock: &networkingv1.IPBlock{CIDR: "10.0.0.0/16"}}}},
+			}))
+		})
+
+		It("should drop ports shadowed by all ports on a protocol", func() {
+			netpols := mustSimplify(BuildNetworkPolicies(mustParsePolicies(`
+metadata: {name: a, namespace: x}
+spec:
+  podSelector: {}
+  ingress:
+  - from:
+    - podSelector: {}
+    ports:
+    - {port: 80, protocol: TCP}
+    - {port: 53, protocol: UDP}
+    - {protocol: TCP}
+    - {port: 8000, endPort: 9000, protocol: TCP}
+  policyTypes: [Ingress]`)))
+			tcp, udp := v1.ProtocolTCP, v1.ProtocolUDP
+			port53 := intstr.FromInt(53)
+			Expect(netpols).To(HaveLen(1))
+			Expect(netpols[0].Spec.Ingress).To(HaveLen(1))
+			Expect(netpols[0].Spec.Ingress[0].Ports).To(Equal([]networkingv1.NetworkPolicyPort{
+				{Protocol: &udp, Port: &port53},
+				{Protocol: &tcp},
+			}))
+		})
+
+		It("should drop ports within port ranges", func() {
+			port := SimplifyPortMatcher(&SpecificPortMatcher{
+				Ports: []*PortProtocolMatcher{
+					{Port: &port80, Protocol: v1.ProtocolTCP},
+					{Port: &port80, Protocol: v1.ProtocolUDP},
+				},
+				PortRanges: []*PortRangeMatcher{
+					{From: 80, To: 90, Protocol: v1.ProtocolTCP},
+					{From: 81, To: 85, Protocol: v1.ProtocolTCP},
+				},
+			})
+			Expect(port).To(Equal(&SpecificPortMatcher{
+				Ports:      []*PortProtocolMatcher{{Port: &port80, Protocol: v1.ProtocolUDP}},
+				PortRanges: []*PortRangeMatcher{{From: 80, To: 90, Protocol: v1.ProtocolTCP}},
+			}))
+		})
+
+		It("should drop peers whose ports are allowed for all IPs", func() {
+			policy := Simplify(BuildNetworkPolicies(mustParsePolicies(`
+metadata: {name: a, namespace: x}
+spec:
+  podSelector: {}
+  ingress:
+  - ports:
+    - {port: 80, protocol: TCP}
+  - from:
+    - namespaceSelector: {matchLabels: {ns: y}}
+    ports:
+    - {port: 80, protocol: TCP}
+  policyTypes: [Ingress]`)))
+			ingress, _ := policy.SortedTargets()
+			Expect(ingress).To(HaveLen(1))
+			peer := ingress[0].Peer.(*SpecificPeerMatcher)
+			Expect(peer.Internal).To(Equal(&NoneInternalMatcher{}))
+		})
+
+		It("should find peers which are subsets of other peers", func() {
+			buildPeer := func(policyYaml string) PeerMatcher {
+				ingress, _ := mustBuildTarget(mustParsePolicies(policyYaml)[0])
+				return ingress.Peer
+			}
+			ipBlock := buildPeer(`
+metadata: {name: a, namespace: x}
+spec:
+  podSelector: {}
+  ingress:
+  - from:
+    - ipBlock: {cidr: 10.0.1.0/24}
+    ports:
+    - {port: 80, protocol: TCP}
+  policyTypes: [Ingress]`)
+			largerIPBlock := buildPeer(`
+metadata: {name: b, namespace: x}
+spec:
+  podSelector: {}
+  ingress:
+  - from:
+    - ipBlock: {cidr: 10.0.0.0/16, except: [10.0.2.0/24]}
+    ports:
+    - {protocol: TCP}
+  policyTypes: [Ingress]`)
+			allIPsOnPort80 := buildPeer(`
+metadata: {name: c, namespace: x}
+spec:
+  podSelector: {}
+  ingress:
+  - ports:
+    - {port: 80, protocol: TCP}
+  policyTypes: [Ingress]`)
+			Expect(IsPeerMatcherSubset(ipBlock, largerIPBlock)).To(BeTrue())
+			Expect(IsPeerMatcherSubset(largerIPBlock, ipBlock)).To(BeFalse())
+			Expect(IsPeerMatcherSubset(ipBlock, allIPsOnPort80)).To(BeTrue())
+			Expect(IsPeerMatcherSubset(allIPsOnPort80, ipBlock)).To(BeFalse())
+			Expect(IsPeerMatcherSubset(allIPsOnPort80, &AllPeerMatcher{})).To(BeTrue())
+		})
+	})
+}
@@ -11,5 +11,11 @@ func TestMatcher(t *testing.T) {
 	RegisterFailHandler(Fail)
 	RunBuilderTests()
 	RunPolicyTests()
+	RunAdminPolicyTests()
+	RunEquivalenceTests()
+	RunSimplifierTests()
+	RunReachingTests()
+	RunProvenanceTests()
+	RunTargetIndexTests()
 	RunSpecs(t, "network policy matcher suite")
 }
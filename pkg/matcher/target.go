@@ -17,6 +17,21 @@ type Target struct {
 	primaryKey  string
 }
 
+// TargetSummary identifies a target, and the policies it was built from, for structured output
+type TargetSummary struct {
+	Namespace      string               `json:"namespace"`
+	PodSelector    metav1.LabelSelector `json:"podSelector"`
+	SourcePolicies []string             `json:"sourcePolicies"`
+}
+
+func (t *Target) Summary() *TargetSummary {
+	summary := &TargetSummary{Namespace: t.Namespace, PodSelector: t.PodSelector, SourcePolicies: []string{}}
+	for _, policy := range t.SourceRules {
+		summary.SourcePolicies = append(summary.SourcePolicies, policy.Namespace+"/"+policy.Name)
+	}
+	return summary
+}
+
 func (t *Target) String() string {
 	return t.GetPrimaryKey()
 }
@@ -28,19 +43,23 @@ func (t *Target) IsMatch(namespace string, podLabels map[string]string) bool {
 // CombinePeerMatchers creates a new Target combining the egress and ingress rules
 // of the two original targets.  Neither input is modified.
 // The Primary Keys of the two targets must match.
-func (t *Target) Combine(other *Target) *Target {
+func (t *Target) Combine(other *Target) (*Target, error) {
 	myPk := t.GetPrimaryKey()
 	otherPk := other.GetPrimaryKey()
 	if myPk != otherPk {
-		panic(errors.Errorf("cannot combine targets: primary keys differ -- '%s' vs '%s'", myPk, otherPk))
+		return nil, errors.Errorf("cannot combine targets: primary keys differ -- '%s' vs '%s'", myPk, otherPk)
 	}
 
+	peer, err := CombinePeerMatchers(t.Peer, other.Peer)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "cannot combine targets %s", myPk)
+	}
 	return &Target{
 		Namespace:   t.Namespace,
 		PodSelector: t.PodSelector,
-		Peer:        CombinePeerMatchers(t.Peer, other.Peer),
+		Peer:        peer,
 		SourceRules: append(t.SourceRules, other.SourceRules...),
-	}
+	}, nil
 }
 
 // The primary key is a deterministic combination of PodSelector and namespace
@@ -53,9 +72,9 @@ func (t *Target) GetPrimaryKey() string {
 
 // CombineTargetsIgnoringPrimaryKey creates a new target from the given namespace and pod selector,
 // and combines all the edges and source rules from the original targets into the new target.
-func CombineTargetsIgnoringPrimaryKey(namespace string, podSelector metav1.LabelSelector, targets []*Target) *Target {
+func CombineTargetsIgnoringPrimaryKey(namespace string, podSelector metav1.LabelSelector, targets []*Target) (*Target, error) {
 	if len(targets) == 0 {
-		return nil
+		return nil, nil
 	}
 	target := &Target{
 		Namespace:   namespace,
@@ -64,8 +83,12 @@ func CombineTargetsIgnoringPrimaryKey(namespace string, podSelector metav1.Label
 		SourceRules: targets[0].SourceRules,
 	}
 	for _, t := range targets[1:] {
-		target.Peer = CombinePeerMatchers(target.Peer, t.Peer)
+		peer, err := CombinePeerMatchers(target.Peer, t.Peer)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "cannot combine target %s", t.GetPrimaryKey())
+		}
+		target.Peer = peer
 		target.SourceRules = append(target.SourceRules, t.SourceRules...)
 	}
-	return target
+	return target, nil
 }
@@ -0,0 +1,95 @@
+package matcher
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sort"
+)
+
+// targetIndex finds the targets which may apply to a pod, without checking every target: targets are grouped by
+// namespace, and then by a label which their pod selector requires.  Targets are stored by primary key, so that
+// combining a target with another of the same key -- which replaces it in the Policy -- doesn't change the index.
+type targetIndex struct {
+	namespaces map[string]*namespaceTargetIndex
+}
+
+type namespaceTargetIndex struct {
+	// byLabel holds the keys of targets requiring a label value, by label key and then value
+	byLabel map[string]map[string][]string
+	// byLabelKey holds the keys of targets requiring a label key, but not a specific value
+	byLabelKey map[string][]string
+	// unindexed holds the keys of targets which don't require any label, such as those selecting all pods
+	unindexed []string
+}
+
+func newTargetIndex() *targetIndex {
+	return &targetIndex{namespaces: map[string]*namespaceTargetIndex{}}
+}
+
+func (t *targetIndex) add(target *Target) {
+	index, ok := t.namespaces[target.Namespace]
+	if !ok {
+		index = &namespaceTargetIndex{byLabel: map[string]map[string][]string{}, byLabelKey: map[string][]string{}}
+		t.namespaces[target.Namespace] = index
+	}
+	index.add(target.GetPrimaryKey(), target.PodSelector)
+}
+
+// add indexes a target by one label its selector requires: a label of matchLabels if there are any, otherwise the
+// key and values of an In expression, otherwise the key of an Exists or NotIn expression.  Pods without the key of
+// a matchLabels with an empty value match it, so such labels aren't used.
+func (n *namespaceTargetIndex) add(primaryKey string, selector metav1.LabelSelector) {
+	var keys []string
+	for key, value := range selector.MatchLabels {
+		if value != "" {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) > 0 {
+		sort.Strings(keys)
+		n.addByLabel(keys[0], []string{selector.MatchLabels[keys[0]]}, primaryKey)
+		return
+	}
+	for _, exp := range selector.MatchExpressions {
+		if exp.Operator == metav1.LabelSelectorOpIn {
+			n.addByLabel(exp.Key, exp.Values, primaryKey)
+			return
+		}
+	}
+	for _, exp := range selector.MatchExpressions {
+		if exp.Operator == metav1.LabelSelectorOpExists || exp.Operator == metav1.LabelSelectorOpNotIn {
+			n.byLabelKey[exp.Key] = append(n.byLabelKey[exp.Key], primaryKey)
+			return
+		}
+	}
+	n.unindexed = append(n.unindexed, primaryKey)
+}
+
+func (n *namespaceTargetIndex) addByLabel(key string, values []string, primaryKey string) {
+	if _, ok := n.byLabel[key]; !ok {
+		n.byLabel[key] = map[string][]string{}
+	}
+	added := map[string]bool{}
+	for _, value := range values {
+		if !added[value] {
+			added[value] = true
+			n.byLabel[key][value] = append(n.byLabel[key][value], primaryKey)
+		}
+	}
+}
+
+// candidates returns the keys of the targets which may apply to a pod; each key is returned once, since a pod has
+// a single value for the label a target is indexed by
+func (t *targetIndex) candidates(namespace string, podLabels map[string]string) []string {
+	index, ok := t.namespaces[namespace]
+	if !ok {
+		return nil
+	}
+	candidates := append([]string{}, index.unindexed...)
+	for key, value := range podLabels {
+		if byValue, ok := index.byLabel[key]; ok {
+			candidates = append(candidates, byValue[value]...)
+		}
+		candidates = append(candidates, index.byLabelKey[key]...)
+	}
+	return candidates
+}
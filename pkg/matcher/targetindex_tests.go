@@ -0,0 +1,93 @@
+package matcher
+
+import (
+	"sort"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func RunTargetIndexTests() {
+	Describe("Target index", func() {
+		policyFor := func(namespace string, name string, selector metav1.LabelSelector) *networkingv1.NetworkPolicy {
+			return &networkingv1.NetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+				Spec: networkingv1.NetworkPolicySpec{
+					PodSelector: selector,
+					PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress},
+				},
+			}
+		}
+		expression := func(key string, operator metav1.LabelSelectorOperator, values ...string) metav1.LabelSelector {
+			return metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: key, Operator: operator, Values: values}}}
+		}
+		policies := BuildNetworkPolicies([]*networkingv1.NetworkPolicy{
+			policyFor("x", "all", metav1.LabelSelector{}),
+			policyFor("x", "web", metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}),
+			policyFor("x", "web-too", metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}),
+			policyFor("x", "web-prod", metav1.LabelSelector{MatchLabels: map[string]string{"app": "web", "env": "prod"}}),
+			policyFor("x", "empty-value", metav1.LabelSelector{MatchLabels: map[string]string{"tier": ""}}),
+			policyFor("x", "in", expression("app", metav1.LabelSelectorOpIn, "web", "db", "web")),
+			policyFor("x", "not-in", expression("app", metav1.LabelSelectorOpNotIn, "db")),
+			policyFor("x", "exists", expression("env", metav1.LabelSelectorOpExists)),
+			policyFor("x", "does-not-exist", expression("env", metav1.LabelSelectorOpDoesNotExist)),
+			policyFor("y", "web", metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}),
+		})
+		scannedTargets := func(isIngress bool, namespace string, podLabels map[string]string) []string {
+			var keys []string
+			dict, _ := policies.targets(isIngress)
+			for key, target := range dict {
+				if target.IsMatch(namespace, podLabels) {
+					keys = append(keys, key)
+				}
+			}
+			sort.Strings(keys)
+			return keys
+		}
+		indexedTargets := func(isIngress bool, namespace string, podLabels map[string]string) []string {
+			var keys []string
+			for _, target := range policies.TargetsApplyingToPod(isIngress, namespace, podLabels) {
+				keys = append(keys, target.GetPrimaryKey())
+			}
+			sort.Strings(keys)
+			return keys
+		}
+
+		It("should find the same targets as checking every target", func() {
+			pods := []map[string]string{
+				nil,
+				{"app": "web"},
+				{"app": "web", "env": "prod"},
+				{"app": "db", "env": "dev"},
+				{"app": "api", "tier": ""},
+				{"tier": "backend"},
+			}
+			for _, namespace := range []string{"x", "y", "z"} {
+				for _, labels := range pods {
+					for _, isIngress := range []bool{true, false} {
+						Expect(indexedTargets(isIngress, namespace, labels)).To(Equal(scannedTargets(isIngress, namespace, labels)))
+					}
+				}
+			}
+		})
+
+		It("should find each target once, even if it's indexed under several values", func() {
+			targets := policies.TargetsApplyingToPod(true, "x", map[string]string{"app": "web", "env": "prod"})
+			// all, web -- combined with web-too -- web-prod, empty-value, in, not-in and exists
+			Expect(targets).To(HaveLen(7))
+		})
+
+		It("should find combined targets", func() {
+			targets := policies.TargetsApplyingToPod(true, "x", map[string]string{"app": "web"})
+			var sourcePolicies [][]string
+			for _, target := range targets {
+				if target.PodSelector.MatchLabels["app"] == "web" && len(target.PodSelector.MatchLabels) == 1 {
+					sourcePolicies = append(sourcePolicies, target.Summary().SourcePolicies)
+				}
+			}
+			Expect(sourcePolicies).To(Equal([][]string{{"x/web", "x/web-too"}}))
+		})
+	})
+}
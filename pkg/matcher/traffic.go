@@ -22,7 +22,8 @@ func (t *Traffic) Table() string {
 	table.SetRowLine(true)
 	table.SetAutoMergeCells(true)
 
-	pp := fmt.Sprintf("%d (%s) on %s", t.ResolvedPort, t.ResolvedPortName, t.Protocol)
+	portInt, portName := t.ResolvePort()
+	pp := fmt.Sprintf("%d (%s) on %s", portInt, portName, t.Protocol)
 	table.SetHeader([]string{"Port/Protocol", "Source/Dest", "Pod IP", "Namespace", "NS Labels", "Pod Labels"})
 
 	source := []string{pp, "source", t.Source.IP}
@@ -47,6 +48,34 @@ func (t *Traffic) Table() string {
 	return tableString.String()
 }
 
+// UnresolvedPort is the ResolvedPort of traffic to a named port whose number isn't known: port 0 can't be sent to,
+// and it's what traffic read from json without a port number has
+const UnresolvedPort = 0
+
+// ResolvePort returns the port number and port name this traffic is sent to.  Named ports are
+// defined by the container ports of the *destination* pod, and the same name may map to different
+// numbers on different pods.  So if the destination carries a container port table, the name is
+// resolved against it; otherwise, ResolvedPort and ResolvedPortName are used as-is.
+//
+// Ports are resolved once per traffic, by Policy.IsIngressOrEgressAllowed, rather than by each
+// SpecificPortMatcher: every port matcher of every target and admin rule -- for ingress and egress
+// alike -- is then checked against the same number and name, and matchers don't need the traffic.
+func (t *Traffic) ResolvePort() (int, string) {
+	if t.Destination == nil || t.Destination.Internal == nil || t.Destination.Internal.ContainerPorts == nil {
+		return t.ResolvedPort, t.ResolvedPortName
+	}
+	dest := t.Destination.Internal
+	// only a name was given: look up its number on the destination pod
+	if t.ResolvedPort == UnresolvedPort && t.ResolvedPortName != "" {
+		if portInt, ok := dest.ResolveNamedPort(t.ResolvedPortName, t.Protocol); ok {
+			return portInt, t.ResolvedPortName
+		}
+		return t.ResolvedPort, ""
+	}
+	portName, _ := dest.ResolveNumberedPort(t.ResolvedPort, t.Protocol)
+	return t.ResolvedPort, portName
+}
+
 func labelsToString(labels map[string]string) string {
 	var kvs []string
 	for k, v := range labels {
@@ -78,4 +107,34 @@ type InternalPeer struct {
 	Namespace       string
 	//NodeLabels      map[string]string
 	//Node            string
+
+	// ContainerPorts is optional: if nil, the pod's ports are unknown and named ports can't be resolved
+	ContainerPorts []*ContainerPort
+}
+
+// ResolveNamedPort finds the number of the container port with the given name and protocol
+func (p *InternalPeer) ResolveNamedPort(portName string, protocol v1.Protocol) (int, bool) {
+	for _, cp := range p.ContainerPorts {
+		if cp.Name == portName && cp.Protocol == protocol {
+			return cp.Port, true
+		}
+	}
+	return 0, false
+}
+
+// ResolveNumberedPort finds the name of the container port with the given number and protocol
+func (p *InternalPeer) ResolveNumberedPort(portInt int, protocol v1.Protocol) (string, bool) {
+	for _, cp := range p.ContainerPorts {
+		if cp.Port == portInt && cp.Protocol == protocol {
+			return cp.Name, true
+		}
+	}
+	return "", false
+}
+
+// ContainerPort models a single entry of a pod's container port table
+type ContainerPort struct {
+	Name     string
+	Port     int
+	Protocol v1.Protocol
 }